@@ -0,0 +1,55 @@
+// Сигнальный WebRTC-сервер: настройки из -config, флагов и окружения,
+// SIGHUP перечитывает конфигурацию, SIGINT/SIGTERM выключает сервер.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go-webrtc/config"
+	"go-webrtc/signaling"
+)
+
+func main() {
+	configPath := flag.String("config", "", "JSON config file (default $WEBRTC_CONFIG)")
+	configFlags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	server, err := signaling.New(signaling.Options{
+		Config:  config.Load(*configPath, configFlags()),
+		Logging: true,
+	})
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP)
+		for range sig {
+			server.Reload()
+		}
+	}()
+	// SIGINT/SIGTERM выключает сервер, повторный сигнал завершает процесс
+	// сразу
+	go func() {
+		sig := make(chan os.Signal, 2)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		got := <-sig
+		log.Printf("Received %s, shutting down", got)
+		go func() {
+			got := <-sig
+			log.Printf("Received %s again, exiting", got)
+			os.Exit(1)
+		}()
+		server.Shutdown()
+	}()
+
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatal("Server failed:", err)
+	}
+}
@@ -0,0 +1,1713 @@
+// Package config — настройки сервера: значения по умолчанию, файл
+// WEBRTC_CONFIG, переменные окружения и флаги, проверка и вывод
+// действующих значений в лог.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/media"
+)
+
+// Config — настройки сервера. Собирается Load, проверяется Validate и
+// дальше не меняется.
+type Config struct {
+	// JSON-файл конфигурации (-config или WEBRTC_CONFIG) и ICE-серверы
+	// из него или из ICE_SERVERS; без них — серверы по умолчанию.
+	// Список ICE-серверов перечитывается по SIGHUP
+	ConfigFile string
+	ICEServers []webrtc.ICEServer
+
+	// Адрес HTTP-сервера
+	ListenAddr string
+
+	// Отдельный адрес для админских эндпоинтов; пусто — на ListenAddr.
+	// При TLS обслуживается с тем же сертификатом
+	AdminListenAddr string
+
+	// Адрес обычного HTTP, который перенаправляет на HTTPS (и отвечает
+	// на проверки Let's Encrypt http-01). Только вместе с TLS
+	HTTPRedirectAddr string
+
+	// Адрес сигнализации по gRPC (proto/signaling.proto); пусто —
+	// выключена. При TLS обслуживается с тем же сертификатом
+	GRPCListenAddr string
+
+	// Связь комнат между экземплярами сервера: memory — один экземпляр,
+	// redis — pub/sub в RedisURL с каналами BackplanePrefix<комната>.
+	// RedisURL: redis://[user:password@]host[:port][/db], rediss:// — TLS
+	Backplane       string
+	RedisURL        string
+	BackplanePrefix string
+	// Сколько ждать списка участников с других экземпляров при первом
+	// входе в комнату
+	BackplaneSyncTimeout time.Duration
+
+	// Сколько держать сессию (PeerConnection, комнату) после обрыва
+	// WebSocket, ожидая переподключения с ?resume=<токен>. 0 — сессия
+	// закрывается вместе с сокетом
+	SessionResumeGrace time.Duration
+
+	// Уровень лога сервера, уровень внутренних логов pion и формат: json
+	// или text. Запись pion проходит, только если ее уровень не ниже
+	// обоих
+	LogLevel     string
+	LogLevelPion string
+	LogFormat    string
+
+	// Рестрим медиа клиента через ffmpeg (restream, /restreams): в RTMP
+	// по URL с одним из EgressURLPrefixes или в HLS в EgressHLSDir
+	EgressEnabled     bool
+	EgressFFmpeg      string
+	EgressHLSDir      string
+	EgressURLPrefixes []string
+
+	// Каталог записей входящих треков (start-recording, /recordings);
+	// пустой — запись выключена. Файлы трека сменяются по длительности
+	// и размеру, 0 — без ограничения
+	RecordingDir         string
+	RecordingMaxDuration time.Duration
+	RecordingMaxSizeMB   int
+
+	// Каталог файлов, загружаемых по каналам данных (file-upload); пустой
+	// — передача файлов выключена. Предел размера файла и размер куска
+	// при отправке клиенту (не больше сообщения SCTP)
+	FileTransferDir       string
+	FileTransferMaxSizeMB int
+	FileChunkSize         int
+
+	// Метрики GetStats() по каждому PeerConnection в /metrics (серии с id
+	// клиента). Выключается, если клиентов слишком много для Prometheus
+	MetricsPeerStats bool
+
+	// Сколько ждать закрытия клиентов при SIGINT/SIGTERM
+	ShutdownTimeout time.Duration
+
+	// Сколько перед закрытием ждать, пока клиенты после server-closing
+	// уйдут сами. 0 — закрывать сразу
+	DrainTimeout time.Duration
+
+	// Закрывать WebSocket через close-фрейм с ожиданием ответа
+	CloseHandshake        bool
+	CloseHandshakeTimeout time.Duration
+
+	// Keepalive: соединение без сообщений и pong'ов дольше ReadTimeout
+	// закрывается, ping отправляется каждые PingInterval
+	ReadTimeout  time.Duration
+	PingInterval time.Duration
+
+	// Запись одного сообщения клиенту не дольше WriteTimeout. Рассылки
+	// (комната, сервер) пишут параллельно, не больше BroadcastWorkers
+	// сразу, с таймаутом BroadcastWriteTimeout на клиента
+	WriteTimeout          time.Duration
+	BroadcastWorkers      int
+	BroadcastWriteTimeout time.Duration
+
+	// За сколько до закрытия по таймауту чтения предупреждать клиента
+	// idle-warning. 0 — не предупреждать
+	IdleWarningBefore time.Duration
+
+	// Клиент, не приславший offer и не вошедший в комнату за
+	// NoOfferTimeout после подключения, отключается с NO_SIGNALING.
+	// Ping/pong его не продлевают. 0 — не отключать
+	NoOfferTimeout time.Duration
+
+	// Запрашивать ключевой кадр (PLI), если его не было дольше этого
+	// интервала. 0 — выключено
+	KeyframeInterval time.Duration
+
+	// CORS для HTTP-эндпоинтов (не WebSocket)
+	CORSAllowedOrigins []string
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+
+	// Прием новых WebSocket-подключений: не чаще AcceptRate в секунду
+	// (0 — без ограничения), ожидающих не больше AcceptQueue, сверх
+	// очереди — 503 с Retry-After
+	AcceptRate  float64
+	AcceptQueue int
+
+	// Не больше MaxClients WebSocket-подключений одновременно (0 — без
+	// ограничения) и не чаще ConnectRatePerIP в секунду с одного адреса
+	// с запасом ConnectBurstPerIP (0 — без ограничения)
+	MaxClients        int
+	ConnectRatePerIP  float64
+	ConnectBurstPerIP int
+
+	// Число шардов реестра клиентов: подключение и отключение блокируют
+	// только свой шард. 1 — общий мьютекс на всех клиентов
+	ClientShards int
+
+	// Квоты (0 — без ограничения): открытых подключений с одного адреса,
+	// комнат одновременно у одного пользователя (sub токена), сообщений
+	// клиента в секунду с запасом MessageBurst и PeerConnection на сервер
+	MaxConnectionsPerIP int
+	MaxRoomsPerUser     int
+	MessageRate         float64
+	MessageBurst        int
+	MaxPeerConnections  int
+
+	// Границы подсказки Retry-After / retryAfter при отказе из-за
+	// нагрузки или выключения; само значение считается из состояния очереди
+	RetryAfter    time.Duration
+	RetryAfterMax time.Duration
+
+	// Сети прокси, которым можно доверять X-Forwarded-For
+	TrustedProxies []*net.IPNet
+
+	// Восстановление ICE по инициативе сервера (offer с ICE restart)
+	ICERecovery            bool
+	ICERecoveryMaxAttempts int
+	ICERecoveryBackoff     time.Duration
+
+	// Сколько неудач ICE (переход в failed или безуспешный restart) за
+	// окно терпится, прежде чем клиент отключается с
+	// PERSISTENT_ICE_FAILURE. 0 — не ограничено
+	ICEFailureLimit  int
+	ICEFailureWindow time.Duration
+
+	// Максимум каналов данных на сессию, 0 — без ограничения
+	MaxDataChannels int
+	// Пересылаемые сообщения каналов данных от этого размера в байтах
+	// сжимаются deflate для получателей, согласовавших dc-deflate в
+	// hello. 0 — без сжатия
+	DataChannelCompressMin int
+
+	// Шаблоны TURN URL с переменными {region} и {clientId},
+	// раскрываются отдельно для каждого клиента
+	TURNURLTemplates []string
+	TURNUsername     string
+	TURNCredential   string
+
+	// Общий секрет TURN REST API. Если задан, вместо TURN_USERNAME и
+	// TURN_CREDENTIAL каждому клиенту выдаются свои временные данные
+	TURNSecret        string
+	TURNCredentialTTL time.Duration
+
+	// Переход на TURN по TCP/TLS, если ICE не подключился за таймаут.
+	// URL — шаблоны, как в TURN_URL_TEMPLATES, с теми же учетными данными
+	TURNTCPFallback        bool
+	TURNTCPFallbackTimeout time.Duration
+	TURNTCPURLs            []string
+
+	// Предел сессий через TCP-релей (0 — без предела). Сверх него
+	// переход идет на запасные URL, а без них не выполняется
+	TCPRelayLimit        int
+	TURNTCPSecondaryURLs []string
+
+	// Встроенный TURN на этом порту по UDP и TCP (0 — выключен).
+	// PublicIP — адрес релея в ответах, Host — имя в URL для клиентов
+	// (по умолчанию PublicIP), релей занимает порты из диапазона
+	TURNServerPort         int
+	TURNServerPublicIP     string
+	TURNServerHost         string
+	TURNServerRealm        string
+	TURNServerRelayMinPort int
+	TURNServerRelayMaxPort int
+
+	// Интервал расчета оценки качества (0 — выключено) и запас,
+	// на который оценка должна уйти за порог для смены уровня
+	QualityInterval   time.Duration
+	QualityHysteresis float64
+
+	// "server" — сервер сам отвечает на offer; "relay" — клиенты
+	// разбиваются на комнаты по ?room= и сигнализация пересылается
+	// между двумя участниками комнаты; "proxy" — комнаты как в relay, но
+	// каждый участник соединяется только с сервером, а сервер пересылает
+	// медиа между ними. Участники не видят адресов друг друга, зато весь
+	// трафик звонка дважды проходит через сервер и SRTP; "sfu" — как
+	// proxy, но в комнате до SFUMaxRoomMembers участников, и каждый
+	// получает треки всех остальных
+	SignalingMode string
+
+	// Предел участников комнаты в режиме sfu
+	SFUMaxRoomMembers int
+	// Предел публикующих участников комнаты в режиме sfu, зрители
+	// (role=viewer) не считаются. 0 — без ограничения
+	MaxPublishersPerRoom int
+
+	// Максимум повторных offer'ов клиента на сессию, не считая
+	// ICE restart. 0 — без ограничения
+	MaxRenegotiations int
+
+	// BundlePolicy для PeerConnection: max-bundle, balanced, max-compat
+	BundlePolicy string
+
+	// Предел разрешения видео от клиентов, 0 — без ограничения.
+	// Передается в answer через imageattr и max-fs
+	MaxVideoWidth  int
+	MaxVideoHeight int
+
+	// Параметры Opus в answer по умолчанию: FEC, DTX и предел средней
+	// скорости (0 — не указывать). Offer может переопределить их в поле opus
+	OpusFEC               bool
+	OpusDTX               bool
+	OpusMaxAverageBitrate int
+
+	// Проверять входящие сообщения по JSON Schema (стоит CPU)
+	SchemaValidation bool
+
+	// Лимиты на сессию: ICE-кандидаты клиента (0 — без ограничения)
+	// и размер одного WebSocket-сообщения в байтах
+	MaxCandidates  int
+	MaxMessageSize int64
+
+	// Разрешенные профили SRTP по именам IANA, пусто — набор pion
+	SRTPProfiles []string
+
+	// Кодеки по именам в порядке предпочтения: vp8, vp9, av1, h264 (все
+	// профили) или h264-baseline, h264-constrained-baseline, h264-main,
+	// h264-high; opus, g722, pcmu, pcma. Пусто — набор и порядок pion
+	VideoCodecs []string
+	AudioCodecs []string
+	// Обратная связь RTCP видео: goog-remb, ccm fir, nack, nack pli,
+	// transport-cc или none. Пусто — все, как у pion
+	VideoRTCPFeedback []string
+	// Отвергать offer, в котором у аудио- или видеосекции нет ни одного
+	// общего с сервером кодека, ошибкой NO_COMMON_CODEC
+	RequireCommonCodec bool
+
+	// Бюджет на первичную установку сессии: от offer до конца сбора
+	// кандидатов. 0 — без ограничения
+	SetupTimeout time.Duration
+
+	// Пауза между отправкой answer и первым trickle-кандидатом,
+	// для клиентов, не успевающих применить answer. 0 — выключено
+	AnswerCandidateDelay time.Duration
+
+	// Без trickle: answer уходит после сбора всех кандидатов и содержит
+	// их сам. ANSWER_MAX_CANDIDATES ограничивает число кандидатов на
+	// компонент (0 — все), ANSWER_MAX_SIZE — размер answer в байтах
+	// (0 — без ограничения), чтобы answer влезал в буфер клиента
+	NonTrickle          bool
+	AnswerMaxCandidates int
+	AnswerMaxSize       int
+
+	// Оценка полосы в сторону клиента по TWCC (GCC): раз в
+	// BWEReportInterval клиент получает {"type":"bwe"}. 0 — выключено
+	BWEReportInterval time.Duration
+	BWEInitialBitrate int
+	// Управление перегрузкой при пересылке: видео подписчику
+	// ограничивается по оценке полосы к нему, при перегрузке
+	// приостанавливается. Включает GCC независимо от BWE_REPORT_INTERVAL.
+	CongestionControl bool
+
+	// Определение говорящего по расширению audio-level: раз в
+	// ActiveSpeakerInterval сравнивается средняя громкость участников
+	// комнаты, и при смене говорящего комната получает activeSpeaker.
+	// 0 — выключено. Порог — уровень в -dBov (0 — громче всего, 127 —
+	// тишина), тише него участник не считается говорящим. Новый
+	// говорящий должен быть самым громким не меньше ActiveSpeakerDebounce
+	ActiveSpeakerInterval  time.Duration
+	ActiveSpeakerThreshold int
+	ActiveSpeakerDebounce  time.Duration
+
+	// Общий UDP-порт для ICE всех сессий (0 — эфемерные порты)
+	ICEUDPPort int
+
+	// Только для тестов: фиксированные ICE ufrag/pwd, чтобы SDP ответа
+	// был воспроизводимым. В продакшене запрещено — учетные данные ICE
+	// перестают быть секретом
+	TestICEUfrag string
+	TestICEPwd   string
+
+	// TLS: сертификат и ключ включают HTTPS/WSS. Наборы шифров
+	// применяются только к TLS 1.2, в 1.3 Go выбирает их сам
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   string
+	TLSCipherSuites []string
+
+	// Сертификат Let's Encrypt для этих доменов вместо файлов. Выданные
+	// сертификаты хранятся в TLSAutocertCache, Email — для уведомлений CA
+	TLSAutocertDomains []string
+	TLSAutocertCache   string
+	TLSAutocertEmail   string
+
+	// Известные арендаторы для меток в статистике, остальные
+	// считаются как "other". Пусто — без разбивки
+	Tenants []string
+
+	// Аутентификация клиентов: none, psk (общий ключ в сообщении auth)
+	// или token (JWT HS256 с секретом AuthTokenSecret при подключении)
+	AuthMode        string
+	AuthPSK         string
+	AuthTokenSecret string
+
+	// Ключи API для AUTH_MODE=token вместо JWT, как "user:key"
+	AuthAPIKeys []string
+
+	// Origin'ы, с которых браузер может открыть /ws ("*" — любые).
+	// Пусто — только тот же хост, что у сервера
+	WSAllowedOrigins []string
+
+	// Сообщения до auth: reject — ошибка AUTH_REQUIRED, buffer — держать
+	// до PreAuthBuffer штук и выполнить после успешной auth
+	PreAuthMode   string
+	PreAuthBuffer int
+
+	// Токен для админских эндпоинтов (Authorization: Bearer)
+	// и включение /debug/pprof/ за ним
+	AdminToken   string
+	PprofEnabled bool
+
+	// Трансляция лога в /admin/logs: буфер событий на подписчика и
+	// что делать при его переполнении (drop или disconnect)
+	LogStreamBuffer int
+	LogStreamDrop   string
+
+	// События сессий в /events (SSE): сколько хранить для продолжения по
+	// Last-Event-ID, буфер на подписчика (отстающий отключается) и период
+	// комментария-пинга
+	EventHistory   int
+	EventBuffer    int
+	EventHeartbeat time.Duration
+
+	// Адреса для POST-уведомлений о событиях сессий через запятую,
+	// пусто — выключено. WebhookEvents — отправляемые типы, пусто — все.
+	// С WebhookSecret тело подписывается HMAC-SHA256. Неудачная доставка
+	// повторяется до WebhookRetries раз, пауза от WebhookRetryBackoff
+	// удваивается
+	WebhookURLs         []string
+	WebhookTimeout      time.Duration
+	WebhookEvents       []string
+	WebhookSecret       string
+	WebhookRetries      int
+	WebhookRetryBackoff time.Duration
+
+	// Ошибки разбора переменных окружения, проверяются в Validate
+	parseErrors []Problem
+
+	// Явно заданные флаги командной строки по имени переменной
+	// окружения; важнее окружения и файла
+	flags map[string]string
+
+	// Откуда взят список ICE-серверов, для сообщений Validate
+	iceServersKey string
+}
+
+type Problem struct {
+	Key     string
+	Message string
+	Fatal   bool
+}
+
+func (p Problem) String() string {
+	level := "warning"
+	if p.Fatal {
+		level = "error"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, p.Key, p.Message)
+}
+
+// Default — настройки по умолчанию, без окружения и файла
+func Default() Config {
+	return Config{
+		ICEServers: defaultICEServers,
+		ListenAddr: ":8080",
+
+		LogLevel:     "info",
+		LogLevelPion: "warn",
+		LogFormat:    "json",
+
+		EgressFFmpeg:      "ffmpeg",
+		EgressHLSDir:      "./hls",
+		EgressURLPrefixes: []string{"rtmp://", "rtmps://"},
+
+		RecordingMaxDuration: time.Hour,
+
+		MetricsPeerStats: true,
+
+		Backplane:       "memory",
+		RedisURL:        "redis://localhost:6379",
+		BackplanePrefix: "webrtc:room:",
+
+		BackplaneSyncTimeout: 200 * time.Millisecond,
+
+		ShutdownTimeout: 10 * time.Second,
+
+		CloseHandshake:        false,
+		CloseHandshakeTimeout: time.Second,
+		ReadTimeout:           60 * time.Second,
+		PingInterval:          30 * time.Second,
+		WriteTimeout:          10 * time.Second,
+		BroadcastWorkers:      16,
+		BroadcastWriteTimeout: 2 * time.Second,
+		IdleWarningBefore:     15 * time.Second,
+		CORSAllowedOrigins:    []string{"*"},
+		CORSAllowedMethods:    []string{"GET", "POST", "OPTIONS"},
+		CORSAllowedHeaders:    []string{"Content-Type", "Authorization"},
+
+		AcceptQueue: 100,
+
+		MaxClients:          1000,
+		ConnectRatePerIP:    1,
+		ConnectBurstPerIP:   10,
+		ClientShards:        32,
+		MaxConnectionsPerIP: 50,
+		MessageRate:         50,
+		MessageBurst:        100,
+
+		BWEInitialBitrate: 1_000_000,
+
+		ActiveSpeakerThreshold: 50,
+		ActiveSpeakerDebounce:  time.Second,
+
+		RetryAfter:    5 * time.Second,
+		RetryAfterMax: 5 * time.Minute,
+
+		ICERecoveryMaxAttempts: 3,
+		ICERecoveryBackoff:     2 * time.Second,
+		ICEFailureLimit:        5,
+		ICEFailureWindow:       5 * time.Minute,
+
+		MaxDataChannels: 32,
+
+		TURNCredentialTTL:      time.Hour,
+		TURNTCPFallbackTimeout: 10 * time.Second,
+		TURNServerRealm:        "go-webrtc",
+		FileTransferMaxSizeMB:  1024,
+		FileChunkSize:          16 << 10,
+		TURNServerRelayMinPort: 49152,
+		TURNServerRelayMaxPort: 65535,
+
+		QualityInterval:   5 * time.Second,
+		QualityHysteresis: 5,
+
+		SignalingMode: "server",
+		BundlePolicy:  "max-bundle",
+
+		SFUMaxRoomMembers: 8,
+
+		MaxRenegotiations: 50,
+
+		OpusFEC: true,
+
+		MaxCandidates:  200,
+		MaxMessageSize: 1 << 20,
+
+		TLSMinVersion:    "1.2",
+		TLSAutocertCache: "autocert",
+
+		WebhookTimeout:      5 * time.Second,
+		WebhookRetries:      5,
+		WebhookRetryBackoff: time.Second,
+
+		LogStreamBuffer: 256,
+		LogStreamDrop:   "drop",
+
+		EventHistory:   1000,
+		EventBuffer:    256,
+		EventHeartbeat: 15 * time.Second,
+
+		AuthMode:      "none",
+		PreAuthMode:   "reject",
+		PreAuthBuffer: 16,
+	}
+}
+
+// Load читает файл конфигурации (путь из -config, иначе из
+// WEBRTC_CONFIG), затем переменные окружения и флаги: каждый следующий
+// источник переопределяет предыдущий
+func Load(path string, flags map[string]string) Config {
+	c := Default()
+	c.flags = flags
+	c.iceServersKey = "WEBRTC_CONFIG"
+	c.ConfigFile = path
+	if c.ConfigFile == "" {
+		c.ConfigFile = c.envString("WEBRTC_CONFIG", "")
+	}
+	if c.ConfigFile != "" {
+		c.loadFile(c.ConfigFile)
+	}
+	c.ICEServers = c.envICEServers("ICE_SERVERS", c.ICEServers)
+	c.ListenAddr = c.envString("LISTEN_ADDR", c.ListenAddr)
+	c.AdminListenAddr = c.envString("ADMIN_LISTEN_ADDR", c.AdminListenAddr)
+	c.HTTPRedirectAddr = c.envString("HTTP_REDIRECT_ADDR", c.HTTPRedirectAddr)
+	c.GRPCListenAddr = c.envString("GRPC_LISTEN_ADDR", c.GRPCListenAddr)
+	c.LogLevel = c.envString("LOG_LEVEL", c.LogLevel)
+	c.LogLevelPion = c.envString("LOG_LEVEL_PION", c.LogLevelPion)
+	c.LogFormat = c.envString("LOG_FORMAT", c.LogFormat)
+	c.SessionResumeGrace = c.envDuration("SESSION_RESUME_GRACE", c.SessionResumeGrace)
+	c.EgressEnabled = c.envBool("EGRESS_ENABLED", c.EgressEnabled)
+	c.EgressFFmpeg = c.envString("EGRESS_FFMPEG", c.EgressFFmpeg)
+	c.EgressHLSDir = c.envString("EGRESS_HLS_DIR", c.EgressHLSDir)
+	c.EgressURLPrefixes = c.envList("EGRESS_URL_PREFIXES", c.EgressURLPrefixes)
+	c.RecordingDir = c.envString("RECORDING_DIR", c.RecordingDir)
+	c.RecordingMaxDuration = c.envDuration("RECORDING_MAX_DURATION", c.RecordingMaxDuration)
+	c.RecordingMaxSizeMB = c.envInt("RECORDING_MAX_SIZE_MB", c.RecordingMaxSizeMB)
+	c.FileTransferDir = c.envString("FILE_TRANSFER_DIR", c.FileTransferDir)
+	c.FileTransferMaxSizeMB = c.envInt("FILE_TRANSFER_MAX_SIZE_MB", c.FileTransferMaxSizeMB)
+	c.FileChunkSize = c.envInt("FILE_CHUNK_SIZE", c.FileChunkSize)
+	c.MetricsPeerStats = c.envBool("METRICS_PEER_STATS", c.MetricsPeerStats)
+	c.Backplane = c.envString("BACKPLANE", c.Backplane)
+	c.RedisURL = c.envString("REDIS_URL", c.RedisURL)
+	c.BackplanePrefix = c.envString("BACKPLANE_PREFIX", c.BackplanePrefix)
+	c.BackplaneSyncTimeout = c.envDuration("BACKPLANE_SYNC_TIMEOUT", c.BackplaneSyncTimeout)
+	c.ShutdownTimeout = c.envDuration("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	c.DrainTimeout = c.envDuration("DRAIN_TIMEOUT", c.DrainTimeout)
+	c.CloseHandshake = c.envBool("WS_CLOSE_HANDSHAKE", c.CloseHandshake)
+	c.CloseHandshakeTimeout = c.envDuration("WS_CLOSE_TIMEOUT", c.CloseHandshakeTimeout)
+	c.ReadTimeout = c.envDuration("READ_TIMEOUT", c.ReadTimeout)
+	c.PingInterval = c.envDuration("PING_INTERVAL", c.PingInterval)
+	c.WriteTimeout = c.envDuration("WRITE_TIMEOUT", c.WriteTimeout)
+	c.BroadcastWorkers = c.envInt("BROADCAST_WORKERS", c.BroadcastWorkers)
+	c.BroadcastWriteTimeout = c.envDuration("BROADCAST_WRITE_TIMEOUT", c.BroadcastWriteTimeout)
+	c.IdleWarningBefore = c.envDuration("IDLE_WARNING_BEFORE", c.IdleWarningBefore)
+	c.NoOfferTimeout = c.envDuration("NO_OFFER_TIMEOUT", c.NoOfferTimeout)
+	c.KeyframeInterval = c.envDuration("KEYFRAME_INTERVAL", c.KeyframeInterval)
+	c.CORSAllowedOrigins = c.envList("CORS_ALLOWED_ORIGINS", c.CORSAllowedOrigins)
+	c.CORSAllowedMethods = c.envList("CORS_ALLOWED_METHODS", c.CORSAllowedMethods)
+	c.CORSAllowedHeaders = c.envList("CORS_ALLOWED_HEADERS", c.CORSAllowedHeaders)
+	c.TrustedProxies = c.envCIDRs("TRUSTED_PROXIES", c.TrustedProxies)
+	c.AcceptRate = c.envFloat("ACCEPT_RATE", c.AcceptRate)
+	c.AcceptQueue = c.envInt("ACCEPT_QUEUE", c.AcceptQueue)
+	c.MaxClients = c.envInt("MAX_CLIENTS", c.MaxClients)
+	c.ConnectRatePerIP = c.envFloat("CONNECT_RATE_PER_IP", c.ConnectRatePerIP)
+	c.ConnectBurstPerIP = c.envInt("CONNECT_BURST_PER_IP", c.ConnectBurstPerIP)
+	c.ClientShards = c.envInt("CLIENT_SHARDS", c.ClientShards)
+	c.MaxConnectionsPerIP = c.envInt("MAX_CONNECTIONS_PER_IP", c.MaxConnectionsPerIP)
+	c.MaxRoomsPerUser = c.envInt("MAX_ROOMS_PER_USER", c.MaxRoomsPerUser)
+	c.MessageRate = c.envFloat("MESSAGE_RATE", c.MessageRate)
+	c.MessageBurst = c.envInt("MESSAGE_BURST", c.MessageBurst)
+	c.MaxPeerConnections = c.envInt("MAX_PEER_CONNECTIONS", c.MaxPeerConnections)
+	c.RetryAfter = c.envDuration("RETRY_AFTER", c.RetryAfter)
+	c.RetryAfterMax = c.envDuration("RETRY_AFTER_MAX", c.RetryAfterMax)
+	c.ICERecovery = c.envBool("ICE_RECOVERY", c.ICERecovery)
+	c.ICERecoveryMaxAttempts = c.envInt("ICE_RECOVERY_MAX_ATTEMPTS", c.ICERecoveryMaxAttempts)
+	c.ICERecoveryBackoff = c.envDuration("ICE_RECOVERY_BACKOFF", c.ICERecoveryBackoff)
+	c.ICEFailureLimit = c.envInt("ICE_FAILURE_LIMIT", c.ICEFailureLimit)
+	c.ICEFailureWindow = c.envDuration("ICE_FAILURE_WINDOW", c.ICEFailureWindow)
+	c.MaxDataChannels = c.envInt("MAX_DATA_CHANNELS", c.MaxDataChannels)
+	c.DataChannelCompressMin = c.envInt("DATA_CHANNEL_COMPRESS_MIN", c.DataChannelCompressMin)
+	c.TURNURLTemplates = c.envList("TURN_URL_TEMPLATES", c.TURNURLTemplates)
+	c.TURNUsername = c.envString("TURN_USERNAME", c.TURNUsername)
+	c.TURNCredential = c.envString("TURN_CREDENTIAL", c.TURNCredential)
+	c.TURNSecret = c.envString("TURN_SECRET", c.TURNSecret)
+	c.TURNCredentialTTL = c.envDuration("TURN_CREDENTIAL_TTL", c.TURNCredentialTTL)
+	c.TURNTCPFallback = c.envBool("TURN_TCP_FALLBACK", c.TURNTCPFallback)
+	c.TURNTCPFallbackTimeout = c.envDuration("TURN_TCP_FALLBACK_TIMEOUT", c.TURNTCPFallbackTimeout)
+	c.TURNTCPURLs = c.envList("TURN_TCP_URLS", c.TURNTCPURLs)
+	c.TCPRelayLimit = c.envInt("TCP_RELAY_LIMIT", c.TCPRelayLimit)
+	c.TURNTCPSecondaryURLs = c.envList("TURN_TCP_SECONDARY_URLS", c.TURNTCPSecondaryURLs)
+	c.TURNServerPort = c.envInt("TURN_SERVER_PORT", c.TURNServerPort)
+	c.TURNServerPublicIP = c.envString("TURN_SERVER_PUBLIC_IP", c.TURNServerPublicIP)
+	c.TURNServerHost = c.envString("TURN_SERVER_HOST", c.TURNServerHost)
+	c.TURNServerRealm = c.envString("TURN_SERVER_REALM", c.TURNServerRealm)
+	c.TURNServerRelayMinPort = c.envInt("TURN_SERVER_RELAY_MIN_PORT", c.TURNServerRelayMinPort)
+	c.TURNServerRelayMaxPort = c.envInt("TURN_SERVER_RELAY_MAX_PORT", c.TURNServerRelayMaxPort)
+	c.QualityInterval = c.envDuration("QUALITY_INTERVAL", c.QualityInterval)
+	c.QualityHysteresis = c.envFloat("QUALITY_HYSTERESIS", c.QualityHysteresis)
+	c.SignalingMode = c.envString("SIGNALING_MODE", c.SignalingMode)
+	c.SFUMaxRoomMembers = c.envInt("SFU_MAX_ROOM_MEMBERS", c.SFUMaxRoomMembers)
+	c.MaxPublishersPerRoom = c.envInt("MAX_PUBLISHERS_PER_ROOM", c.MaxPublishersPerRoom)
+	c.MaxRenegotiations = c.envInt("MAX_RENEGOTIATIONS", c.MaxRenegotiations)
+	c.BundlePolicy = c.envString("BUNDLE_POLICY", c.BundlePolicy)
+	c.MaxVideoWidth = c.envInt("MAX_VIDEO_WIDTH", c.MaxVideoWidth)
+	c.MaxVideoHeight = c.envInt("MAX_VIDEO_HEIGHT", c.MaxVideoHeight)
+	c.SchemaValidation = c.envBool("SCHEMA_VALIDATION", c.SchemaValidation)
+	c.MaxCandidates = c.envInt("MAX_CANDIDATES", c.MaxCandidates)
+	c.OpusFEC = c.envBool("OPUS_FEC", c.OpusFEC)
+	c.OpusDTX = c.envBool("OPUS_DTX", c.OpusDTX)
+	c.OpusMaxAverageBitrate = c.envInt("OPUS_MAX_AVERAGE_BITRATE", c.OpusMaxAverageBitrate)
+	c.MaxMessageSize = int64(c.envInt("MAX_MESSAGE_SIZE", int(c.MaxMessageSize)))
+	c.SRTPProfiles = c.envList("SRTP_PROFILES", c.SRTPProfiles)
+	c.VideoCodecs = c.envList("VIDEO_CODECS", c.VideoCodecs)
+	c.AudioCodecs = c.envList("AUDIO_CODECS", c.AudioCodecs)
+	c.VideoRTCPFeedback = c.envList("VIDEO_RTCP_FEEDBACK", c.VideoRTCPFeedback)
+	c.RequireCommonCodec = c.envBool("REQUIRE_COMMON_CODEC", c.RequireCommonCodec)
+	c.SetupTimeout = c.envDuration("SETUP_TIMEOUT", c.SetupTimeout)
+	c.AnswerCandidateDelay = c.envDuration("ANSWER_CANDIDATE_DELAY", c.AnswerCandidateDelay)
+	c.NonTrickle = c.envBool("NON_TRICKLE", c.NonTrickle)
+	c.AnswerMaxCandidates = c.envInt("ANSWER_MAX_CANDIDATES", c.AnswerMaxCandidates)
+	c.AnswerMaxSize = c.envInt("ANSWER_MAX_SIZE", c.AnswerMaxSize)
+	c.BWEReportInterval = c.envDuration("BWE_REPORT_INTERVAL", c.BWEReportInterval)
+	c.BWEInitialBitrate = c.envInt("BWE_INITIAL_BITRATE", c.BWEInitialBitrate)
+	c.CongestionControl = c.envBool("CONGESTION_CONTROL", c.CongestionControl)
+	c.ActiveSpeakerInterval = c.envDuration("ACTIVE_SPEAKER_INTERVAL", c.ActiveSpeakerInterval)
+	c.ActiveSpeakerThreshold = c.envInt("ACTIVE_SPEAKER_THRESHOLD", c.ActiveSpeakerThreshold)
+	c.ActiveSpeakerDebounce = c.envDuration("ACTIVE_SPEAKER_DEBOUNCE", c.ActiveSpeakerDebounce)
+	c.ICEUDPPort = c.envInt("ICE_UDP_PORT", c.ICEUDPPort)
+	c.TestICEUfrag = c.envString("TEST_ICE_UFRAG", c.TestICEUfrag)
+	c.TestICEPwd = c.envString("TEST_ICE_PWD", c.TestICEPwd)
+	c.TLSCertFile = c.envString("TLS_CERT_FILE", c.TLSCertFile)
+	c.TLSKeyFile = c.envString("TLS_KEY_FILE", c.TLSKeyFile)
+	c.TLSMinVersion = c.envString("TLS_MIN_VERSION", c.TLSMinVersion)
+	c.TLSCipherSuites = c.envList("TLS_CIPHER_SUITES", c.TLSCipherSuites)
+	c.TLSAutocertDomains = c.envList("TLS_AUTOCERT_DOMAINS", c.TLSAutocertDomains)
+	c.TLSAutocertCache = c.envString("TLS_AUTOCERT_CACHE", c.TLSAutocertCache)
+	c.TLSAutocertEmail = c.envString("TLS_AUTOCERT_EMAIL", c.TLSAutocertEmail)
+	c.LogStreamBuffer = c.envInt("LOG_STREAM_BUFFER", c.LogStreamBuffer)
+	c.LogStreamDrop = c.envString("LOG_STREAM_DROP", c.LogStreamDrop)
+	c.EventHistory = c.envInt("EVENT_HISTORY", c.EventHistory)
+	c.EventBuffer = c.envInt("EVENT_BUFFER", c.EventBuffer)
+	c.EventHeartbeat = c.envDuration("EVENT_HEARTBEAT", c.EventHeartbeat)
+	c.WebhookURLs = c.envList("WEBHOOK_URL", c.WebhookURLs)
+	c.WebhookTimeout = c.envDuration("WEBHOOK_TIMEOUT", c.WebhookTimeout)
+	c.WebhookEvents = c.envList("WEBHOOK_EVENTS", c.WebhookEvents)
+	c.WebhookSecret = c.envString("WEBHOOK_SECRET", c.WebhookSecret)
+	c.WebhookRetries = c.envInt("WEBHOOK_RETRIES", c.WebhookRetries)
+	c.WebhookRetryBackoff = c.envDuration("WEBHOOK_RETRY_BACKOFF", c.WebhookRetryBackoff)
+	c.Tenants = c.envList("TENANTS", c.Tenants)
+	c.AuthMode = c.envString("AUTH_MODE", c.AuthMode)
+	c.AuthPSK = c.envString("AUTH_PSK", c.AuthPSK)
+	c.AuthTokenSecret = c.envString("AUTH_TOKEN_SECRET", c.AuthTokenSecret)
+	c.AuthAPIKeys = c.envList("AUTH_API_KEYS", c.AuthAPIKeys)
+	c.WSAllowedOrigins = c.envList("WS_ALLOWED_ORIGINS", c.WSAllowedOrigins)
+	c.PreAuthMode = c.envString("PRE_AUTH_MODE", c.PreAuthMode)
+	c.PreAuthBuffer = c.envInt("PRE_AUTH_BUFFER", c.PreAuthBuffer)
+	c.AdminToken = c.envString("ADMIN_TOKEN", c.AdminToken)
+	c.PprofEnabled = c.envBool("PPROF_ENABLED", c.PprofEnabled)
+	return c
+}
+
+// configFile — формат JSON-файла конфигурации. Незаданные поля
+// оставляют значения по умолчанию
+type configFile struct {
+	ICEServers         []webrtc.ICEServer `json:"iceServers"`
+	ListenAddr         string             `json:"listenAddr"`
+	ShutdownTimeout    fileDuration       `json:"shutdownTimeout"`
+	ReadTimeout        fileDuration       `json:"readTimeout"`
+	PingInterval       fileDuration       `json:"pingInterval"`
+	WriteTimeout       fileDuration       `json:"writeTimeout"`
+	CORSAllowedOrigins []string           `json:"corsAllowedOrigins"`
+}
+
+// fileDuration — длительность в файле конфигурации строкой, как "5s"
+type fileDuration time.Duration
+
+func (d *fileDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = fileDuration(v)
+	return nil
+}
+
+// set заменяет dst, если длительность задана в файле
+func (d fileDuration) set(dst *time.Duration) {
+	if d != 0 {
+		*dst = time.Duration(d)
+	}
+}
+
+func (c *Config) loadFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.parseErrors = append(c.parseErrors, Problem{Key: "WEBRTC_CONFIG", Message: err.Error(), Fatal: true})
+		return
+	}
+	var f configFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		c.parseErrors = append(c.parseErrors, Problem{
+			Key:     "WEBRTC_CONFIG",
+			Message: fmt.Sprintf("%s: %v", path, err),
+			Fatal:   true,
+		})
+		return
+	}
+	if f.ICEServers != nil {
+		c.ICEServers = f.ICEServers
+	}
+	if f.ListenAddr != "" {
+		c.ListenAddr = f.ListenAddr
+	}
+	f.ShutdownTimeout.set(&c.ShutdownTimeout)
+	f.ReadTimeout.set(&c.ReadTimeout)
+	f.PingInterval.set(&c.PingInterval)
+	f.WriteTimeout.set(&c.WriteTimeout)
+	if f.CORSAllowedOrigins != nil {
+		c.CORSAllowedOrigins = f.CORSAllowedOrigins
+	}
+}
+
+// Validate проверяет все настройки и возвращает найденные проблемы.
+// Проблемы с Fatal=true не позволяют запустить сервер.
+func (c Config) Validate() []Problem {
+	problems := append([]Problem(nil), c.parseErrors...)
+	fatal := func(key, format string, args ...interface{}) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...), Fatal: true})
+	}
+	warn := func(key, format string, args ...interface{}) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		fatal("SHUTDOWN_TIMEOUT", "must be positive, got %s", c.ShutdownTimeout)
+	}
+	for key, level := range map[string]string{"LOG_LEVEL": c.LogLevel, "LOG_LEVEL_PION": c.LogLevelPion} {
+		if _, err := ParseLogLevel(level); err != nil {
+			fatal(key, "must be debug, info, warn or error, got %q", level)
+		}
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		fatal("LOG_FORMAT", "must be json or text, got %q", c.LogFormat)
+	}
+	if c.SessionResumeGrace < 0 {
+		fatal("SESSION_RESUME_GRACE", "must not be negative, got %s", c.SessionResumeGrace)
+	}
+	if c.EgressEnabled {
+		if _, err := exec.LookPath(c.EgressFFmpeg); err != nil {
+			warn("EGRESS_FFMPEG", "%s not found, restreams will fail: %v", c.EgressFFmpeg, err)
+		}
+		if c.SignalingMode == "relay" {
+			warn("EGRESS_ENABLED", "media does not pass through the server in relay mode")
+		}
+	}
+	if c.RecordingMaxDuration < 0 {
+		fatal("RECORDING_MAX_DURATION", "must not be negative, got %s", c.RecordingMaxDuration)
+	}
+	if c.RecordingMaxSizeMB < 0 {
+		fatal("RECORDING_MAX_SIZE_MB", "must not be negative, got %d", c.RecordingMaxSizeMB)
+	}
+	if c.RecordingDir != "" && c.SignalingMode == "relay" {
+		warn("RECORDING_DIR", "media does not pass through the server in relay mode")
+	}
+	if c.FileTransferMaxSizeMB < 1 {
+		fatal("FILE_TRANSFER_MAX_SIZE_MB", "must be at least 1, got %d", c.FileTransferMaxSizeMB)
+	}
+	// 65535 — наибольшее сообщение SCTP, которое примут все браузеры
+	if c.FileChunkSize < 1024 || c.FileChunkSize > 65535 {
+		fatal("FILE_CHUNK_SIZE", "must be 1024-65535 bytes, got %d", c.FileChunkSize)
+	}
+	switch c.Backplane {
+	case "memory":
+	case "redis":
+		if !validRedisURL(c.RedisURL) {
+			fatal("REDIS_URL", "must look like redis://[user:password@]host[:port][/db] or rediss://...")
+		}
+		if c.BackplaneSyncTimeout <= 0 {
+			fatal("BACKPLANE_SYNC_TIMEOUT", "must be positive, got %s", c.BackplaneSyncTimeout)
+		}
+		if c.SignalingMode == "proxy" || c.SignalingMode == "sfu" {
+			warn("BACKPLANE", "media is forwarded only between clients of the same instance in %s mode", c.SignalingMode)
+		}
+	default:
+		fatal("BACKPLANE", "must be memory or redis, got %q", c.Backplane)
+	}
+
+	if c.DrainTimeout < 0 {
+		fatal("DRAIN_TIMEOUT", "must not be negative, got %s", c.DrainTimeout)
+	}
+
+	if c.CloseHandshakeTimeout <= 0 {
+		fatal("WS_CLOSE_TIMEOUT", "must be positive, got %s", c.CloseHandshakeTimeout)
+	} else if c.CloseHandshakeTimeout > 10*time.Second {
+		warn("WS_CLOSE_TIMEOUT", "%s delays every teardown", c.CloseHandshakeTimeout)
+	}
+
+	if c.ReadTimeout <= 0 {
+		fatal("READ_TIMEOUT", "must be positive, got %s", c.ReadTimeout)
+	}
+	if c.PingInterval <= 0 || c.PingInterval >= c.ReadTimeout {
+		fatal("PING_INTERVAL", "must be in (0, READ_TIMEOUT %s), got %s", c.ReadTimeout, c.PingInterval)
+	} else if c.PingInterval > c.ReadTimeout/2 {
+		warn("PING_INTERVAL", "one lost pong closes the connection, use at most half of READ_TIMEOUT")
+	}
+	if c.WriteTimeout <= 0 {
+		fatal("WRITE_TIMEOUT", "must be positive, got %s", c.WriteTimeout)
+	}
+	if c.BroadcastWorkers < 1 {
+		fatal("BROADCAST_WORKERS", "must be at least 1, got %d", c.BroadcastWorkers)
+	}
+	if c.BroadcastWriteTimeout <= 0 {
+		fatal("BROADCAST_WRITE_TIMEOUT", "must be positive, got %s", c.BroadcastWriteTimeout)
+	} else if c.BroadcastWriteTimeout > c.WriteTimeout {
+		warn("BROADCAST_WRITE_TIMEOUT", "%s is longer than WRITE_TIMEOUT (%s)", c.BroadcastWriteTimeout, c.WriteTimeout)
+	}
+	if c.IdleWarningBefore < 0 || c.IdleWarningBefore >= c.ReadTimeout {
+		fatal("IDLE_WARNING_BEFORE", "must be in [0, %s), got %s", c.ReadTimeout, c.IdleWarningBefore)
+	}
+	if c.NoOfferTimeout < 0 {
+		fatal("NO_OFFER_TIMEOUT", "must not be negative, got %s", c.NoOfferTimeout)
+	} else if c.NoOfferTimeout > 0 && c.NoOfferTimeout < time.Second {
+		warn("NO_OFFER_TIMEOUT", "%s leaves clients no time to create an offer", c.NoOfferTimeout)
+	}
+
+	if c.KeyframeInterval < 0 {
+		fatal("KEYFRAME_INTERVAL", "must not be negative, got %s", c.KeyframeInterval)
+	} else if c.KeyframeInterval > 0 && c.KeyframeInterval < time.Second {
+		warn("KEYFRAME_INTERVAL", "%s will flood publishers with PLI", c.KeyframeInterval)
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			if len(c.CORSAllowedOrigins) > 1 {
+				fatal("CORS_ALLOWED_ORIGINS", "\"*\" cannot be combined with explicit origins")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			fatal("CORS_ALLOWED_ORIGINS", "%q is not an origin like https://example.com", origin)
+		}
+	}
+	if len(c.CORSAllowedMethods) == 0 {
+		fatal("CORS_ALLOWED_METHODS", "must not be empty")
+	}
+
+	if c.ICERecoveryMaxAttempts < 1 {
+		fatal("ICE_RECOVERY_MAX_ATTEMPTS", "must be at least 1, got %d", c.ICERecoveryMaxAttempts)
+	} else if c.ICERecoveryMaxAttempts > 10 {
+		warn("ICE_RECOVERY_MAX_ATTEMPTS", "%d attempts with doubling backoff may take very long", c.ICERecoveryMaxAttempts)
+	}
+	if c.ICEFailureLimit < 0 {
+		fatal("ICE_FAILURE_LIMIT", "must not be negative, got %d", c.ICEFailureLimit)
+	}
+	if c.ICEFailureLimit > 0 && c.ICEFailureWindow <= 0 {
+		fatal("ICE_FAILURE_WINDOW", "must be positive, got %s", c.ICEFailureWindow)
+	}
+	if c.ICERecoveryBackoff <= 0 {
+		fatal("ICE_RECOVERY_BACKOFF", "must be positive, got %s", c.ICERecoveryBackoff)
+	}
+
+	if err := media.ValidateOpusBitrate(c.OpusMaxAverageBitrate); err != nil {
+		fatal("OPUS_MAX_AVERAGE_BITRATE", "%v", err)
+	}
+
+	if c.AcceptRate < 0 {
+		fatal("ACCEPT_RATE", "must not be negative, got %g", c.AcceptRate)
+	}
+	if c.AcceptRate > 0 && c.AcceptQueue < 1 {
+		fatal("ACCEPT_QUEUE", "must be at least 1, got %d", c.AcceptQueue)
+	}
+	if c.MaxClients < 0 {
+		fatal("MAX_CLIENTS", "must not be negative, got %d", c.MaxClients)
+	} else if c.MaxClients == 0 {
+		warn("MAX_CLIENTS", "no connection limit, every client gets a PeerConnection")
+	}
+	if c.ConnectRatePerIP < 0 {
+		fatal("CONNECT_RATE_PER_IP", "must not be negative, got %g", c.ConnectRatePerIP)
+	}
+	if c.ConnectRatePerIP > 0 && c.ConnectBurstPerIP < 1 {
+		fatal("CONNECT_BURST_PER_IP", "must be at least 1, got %d", c.ConnectBurstPerIP)
+	}
+	if c.ClientShards < 1 || c.ClientShards > 4096 {
+		fatal("CLIENT_SHARDS", "must be between 1 and 4096, got %d", c.ClientShards)
+	}
+	if c.MaxConnectionsPerIP < 0 {
+		fatal("MAX_CONNECTIONS_PER_IP", "must not be negative, got %d", c.MaxConnectionsPerIP)
+	} else if c.MaxClients > 0 && c.MaxConnectionsPerIP > c.MaxClients {
+		warn("MAX_CONNECTIONS_PER_IP", "%d is above MAX_CLIENTS=%d and is never reached", c.MaxConnectionsPerIP, c.MaxClients)
+	}
+	if c.MaxRoomsPerUser < 0 {
+		fatal("MAX_ROOMS_PER_USER", "must not be negative, got %d", c.MaxRoomsPerUser)
+	} else if c.MaxRoomsPerUser > 0 && c.AuthMode == "none" {
+		warn("MAX_ROOMS_PER_USER", "has no effect with AUTH_MODE=none, clients have no user")
+	}
+	if c.MessageRate < 0 {
+		fatal("MESSAGE_RATE", "must not be negative, got %g", c.MessageRate)
+	}
+	if c.MessageRate > 0 && c.MessageBurst < 1 {
+		fatal("MESSAGE_BURST", "must be at least 1, got %d", c.MessageBurst)
+	}
+	if c.MaxPeerConnections < 0 {
+		fatal("MAX_PEER_CONNECTIONS", "must not be negative, got %d", c.MaxPeerConnections)
+	}
+	if c.RetryAfter < time.Second {
+		fatal("RETRY_AFTER", "must be at least 1s, Retry-After is in whole seconds, got %s", c.RetryAfter)
+	}
+	if c.RetryAfterMax < c.RetryAfter {
+		fatal("RETRY_AFTER_MAX", "must not be less than RETRY_AFTER (%s), got %s", c.RetryAfter, c.RetryAfterMax)
+	}
+
+	if c.MaxDataChannels < 0 {
+		fatal("MAX_DATA_CHANNELS", "must not be negative, got %d", c.MaxDataChannels)
+	} else if c.MaxDataChannels > 65534 {
+		warn("MAX_DATA_CHANNELS", "SCTP allows at most 65534 streams, limit %d is never reached", c.MaxDataChannels)
+	}
+	if c.DataChannelCompressMin < 0 {
+		fatal("DATA_CHANNEL_COMPRESS_MIN", "must not be negative, got %d", c.DataChannelCompressMin)
+	}
+
+	for _, a := range []struct{ key, addr string }{
+		{"LISTEN_ADDR", c.ListenAddr},
+		{"ADMIN_LISTEN_ADDR", c.AdminListenAddr},
+		{"HTTP_REDIRECT_ADDR", c.HTTPRedirectAddr},
+		{"GRPC_LISTEN_ADDR", c.GRPCListenAddr},
+	} {
+		if a.addr == "" && a.key != "LISTEN_ADDR" {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(a.addr); err != nil {
+			fatal(a.key, "%v", err)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			fatal(a.key, "invalid port %q", port)
+		}
+	}
+	if c.AdminListenAddr != "" && c.AdminListenAddr == c.ListenAddr {
+		fatal("ADMIN_LISTEN_ADDR", "must differ from LISTEN_ADDR, leave it empty to serve admin endpoints there")
+	}
+	if c.HTTPRedirectAddr != "" && (c.HTTPRedirectAddr == c.ListenAddr || c.HTTPRedirectAddr == c.AdminListenAddr) {
+		fatal("HTTP_REDIRECT_ADDR", "must differ from LISTEN_ADDR and ADMIN_LISTEN_ADDR")
+	}
+	if c.GRPCListenAddr != "" && slices.Contains([]string{c.ListenAddr, c.AdminListenAddr, c.HTTPRedirectAddr}, c.GRPCListenAddr) {
+		fatal("GRPC_LISTEN_ADDR", "must differ from LISTEN_ADDR, ADMIN_LISTEN_ADDR and HTTP_REDIRECT_ADDR")
+	}
+
+	for i, server := range c.ICEServers {
+		if err := validateICEServer(server); err != nil {
+			fatal(c.iceServersKey, "iceServers[%d]: %v", i, err)
+		}
+	}
+
+	for _, tmpl := range c.TURNURLTemplates {
+		if err := validateTURNTemplate(tmpl); err != nil {
+			fatal("TURN_URL_TEMPLATES", "%v", err)
+		}
+	}
+	staticTURN := c.TURNUsername != "" && c.TURNCredential != ""
+	if len(c.TURNURLTemplates) > 0 && !staticTURN && c.TURNSecret == "" {
+		fatal("TURN_USERNAME", "TURN_USERNAME and TURN_CREDENTIAL or TURN_SECRET are required with TURN_URL_TEMPLATES")
+	}
+	if c.TURNServerPort < 0 || c.TURNServerPort > 65535 {
+		fatal("TURN_SERVER_PORT", "must be 0-65535, got %d", c.TURNServerPort)
+	} else if c.TURNServerPort > 0 {
+		if !staticTURN && c.TURNSecret == "" {
+			fatal("TURN_SERVER_PORT", "TURN_USERNAME and TURN_CREDENTIAL or TURN_SECRET are required for the embedded TURN server")
+		}
+		if ip := net.ParseIP(c.TURNServerPublicIP); ip == nil || ip.To4() == nil {
+			fatal("TURN_SERVER_PUBLIC_IP", "must be the public IPv4 address of this host with TURN_SERVER_PORT, got %q", c.TURNServerPublicIP)
+		}
+		if c.TURNServerRealm == "" {
+			fatal("TURN_SERVER_REALM", "must not be empty")
+		}
+		if c.TURNServerRelayMinPort < 1 || c.TURNServerRelayMaxPort > 65535 || c.TURNServerRelayMinPort > c.TURNServerRelayMaxPort {
+			fatal("TURN_SERVER_RELAY_MIN_PORT", "relay port range %d-%d is invalid", c.TURNServerRelayMinPort, c.TURNServerRelayMaxPort)
+		} else if c.TURNServerPort >= c.TURNServerRelayMinPort && c.TURNServerPort <= c.TURNServerRelayMaxPort {
+			warn("TURN_SERVER_PORT", "%d is inside the relay port range %d-%d", c.TURNServerPort, c.TURNServerRelayMinPort, c.TURNServerRelayMaxPort)
+		}
+	}
+	if c.TURNSecret != "" && staticTURN {
+		warn("TURN_SECRET", "overrides TURN_USERNAME and TURN_CREDENTIAL")
+	}
+	if c.TURNCredentialTTL <= 0 {
+		fatal("TURN_CREDENTIAL_TTL", "must be positive, got %s", c.TURNCredentialTTL)
+	}
+
+	for _, tmpl := range c.TURNTCPURLs {
+		if err := validateTURNTCPURL(tmpl); err != nil {
+			fatal("TURN_TCP_URLS", "%v", err)
+		}
+	}
+	for _, tmpl := range c.TURNTCPSecondaryURLs {
+		if err := validateTURNTCPURL(tmpl); err != nil {
+			fatal("TURN_TCP_SECONDARY_URLS", "%v", err)
+		}
+	}
+	if c.TCPRelayLimit < 0 {
+		fatal("TCP_RELAY_LIMIT", "must not be negative, got %d", c.TCPRelayLimit)
+	} else if c.TCPRelayLimit > 0 && !c.TURNTCPFallback {
+		warn("TCP_RELAY_LIMIT", "has no effect without TURN_TCP_FALLBACK")
+	}
+	if c.TCPRelayLimit == 0 && len(c.TURNTCPSecondaryURLs) > 0 {
+		warn("TURN_TCP_SECONDARY_URLS", "never used without TCP_RELAY_LIMIT")
+	}
+	if c.TURNTCPFallback {
+		if len(c.TURNTCPURLs) == 0 {
+			fatal("TURN_TCP_FALLBACK", "requires TURN_TCP_URLS")
+		}
+		if !staticTURN && c.TURNSecret == "" {
+			fatal("TURN_TCP_FALLBACK", "TURN_USERNAME and TURN_CREDENTIAL or TURN_SECRET are required for the TCP relay")
+		}
+	}
+	if c.TURNTCPFallbackTimeout <= 0 {
+		fatal("TURN_TCP_FALLBACK_TIMEOUT", "must be positive, got %s", c.TURNTCPFallbackTimeout)
+	}
+
+	if c.QualityInterval < 0 {
+		fatal("QUALITY_INTERVAL", "must not be negative, got %s", c.QualityInterval)
+	} else if c.QualityInterval > 0 && c.QualityInterval < time.Second {
+		warn("QUALITY_INTERVAL", "%s is too short to measure loss reliably", c.QualityInterval)
+	}
+	if c.QualityHysteresis < 0 || c.QualityHysteresis >= QualityPoorBelow-QualityCriticalBelow {
+		fatal("QUALITY_HYSTERESIS", "must be in [0, %d), got %g", QualityPoorBelow-QualityCriticalBelow, c.QualityHysteresis)
+	}
+
+	switch c.SignalingMode {
+	case "server", "relay", "proxy", "sfu":
+	default:
+		fatal("SIGNALING_MODE", "must be server, relay, proxy or sfu, got %q", c.SignalingMode)
+	}
+	if c.SFUMaxRoomMembers < 2 {
+		fatal("SFU_MAX_ROOM_MEMBERS", "must be at least 2, got %d", c.SFUMaxRoomMembers)
+	}
+	if c.MaxPublishersPerRoom < 0 {
+		fatal("MAX_PUBLISHERS_PER_ROOM", "must not be negative, got %d", c.MaxPublishersPerRoom)
+	} else if c.MaxPublishersPerRoom > 0 && c.SignalingMode != "sfu" {
+		warn("MAX_PUBLISHERS_PER_ROOM", "applies only to SIGNALING_MODE=sfu, ignored in %s", c.SignalingMode)
+	}
+
+	if c.MaxRenegotiations < 0 {
+		fatal("MAX_RENEGOTIATIONS", "must not be negative, got %d", c.MaxRenegotiations)
+	}
+
+	if _, ok := media.BundlePolicies[c.BundlePolicy]; !ok {
+		fatal("BUNDLE_POLICY", "must be max-bundle, balanced or max-compat, got %q", c.BundlePolicy)
+	} else if c.BundlePolicy != "max-bundle" {
+		warn("BUNDLE_POLICY", "pion multiplexes all media over one transport, %s does not create per-m-line transports", c.BundlePolicy)
+	}
+
+	if c.MaxVideoWidth < 0 || c.MaxVideoHeight < 0 {
+		fatal("MAX_VIDEO_WIDTH", "limits must not be negative, got %dx%d", c.MaxVideoWidth, c.MaxVideoHeight)
+	} else if (c.MaxVideoWidth == 0) != (c.MaxVideoHeight == 0) {
+		fatal("MAX_VIDEO_WIDTH", "MAX_VIDEO_WIDTH and MAX_VIDEO_HEIGHT must be set together")
+	}
+
+	if c.MaxCandidates < 0 {
+		fatal("MAX_CANDIDATES", "must not be negative, got %d", c.MaxCandidates)
+	}
+	if c.MaxMessageSize < 4096 {
+		fatal("MAX_MESSAGE_SIZE", "must be at least 4096 bytes to fit an SDP, got %d", c.MaxMessageSize)
+	}
+
+	for _, name := range c.SRTPProfiles {
+		if _, ok := media.SRTPProfiles[name]; !ok {
+			fatal("SRTP_PROFILES", "unsupported profile %q", name)
+		}
+	}
+	for _, name := range c.VideoCodecs {
+		if !media.ValidVideoCodec(name) {
+			fatal("VIDEO_CODECS", "unknown codec %q, known: h264,%s", name, strings.Join(media.DefaultVideoCodecs, ","))
+		}
+	}
+	for _, name := range c.AudioCodecs {
+		if !media.ValidAudioCodec(name) {
+			fatal("AUDIO_CODECS", "unknown codec %q, known: %s", name, strings.Join(media.DefaultAudioCodecs, ","))
+		}
+	}
+	for _, fb := range c.VideoRTCPFeedback {
+		if fb == "none" && len(c.VideoRTCPFeedback) > 1 {
+			fatal("VIDEO_RTCP_FEEDBACK", "none cannot be combined with other entries")
+		} else if fb != "none" && !slices.Contains(media.DefaultVideoFeedback, fb) {
+			fatal("VIDEO_RTCP_FEEDBACK", "unknown feedback %q, known: %s", fb, strings.Join(media.DefaultVideoFeedback, ","))
+		}
+	}
+	if c.VideoRTCPFeedback != nil && !slices.Contains(c.VideoRTCPFeedback, "transport-cc") && (c.BWEReportInterval > 0 || c.CongestionControl) {
+		warn("VIDEO_RTCP_FEEDBACK", "without transport-cc clients send no TWCC feedback and the bandwidth estimate stays at BWE_INITIAL_BITRATE")
+	}
+
+	if c.SetupTimeout < 0 {
+		fatal("SETUP_TIMEOUT", "must not be negative, got %s", c.SetupTimeout)
+	} else if c.SetupTimeout > 0 && c.SetupTimeout < time.Second {
+		warn("SETUP_TIMEOUT", "%s is shorter than STUN gathering usually takes", c.SetupTimeout)
+	}
+
+	if c.AnswerCandidateDelay < 0 {
+		fatal("ANSWER_CANDIDATE_DELAY", "must not be negative, got %s", c.AnswerCandidateDelay)
+	} else if c.AnswerCandidateDelay > time.Second {
+		warn("ANSWER_CANDIDATE_DELAY", "%s delays every connection setup", c.AnswerCandidateDelay)
+	}
+	if c.AnswerMaxCandidates < 0 {
+		fatal("ANSWER_MAX_CANDIDATES", "must not be negative, got %d", c.AnswerMaxCandidates)
+	} else if c.AnswerMaxCandidates > 0 && !c.NonTrickle {
+		warn("ANSWER_MAX_CANDIDATES", "has no effect without NON_TRICKLE, candidates are trickled")
+	}
+	if c.AnswerMaxSize < 0 {
+		fatal("ANSWER_MAX_SIZE", "must not be negative, got %d", c.AnswerMaxSize)
+	} else if c.AnswerMaxSize > 0 && !c.NonTrickle {
+		warn("ANSWER_MAX_SIZE", "has no effect without NON_TRICKLE, candidates are trickled")
+	}
+	if c.NonTrickle && c.AnswerCandidateDelay > 0 {
+		warn("ANSWER_CANDIDATE_DELAY", "has no effect with NON_TRICKLE")
+	}
+
+	if c.BWEReportInterval < 0 {
+		fatal("BWE_REPORT_INTERVAL", "must not be negative, got %s", c.BWEReportInterval)
+	} else if c.BWEReportInterval > 0 && c.BWEReportInterval < 100*time.Millisecond {
+		warn("BWE_REPORT_INTERVAL", "%s floods clients with bwe messages", c.BWEReportInterval)
+	}
+	if c.BWEInitialBitrate <= 0 {
+		fatal("BWE_INITIAL_BITRATE", "must be positive, got %d", c.BWEInitialBitrate)
+	}
+	if c.CongestionControl && c.SignalingMode != "proxy" && c.SignalingMode != "sfu" {
+		warn("CONGESTION_CONTROL", "has no effect in SIGNALING_MODE=%s, the server does not forward media", c.SignalingMode)
+	}
+	if c.ActiveSpeakerInterval < 0 {
+		fatal("ACTIVE_SPEAKER_INTERVAL", "must not be negative, got %s", c.ActiveSpeakerInterval)
+	} else if c.ActiveSpeakerInterval > 0 && c.ActiveSpeakerInterval < 100*time.Millisecond {
+		warn("ACTIVE_SPEAKER_INTERVAL", "%s holds too few audio packets to average", c.ActiveSpeakerInterval)
+	}
+	if c.ActiveSpeakerInterval > 0 && c.SignalingMode == "relay" {
+		warn("ACTIVE_SPEAKER_INTERVAL", "media does not pass through the server in relay mode")
+	}
+	if c.ActiveSpeakerThreshold < 0 || c.ActiveSpeakerThreshold > 127 {
+		fatal("ACTIVE_SPEAKER_THRESHOLD", "must be 0-127 (-dBov), got %d", c.ActiveSpeakerThreshold)
+	}
+	if c.ActiveSpeakerDebounce < 0 {
+		fatal("ACTIVE_SPEAKER_DEBOUNCE", "must not be negative, got %s", c.ActiveSpeakerDebounce)
+	}
+
+	if c.ICEUDPPort < 0 || c.ICEUDPPort > 65535 {
+		fatal("ICE_UDP_PORT", "must be a port number, got %d", c.ICEUDPPort)
+	}
+	if c.TestICEUfrag != "" || c.TestICEPwd != "" {
+		if err := media.ValidateTestICECredentials(c.TestICEUfrag, c.TestICEPwd); err != nil {
+			fatal("TEST_ICE_UFRAG", "%v", err)
+		} else {
+			warn("TEST_ICE_UFRAG", "fixed ICE credentials are for tests only, NEVER use them in production")
+		}
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fatal("TLS_CERT_FILE", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if err := validateTLSMinVersion(c.TLSMinVersion); err != nil {
+		fatal("TLS_MIN_VERSION", "%v", err)
+	}
+	for _, name := range c.TLSCipherSuites {
+		if _, err := TLSCipherSuite(name); err != nil {
+			fatal("TLS_CIPHER_SUITES", "%v", err)
+		}
+	}
+	if len(c.TLSCipherSuites) > 0 && c.TLSMinVersion == "1.3" {
+		warn("TLS_CIPHER_SUITES", "ignored with TLS_MIN_VERSION=1.3")
+	}
+	if c.TLSCertFile != "" && len(c.TLSAutocertDomains) > 0 {
+		fatal("TLS_AUTOCERT_DOMAINS", "set either TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS, not both")
+	}
+	for _, d := range c.TLSAutocertDomains {
+		if d == "" || strings.ContainsAny(d, ":/*") {
+			fatal("TLS_AUTOCERT_DOMAINS", "invalid domain %q", d)
+		}
+	}
+	if len(c.TLSAutocertDomains) > 0 && c.TLSAutocertCache == "" {
+		warn("TLS_AUTOCERT_CACHE", "empty, certificates are requested again after every restart and may hit Let's Encrypt rate limits")
+	}
+	if len(c.TLSAutocertDomains) > 0 && c.HTTPRedirectAddr == "" {
+		if _, port, _ := net.SplitHostPort(c.ListenAddr); port != "443" {
+			warn("HTTP_REDIRECT_ADDR", "empty and LISTEN_ADDR is not on port 443, Let's Encrypt cannot validate the domain")
+		}
+	}
+	if !c.TLSEnabled() && (len(c.TLSCipherSuites) > 0 || c.TLSMinVersion != "1.2") {
+		warn("TLS_MIN_VERSION", "TLS settings have no effect without TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+	}
+	if !c.TLSEnabled() && c.HTTPRedirectAddr != "" {
+		warn("HTTP_REDIRECT_ADDR", "ignored without TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+	}
+
+	if c.LogStreamBuffer < 1 {
+		fatal("LOG_STREAM_BUFFER", "must be at least 1, got %d", c.LogStreamBuffer)
+	}
+	if c.LogStreamDrop != "drop" && c.LogStreamDrop != "disconnect" {
+		fatal("LOG_STREAM_DROP", "must be drop or disconnect, got %q", c.LogStreamDrop)
+	}
+	if c.EventHistory < 1 {
+		fatal("EVENT_HISTORY", "must be at least 1, got %d", c.EventHistory)
+	}
+	if c.EventBuffer < 1 {
+		fatal("EVENT_BUFFER", "must be at least 1, got %d", c.EventBuffer)
+	}
+	if c.EventHeartbeat <= 0 {
+		fatal("EVENT_HEARTBEAT", "must be positive, got %s", c.EventHeartbeat)
+	} else if c.EventHeartbeat > time.Minute {
+		warn("EVENT_HEARTBEAT", "%s may be longer than proxy idle timeouts", c.EventHeartbeat)
+	}
+
+	for _, raw := range c.WebhookURLs {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fatal("WEBHOOK_URL", "%q is not an http(s) URL", raw)
+		}
+	}
+	if c.WebhookTimeout <= 0 {
+		fatal("WEBHOOK_TIMEOUT", "must be positive, got %s", c.WebhookTimeout)
+	}
+	for _, typ := range c.WebhookEvents {
+		if !slices.Contains(WebhookEventTypes, typ) {
+			fatal("WEBHOOK_EVENTS", "unknown event %q, known: %s", typ, strings.Join(WebhookEventTypes, ","))
+		}
+	}
+	if c.WebhookRetries < 0 {
+		fatal("WEBHOOK_RETRIES", "must not be negative, got %d", c.WebhookRetries)
+	}
+	if c.WebhookRetryBackoff <= 0 {
+		fatal("WEBHOOK_RETRY_BACKOFF", "must be positive, got %s", c.WebhookRetryBackoff)
+	}
+	if len(c.WebhookURLs) > 0 && c.WebhookSecret == "" {
+		warn("WEBHOOK_SECRET", "not set, receivers cannot verify that webhooks come from this server")
+	} else if c.WebhookSecret != "" && len(c.WebhookSecret) < 32 {
+		warn("WEBHOOK_SECRET", "shorter than 32 bytes")
+	}
+
+	if slices.Contains(c.Tenants, TenantOther) {
+		fatal("TENANTS", "%q is reserved for unknown tenants", TenantOther)
+	}
+	if len(c.Tenants) > 100 {
+		warn("TENANTS", "%d tenants make per-tenant metrics expensive", len(c.Tenants))
+	}
+
+	switch c.AuthMode {
+	case "none":
+		if c.AuthPSK != "" {
+			warn("AUTH_PSK", "ignored with AUTH_MODE=none")
+		}
+	case "psk":
+		if c.AuthPSK == "" {
+			fatal("AUTH_PSK", "required with AUTH_MODE=psk")
+		} else if len(c.AuthPSK) < 16 {
+			warn("AUTH_PSK", "key shorter than 16 bytes is easy to guess")
+		}
+	case "token":
+		if c.AuthTokenSecret == "" && len(c.AuthAPIKeys) == 0 {
+			fatal("AUTH_TOKEN_SECRET", "AUTH_TOKEN_SECRET or AUTH_API_KEYS required with AUTH_MODE=token")
+		} else if c.AuthTokenSecret != "" && len(c.AuthTokenSecret) < 32 {
+			warn("AUTH_TOKEN_SECRET", "HS256 secret shorter than 32 bytes is weak")
+		}
+	default:
+		fatal("AUTH_MODE", "must be none, psk or token, got %q", c.AuthMode)
+	}
+	if c.AuthMode != "token" && c.AuthTokenSecret != "" {
+		warn("AUTH_TOKEN_SECRET", "ignored unless AUTH_MODE=token")
+	}
+	if c.AuthMode != "token" && len(c.AuthAPIKeys) > 0 {
+		warn("AUTH_API_KEYS", "ignored unless AUTH_MODE=token")
+	}
+	for _, entry := range c.AuthAPIKeys {
+		user, key, ok := strings.Cut(entry, ":")
+		if !ok || user == "" || key == "" {
+			fatal("AUTH_API_KEYS", "entries must look like user:key")
+		} else if strings.Count(key, ".") == 2 {
+			fatal("AUTH_API_KEYS", "key for %s looks like a JWT", user)
+		} else if len(key) < 16 {
+			warn("AUTH_API_KEYS", "key for %s is shorter than 16 bytes and easy to guess", user)
+		}
+	}
+	for _, origin := range c.WSAllowedOrigins {
+		if origin == "*" {
+			if len(c.WSAllowedOrigins) > 1 {
+				warn("WS_ALLOWED_ORIGINS", "\"*\" makes the other entries redundant")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			fatal("WS_ALLOWED_ORIGINS", "%q is not an origin like https://example.com", origin)
+		}
+	}
+
+	if c.PreAuthMode != "reject" && c.PreAuthMode != "buffer" {
+		fatal("PRE_AUTH_MODE", "must be reject or buffer, got %q", c.PreAuthMode)
+	}
+	if c.PreAuthBuffer < 1 {
+		fatal("PRE_AUTH_BUFFER", "must be at least 1, got %d", c.PreAuthBuffer)
+	} else if c.PreAuthBuffer > 256 {
+		warn("PRE_AUTH_BUFFER", "%d held messages per connection is a lot of memory before auth", c.PreAuthBuffer)
+	}
+
+	if c.PprofEnabled && c.AdminToken == "" {
+		fatal("PPROF_ENABLED", "requires ADMIN_TOKEN")
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < 16 {
+		warn("ADMIN_TOKEN", "token shorter than 16 bytes is easy to guess")
+	}
+
+	// Опечатки в именах переменных иначе молча дают значения по умолчанию
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if key := c.similarKey(name); key != "" {
+			warn(name, "unknown setting, did you mean %s?", key)
+		}
+	}
+
+	return problems
+}
+
+// effective возвращает итоговые значения настроек для лога.
+// Секреты нужно пропускать через redact.
+func (c Config) effective() [][2]string {
+	return [][2]string{
+		{"WEBRTC_CONFIG", c.ConfigFile},
+		{"ICE_SERVERS", ICEServerURLs(c.ICEServers)},
+		{"LISTEN_ADDR", c.ListenAddr},
+		{"ADMIN_LISTEN_ADDR", c.AdminListenAddr},
+		{"HTTP_REDIRECT_ADDR", c.HTTPRedirectAddr},
+		{"GRPC_LISTEN_ADDR", c.GRPCListenAddr},
+		{"LOG_LEVEL", c.LogLevel},
+		{"LOG_LEVEL_PION", c.LogLevelPion},
+		{"LOG_FORMAT", c.LogFormat},
+		{"SESSION_RESUME_GRACE", c.SessionResumeGrace.String()},
+		{"EGRESS_ENABLED", strconv.FormatBool(c.EgressEnabled)},
+		{"EGRESS_FFMPEG", c.EgressFFmpeg},
+		{"EGRESS_HLS_DIR", c.EgressHLSDir},
+		{"EGRESS_URL_PREFIXES", strings.Join(c.EgressURLPrefixes, ",")},
+		{"RECORDING_DIR", c.RecordingDir},
+		{"RECORDING_MAX_DURATION", c.RecordingMaxDuration.String()},
+		{"RECORDING_MAX_SIZE_MB", strconv.Itoa(c.RecordingMaxSizeMB)},
+		{"FILE_TRANSFER_DIR", c.FileTransferDir},
+		{"FILE_TRANSFER_MAX_SIZE_MB", strconv.Itoa(c.FileTransferMaxSizeMB)},
+		{"FILE_CHUNK_SIZE", strconv.Itoa(c.FileChunkSize)},
+		{"METRICS_PEER_STATS", strconv.FormatBool(c.MetricsPeerStats)},
+		{"BACKPLANE", c.Backplane},
+		{"REDIS_URL", RedactURL(c.RedisURL)},
+		{"BACKPLANE_PREFIX", c.BackplanePrefix},
+		{"BACKPLANE_SYNC_TIMEOUT", c.BackplaneSyncTimeout.String()},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout.String()},
+		{"DRAIN_TIMEOUT", c.DrainTimeout.String()},
+		{"WS_CLOSE_HANDSHAKE", strconv.FormatBool(c.CloseHandshake)},
+		{"WS_CLOSE_TIMEOUT", c.CloseHandshakeTimeout.String()},
+		{"READ_TIMEOUT", c.ReadTimeout.String()},
+		{"PING_INTERVAL", c.PingInterval.String()},
+		{"WRITE_TIMEOUT", c.WriteTimeout.String()},
+		{"BROADCAST_WORKERS", strconv.Itoa(c.BroadcastWorkers)},
+		{"BROADCAST_WRITE_TIMEOUT", c.BroadcastWriteTimeout.String()},
+		{"IDLE_WARNING_BEFORE", c.IdleWarningBefore.String()},
+		{"NO_OFFER_TIMEOUT", c.NoOfferTimeout.String()},
+		{"KEYFRAME_INTERVAL", c.KeyframeInterval.String()},
+		{"CORS_ALLOWED_ORIGINS", strings.Join(c.CORSAllowedOrigins, ",")},
+		{"CORS_ALLOWED_METHODS", strings.Join(c.CORSAllowedMethods, ",")},
+		{"CORS_ALLOWED_HEADERS", strings.Join(c.CORSAllowedHeaders, ",")},
+		{"TRUSTED_PROXIES", joinCIDRs(c.TrustedProxies)},
+		{"ACCEPT_RATE", strconv.FormatFloat(c.AcceptRate, 'g', -1, 64)},
+		{"ACCEPT_QUEUE", strconv.Itoa(c.AcceptQueue)},
+		{"MAX_CLIENTS", strconv.Itoa(c.MaxClients)},
+		{"CONNECT_RATE_PER_IP", strconv.FormatFloat(c.ConnectRatePerIP, 'g', -1, 64)},
+		{"CONNECT_BURST_PER_IP", strconv.Itoa(c.ConnectBurstPerIP)},
+		{"CLIENT_SHARDS", strconv.Itoa(c.ClientShards)},
+		{"MAX_CONNECTIONS_PER_IP", strconv.Itoa(c.MaxConnectionsPerIP)},
+		{"MAX_ROOMS_PER_USER", strconv.Itoa(c.MaxRoomsPerUser)},
+		{"MESSAGE_RATE", strconv.FormatFloat(c.MessageRate, 'g', -1, 64)},
+		{"MESSAGE_BURST", strconv.Itoa(c.MessageBurst)},
+		{"MAX_PEER_CONNECTIONS", strconv.Itoa(c.MaxPeerConnections)},
+		{"RETRY_AFTER", c.RetryAfter.String()},
+		{"RETRY_AFTER_MAX", c.RetryAfterMax.String()},
+		{"ICE_RECOVERY", strconv.FormatBool(c.ICERecovery)},
+		{"ICE_RECOVERY_MAX_ATTEMPTS", strconv.Itoa(c.ICERecoveryMaxAttempts)},
+		{"ICE_RECOVERY_BACKOFF", c.ICERecoveryBackoff.String()},
+		{"ICE_FAILURE_LIMIT", strconv.Itoa(c.ICEFailureLimit)},
+		{"ICE_FAILURE_WINDOW", c.ICEFailureWindow.String()},
+		{"MAX_DATA_CHANNELS", strconv.Itoa(c.MaxDataChannels)},
+		{"DATA_CHANNEL_COMPRESS_MIN", strconv.Itoa(c.DataChannelCompressMin)},
+		{"TURN_URL_TEMPLATES", strings.Join(c.TURNURLTemplates, ",")},
+		{"TURN_USERNAME", c.TURNUsername},
+		{"TURN_CREDENTIAL", redact(c.TURNCredential)},
+		{"TURN_SECRET", redact(c.TURNSecret)},
+		{"TURN_CREDENTIAL_TTL", c.TURNCredentialTTL.String()},
+		{"TURN_TCP_FALLBACK", strconv.FormatBool(c.TURNTCPFallback)},
+		{"TURN_TCP_FALLBACK_TIMEOUT", c.TURNTCPFallbackTimeout.String()},
+		{"TURN_TCP_URLS", strings.Join(c.TURNTCPURLs, ",")},
+		{"TCP_RELAY_LIMIT", strconv.Itoa(c.TCPRelayLimit)},
+		{"TURN_TCP_SECONDARY_URLS", strings.Join(c.TURNTCPSecondaryURLs, ",")},
+		{"TURN_SERVER_PORT", strconv.Itoa(c.TURNServerPort)},
+		{"TURN_SERVER_PUBLIC_IP", c.TURNServerPublicIP},
+		{"TURN_SERVER_HOST", c.TURNServerHost},
+		{"TURN_SERVER_REALM", c.TURNServerRealm},
+		{"TURN_SERVER_RELAY_MIN_PORT", strconv.Itoa(c.TURNServerRelayMinPort)},
+		{"TURN_SERVER_RELAY_MAX_PORT", strconv.Itoa(c.TURNServerRelayMaxPort)},
+		{"QUALITY_INTERVAL", c.QualityInterval.String()},
+		{"QUALITY_HYSTERESIS", strconv.FormatFloat(c.QualityHysteresis, 'g', -1, 64)},
+		{"SIGNALING_MODE", c.SignalingMode},
+		{"SFU_MAX_ROOM_MEMBERS", strconv.Itoa(c.SFUMaxRoomMembers)},
+		{"MAX_PUBLISHERS_PER_ROOM", strconv.Itoa(c.MaxPublishersPerRoom)},
+		{"MAX_RENEGOTIATIONS", strconv.Itoa(c.MaxRenegotiations)},
+		{"BUNDLE_POLICY", c.BundlePolicy},
+		{"MAX_VIDEO_WIDTH", strconv.Itoa(c.MaxVideoWidth)},
+		{"MAX_VIDEO_HEIGHT", strconv.Itoa(c.MaxVideoHeight)},
+		{"SCHEMA_VALIDATION", strconv.FormatBool(c.SchemaValidation)},
+		{"MAX_CANDIDATES", strconv.Itoa(c.MaxCandidates)},
+		{"OPUS_FEC", strconv.FormatBool(c.OpusFEC)},
+		{"OPUS_DTX", strconv.FormatBool(c.OpusDTX)},
+		{"OPUS_MAX_AVERAGE_BITRATE", strconv.Itoa(c.OpusMaxAverageBitrate)},
+		{"MAX_MESSAGE_SIZE", strconv.FormatInt(c.MaxMessageSize, 10)},
+		{"SRTP_PROFILES", strings.Join(c.SRTPProfiles, ",")},
+		{"VIDEO_CODECS", strings.Join(c.VideoCodecs, ",")},
+		{"AUDIO_CODECS", strings.Join(c.AudioCodecs, ",")},
+		{"VIDEO_RTCP_FEEDBACK", strings.Join(c.VideoRTCPFeedback, ",")},
+		{"REQUIRE_COMMON_CODEC", strconv.FormatBool(c.RequireCommonCodec)},
+		{"SETUP_TIMEOUT", c.SetupTimeout.String()},
+		{"ANSWER_CANDIDATE_DELAY", c.AnswerCandidateDelay.String()},
+		{"NON_TRICKLE", strconv.FormatBool(c.NonTrickle)},
+		{"ANSWER_MAX_CANDIDATES", strconv.Itoa(c.AnswerMaxCandidates)},
+		{"ANSWER_MAX_SIZE", strconv.Itoa(c.AnswerMaxSize)},
+		{"BWE_REPORT_INTERVAL", c.BWEReportInterval.String()},
+		{"BWE_INITIAL_BITRATE", strconv.Itoa(c.BWEInitialBitrate)},
+		{"CONGESTION_CONTROL", strconv.FormatBool(c.CongestionControl)},
+		{"ACTIVE_SPEAKER_INTERVAL", c.ActiveSpeakerInterval.String()},
+		{"ACTIVE_SPEAKER_THRESHOLD", strconv.Itoa(c.ActiveSpeakerThreshold)},
+		{"ACTIVE_SPEAKER_DEBOUNCE", c.ActiveSpeakerDebounce.String()},
+		{"ICE_UDP_PORT", strconv.Itoa(c.ICEUDPPort)},
+		{"TEST_ICE_UFRAG", c.TestICEUfrag},
+		{"TEST_ICE_PWD", redact(c.TestICEPwd)},
+		{"TLS_CERT_FILE", c.TLSCertFile},
+		{"TLS_KEY_FILE", c.TLSKeyFile},
+		{"TLS_MIN_VERSION", c.TLSMinVersion},
+		{"TLS_CIPHER_SUITES", strings.Join(c.TLSCipherSuites, ",")},
+		{"TLS_AUTOCERT_DOMAINS", strings.Join(c.TLSAutocertDomains, ",")},
+		{"TLS_AUTOCERT_CACHE", c.TLSAutocertCache},
+		{"TLS_AUTOCERT_EMAIL", c.TLSAutocertEmail},
+		{"TENANTS", strings.Join(c.Tenants, ",")},
+		{"AUTH_MODE", c.AuthMode},
+		{"AUTH_PSK", redact(c.AuthPSK)},
+		{"AUTH_TOKEN_SECRET", redact(c.AuthTokenSecret)},
+		{"AUTH_API_KEYS", redactAPIKeys(c.AuthAPIKeys)},
+		{"WS_ALLOWED_ORIGINS", strings.Join(c.WSAllowedOrigins, ",")},
+		{"PRE_AUTH_MODE", c.PreAuthMode},
+		{"PRE_AUTH_BUFFER", strconv.Itoa(c.PreAuthBuffer)},
+		{"ADMIN_TOKEN", redact(c.AdminToken)},
+		{"PPROF_ENABLED", strconv.FormatBool(c.PprofEnabled)},
+		{"LOG_STREAM_BUFFER", strconv.Itoa(c.LogStreamBuffer)},
+		{"LOG_STREAM_DROP", c.LogStreamDrop},
+		{"EVENT_HISTORY", strconv.Itoa(c.EventHistory)},
+		{"EVENT_BUFFER", strconv.Itoa(c.EventBuffer)},
+		{"EVENT_HEARTBEAT", c.EventHeartbeat.String()},
+		{"WEBHOOK_URL", strings.Join(c.WebhookURLs, ",")},
+		{"WEBHOOK_TIMEOUT", c.WebhookTimeout.String()},
+		{"WEBHOOK_EVENTS", strings.Join(c.WebhookEvents, ",")},
+		{"WEBHOOK_SECRET", redact(c.WebhookSecret)},
+		{"WEBHOOK_RETRIES", strconv.Itoa(c.WebhookRetries)},
+		{"WEBHOOK_RETRY_BACKOFF", c.WebhookRetryBackoff.String()},
+	}
+}
+
+// Reload заново читает те же файл, окружение и флаги
+func (c Config) Reload() Config {
+	return Load(c.ConfigFile, c.flags)
+}
+
+// ICEServersKey — откуда взят список ICE-серверов: ключ, под которым
+// Validate сообщает о его ошибках
+func (c Config) ICEServersKey() string {
+	return c.iceServersKey
+}
+
+// LogEffective пишет в лог действующие настройки, секреты скрыты
+func (c Config) LogEffective() {
+	for _, kv := range c.effective() {
+		log.Printf("Config %s=%s", kv[0], kv[1])
+	}
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "<redacted>"
+}
+
+// validRedisURL проверяет REDIS_URL так же, как его разбирает backplane:
+// схема redis или rediss, хост и необязательный номер базы в пути
+func validRedisURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+		return false
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if n, err := strconv.Atoi(db); err != nil || n < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RedactURL скрывает пароль в URL
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redact(raw)
+	}
+	return u.Redacted()
+}
+
+// redactAPIKeys оставляет от ключей API только пользователей
+func redactAPIKeys(entries []string) string {
+	users := make([]string, len(entries))
+	for i, entry := range entries {
+		user, _, _ := strings.Cut(entry, ":")
+		users[i] = user + ":" + redact("key")
+	}
+	return strings.Join(users, ",")
+}
+
+func (c Config) similarKey(name string) string {
+	for _, kv := range c.effective() {
+		if name == kv[0] {
+			return ""
+		}
+	}
+	for _, kv := range c.effective() {
+		if d := editDistance(name, kv[0]); d > 0 && d <= 2 {
+			return kv[0]
+		}
+	}
+	return ""
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// lookup возвращает значение настройки из флага или, если флаг не
+// задан, из окружения
+func (c *Config) lookup(key string) (string, bool) {
+	if v, ok := c.flags[key]; ok {
+		return v, true
+	}
+	return os.LookupEnv(key)
+}
+
+func (c *Config) envString(key, def string) string {
+	if v, ok := c.lookup(key); ok {
+		return v
+	}
+	return def
+}
+
+func (c *Config) envBool(key string, def bool) bool {
+	v, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		c.parseError(key, v, "a boolean")
+		return def
+	}
+	return b
+}
+
+func (c *Config) envInt(key string, def int) int {
+	v, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		c.parseError(key, v, "an integer")
+		return def
+	}
+	return n
+}
+
+func (c *Config) envFloat(key string, def float64) float64 {
+	v, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		c.parseError(key, v, "a number")
+		return def
+	}
+	return f
+}
+
+func (c *Config) envDuration(key string, def time.Duration) time.Duration {
+	v, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		c.parseError(key, v, "a duration like 5s")
+		return def
+	}
+	return d
+}
+
+// envList разбирает список через запятую, пустые элементы отбрасываются
+func (c *Config) envList(key string, def []string) []string {
+	v, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envCIDRs разбирает список сетей; одиночный адрес считается /32 или /128
+func (c *Config) envCIDRs(key string, def []*net.IPNet) []*net.IPNet {
+	items := c.envList(key, nil)
+	if items == nil {
+		return def
+	}
+	var nets []*net.IPNet
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				c.parseError(key, item, "an IP address or CIDR")
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			c.parseError(key, item, "an IP address or CIDR")
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func joinCIDRs(nets []*net.IPNet) string {
+	list := make([]string, len(nets))
+	for i, n := range nets {
+		list[i] = n.String()
+	}
+	return strings.Join(list, ",")
+}
+
+// envICEServers разбирает список ICE-серверов в формате iceServers
+// файла конфигурации
+func (c *Config) envICEServers(key string, def []webrtc.ICEServer) []webrtc.ICEServer {
+	v, ok := c.lookup(key)
+	if !ok {
+		return def
+	}
+	var servers []webrtc.ICEServer
+	if err := json.Unmarshal([]byte(v), &servers); err != nil {
+		c.parseError(key, v, "a JSON array of ICE servers")
+		return def
+	}
+	c.iceServersKey = key
+	return servers
+}
+
+func (c *Config) parseError(key, value, want string) {
+	c.parseErrors = append(c.parseErrors, Problem{
+		Key:     key,
+		Message: fmt.Sprintf("%q is not %s", value, want),
+		Fatal:   true,
+	})
+}
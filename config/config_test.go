@@ -0,0 +1,170 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fatalKeys — ключи фатальных проблем из Validate
+func fatalKeys(c Config) []string {
+	var keys []string
+	for _, p := range c.Validate() {
+		if p.Fatal {
+			keys = append(keys, p.Key)
+		}
+	}
+	return keys
+}
+
+func hasKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `{
+		"iceServers": [{"urls": ["stun:stun.example.com:3478"]}],
+		"listenAddr": ":9999",
+		"readTimeout": "40s",
+		"pingInterval": "10s",
+		"corsAllowedOrigins": ["https://example.com"]
+	}`)
+	c := Load(path, nil)
+	if keys := fatalKeys(c); len(keys) != 0 {
+		t.Fatalf("valid file: fatal problems %v", keys)
+	}
+	if c.ListenAddr != ":9999" {
+		t.Errorf("ListenAddr = %q, want :9999", c.ListenAddr)
+	}
+	if c.ReadTimeout != 40*time.Second || c.PingInterval != 10*time.Second {
+		t.Errorf("timeouts = %s/%s, want 40s/10s", c.ReadTimeout, c.PingInterval)
+	}
+	if len(c.ICEServers) != 1 || c.ICEServers[0].URLs[0] != "stun:stun.example.com:3478" {
+		t.Errorf("ICEServers = %+v", c.ICEServers)
+	}
+	if len(c.CORSAllowedOrigins) != 1 || c.CORSAllowedOrigins[0] != "https://example.com" {
+		t.Errorf("CORSAllowedOrigins = %v", c.CORSAllowedOrigins)
+	}
+	// Незаданные в файле поля остаются по умолчанию
+	if def := Default(); c.WriteTimeout != def.WriteTimeout {
+		t.Errorf("WriteTimeout = %s, want default %s", c.WriteTimeout, def.WriteTimeout)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"missing", filepath.Join(t.TempDir(), "absent.json"), "no such file"},
+		{"malformed", writeConfig(t, `{"listenAddr": ":9999",`), "unexpected end"},
+		{"wrong type", writeConfig(t, `{"listenAddr": 9999}`), "cannot unmarshal"},
+		{"bad duration", writeConfig(t, `{"readTimeout": 30}`), "duration must be a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Load(tt.path, nil)
+			var found bool
+			for _, p := range c.Validate() {
+				if p.Key == "WEBRTC_CONFIG" && p.Fatal && strings.Contains(p.Message, tt.want) {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("no fatal WEBRTC_CONFIG problem containing %q in %v", tt.want, c.Validate())
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `{"listenAddr": ":1000", "readTimeout": "40s", "pingInterval": "10s"}`)
+
+	c := Load(path, nil)
+	if c.ListenAddr != ":1000" {
+		t.Fatalf("file: ListenAddr = %q", c.ListenAddr)
+	}
+
+	t.Setenv("LISTEN_ADDR", ":2000")
+	t.Setenv("READ_TIMEOUT", "50s")
+	c = Load(path, nil)
+	if c.ListenAddr != ":2000" || c.ReadTimeout != 50*time.Second {
+		t.Fatalf("env over file: ListenAddr = %q, ReadTimeout = %s", c.ListenAddr, c.ReadTimeout)
+	}
+	if c.PingInterval != 10*time.Second {
+		t.Fatalf("env must not touch PingInterval from file, got %s", c.PingInterval)
+	}
+
+	c = Load(path, map[string]string{"LISTEN_ADDR": ":3000"})
+	if c.ListenAddr != ":3000" {
+		t.Fatalf("flag over env: ListenAddr = %q", c.ListenAddr)
+	}
+	if c.ReadTimeout != 50*time.Second {
+		t.Fatalf("flag must not touch READ_TIMEOUT from env, got %s", c.ReadTimeout)
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := writeConfig(t, `{"listenAddr": ":4000"}`)
+	t.Setenv("WEBRTC_CONFIG", path)
+	if c := Load("", nil); c.ListenAddr != ":4000" {
+		t.Fatalf("ListenAddr = %q, want :4000 from WEBRTC_CONFIG file", c.ListenAddr)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	if keys := fatalKeys(Default()); len(keys) != 0 {
+		t.Fatalf("Default: fatal problems %v", keys)
+	}
+	tests := []struct {
+		key    string
+		modify func(*Config)
+	}{
+		{"SHUTDOWN_TIMEOUT", func(c *Config) { c.ShutdownTimeout = 0 }},
+		{"LOG_LEVEL", func(c *Config) { c.LogLevel = "verbose" }},
+		{"LOG_FORMAT", func(c *Config) { c.LogFormat = "xml" }},
+		{"SESSION_RESUME_GRACE", func(c *Config) { c.SessionResumeGrace = -time.Second }},
+		{"READ_TIMEOUT", func(c *Config) { c.ReadTimeout = 0 }},
+		{"PING_INTERVAL", func(c *Config) { c.PingInterval = c.ReadTimeout }},
+		{"REDIS_URL", func(c *Config) { c.Backplane = "redis"; c.RedisURL = "redis://localhost:6379/cache" }},
+		{"CLIENT_SHARDS", func(c *Config) { c.ClientShards = 0 }},
+		{"MAX_PUBLISHERS_PER_ROOM", func(c *Config) { c.MaxPublishersPerRoom = -1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			c := Default()
+			tt.modify(&c)
+			if keys := fatalKeys(c); !hasKey(keys, tt.key) {
+				t.Fatalf("fatal problems %v, want %s", keys, tt.key)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEnvParseErrors(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "soon")
+	t.Setenv("PPROF_ENABLED", "maybe")
+	keys := fatalKeys(Load("", nil))
+	for _, key := range []string{"READ_TIMEOUT", "PPROF_ENABLED"} {
+		if !hasKey(keys, key) {
+			t.Errorf("fatal problems %v, want %s", keys, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"flag"
+)
+
+// Флаги командной строки и настройки, которые они задают. Значение
+// флага разбирается так же, как переменная окружения с тем же ключом.
+var configFlagKeys = []struct {
+	name, key, usage string
+}{
+	{"listen", "LISTEN_ADDR", "listen address, e.g. :8080"},
+	{"admin-listen", "ADMIN_LISTEN_ADDR", "separate listen address for admin endpoints, e.g. 127.0.0.1:9090"},
+	{"http-redirect", "HTTP_REDIRECT_ADDR", "plain HTTP address redirecting to HTTPS, e.g. :80"},
+	{"grpc-listen", "GRPC_LISTEN_ADDR", "listen address for gRPC signaling, e.g. :9000"},
+	{"tls-cert", "TLS_CERT_FILE", "TLS certificate file, enables HTTPS/WSS"},
+	{"tls-key", "TLS_KEY_FILE", "TLS private key file"},
+	{"tls-autocert", "TLS_AUTOCERT_DOMAINS", "comma-separated domains to get Let's Encrypt certificates for"},
+	{"tls-autocert-cache", "TLS_AUTOCERT_CACHE", "directory for Let's Encrypt certificates"},
+	{"ice-servers", "ICE_SERVERS", `ICE servers as JSON, e.g. [{"urls":["stun:stun.example.com:3478"]}]`},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "how long to wait for clients on shutdown"},
+	{"read-timeout", "READ_TIMEOUT", "close connections silent for this long"},
+	{"ping-interval", "PING_INTERVAL", "WebSocket ping interval"},
+	{"write-timeout", "WRITE_TIMEOUT", "timeout for a single message write"},
+	{"cors-origins", "CORS_ALLOWED_ORIGINS", "comma-separated allowed CORS origins"},
+	{"log-level", "LOG_LEVEL", "log level: debug, info, warn or error"},
+	{"log-format", "LOG_FORMAT", "log format: json or text"},
+}
+
+// RegisterFlags регистрирует флаги настроек. Возвращаемая функция
+// после flag.Parse отдает только явно заданные флаги, чтобы остальные
+// не перекрывали окружение и файл.
+func RegisterFlags(fs *flag.FlagSet) func() map[string]string {
+	values := make(map[string]*string, len(configFlagKeys))
+	keys := make(map[string]string, len(configFlagKeys))
+	for _, f := range configFlagKeys {
+		values[f.name] = fs.String(f.name, "", f.usage+" (env "+f.key+")")
+		keys[f.name] = f.key
+	}
+	return func() map[string]string {
+		set := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) {
+			if key, ok := keys[f.Name]; ok {
+				set[key] = *values[f.Name]
+			}
+		})
+		return set
+	}
+}
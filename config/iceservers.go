@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pion/stun"
+	"github.com/pion/webrtc/v3"
+)
+
+var defaultICEServers = []webrtc.ICEServer{
+	{URLs: []string{"stun:stun.l.google.com:19302"}},
+}
+
+// Переменные, доступные в шаблонах TURN_URL_TEMPLATES, и их вхождения
+var (
+	TURNTemplateVars  = []string{"region", "clientId"}
+	TURNTemplateVarRe = regexp.MustCompile(`\{([^{}]*)\}`)
+)
+
+// validateTURNTemplate проверяет схему и имена переменных шаблона
+func validateTURNTemplate(tmpl string) error {
+	if !strings.HasPrefix(tmpl, "turn:") && !strings.HasPrefix(tmpl, "turns:") {
+		return fmt.Errorf("%q must start with turn: or turns:", tmpl)
+	}
+	for _, m := range TURNTemplateVarRe.FindAllStringSubmatch(tmpl, -1) {
+		if !slices.Contains(TURNTemplateVars, m[1]) {
+			return fmt.Errorf("%q uses unknown variable {%s}", tmpl, m[1])
+		}
+	}
+	if rest := TURNTemplateVarRe.ReplaceAllString(tmpl, ""); strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("%q has unbalanced braces", tmpl)
+	}
+	return nil
+}
+
+// validateTURNTCPURL допускает только turns: или turn: с transport=tcp
+func validateTURNTCPURL(tmpl string) error {
+	if err := validateTURNTemplate(tmpl); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(tmpl, "turns:") && !strings.Contains(tmpl, "transport=tcp") {
+		return fmt.Errorf("%q is not a TCP relay, use turns: or ?transport=tcp", tmpl)
+	}
+	return nil
+}
+
+// validateICEServer требует хотя бы один URL, а для TURN — логин и пароль
+func validateICEServer(server webrtc.ICEServer) error {
+	if len(server.URLs) == 0 {
+		return fmt.Errorf("no urls")
+	}
+	for _, raw := range server.URLs {
+		u, err := stun.ParseURI(raw)
+		if err != nil {
+			return fmt.Errorf("%q: %v", raw, err)
+		}
+		if u.Scheme != stun.SchemeTypeTURN && u.Scheme != stun.SchemeTypeTURNS {
+			continue
+		}
+		credential, _ := server.Credential.(string)
+		if server.Username == "" || credential == "" {
+			return fmt.Errorf("%q needs username and credential", raw)
+		}
+	}
+	return nil
+}
+
+// ICEServerURLs перечисляет URL серверов для лога, без учетных данных
+func ICEServerURLs(servers []webrtc.ICEServer) string {
+	var urls []string
+	for _, server := range servers {
+		urls = append(urls, server.URLs...)
+	}
+	return strings.Join(urls, ",")
+}
+
+// TURNHost — имя, по которому клиенты обращаются к встроенному TURN:
+// TURN_SERVER_HOST или публичный IP
+func (c Config) TURNHost() string {
+	if c.TURNServerHost != "" {
+		return c.TURNServerHost
+	}
+	return c.TURNServerPublicIP
+}
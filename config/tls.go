@@ -0,0 +1,52 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSEnabled — сервер работает по HTTPS/WSS
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.TLSAutocertDomains) > 0
+}
+
+// TLSConfig — версия и наборы шифров из уже проверенных настроек
+func (c Config) TLSConfig() *tls.Config {
+	config := &tls.Config{MinVersion: tlsVersions[c.TLSMinVersion]}
+	for _, name := range c.TLSCipherSuites {
+		id, _ := TLSCipherSuite(name)
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config
+}
+
+// TLSCipherSuite ищет набор по имени среди безопасных, которые знает Go
+func TLSCipherSuite(name string) (uint16, error) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name {
+			return s.ID, nil
+		}
+	}
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.Name == name {
+			return 0, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
+
+func validateTLSMinVersion(v string) error {
+	if _, ok := tlsVersions[v]; ok {
+		return nil
+	}
+	if strings.HasPrefix(v, "1.0") || strings.HasPrefix(v, "1.1") {
+		return fmt.Errorf("TLS %s is not allowed, use 1.2 or 1.3", v)
+	}
+	return fmt.Errorf("must be 1.2 or 1.3, got %q", v)
+}
@@ -0,0 +1,33 @@
+package config
+
+import "log/slog"
+
+// События вебхуков для WEBHOOK_EVENTS
+var WebhookEventTypes = []string{
+	"client-connected",
+	"client-disconnected",
+	"room-created",
+	"room-destroyed",
+	"recording-started",
+	"recording-finished",
+	"ice-failed",
+	"session-failed",
+}
+
+// Метка для арендаторов вне списка TENANTS: ограничивает число
+// различных значений в метриках
+const TenantOther = "other"
+
+// Пороговые значения оценки качества (0-100)
+const (
+	QualityPoorBelow     = 70
+	QualityCriticalBelow = 40
+)
+
+// ParseLogLevel разбирает debug, info, warn, error, а также смещения
+// вроде debug-4 (trace pion)
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
@@ -0,0 +1,197 @@
+// Package media — медиа сигнального сервера: кодеки, расширения
+// заголовка, интерсепторы и оценка полосы для webrtc.API pion, а также
+// преобразования SDP offer и answer.
+package media
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"sync"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/logging"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// RED (RFC 2198): избыточное аудио поверх Opus
+const MimeTypeRED = "audio/red"
+
+// Options — настройки медиа. Нулевые значения — как у pion.
+type Options struct {
+	Codecs Codecs
+	// audio-level (RFC 6464) во входящем звуке, для определения говорящего
+	AudioLevel bool
+	// Оценка полосы GCC по TWCC-отчетам клиента
+	BWE               bool
+	BWEInitialBitrate int
+	// Профили SRTP по именам SRTPProfiles, пусто — все
+	SRTPProfiles []string
+	// Один UDP-сокет ICE на все PeerConnection, 0 — свой на каждый
+	ICEUDPPort int
+	// Фиксированные ufrag и pwd ICE, только для тестовых стендов
+	TestICEUfrag  string
+	TestICEPwd    string
+	LoggerFactory logging.LoggerFactory
+}
+
+// API создает PeerConnection с медиа по Options
+type API struct {
+	api *webrtc.API
+	mux net.PacketConn
+
+	// cc-интерсептор отдает оценщик через callback, вызываемый прямо
+	// внутри NewPeerConnection. Создание PeerConnection сериализуется,
+	// чтобы оценщик достался своей сессии.
+	bweMu      sync.Mutex
+	bweCreated cc.BandwidthEstimator
+}
+
+func NewAPI(o Options) (*API, error) {
+	a := &API{}
+	m, err := newMediaEngine(o)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &interceptor.Registry{}
+	if err := o.Codecs.registerInterceptors(m, i); err != nil {
+		return nil, err
+	}
+	if o.BWE {
+		if err := a.registerBWE(m, i, o.BWEInitialBitrate); err != nil {
+			return nil, err
+		}
+	}
+
+	var se webrtc.SettingEngine
+	se.LoggerFactory = o.LoggerFactory
+	if len(o.SRTPProfiles) > 0 {
+		profiles := make([]dtls.SRTPProtectionProfile, len(o.SRTPProfiles))
+		for n, name := range o.SRTPProfiles {
+			profiles[n] = SRTPProfiles[name]
+		}
+		se.SetSRTPProtectionProfiles(profiles...)
+	}
+
+	// Один UDP-сокет на все PeerConnection: в firewall открывается один порт
+	if o.ICEUDPPort > 0 {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: o.ICEUDPPort})
+		if err != nil {
+			return nil, err
+		}
+		a.mux = conn
+		se.SetICEUDPMux(webrtc.NewICEUDPMux(nil, conn))
+		slog.Info("ICE UDP mux listening", "addr", conn.LocalAddr().String())
+	}
+
+	if o.TestICEUfrag != "" {
+		se.SetICECredentials(o.TestICEUfrag, o.TestICEPwd)
+		slog.Warn("fixed ICE credentials in use, test setups only", "ufrag", o.TestICEUfrag)
+	}
+
+	a.api = webrtc.NewAPI(
+		webrtc.WithMediaEngine(m),
+		webrtc.WithInterceptorRegistry(i),
+		webrtc.WithSettingEngine(se),
+	)
+	return a, nil
+}
+
+func newMediaEngine(o Options) (*webrtc.MediaEngine, error) {
+	m := &webrtc.MediaEngine{}
+	if err := o.Codecs.register(m); err != nil {
+		return nil, err
+	}
+	if err := registerSimulcastExtensions(m); err != nil {
+		return nil, err
+	}
+	if o.AudioLevel {
+		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, webrtc.RTPCodecTypeAudio); err != nil {
+			return nil, err
+		}
+	}
+	// RED без Opus не из чего собирать
+	if !o.Codecs.HasAudio("opus") {
+		return m, nil
+	}
+
+	// fmtp "111/111" — два блока Opus (PT 111) в одном пакете.
+	// Пакеты RED не распаковываются, а идут дальше как есть.
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    MimeTypeRED,
+			ClockRate:   48000,
+			Channels:    2,
+			SDPFmtpLine: "111/111",
+		},
+		PayloadType: 63,
+	}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// registerSimulcastExtensions включает расширения заголовка, по которым
+// pion сопоставляет слои simulcast их rid
+func registerSimulcastExtensions(m *webrtc.MediaEngine) error {
+	for _, uri := range []string{sdp.SDESMidURI, sdp.SDESRTPStreamIDURI, "urn:ietf:params:rtp-hdrext:sdes:repaired-rtp-stream-id"} {
+		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: uri}, webrtc.RTPCodecTypeVideo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerBWE подключает оценку полосы GCC по TWCC-отчетам клиента
+func (a *API) registerBWE(m *webrtc.MediaEngine, i *interceptor.Registry, initialBitrate int) error {
+	factory, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		return gcc.NewSendSideBWE(gcc.SendSideBWEInitialBitrate(initialBitrate))
+	})
+	if err != nil {
+		return err
+	}
+	factory.OnNewPeerConnection(func(_ string, estimator cc.BandwidthEstimator) {
+		a.bweCreated = estimator
+	})
+	i.Add(factory)
+	return webrtc.ConfigureTWCCHeaderExtensionSender(m, i)
+}
+
+// NewPeerConnection создает PeerConnection и, если оценка полосы
+// включена, возвращает его оценщик
+func (a *API) NewPeerConnection(config webrtc.Configuration) (*webrtc.PeerConnection, cc.BandwidthEstimator, error) {
+	a.bweMu.Lock()
+	defer a.bweMu.Unlock()
+	a.bweCreated = nil
+	pc, err := a.api.NewPeerConnection(config)
+	return pc, a.bweCreated, err
+}
+
+// Close закрывает общий UDP-сокет ICE
+func (a *API) Close() error {
+	if a.mux == nil {
+		return nil
+	}
+	return a.mux.Close()
+}
+
+// ice-char из RFC 8839: буквы, цифры, "+" и "/"
+var iceCharsRe = regexp.MustCompile(`^[A-Za-z0-9+/]*$`)
+
+// ValidateTestICECredentials проверяет длины ufrag/pwd по RFC 8839
+func ValidateTestICECredentials(ufrag, pwd string) error {
+	if len(ufrag) < 4 || len(ufrag) > 256 || !iceCharsRe.MatchString(ufrag) {
+		return fmt.Errorf("ufrag must be 4-256 ice-chars, got %q", ufrag)
+	}
+	if len(pwd) < 22 || len(pwd) > 256 || !iceCharsRe.MatchString(pwd) {
+		return fmt.Errorf("TEST_ICE_PWD must be 22-256 ice-chars")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package media
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// Порядок, в котором типы кандидатов попадают в урезанный answer:
+// relay работает почти везде, srflx — через большинство NAT, host —
+// только в одной сети с сервером
+var candidateTypeOrder = []string{"relay", "srflx", "prflx", "host"}
+
+type sdpCandidate struct {
+	attr      sdp.Attribute
+	component string
+	typ       string
+	priority  uint64
+}
+
+// parseSDPCandidate разбирает a=candidate:
+// "<foundation> <component> <transport> <priority> <addr> <port> typ <type> ..."
+func parseSDPCandidate(a sdp.Attribute) (sdpCandidate, bool) {
+	fields := strings.Fields(a.Value)
+	if len(fields) < 8 || fields[6] != "typ" {
+		return sdpCandidate{}, false
+	}
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return sdpCandidate{}, false
+	}
+	return sdpCandidate{attr: a, component: fields[1], typ: fields[7], priority: priority}, true
+}
+
+// pickCandidates оставляет не больше limit кандидатов одного компонента:
+// сначала лучший кандидат каждого типа в порядке candidateTypeOrder,
+// затем остальные по убыванию приоритета
+func pickCandidates(cands []sdpCandidate, limit int) []sdpCandidate {
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].priority > cands[j].priority })
+	picked := make([]sdpCandidate, 0, limit)
+	used := make([]bool, len(cands))
+	for _, typ := range candidateTypeOrder {
+		for i, c := range cands {
+			if len(picked) < limit && !used[i] && c.typ == typ {
+				picked = append(picked, c)
+				used[i] = true
+				break
+			}
+		}
+	}
+	for i, c := range cands {
+		if len(picked) < limit && !used[i] {
+			picked = append(picked, c)
+		}
+	}
+	return picked
+}
+
+// TrimCandidates оставляет не больше limit кандидатов на компонент
+// (0 — все) и возвращает, сколько осталось в самой большой группе
+func TrimCandidates(answer webrtc.SessionDescription, limit int) (webrtc.SessionDescription, int, error) {
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(answer.SDP)); err != nil {
+		return answer, 0, err
+	}
+
+	kept := 0
+
+	for _, m := range d.MediaDescriptions {
+		byComponent := make(map[string][]sdpCandidate)
+		var components []string
+		var rest []sdp.Attribute
+		for _, a := range m.Attributes {
+			c, ok := parseSDPCandidate(a)
+			if a.Key != "candidate" || !ok {
+				rest = append(rest, a)
+				continue
+			}
+			if byComponent[c.component] == nil {
+				components = append(components, c.component)
+			}
+			byComponent[c.component] = append(byComponent[c.component], c)
+		}
+		for _, comp := range components {
+			cands := byComponent[comp]
+			if limit > 0 {
+				cands = pickCandidates(cands, limit)
+			}
+			for _, c := range cands {
+				rest = append(rest, c.attr)
+			}
+			if len(cands) > kept {
+				kept = len(cands)
+			}
+		}
+		m.Attributes = rest
+	}
+
+	raw, err := d.Marshal()
+	if err != nil {
+		return answer, 0, err
+	}
+	answer.SDP = string(raw)
+	return answer, kept, nil
+}
@@ -0,0 +1,425 @@
+package media
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// codecSpec — кодек с payload type сервера; rtx 0 — без RTX. Payload
+// type те же, что у pion по умолчанию.
+type codecSpec struct {
+	mime string
+	fmtp string
+	pt   webrtc.PayloadType
+	rtx  webrtc.PayloadType
+}
+
+// Кодеки по именам VIDEO_CODECS и AUDIO_CODECS
+var codecSpecs = map[string][]codecSpec{
+	"vp8": {{webrtc.MimeTypeVP8, "", 96, 97}},
+	"vp9": {
+		{webrtc.MimeTypeVP9, "profile-id=0", 98, 99},
+		{webrtc.MimeTypeVP9, "profile-id=2", 100, 101},
+	},
+	"av1": {{webrtc.MimeTypeAV1, "", 45, 46}},
+	"h264-baseline": {
+		{webrtc.MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f", 102, 103},
+		{webrtc.MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42001f", 104, 105},
+	},
+	"h264-constrained-baseline": {
+		{webrtc.MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f", 106, 107},
+		{webrtc.MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42e01f", 108, 109},
+	},
+	"h264-main": {
+		{webrtc.MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=4d001f", 127, 125},
+		{webrtc.MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=4d001f", 39, 40},
+	},
+	"h264-high": {
+		{webrtc.MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=64001f", 112, 113},
+	},
+
+	"opus": {{webrtc.MimeTypeOpus, "minptime=10;useinbandfec=1", 111, 0}},
+	"g722": {{webrtc.MimeTypeG722, "", 9, 0}},
+	"pcmu": {{webrtc.MimeTypePCMU, "", 0, 0}},
+	"pcma": {{webrtc.MimeTypePCMA, "", 8, 0}},
+}
+
+// Наборы и порядок pion по умолчанию; "h264" — все профили H.264
+var (
+	h264Codecs         = []string{"h264-baseline", "h264-constrained-baseline", "h264-main", "h264-high"}
+	DefaultVideoCodecs = []string{"vp8", "h264-baseline", "h264-constrained-baseline", "h264-main", "av1", "vp9", "h264-high"}
+	DefaultAudioCodecs = []string{"opus", "g722", "pcmu", "pcma"}
+)
+
+// Обратная связь RTCP видео у pion по умолчанию; "none" выключает ее всю
+var DefaultVideoFeedback = []string{"goog-remb", "ccm fir", "nack", "nack pli", "transport-cc"}
+
+func ValidVideoCodec(name string) bool {
+	return name == "h264" || slices.Contains(DefaultVideoCodecs, name)
+}
+
+func ValidAudioCodec(name string) bool {
+	return slices.Contains(DefaultAudioCodecs, name)
+}
+
+// Codecs — набор кодеков сервера: имена видео- и аудиокодеков в порядке
+// предпочтения и обратная связь RTCP видео. nil — как у pion.
+type Codecs struct {
+	Video         []string
+	Audio         []string
+	VideoFeedback []string
+}
+
+// custom — набор кодеков или обратной связи отличается от pion
+func (c Codecs) custom() bool {
+	return c.Video != nil || c.Audio != nil || c.VideoFeedback != nil
+}
+
+// HasAudio — включен ли аудиокодек name
+func (c Codecs) HasAudio(name string) bool {
+	return c.Audio == nil || slices.Contains(c.Audio, name)
+}
+
+// enabledCodecs раскрывает имена из списка в кодеки по порядку
+func enabledCodecs(names, def []string) []codecSpec {
+	if names == nil {
+		names = def
+	}
+	var specs []codecSpec
+	for _, name := range names {
+		if name == "h264" {
+			for _, profile := range h264Codecs {
+				specs = append(specs, codecSpecs[profile]...)
+			}
+			continue
+		}
+		specs = append(specs, codecSpecs[name]...)
+	}
+	return specs
+}
+
+func (c Codecs) videoFeedback() []string {
+	switch {
+	case c.VideoFeedback == nil:
+		return DefaultVideoFeedback
+	case slices.Equal(c.VideoFeedback, []string{"none"}):
+		return nil
+	}
+	return c.VideoFeedback
+}
+
+func (c Codecs) hasVideoFeedback(fb string) bool {
+	return slices.Contains(c.videoFeedback(), fb)
+}
+
+// register регистрирует кодеки набора. nack и transport-cc добавляет
+// registerInterceptors вместе с их интерсепторами.
+func (c Codecs) register(m *webrtc.MediaEngine) error {
+	if !c.custom() {
+		return m.RegisterDefaultCodecs()
+	}
+	var feedback []webrtc.RTCPFeedback
+	for _, fb := range c.videoFeedback() {
+		if fb == "nack" || fb == "nack pli" || fb == "transport-cc" {
+			continue
+		}
+		typ, param, _ := strings.Cut(fb, " ")
+		feedback = append(feedback, webrtc.RTCPFeedback{Type: typ, Parameter: param})
+	}
+	for _, spec := range enabledCodecs(c.Video, DefaultVideoCodecs) {
+		if err := registerCodec(m, spec, webrtc.RTPCodecTypeVideo, feedback); err != nil {
+			return err
+		}
+	}
+	for _, spec := range enabledCodecs(c.Audio, DefaultAudioCodecs) {
+		if err := registerCodec(m, spec, webrtc.RTPCodecTypeAudio, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerCodec(m *webrtc.MediaEngine, c codecSpec, kind webrtc.RTPCodecType, feedback []webrtc.RTCPFeedback) error {
+	var clockRate uint32 = 90000
+	var channels uint16
+	switch c.mime {
+	case webrtc.MimeTypeOpus:
+		clockRate, channels = 48000, 2
+	case webrtc.MimeTypeG722, webrtc.MimeTypePCMU, webrtc.MimeTypePCMA:
+		clockRate = 8000
+	}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:     c.mime,
+			ClockRate:    clockRate,
+			Channels:     channels,
+			SDPFmtpLine:  c.fmtp,
+			RTCPFeedback: feedback,
+		},
+		PayloadType: c.pt,
+	}, kind); err != nil {
+		return err
+	}
+	if c.rtx == 0 {
+		return nil
+	}
+	return m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    "video/rtx",
+			ClockRate:   clockRate,
+			SDPFmtpLine: fmt.Sprintf("apt=%d", c.pt),
+		},
+		PayloadType: c.rtx,
+	}, kind)
+}
+
+// registerInterceptors — RegisterDefaultInterceptors pion, но NACK и
+// TWCC только если они есть в обратной связи видео
+func (c Codecs) registerInterceptors(m *webrtc.MediaEngine, i *interceptor.Registry) error {
+	if !c.custom() {
+		return webrtc.RegisterDefaultInterceptors(m, i)
+	}
+	if c.hasVideoFeedback("nack") || c.hasVideoFeedback("nack pli") {
+		generator, err := nack.NewGeneratorInterceptor()
+		if err != nil {
+			return err
+		}
+		responder, err := nack.NewResponderInterceptor()
+		if err != nil {
+			return err
+		}
+		for _, fb := range []string{"nack", "nack pli"} {
+			if c.hasVideoFeedback(fb) {
+				typ, param, _ := strings.Cut(fb, " ")
+				m.RegisterFeedback(webrtc.RTCPFeedback{Type: typ, Parameter: param}, webrtc.RTPCodecTypeVideo)
+			}
+		}
+		i.Add(responder)
+		i.Add(generator)
+	}
+	if err := webrtc.ConfigureRTCPReports(i); err != nil {
+		return err
+	}
+	if c.hasVideoFeedback("transport-cc") {
+		return webrtc.ConfigureTWCCSender(m, i)
+	}
+	return nil
+}
+
+// offeredCodecs — MIME-типы кодеков m-секции, без RTX, RED и FEC
+func offeredCodecs(m *sdp.MediaDescription) []string {
+	var codecs []string
+	for _, a := range m.Attributes {
+		if a.Key != "rtpmap" {
+			continue
+		}
+		// "<pt> <name>/<clock rate>[/<channels>]"
+		_, rest, _ := strings.Cut(a.Value, " ")
+		name, _, _ := strings.Cut(rest, "/")
+		switch strings.ToLower(name) {
+		case "rtx", "red", "ulpfec", "flexfec-03":
+			continue
+		}
+		mime := m.MediaName.Media + "/" + name
+		if !slices.Contains(codecs, mime) {
+			codecs = append(codecs, mime)
+		}
+	}
+	return codecs
+}
+
+// supportsMime — есть ли кодек с таким MIME среди включенных. pion
+// сопоставляет кодеки так же: при несовпадении fmtp — по MIME.
+func supportsMime(specs []codecSpec, mime string) bool {
+	for _, c := range specs {
+		if strings.EqualFold(c.mime, mime) {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingCommon ищет в offer аудио- или видеосекцию без единого кодека
+// набора и описывает ее. "" — все в порядке или offer не разобрался
+// (его отвергнет pion).
+func (c Codecs) MissingCommon(raw string) string {
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(raw)); err != nil {
+		return ""
+	}
+	for n, m := range d.MediaDescriptions {
+		var names, def []string
+		switch m.MediaName.Media {
+		case "video":
+			names, def = c.Video, DefaultVideoCodecs
+		case "audio":
+			names, def = c.Audio, DefaultAudioCodecs
+		default:
+			continue
+		}
+		if names == nil {
+			names = def
+		}
+		// Отклоненная секция (порт 0) кодеков не требует
+		if m.MediaName.Port.Value == 0 {
+			continue
+		}
+		specs := enabledCodecs(names, nil)
+		offered := offeredCodecs(m)
+		if slices.ContainsFunc(offered, func(mime string) bool { return supportsMime(specs, mime) }) {
+			continue
+		}
+		mid, _ := m.Attribute("mid")
+		slices.Sort(offered)
+		return fmt.Sprintf("%s section %d (mid %s) offers %s, server supports %s",
+			m.MediaName.Media, n, mid, strings.Join(offered, ","), strings.Join(names, ","))
+	}
+	return ""
+}
+
+// ApplyPreferences задает трансиверам порядок кодеков в answer по
+// набору: pion иначе сохраняет порядок offer. Вызывается после
+// SetRemoteDescription, payload type берутся из offer.
+func (c Codecs) ApplyPreferences(pc *webrtc.PeerConnection, offer string) {
+	if c.Video == nil && c.Audio == nil {
+		return
+	}
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(offer)); err != nil {
+		return
+	}
+	sections := make(map[string]*sdp.MediaDescription)
+	for _, m := range d.MediaDescriptions {
+		if mid, ok := m.Attribute("mid"); ok {
+			sections[mid] = m
+		}
+	}
+	for _, t := range pc.GetTransceivers() {
+		m := sections[t.Mid()]
+		if m == nil {
+			continue
+		}
+		specs := enabledCodecs(c.Video, DefaultVideoCodecs)
+		if t.Kind() == webrtc.RTPCodecTypeAudio {
+			specs = enabledCodecs(c.Audio, DefaultAudioCodecs)
+		}
+		if prefs := codecPreferences(m, specs, c.feedback(t.Kind())); len(prefs) > 0 {
+			if err := t.SetCodecPreferences(prefs); err != nil {
+				slog.Warn("codec preferences error", "mid", t.Mid(), "err", err)
+			}
+		}
+	}
+}
+
+// feedback — обратная связь, с которой register и registerInterceptors
+// регистрируют кодеки типа kind. pion берет rtcp-fb answer из
+// предпочтений, поэтому она нужна и в них.
+func (c Codecs) feedback(kind webrtc.RTPCodecType) []webrtc.RTCPFeedback {
+	var feedback []webrtc.RTCPFeedback
+	for _, fb := range c.videoFeedback() {
+		if kind == webrtc.RTPCodecTypeAudio && fb != "transport-cc" {
+			continue
+		}
+		typ, param, _ := strings.Cut(fb, " ")
+		feedback = append(feedback, webrtc.RTCPFeedback{Type: typ, Parameter: param})
+	}
+	return feedback
+}
+
+// codecPreferences — кодеки секции offer в порядке specs, каждый со
+// своим RTX
+func codecPreferences(m *sdp.MediaDescription, specs []codecSpec, feedback []webrtc.RTCPFeedback) []webrtc.RTPCodecParameters {
+	var d sdp.SessionDescription
+	d.MediaDescriptions = []*sdp.MediaDescription{m}
+	codecs := make(map[webrtc.PayloadType]sdp.Codec)
+	rtx := make(map[webrtc.PayloadType]sdp.Codec)
+	for _, f := range m.MediaName.Formats {
+		pt, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			continue
+		}
+		codec, err := d.GetCodecForPayloadType(uint8(pt))
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(codec.Name, "rtx") {
+			if apt, ok := strings.CutPrefix(codec.Fmtp, "apt="); ok {
+				if n, err := strconv.ParseUint(apt, 10, 8); err == nil {
+					rtx[webrtc.PayloadType(n)] = codec
+				}
+			}
+			continue
+		}
+		codecs[webrtc.PayloadType(pt)] = codec
+	}
+
+	order := func(codec sdp.Codec) int {
+		mime := m.MediaName.Media + "/" + codec.Name
+		// Сначала точное совпадение fmtp, затем по MIME
+		for n, c := range specs {
+			if strings.EqualFold(c.mime, mime) && c.fmtp == codec.Fmtp {
+				return n
+			}
+		}
+		for n, c := range specs {
+			if strings.EqualFold(c.mime, mime) {
+				return len(specs) + n
+			}
+		}
+		return -1
+	}
+	// Как и pion, совпавшие только по MIME берутся, лишь если точных нет
+	exact := false
+	for _, codec := range codecs {
+		if n := order(codec); n >= 0 && n < len(specs) {
+			exact = true
+		}
+	}
+	var pts []webrtc.PayloadType
+	for pt, codec := range codecs {
+		if n := order(codec); n >= 0 && (!exact || n < len(specs)) {
+			pts = append(pts, pt)
+		}
+	}
+	slices.SortFunc(pts, func(a, b webrtc.PayloadType) int {
+		if oa, ob := order(codecs[a]), order(codecs[b]); oa != ob {
+			return oa - ob
+		}
+		return int(a) - int(b)
+	})
+
+	var prefs []webrtc.RTPCodecParameters
+	for _, pt := range pts {
+		codec := codecParameters(m.MediaName.Media, pt, codecs[pt])
+		codec.RTCPFeedback = feedback
+		prefs = append(prefs, codec)
+		if r, ok := rtx[pt]; ok {
+			prefs = append(prefs, codecParameters(m.MediaName.Media, webrtc.PayloadType(r.PayloadType), r))
+		}
+	}
+	return prefs
+}
+
+func codecParameters(media string, pt webrtc.PayloadType, c sdp.Codec) webrtc.RTPCodecParameters {
+	var channels uint16
+	if n, err := strconv.ParseUint(c.EncodingParameters, 10, 16); err == nil {
+		channels = uint16(n)
+	}
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    media + "/" + c.Name,
+			ClockRate:   c.ClockRate,
+			Channels:    channels,
+			SDPFmtpLine: c.Fmtp,
+		},
+		PayloadType: pt,
+	}
+}
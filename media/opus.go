@@ -0,0 +1,77 @@
+package media
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// Допустимый maxaveragebitrate по RFC 7587
+const (
+	opusMinBitrate = 6000
+	opusMaxBitrate = 510000
+)
+
+// OpusParams — параметры fmtp Opus, которые сервер просит у отправителя
+// аудио в answer (RFC 7587). MaxAverageBitrate 0 — не указывать.
+type OpusParams struct {
+	FEC               bool
+	DTX               bool
+	MaxAverageBitrate int
+}
+
+// ValidateOpusBitrate проверяет maxaveragebitrate, 0 — не указан
+func ValidateOpusBitrate(bps int) error {
+	if bps != 0 && (bps < opusMinBitrate || bps > opusMaxBitrate) {
+		return fmt.Errorf("maxaveragebitrate must be %d-%d, got %d", opusMinBitrate, opusMaxBitrate, bps)
+	}
+	return nil
+}
+
+// ApplyOpusParams прописывает параметры в fmtp всех форматов Opus answer'а
+func ApplyOpusParams(answer webrtc.SessionDescription, p OpusParams) (webrtc.SessionDescription, error) {
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(answer.SDP)); err != nil {
+		return answer, err
+	}
+
+	for _, m := range d.MediaDescriptions {
+		if m.MediaName.Media != "audio" {
+			continue
+		}
+		for _, pt := range m.MediaName.Formats {
+			n, err := strconv.Atoi(pt)
+			if err != nil {
+				continue
+			}
+			codec, err := d.GetCodecForPayloadType(uint8(n))
+			if err != nil || !strings.EqualFold(codec.Name, "opus") {
+				continue
+			}
+			setFmtpParam(m, pt, "useinbandfec", boolParam(p.FEC))
+			if p.DTX {
+				setFmtpParam(m, pt, "usedtx", 1)
+			}
+			if p.MaxAverageBitrate > 0 {
+				setFmtpParam(m, pt, "maxaveragebitrate", p.MaxAverageBitrate)
+			}
+		}
+	}
+
+	raw, err := d.Marshal()
+	if err != nil {
+		return answer, err
+	}
+	answer.SDP = string(raw)
+	return answer, nil
+}
+
+func boolParam(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package media
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Answer с двумя форматами Opus (111 с fmtp, 109 без) и PCMU
+const opusAnswer = "v=0\r\n" +
+	"o=- 1 1 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111 109 0\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=mid:0\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n" +
+	"a=fmtp:111 minptime=10;useinbandfec=0\r\n" +
+	"a=rtpmap:109 opus/48000/2\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"a=fmtp:0 foo=1\r\n"
+
+// fmtpOf возвращает значение a=fmtp для pt или "" без него
+func fmtpOf(sdp, pt string) string {
+	for _, line := range strings.Split(sdp, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "a=fmtp:"+pt+" "); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func TestApplyOpusParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params OpusParams
+		// Ожидаемый fmtp форматов 111 и 109
+		want111 string
+		want109 string
+	}{
+		{"defaults", OpusParams{}, "minptime=10;useinbandfec=0", "useinbandfec=0"},
+		{"fec replaces existing value", OpusParams{FEC: true}, "minptime=10;useinbandfec=1", "useinbandfec=1"},
+		{"dtx and bitrate appended", OpusParams{FEC: true, DTX: true, MaxAverageBitrate: 20000},
+			"minptime=10;useinbandfec=1;usedtx=1;maxaveragebitrate=20000",
+			"useinbandfec=1;usedtx=1;maxaveragebitrate=20000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyOpusParams(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: opusAnswer}, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := fmtpOf(got.SDP, "111"); v != tt.want111 {
+				t.Errorf("fmtp 111 = %q, want %q", v, tt.want111)
+			}
+			if v := fmtpOf(got.SDP, "109"); v != tt.want109 {
+				t.Errorf("fmtp 109 = %q, want %q", v, tt.want109)
+			}
+			if v := fmtpOf(got.SDP, "0"); v != "foo=1" {
+				t.Errorf("PCMU fmtp changed to %q", v)
+			}
+		})
+	}
+}
+
+func TestValidateOpusBitrate(t *testing.T) {
+	tests := []struct {
+		bps     int
+		wantErr bool
+	}{
+		{0, false},
+		{opusMinBitrate, false},
+		{opusMaxBitrate, false},
+		{opusMinBitrate - 1, true},
+		{opusMaxBitrate + 1, true},
+		{-1, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateOpusBitrate(tt.bps); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateOpusBitrate(%d) = %v, want error %v", tt.bps, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package media
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// Кодеки, у которых max-fs в fmtp ограничивает размер кадра
+// отправителя (RFC 7741 для VP8, RFC 6184 для H264)
+var maxFSCodecs = map[string]bool{"VP8": true, "H264": true}
+
+// maxFrameSize — предел в макроблоках 16x16 для max-fs
+func maxFrameSize(width, height int) int {
+	return ((width + 15) / 16) * ((height + 15) / 16)
+}
+
+// LimitResolution дописывает в answer ограничения на видео клиента:
+// a=imageattr с диапазонами recv (RFC 6236) и max-fs для VP8/H264.
+// Сервер кадры не декодирует, поэтому ограничение только договорное:
+// его соблюдает отправитель, который поддерживает эти атрибуты.
+func LimitResolution(answer webrtc.SessionDescription, width, height int) (webrtc.SessionDescription, error) {
+	if width == 0 || height == 0 {
+		return answer, nil
+	}
+
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(answer.SDP)); err != nil {
+		return answer, err
+	}
+
+	fs := maxFrameSize(width, height)
+	for _, m := range d.MediaDescriptions {
+		if m.MediaName.Media != "video" {
+			continue
+		}
+		m.WithValueAttribute("imageattr", fmt.Sprintf("* recv [x=[1:%d],y=[1:%d]]", width, height))
+
+		for _, pt := range m.MediaName.Formats {
+			n, err := strconv.Atoi(pt)
+			if err != nil {
+				continue
+			}
+			codec, err := d.GetCodecForPayloadType(uint8(n))
+			if err != nil || !maxFSCodecs[strings.ToUpper(codec.Name)] {
+				continue
+			}
+			setFmtpParam(m, pt, "max-fs", fs)
+		}
+	}
+
+	raw, err := d.Marshal()
+	if err != nil {
+		return answer, err
+	}
+	answer.SDP = string(raw)
+	return answer, nil
+}
+
+// setFmtpParam задает параметр в a=fmtp формата: заменяет уже
+// имеющийся, иначе дописывает, создавая строку fmtp, если ее не было
+func setFmtpParam(m *sdp.MediaDescription, pt, key string, value int) {
+	param := fmt.Sprintf("%s=%d", key, value)
+	for i, a := range m.Attributes {
+		if a.Key != "fmtp" || !strings.HasPrefix(a.Value, pt+" ") {
+			continue
+		}
+		params := strings.Split(strings.TrimPrefix(a.Value, pt+" "), ";")
+		replaced := false
+		for j, kv := range params {
+			if k, _, _ := strings.Cut(kv, "="); strings.TrimSpace(k) == key {
+				params[j] = param
+				replaced = true
+			}
+		}
+		if !replaced {
+			params = append(params, param)
+		}
+		m.Attributes[i].Value = pt + " " + strings.Join(params, ";")
+		return
+	}
+	m.WithValueAttribute("fmtp", pt+" "+param)
+}
@@ -0,0 +1,99 @@
+package media
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// Профили SRTP, которые умеет pion, по именам из реестра IANA
+var SRTPProfiles = map[string]dtls.SRTPProtectionProfile{
+	"SRTP_AES128_CM_HMAC_SHA1_80": dtls.SRTP_AES128_CM_HMAC_SHA1_80,
+	"SRTP_AEAD_AES_128_GCM":       dtls.SRTP_AEAD_AES_128_GCM,
+	"SRTP_AEAD_AES_256_GCM":       dtls.SRTP_AEAD_AES_256_GCM,
+}
+
+// Политики BUNDLE_POLICY
+var BundlePolicies = map[string]webrtc.BundlePolicy{
+	"max-bundle": webrtc.BundlePolicyMaxBundle,
+	"balanced":   webrtc.BundlePolicyBalanced,
+	"max-compat": webrtc.BundlePolicyMaxCompat,
+}
+
+// BundleGroup возвращает mid'ы из a=group:BUNDLE; ok=false, если группы нет
+func BundleGroup(raw string) (mids string, ok bool) {
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(raw)); err != nil {
+		return "", false
+	}
+	for _, a := range d.Attributes {
+		if a.Key != sdp.AttrKeyGroup {
+			continue
+		}
+		if rest, found := strings.CutPrefix(a.Value, "BUNDLE"); found {
+			return strings.TrimSpace(rest), true
+		}
+	}
+	return "", false
+}
+
+// HeaderExtensions возвращает URI согласованных a=extmap по типам медиа.
+// В answer попадают только расширения, принятые обеими сторонами.
+func HeaderExtensions(raw string) map[string][]string {
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(raw)); err != nil {
+		return nil
+	}
+	exts := make(map[string][]string)
+	for _, m := range d.MediaDescriptions {
+		kind := m.MediaName.Media
+		for _, a := range m.Attributes {
+			if a.Key != sdp.AttrKeyExtMap {
+				continue
+			}
+			// "<id>[/<direction>] <uri> [<attributes>]"
+			fields := strings.Fields(a.Value)
+			if len(fields) < 2 || slices.Contains(exts[kind], fields[1]) {
+				continue
+			}
+			exts[kind] = append(exts[kind], fields[1])
+		}
+	}
+	return exts
+}
+
+// TWCCNegotiated — есть ли transport-wide-cc в примененном answer:
+// без него клиент не присылает TWCC-отчеты
+func TWCCNegotiated(pc *webrtc.PeerConnection) bool {
+	local := pc.CurrentLocalDescription()
+	if local == nil {
+		return false
+	}
+	for _, uris := range HeaderExtensions(local.SDP) {
+		if slices.Contains(uris, sdp.TransportCCURI) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsICELite проверяет a=ice-lite. По RFC 8839 атрибут сессионный, но
+// встречаются реализации, которые ставят его в m-line.
+func IsICELite(raw string) bool {
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(raw)); err != nil {
+		return false
+	}
+	if _, ok := d.Attribute(sdp.AttrKeyICELite); ok {
+		return true
+	}
+	for _, m := range d.MediaDescriptions {
+		if _, ok := m.Attribute(sdp.AttrKeyICELite); ok {
+			return true
+		}
+	}
+	return false
+}
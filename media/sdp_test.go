@@ -0,0 +1,68 @@
+package media
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Сессия с одной m-line; extra дописывается в конец сессионной части,
+// media — в конец m-line
+func testSDP(extra, media string) string {
+	return "v=0\r\n" +
+		"o=- 1 1 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		extra +
+		"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:0\r\n" +
+		media
+}
+
+func TestIsICELite(t *testing.T) {
+	tests := []struct {
+		name string
+		sdp  string
+		want bool
+	}{
+		{"session level", testSDP("a=ice-lite\r\n", ""), true},
+		{"media level", testSDP("", "a=ice-lite\r\n"), true},
+		{"full ICE", testSDP("", ""), false},
+		{"malformed", "not an sdp", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsICELite(tt.sdp); got != tt.want {
+				t.Fatalf("IsICELite = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Offer ICE-lite агента pion содержит a=ice-lite и распознается
+func TestIsICELitePionOffer(t *testing.T) {
+	for _, lite := range []bool{true, false} {
+		var se webrtc.SettingEngine
+		se.SetLite(lite)
+		pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		if _, err := pc.CreateDataChannel("test", nil); err != nil {
+			t.Fatal(err)
+		}
+		offer, err := pc.CreateOffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has := strings.Contains(offer.SDP, "a=ice-lite"); has != lite {
+			t.Fatalf("lite=%v: offer has a=ice-lite = %v", lite, has)
+		}
+		if got := IsICELite(offer.SDP); got != lite {
+			t.Fatalf("lite=%v: IsICELite = %v", lite, got)
+		}
+	}
+}
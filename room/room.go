@@ -0,0 +1,182 @@
+// Package room — реестр комнат сигнального сервера: локальные участники,
+// общее состояние комнаты и участники с других экземпляров (backplane).
+// Тип участника задает встраивающий код.
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrStateFull — в общем состоянии комнаты нет места для нового ключа
+var ErrStateFull = errors.New("room state is full")
+
+// ErrFull — в комнате нет места для нового участника
+var ErrFull = errors.New("room is full")
+
+// Room — комната реестра. Поля, кроме ID и Created, меняются только
+// через Registry под его блокировкой.
+type Room[M comparable] struct {
+	ID      string
+	Created time.Time
+
+	members []M
+
+	// Общее состояние комнаты (state-set), живет, пока в ней есть кто-то
+	state map[string]json.RawMessage
+
+	// Участники с других экземпляров: id клиента → экземпляр.
+	// synced закрывается первым ответом на sync
+	remote map[string]string
+	synced chan struct{}
+}
+
+// Info — снимок комнаты на момент вызова
+type Info[M comparable] struct {
+	Room      *Room[M]
+	Members   []M
+	Remote    int
+	StateKeys int
+}
+
+// Registry — комнаты по id и комната каждого участника. Участник
+// находится не больше чем в одной комнате.
+type Registry[M comparable] struct {
+	mu    sync.Mutex
+	rooms map[string]*Room[M]
+	of    map[M]*Room[M]
+}
+
+func NewRegistry[M comparable]() *Registry[M] {
+	return &Registry[M]{
+		rooms: make(map[string]*Room[M]),
+		of:    make(map[M]*Room[M]),
+	}
+}
+
+// Join добавляет участника в комнату id, создавая ее. capacity — предел
+// участников вместе с известными участниками других экземпляров, сверх
+// него — ErrFull. admit, если задан, решает по локальным участникам под
+// блокировкой реестра; его ошибка возвращается как есть, и участник не
+// добавляется.
+func (r *Registry[M]) Join(id string, m M, capacity int, admit func(members []M) error) (room *Room[M], created bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room = r.rooms[id]
+	var members []M
+	if room != nil {
+		if len(room.members)+len(room.remote) >= capacity {
+			return nil, false, ErrFull
+		}
+		members = room.members
+	}
+	if admit != nil {
+		if err := admit(members); err != nil {
+			return nil, false, err
+		}
+	}
+	created = room == nil
+	if created {
+		room = &Room[M]{ID: id, Created: time.Now()}
+		r.rooms[id] = room
+	}
+	room.members = append(room.members, m)
+	r.of[m] = room
+	return room, created, nil
+}
+
+// Leave убирает участника из его комнаты. Возвращает комнату (nil, если
+// участник не был в комнате), оставшихся участников и опустела ли она;
+// опустевшая комната удаляется из реестра.
+func (r *Registry[M]) Leave(m M) (room *Room[M], peers []M, emptied bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room = r.of[m]
+	if room == nil {
+		return nil, nil, false
+	}
+	delete(r.of, m)
+	for i, member := range room.members {
+		if member == m {
+			room.members = append(room.members[:i], room.members[i+1:]...)
+			break
+		}
+	}
+	emptied = len(room.members) == 0 && r.rooms[room.ID] == room
+	if emptied {
+		delete(r.rooms, room.ID)
+	}
+	return room, append([]M(nil), room.members...), emptied
+}
+
+// Of — комната участника или nil
+func (r *Registry[M]) Of(m M) *Room[M] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.of[m]
+}
+
+// Peers — остальные участники комнаты m
+func (r *Registry[M]) Peers(m M) []M {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room := r.of[m]
+	if room == nil {
+		return nil
+	}
+	var peers []M
+	for _, member := range room.members {
+		if member != m {
+			peers = append(peers, member)
+		}
+	}
+	return peers
+}
+
+// RemotePeers — id участников комнаты m на других экземплярах
+func (r *Registry[M]) RemotePeers(m M) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room := r.of[m]
+	if room == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(room.remote))
+	for id := range room.remote {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Get — снимок комнаты id
+func (r *Registry[M]) Get(id string) (Info[M], bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room := r.rooms[id]
+	if room == nil {
+		return Info[M]{}, false
+	}
+	return room.info(), true
+}
+
+// List — снимки всех комнат
+func (r *Registry[M]) List() []Info[M] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := make([]Info[M], 0, len(r.rooms))
+	for _, room := range r.rooms {
+		infos = append(infos, room.info())
+	}
+	return infos
+}
+
+func (room *Room[M]) info() Info[M] {
+	return Info[M]{
+		Room:      room,
+		Members:   append([]M(nil), room.members...),
+		Remote:    len(room.remote),
+		StateKeys: len(room.state),
+	}
+}
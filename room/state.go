@@ -0,0 +1,124 @@
+package room
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SetState записывает ключ общего состояния комнаты, value nil удаляет
+// его. Новый ключ сверх maxKeys — ErrStateFull. Возвращает участников,
+// которым нужно разослать изменение.
+func (r *Registry[M]) SetState(room *Room[M], key string, value json.RawMessage, maxKeys int) ([]M, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, exists := room.state[key]
+	switch {
+	case value == nil:
+		delete(room.state, key)
+	case !exists && len(room.state) >= maxKeys:
+		return nil, ErrStateFull
+	default:
+		if room.state == nil {
+			room.state = make(map[string]json.RawMessage)
+		}
+		room.state[key] = value
+	}
+	return append([]M(nil), room.members...), nil
+}
+
+// State — копия общего состояния комнаты
+func (r *Registry[M]) State(room *Room[M]) map[string]json.RawMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := make(map[string]json.RawMessage, len(room.state))
+	for k, v := range room.state {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// Members — локальные участники комнаты id; false — комнаты нет
+func (r *Registry[M]) Members(id string) ([]M, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room := r.rooms[id]
+	if room == nil {
+		return nil, false
+	}
+	return append([]M(nil), room.members...), true
+}
+
+// AddRemote запоминает участников комнаты id с экземпляра instance и
+// возвращает локальных участников. false — комнаты здесь нет.
+func (r *Registry[M]) AddRemote(id, instance string, clients ...string) ([]M, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room := r.rooms[id]
+	if room == nil {
+		return nil, false
+	}
+	room.addRemote(instance, clients)
+	return append([]M(nil), room.members...), true
+}
+
+// Synced — ответ экземпляра instance на sync: его участники комнаты id.
+// Первый ответ завершает ожидание Sync.
+func (r *Registry[M]) Synced(id, instance string, clients []string) ([]M, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room := r.rooms[id]
+	if room == nil {
+		return nil, false
+	}
+	room.addRemote(instance, clients)
+	if room.synced != nil {
+		close(room.synced)
+		room.synced = nil
+	}
+	return append([]M(nil), room.members...), true
+}
+
+// RemoveRemote забывает участника комнаты id с другого экземпляра
+func (r *Registry[M]) RemoveRemote(id, client string) ([]M, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	room := r.rooms[id]
+	if room == nil {
+		return nil, false
+	}
+	delete(room.remote, client)
+	return append([]M(nil), room.members...), true
+}
+
+func (room *Room[M]) addRemote(instance string, clients []string) {
+	for _, id := range clients {
+		if id == "" {
+			continue
+		}
+		if room.remote == nil {
+			room.remote = make(map[string]string)
+		}
+		room.remote[id] = instance
+	}
+}
+
+// Sync узнает участников комнаты на других экземплярах: ask рассылает
+// запрос, ожидание заканчивает первый Synced, но не дольше timeout —
+// если комната есть только здесь, ответа не будет
+func (r *Registry[M]) Sync(room *Room[M], timeout time.Duration, ask func()) {
+	synced := make(chan struct{})
+	r.mu.Lock()
+	room.synced = synced
+	r.mu.Unlock()
+
+	ask()
+	select {
+	case <-synced:
+	case <-time.After(timeout):
+		r.mu.Lock()
+		if room.synced == synced {
+			room.synced = nil
+		}
+		r.mu.Unlock()
+	}
+}
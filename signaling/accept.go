@@ -0,0 +1,75 @@
+package signaling
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// acceptQueue пропускает новые подключения не чаще ACCEPT_RATE в
+// секунду. Ожидающих не больше ACCEPT_QUEUE, остальные получают 503.
+// Слоты не резервируются заранее: ожидающий занимает ближайший
+// свободный, когда тот наступит, поэтому ушедший клиент ничего не держит.
+type acceptQueue struct {
+	srv     *Server
+	mu      sync.Mutex
+	next    time.Time // ближайший свободный слот
+	waiting int
+}
+
+// wait ждет своего слота. false — очередь заполнена или клиент ушел.
+func (q *acceptQueue) wait(r *http.Request) bool {
+	q.mu.Lock()
+	if q.waiting >= q.srv.cfg.AcceptQueue {
+		q.mu.Unlock()
+		return false
+	}
+	q.waiting++
+	defer func() {
+		q.mu.Lock()
+		q.waiting--
+		q.mu.Unlock()
+	}()
+	q.mu.Unlock()
+
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		if !q.next.After(now) {
+			q.next = now.Add(q.interval())
+			q.mu.Unlock()
+			return true
+		}
+		slot := q.next
+		q.mu.Unlock()
+
+		select {
+		case <-time.After(time.Until(slot)):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+// backlog — через сколько дойдет очередь до нового подключения: слот
+// на каждого, кто еще ждет
+func (q *acceptQueue) backlog() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return max(time.Until(q.next), 0) + time.Duration(q.waiting)*q.interval()
+}
+
+func (q *acceptQueue) interval() time.Duration {
+	return time.Duration(float64(time.Second) / q.srv.cfg.AcceptRate)
+}
+
+// withAcceptQueue сглаживает прием подключений при массовом переподключении
+func (s *Server) withAcceptQueue(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AcceptRate > 0 && !s.accepts.wait(r) {
+			s.rejectBusy(w, http.StatusServiceUnavailable, "server busy", s.accepts.backlog())
+			return
+		}
+		next(w, r)
+	}
+}
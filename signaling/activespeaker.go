@@ -0,0 +1,141 @@
+package signaling
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// audioLevelMeter копит уровни audio-level (RFC 6464) входящего звука
+// клиента за интервал определения говорящего
+type audioLevelMeter struct {
+	mu      sync.Mutex
+	sum     int
+	packets int
+}
+
+// audioLevelExtension — id согласованного audio-level у трека, 0 — клиент
+// его не отправляет
+func audioLevelExtension(receiver *webrtc.RTPReceiver) uint8 {
+	for _, ext := range receiver.GetParameters().HeaderExtensions {
+		if ext.URI == sdp.AudioLevelURI {
+			return uint8(ext.ID)
+		}
+	}
+	return 0
+}
+
+func (m *audioLevelMeter) observe(pkt *rtp.Packet, id uint8) {
+	payload := pkt.GetExtension(id)
+	if payload == nil {
+		return
+	}
+	var ext rtp.AudioLevelExtension
+	if ext.Unmarshal(payload) != nil {
+		return
+	}
+	m.mu.Lock()
+	m.sum += int(ext.Level)
+	m.packets++
+	m.mu.Unlock()
+}
+
+// take возвращает средний уровень за интервал в -dBov и начинает новый.
+// false — звука не было.
+func (m *audioLevelMeter) take() (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.packets == 0 {
+		return 0, false
+	}
+	level := m.sum / m.packets
+	m.sum, m.packets = 0, 0
+	return level, true
+}
+
+// speakerState — говорящий комнаты и претендент, который громче всех
+// с since, но еще не продержался ACTIVE_SPEAKER_DEBOUNCE
+type speakerState struct {
+	srv       *Server
+	speaker   string
+	candidate string
+	since     time.Time
+}
+
+// runActiveSpeaker раз в ACTIVE_SPEAKER_INTERVAL выбирает в каждой
+// комнате самого громкого участника. Смена говорящего рассылается всей
+// комнате, участники других экземпляров (BACKPLANE) не учитываются.
+func (s *Server) runActiveSpeaker() {
+	states := make(map[*Room]*speakerState)
+	ticker := time.NewTicker(s.cfg.ActiveSpeakerInterval)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-s.done:
+			return
+		}
+		members := make(map[*Room][]*Client)
+		for _, info := range s.rooms.List() {
+			members[info.Room] = info.Members
+		}
+
+		for room := range states {
+			if _, ok := members[room]; !ok {
+				delete(states, room)
+			}
+		}
+		for room, clients := range members {
+			st := states[room]
+			if st == nil {
+				st = &speakerState{srv: s}
+				states[room] = st
+			}
+			st.update(clients, now)
+		}
+	}
+}
+
+func (st *speakerState) update(clients []*Client, now time.Time) {
+	var loudest *Client
+	best := 0
+	present := false
+	for _, c := range clients {
+		present = present || c.id == st.speaker
+		level, ok := c.audioLevel.take()
+		if ok && level <= st.srv.cfg.ActiveSpeakerThreshold && (loudest == nil || level < best) {
+			loudest, best = c, level
+		}
+	}
+	if !present {
+		st.speaker = ""
+	}
+
+	// Паузы между словами претендента не сбрасывают, только другой
+	// участник, который громче
+	switch {
+	case loudest == nil:
+		return
+	case loudest.id == st.speaker:
+		st.candidate = ""
+		return
+	case loudest.id != st.candidate:
+		st.candidate, st.since = loudest.id, now
+	}
+	if now.Sub(st.since) < st.srv.cfg.ActiveSpeakerDebounce {
+		return
+	}
+
+	st.speaker, st.candidate = loudest.id, ""
+	st.srv.metrics.speakerChanges.Inc()
+	loudest.logger.Debug("active speaker", "level", -best)
+	st.srv.broadcast(clients, map[string]interface{}{
+		"type":     "activeSpeaker",
+		"clientId": loudest.id,
+		"level":    -best,
+	})
+}
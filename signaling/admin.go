@@ -0,0 +1,34 @@
+package signaling
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// withAdmin пускает только запросы с "Authorization: Bearer <ADMIN_TOKEN>"
+func (s *Server) withAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+			slog.Warn("admin request denied", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// registerPprof подключает net/http/pprof к mux за админским токеном.
+// Импорт pprof сам регистрирует обработчики в DefaultServeMux, поэтому
+// сервер использует свой mux.
+func (s *Server) registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", s.withAdmin(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", s.withAdmin(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", s.withAdmin(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", s.withAdmin(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", s.withAdmin(pprof.Trace))
+}
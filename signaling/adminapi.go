@@ -0,0 +1,101 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+)
+
+// Админский API для панели оператора (/api/...): снимки комнат и
+// клиентов, статистика сессии и управление ими. Все за ADMIN_TOKEN.
+
+type roomInfo struct {
+	ID            string   `json:"id"`
+	Members       []string `json:"members"`
+	RemoteMembers int      `json:"remoteMembers,omitempty"` // на других экземплярах
+	Publishers    int      `json:"publishers"`
+	Viewers       int      `json:"viewers"`
+	StateKeys     int      `json:"stateKeys"`
+	Recording     string   `json:"recording,omitempty"`
+}
+
+// handleAPIRooms — GET /api/rooms: комнаты этого экземпляра
+func (s *Server) handleAPIRooms(w http.ResponseWriter, r *http.Request) {
+	list := s.rooms.List()
+	infos := make([]roomInfo, 0, len(list))
+	for _, room := range list {
+		info := roomInfo{
+			ID:            room.Room.ID,
+			Members:       make([]string, len(room.Members)),
+			RemoteMembers: room.Remote,
+			StateKeys:     room.StateKeys,
+		}
+		for i, c := range room.Members {
+			info.Members[i] = c.id
+		}
+		info.Publishers, info.Viewers = roomRoles(room.Members)
+		infos = append(infos, info)
+	}
+
+	s.recordingsMu.Lock()
+	for i := range infos {
+		if rec := s.recordingOf("room", infos[i].ID); rec != nil {
+			infos[i].Recording = rec.ID
+		}
+	}
+	s.recordingsMu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		slog.Warn("rooms encode error", "err", err)
+	}
+}
+
+// handleAPIClientStats — GET /api/clients/{id}/stats: статистика сессии
+// как в /stats и отчет pion в формате W3C, если есть PeerConnection
+func (s *Server) handleAPIClientStats(w http.ResponseWriter, r *http.Request) {
+	client := s.clients.get(r.PathValue("id"))
+	if client == nil {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+	pc := client.pc.Load()
+
+	resp := map[string]interface{}{"session": client.stats()}
+	if pc != nil {
+		resp["webrtc"] = w3cStats(client, pc)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Warn("client stats encode error", "err", err)
+	}
+}
+
+// handleAPICloseRoom — POST /api/rooms/{id}/close: отключает всех
+// участников комнаты на этом экземпляре. Участники на других экземплярах
+// остаются, их число возвращается в remoteMembers.
+func (s *Server) handleAPICloseRoom(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	room, ok := s.rooms.Get(id)
+	members, remote := room.Members, room.Remote
+	if !ok {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	slog.Info("closing room by admin request", "room", id, "members", len(members), "admin", r.RemoteAddr)
+	for _, c := range members {
+		c.event("room-closed")
+		c.sendError("ROOM_CLOSED", "room closed by the operator")
+		s.cleanupClient(c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room":          id,
+		"disconnected":  len(members),
+		"remoteMembers": remote,
+	})
+}
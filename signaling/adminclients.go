@@ -0,0 +1,71 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type clientInfo struct {
+	ID              string    `json:"id"`
+	Identity        string    `json:"identity,omitempty"`
+	RemoteAddr      string    `json:"remoteAddr"`
+	Room            string    `json:"room,omitempty"`
+	Tenant          string    `json:"tenant,omitempty"`
+	Detached        bool      `json:"detached,omitempty"` // ждет переподключения
+	ConnectedAt     time.Time `json:"connectedAt"`
+	LastActivity    time.Time `json:"lastActivity"`
+	ConnectionState string    `json:"connectionState"`
+}
+
+// handleClients — GET /clients и GET /api/clients: подключенные клиенты
+// для оператора
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	list := s.clients.snapshot()
+	infos := make([]clientInfo, 0, len(list))
+	for _, c := range list {
+		state := "none"
+		if pc := c.pc.Load(); pc != nil {
+			state = pc.ConnectionState().String()
+		}
+		var room string
+		if id := c.roomID.Load(); id != nil {
+			room = *id
+		}
+		c.mu.Lock()
+		detached := c.detached
+		c.mu.Unlock()
+		infos = append(infos, clientInfo{
+			ID:              c.id,
+			Identity:        c.identity,
+			RemoteAddr:      c.remoteAddr,
+			Room:            room,
+			Tenant:          c.tenant,
+			Detached:        detached,
+			ConnectedAt:     c.connectedAt,
+			LastActivity:    time.Unix(0, c.lastActivity.Load()),
+			ConnectionState: state,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		slog.Warn("clients encode error", "err", err)
+	}
+}
+
+// handleKickClient — DELETE /clients/{id} и POST /api/clients/{id}/kick:
+// принудительно отключает клиента
+func (s *Server) handleKickClient(w http.ResponseWriter, r *http.Request) {
+	client := s.clients.get(r.PathValue("id"))
+	if client == nil {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+	client.logger.Info("disconnecting by admin request", "admin", r.RemoteAddr)
+	client.event("kicked")
+	client.sendError("DISCONNECTED", "disconnected by the operator")
+	s.cleanupClient(client)
+	w.WriteHeader(http.StatusNoContent)
+}
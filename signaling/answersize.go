@@ -0,0 +1,38 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/media"
+)
+
+// errAnswerTooLarge — answer не влезает в ANSWER_MAX_SIZE даже с одним
+// кандидатом на компонент
+var errAnswerTooLarge = errors.New("answer exceeds ANSWER_MAX_SIZE")
+
+// limitAnswerCandidates урезает кандидаты в answer без trickle до
+// ANSWER_MAX_CANDIDATES на компонент каждой m-line и, если задан
+// ANSWER_MAX_SIZE, дальше до нужного размера. Меньше кандидатов —
+// меньше путей для ICE: клиент за строгим NAT может не подключиться,
+// если отброшен единственный подходящий ему путь. Если answer не
+// влезает и так, возвращается errAnswerTooLarge.
+func (s *Server) limitAnswerCandidates(answer webrtc.SessionDescription, limit int) (webrtc.SessionDescription, error) {
+	reply, kept, err := media.TrimCandidates(answer, limit)
+	if err != nil || s.cfg.AnswerMaxSize == 0 {
+		return reply, err
+	}
+	// ANSWER_MAX_SIZE: убираем кандидатов, пока answer не влезет,
+	// но хотя бы один на компонент остается
+	for kept > 1 && len(reply.SDP) > s.cfg.AnswerMaxSize {
+		if reply, kept, err = media.TrimCandidates(answer, kept-1); err != nil {
+			return reply, err
+		}
+	}
+	if len(reply.SDP) > s.cfg.AnswerMaxSize {
+		return reply, fmt.Errorf("%w: %d bytes with one candidate per component, limit %d", errAnswerTooLarge, len(reply.SDP), s.cfg.AnswerMaxSize)
+	}
+	return reply, nil
+}
@@ -0,0 +1,46 @@
+package signaling
+
+import (
+	"strings"
+	"testing"
+
+	"go-webrtc/config"
+)
+
+func TestAnswerMaxSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		wantErr bool
+	}{
+		{"fits", 1 << 16, false},
+		{"oversized", 200, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newTestServer(t, func(c *config.Config) {
+				c.NonTrickle = true
+				c.AnswerCandidateDelay = 0
+				c.AnswerMaxSize = tt.maxSize
+			})
+			ws := dialWS(t, ts, "")
+			offer := createOffer(t, newPeer(t))
+			sendJSON(t, ws, map[string]string{"type": "offer", "sdp": offer.SDP})
+
+			if !tt.wantErr {
+				answer := readType(t, ws, "answer")
+				if sdp, _ := answer["sdp"].(string); len(sdp) > tt.maxSize {
+					t.Fatalf("answer is %d bytes, limit %d", len(sdp), tt.maxSize)
+				}
+				return
+			}
+			reply := readError(t, ws, "ANSWER_TOO_LARGE")
+			if msg, _ := reply["message"].(string); !strings.Contains(msg, "ANSWER_MAX_SIZE") {
+				t.Fatalf("message %q does not name ANSWER_MAX_SIZE", msg)
+			}
+			if s.clients.snapshot()[0].pc.Load() != nil {
+				t.Fatal("PeerConnection kept after ANSWER_TOO_LARGE")
+			}
+		})
+	}
+}
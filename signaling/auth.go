@@ -0,0 +1,73 @@
+package signaling
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authenticateHTTP проверяет запрос к HTTP-эндпоинту так же, как /ws:
+// токен в режиме token, ключ PSK как Bearer в режиме psk. При отказе
+// отвечает 401 и возвращает false.
+func (s *Server) authenticateHTTP(w http.ResponseWriter, r *http.Request) (Claims, bool) {
+	switch s.cfg.AuthMode {
+	case "token":
+		claims, err := s.validateToken(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return nil, false
+		}
+		return claims, true
+	case "psk":
+		key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.AuthPSK)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return nil, false
+		}
+	}
+	return Claims{}, true
+}
+
+// authenticate проверяет {"type":"auth","key":"..."} в режиме psk.
+// false — ключ неверный, соединение нужно закрыть.
+func (c *Client) authenticate(key string) bool {
+	if c.srv.cfg.AuthMode != "psk" || c.authed.Load() {
+		c.logger.Warn("unexpected auth message")
+		return true
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(c.srv.cfg.AuthPSK)) != 1 {
+		c.logger.Warn("auth failed", "dropped", len(c.preAuth))
+		c.preAuth = nil
+		c.sendError("AUTH_FAILED", "invalid key")
+		return false
+	}
+	c.authed.Store(true)
+	c.event("authed")
+	c.logger.Info("authenticated")
+	c.sendJSON(map[string]interface{}{"type": "auth-ok"})
+	return true
+}
+
+// holdPreAuth откладывает сообщение до auth или отклоняет его с
+// AUTH_REQUIRED, если буфер выключен или заполнен
+func (c *Client) holdPreAuth(msg []byte) {
+	if c.srv.cfg.PreAuthMode == "buffer" && len(c.preAuth) < c.srv.cfg.PreAuthBuffer {
+		c.preAuth = append(c.preAuth, msg)
+		return
+	}
+	c.sendError("AUTH_REQUIRED", "send auth before signaling")
+}
+
+// replayPreAuth выполняет отложенные сообщения по порядку после auth
+func (c *Client) replayPreAuth() bool {
+	held := c.preAuth
+	c.preAuth = nil
+	for _, msg := range held {
+		if !c.srv.handleMessage(c, msg) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package signaling
+
+// Claims — claims JWT клиента (AUTH_MODE=token); в остальных режимах
+// пустые
+type Claims map[string]interface{}
+
+// Subject — sub из токена
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Rooms — комнаты из claim rooms ("*" — любая); nil, если claim нет и
+// ограничения нет
+func (c Claims) Rooms() []string {
+	list, ok := c["rooms"].([]interface{})
+	if !ok {
+		return nil
+	}
+	rooms := make([]string, 0, len(list))
+	for _, v := range list {
+		if room, ok := v.(string); ok {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
+
+// Tenant — арендатор из claim tenant; пусто, если claim нет
+func (c Claims) Tenant() string {
+	tenant, _ := c["tenant"].(string)
+	return tenant
+}
+
+// authorize проверяет действие и отвечает FORBIDDEN при отказе. Комнаты
+// вне claim rooms запрещены до вызова Hooks.Authorize.
+func (c *Client) authorize(msgType string, data map[string]interface{}) bool {
+	if room, _ := data["room"].(string); msgType == "join" && !c.roomAllowed(room) {
+		c.logger.Info("room not allowed by token", "room", room)
+		c.sendError("FORBIDDEN", "room "+room+" is not allowed")
+		return false
+	}
+	if authorize := c.srv.hooks.Authorize; authorize != nil {
+		if err := authorize(c.claims, msgType, data); err != nil {
+			c.logger.Info("action forbidden", "type", msgType, "err", err)
+			c.sendError("FORBIDDEN", err.Error())
+			return false
+		}
+	}
+	return true
+}
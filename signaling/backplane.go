@@ -0,0 +1,148 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// Backplane связывает комнаты нескольких экземпляров сервера за одним
+// балансировщиком: участники комнаты могут быть подключены к разным
+// экземплярам. Каждый экземпляр подписан на комнаты своих клиентов и
+// публикует в них вход, выход и сигнализацию relay.
+//
+// Медиа (proxy, sfu) и каналы данных через backplane не идут: их
+// пересылает только экземпляр, к которому подключены оба участника.
+type Backplane interface {
+	// Publish отправляет сообщение всем экземплярам, подписанным на room
+	Publish(room string, payload []byte) error
+	// Subscribe и Unsubscribe включают и выключают доставку сообщений
+	// комнаты в Messages
+	Subscribe(room string) error
+	Unsubscribe(room string) error
+	// Messages — сообщения комнат, на которые подписан экземпляр,
+	// включая собственные
+	Messages() <-chan backplaneDelivery
+	Close() error
+}
+
+type backplaneDelivery struct {
+	Room    string
+	Payload []byte
+}
+
+// memoryBackplane — один экземпляр: все участники комнат локальные, и
+// пересылать нечего
+type memoryBackplane struct{}
+
+func (memoryBackplane) Publish(string, []byte) error       { return nil }
+func (memoryBackplane) Subscribe(string) error             { return nil }
+func (memoryBackplane) Unsubscribe(string) error           { return nil }
+func (memoryBackplane) Messages() <-chan backplaneDelivery { return nil }
+func (memoryBackplane) Close() error                       { return nil }
+
+// busMessage — сообщение между экземплярами. Kind:
+//   - sync — экземпляр подписался на комнату и спрашивает участников;
+//   - members — ответ на sync: локальные участники комнаты;
+//   - joined, left — клиент экземпляра вошел в комнату или вышел;
+//   - signal — offer/answer/ice участника в режиме relay.
+//
+// Участники упавшего экземпляра остаются в списках, пока комната не
+// опустеет локально.
+type busMessage struct {
+	Instance string                 `json:"instance"`
+	Kind     string                 `json:"kind"`
+	Client   string                 `json:"client,omitempty"`
+	Members  []string               `json:"members,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// newBackplane создает backplane по BACKPLANE
+func (s *Server) newBackplane() (Backplane, error) {
+	if s.cfg.Backplane == "redis" {
+		return newRedisBackplane(s.cfg.RedisURL, s.cfg.BackplanePrefix)
+	}
+	return memoryBackplane{}, nil
+}
+
+func (s *Server) publishRoom(room string, msg busMessage) {
+	msg.Instance = s.instanceID
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	if err := s.backplane.Publish(room, payload); err != nil {
+		slog.Warn("backplane publish error", "room", room, "err", err)
+	}
+}
+
+// runBackplane применяет сообщения других экземпляров к локальным
+// комнатам
+func (s *Server) runBackplane() {
+	messages := s.backplane.Messages()
+	for {
+		select {
+		case d, ok := <-messages:
+			if !ok {
+				return
+			}
+			var msg busMessage
+			if err := json.Unmarshal(d.Payload, &msg); err != nil {
+				slog.Warn("backplane message malformed", "room", d.Room, "err", err)
+				continue
+			}
+			if msg.Instance != s.instanceID {
+				s.handleBusMessage(d.Room, msg)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) handleBusMessage(roomID string, msg busMessage) {
+	var local []*Client
+	var ok bool
+	switch msg.Kind {
+	case "joined":
+		local, ok = s.rooms.AddRemote(roomID, msg.Instance, msg.Client)
+	case "members":
+		local, ok = s.rooms.Synced(roomID, msg.Instance, msg.Members)
+	case "left":
+		local, ok = s.rooms.RemoveRemote(roomID, msg.Client)
+	default:
+		local, ok = s.rooms.Members(roomID)
+	}
+	if !ok {
+		return
+	}
+
+	switch msg.Kind {
+	case "sync":
+		ids := make([]string, len(local))
+		for i, c := range local {
+			ids[i] = c.id
+		}
+		s.publishRoom(roomID, busMessage{Kind: "members", Members: ids})
+	case "joined":
+		s.broadcast(local, map[string]interface{}{"type": "peer-joined", "clientId": msg.Client})
+	case "left":
+		s.broadcast(local, map[string]interface{}{"type": "peer-left", "clientId": msg.Client})
+	case "signal":
+		if msg.Data != nil {
+			s.broadcast(local, msg.Data)
+		}
+	}
+}
+
+// syncRoom узнает участников комнаты на других экземплярах после
+// подписки: ждет первого ответа members, но не дольше
+// BACKPLANE_SYNC_TIMEOUT — если комната есть только здесь, ответа не
+// будет
+func (s *Server) syncRoom(room *Room) {
+	if _, ok := s.backplane.(memoryBackplane); ok {
+		return
+	}
+	s.rooms.Sync(room, s.cfg.BackplaneSyncTimeout, func() {
+		s.publishRoom(room.ID, busMessage{Kind: "sync"})
+	})
+}
@@ -0,0 +1,98 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// broadcastResult — кому сообщение рассылки дошло, а кому нет
+type broadcastResult struct {
+	Delivered []*Client
+	Failed    map[*Client]error
+}
+
+// writePrepared отправляет подготовленное сообщение не дольше timeout.
+// После таймаута посреди кадра gorilla считает соединение сломанным,
+// поэтому такой клиент дальше не обслуживается. Отключенной сессии
+// сообщение копится в исходном виде data.
+func (c *Client) writePrepared(msg *websocket.PreparedMessage, data []byte, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.detached {
+		c.enqueue(data)
+		return nil
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	defer c.conn.SetWriteDeadline(time.Time{})
+	// Подготовленный кадр годится только для WebSocket
+	if ws, ok := c.conn.(*websocket.Conn); ok {
+		return ws.WritePreparedMessage(msg)
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// broadcast рассылает v клиентам параллельно, не больше
+// BROADCAST_WORKERS записей одновременно и не дольше
+// BROADCAST_WRITE_TIMEOUT на каждую, чтобы медленный клиент не
+// задерживал остальных. Сообщение сериализуется один раз. Клиенты, на
+// которых запись не удалась, отключаются.
+func (s *Server) broadcast(targets []*Client, v interface{}) broadcastResult {
+	result := broadcastResult{Failed: make(map[*Client]error)}
+	if len(targets) == 0 {
+		return result
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("broadcast encode error", "err", err)
+		for _, c := range targets {
+			result.Failed[c] = err
+		}
+		return result
+	}
+	msg, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
+	if err != nil {
+		slog.Error("broadcast prepare error", "err", err)
+		for _, c := range targets {
+			result.Failed[c] = err
+		}
+		return result
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, s.cfg.BroadcastWorkers)
+	)
+	for _, c := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := c.writePrepared(msg, data, s.cfg.BroadcastWriteTimeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed[c] = err
+			} else {
+				result.Delivered = append(result.Delivered, c)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for c, err := range result.Failed {
+		if c.resumable() {
+			c.logger.Warn("broadcast write failed, dropping socket", "err", err)
+			c.dropConn()
+			continue
+		}
+		c.logger.Warn("broadcast write failed, disconnecting", "err", err)
+		go s.cleanupClient(c)
+	}
+	return result
+}
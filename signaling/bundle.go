@@ -0,0 +1,23 @@
+package signaling
+
+import (
+	"go-webrtc/media"
+)
+
+// checkBundle фиксирует итоговую группу BUNDLE. pion всегда работает через
+// один транспорт, поэтому клиент без BUNDLE в offer все равно получит
+// все m-line'ы на одном транспорте — об этом стоит знать при отладке.
+func (s *Server) checkBundle(client *Client, offer, answer string) {
+	group, ok := media.BundleGroup(answer)
+	client.statsMu.Lock()
+	client.bundle = group
+	client.statsMu.Unlock()
+
+	if _, offered := media.BundleGroup(offer); !offered {
+		client.logger.Info("offer has no BUNDLE group, answering over a single transport", "policy", s.cfg.BundlePolicy)
+		return
+	}
+	if !ok && s.cfg.BundlePolicy == "max-bundle" {
+		client.logger.Warn("answer has no BUNDLE group despite max-bundle policy")
+	}
+}
@@ -0,0 +1,76 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/media"
+)
+
+// Создание PeerConnection сериализуется: квота MAX_PEERS проверяется и
+// занимается под одной блокировкой
+
+// bweEnabled — нужна ли оценка полосы GCC: для отчетов клиенту или для
+// управления перегрузкой
+func (s *Server) bweEnabled() bool {
+	return s.cfg.BWEReportInterval > 0 || s.cfg.CongestionControl
+}
+
+// newPeerConnection создает PeerConnection и, если оценка полосы
+// включена, возвращает его оценщик
+func (s *Server) newPeerConnection(config webrtc.Configuration) (*webrtc.PeerConnection, cc.BandwidthEstimator, error) {
+	s.peersMu.Lock()
+	defer s.peersMu.Unlock()
+	if err := s.reservePeer(); err != nil {
+		return nil, nil, err
+	}
+	pc, estimator, err := s.api.NewPeerConnection(config)
+	if err == nil {
+		s.trackPeer(pc)
+	}
+	return pc, estimator, err
+}
+
+// watchBWE запоминает оценщик сессии и обновляет оценку при каждом ее
+// изменении. Изменения начинаются с первыми TWCC-отчетами, поэтому без
+// согласованного TWCC оценки нет.
+func (c *Client) watchBWE(estimator cc.BandwidthEstimator) {
+	c.statsMu.Lock()
+	c.estimator = estimator
+	c.statsMu.Unlock()
+	estimator.OnTargetBitrateChange(func(bps int) {
+		c.statsMu.Lock()
+		if c.estimator == estimator {
+			c.bwe = bps
+		}
+		c.statsMu.Unlock()
+	})
+}
+
+// reportBWE раз в BWE_REPORT_INTERVAL отправляет клиенту оценку полосы
+// в сторону клиента. Пока TWCC не согласован, оценки нет: сообщения не
+// отправляются, и в /stats ее тоже нет.
+func (s *Server) reportBWE(client *Client, pc *webrtc.PeerConnection, estimator cc.BandwidthEstimator) {
+	ticker := time.NewTicker(s.cfg.BWEReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-client.readDone:
+			return
+		case <-ticker.C:
+		}
+		if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		if !media.TWCCNegotiated(pc) {
+			continue
+		}
+		bps := estimator.GetTargetBitrate()
+		client.statsMu.Lock()
+		client.bwe = bps
+		client.statsMu.Unlock()
+		client.sendJSON(map[string]interface{}{"type": "bwe", "bps": bps})
+	}
+}
@@ -0,0 +1,1022 @@
+package signaling
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/webrtc/v3"
+	"golang.org/x/time/rate"
+
+	"go-webrtc/media"
+)
+
+// signalConn — транспорт сигнализации сессии: *websocket.Conn или поток
+// gRPC (grpcConn). Сессия пользуется только этими методами.
+type signalConn interface {
+	WriteJSON(v interface{}) error
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+type Client struct {
+	srv         *Server
+	id          string
+	logger      *slog.Logger // с id подключения и адресом
+	conn        signalConn
+	pc          atomic.Pointer[webrtc.PeerConnection] // nil до первого offer и после failSetup
+	remoteAddr  string
+	identity    string   // sub из токена в режиме AUTH_MODE=token
+	rooms       []string // разрешенные токеном комнаты, nil — любые
+	claims      Claims
+	region      string
+	tenant      string
+	roomID      atomic.Pointer[string] // id комнаты для лога
+	connectedAt time.Time
+	mu          sync.Mutex
+
+	// Зритель комнаты (role=viewer): в режиме sfu только получает треки
+	// и не считается в MAX_PUBLISHERS_PER_ROOM
+	viewer atomic.Bool
+
+	readDone     chan struct{} // закрывается, когда сессия закончилась
+	endOnce      sync.Once
+	peerClosed   atomic.Bool
+	lastActivity atomic.Int64
+	closeOnce    sync.Once
+	closing      atomic.Bool
+
+	// Возобновление после обрыва сокета (session.go). detached и outbox
+	// под mu, parked и parkTimer под sessionsMu
+	sessionToken string
+	detached     bool
+	outbox       [][]byte
+	outboxLost   bool
+	parked       bool
+	parkTimer    *time.Timer
+
+	iceConnected chan struct{}
+	recovering   atomic.Bool
+	signaled     atomic.Bool  // был offer или вход в комнату
+	protocol     atomic.Int32 // версия протокола сигнализации
+
+	// Закрывается через AnswerCandidateDelay после первого answer
+	trickleReady     chan struct{}
+	trickleReadyOnce sync.Once
+	established      atomic.Bool
+	authed           atomic.Bool
+	firstMedia       atomic.Bool
+
+	// Сигнальные сообщения, пришедшие до auth (только из цикла чтения)
+	preAuth [][]byte
+
+	// Лимит частоты сообщений и отказы подряд (только из цикла чтения)
+	msgLimiter *rate.Limiter
+	msgDropped int
+	// Close-фрейм уже отправлен (closeWith)
+	closeSent atomic.Bool
+
+	// Каналы данных клиента по меткам и сообщения участника комнаты,
+	// ждущие открытия одноименного канала (под mu)
+	channels  map[string]*webrtc.DataChannel
+	pendingDC map[string][]webrtc.DataChannelMessage
+	// Сжатие пересылаемых сообщений каналов (dc-deflate)
+	dcCompression compressionCounter
+	// Передачи файлов по id (под mu)
+	files map[string]*fileTransfer
+
+	// Пересылка медиа второму участнику (SIGNALING_MODE=proxy)
+	proxy proxyState
+	// Рестрим в RTMP или HLS через ffmpeg
+	egress atomic.Pointer[egress]
+	// Громкость входящего звука для определения говорящего
+	audioLevel audioLevelMeter
+
+	// Сериализует offer/answer на PeerConnection клиента
+	negotiationMu sync.Mutex
+	// Параметры Opus последнего offer (под negotiationMu)
+	opus media.OpusParams
+
+	dataChannels atomic.Int32
+	candidates   atomic.Int32
+
+	statsMu   sync.Mutex
+	codecs    map[string]string
+	keyframes []*keyframeTracker
+	recorders []*trackRecorder
+
+	receiveStats     []*rtpReceiveStats
+	quality          *qualityStats
+	bundle           string
+	iceLite          bool
+	tcpFallback      bool
+	tcpRelay         bool
+	renegotiations   int
+	iceRestarts      int
+	iceRecoveries    int         // offer с ICE restart от сервера
+	iceFailures      []time.Time // неудачи ICE за ICE_FAILURE_WINDOW
+	bwe              int
+	remb             int                   // последний REMB клиента, bps
+	estimator        cc.BandwidthEstimator // GCC текущего PeerConnection
+	headerExtensions map[string][]string
+	srtpProfile      string
+	failure          setupFailure
+	timeline         []timelineEvent
+
+	// Начало сбора кандидатов и задержки их появления по типам
+	gatherStart   time.Time
+	gatherLatency map[string]*latencyAcc
+
+	// Согласованные в hello возможности, nil — hello не было
+	features map[string]bool
+
+	// Отчеты клиента о воспроизведении (блокировка autoplay)
+	mediaPlaying    *bool
+	playbackReports int
+	playbackBlocked int
+}
+
+// clientRegion берет регион из ?region= или из заголовка гео-прокси
+func clientRegion(r *http.Request) string {
+	if region := r.URL.Query().Get("region"); region != "" {
+		return region
+	}
+	return r.Header.Get("X-Client-Region")
+}
+
+func newClientID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// sendJSON пишет сообщение не дольше WRITE_TIMEOUT: клиент, который не
+// читает, не держит c.mu и тех, кто ждет его для записи
+func (c *Client) sendJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.detached {
+		return c.enqueueJSON(v)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.srv.cfg.WriteTimeout))
+	defer c.conn.SetWriteDeadline(time.Time{})
+	return c.conn.WriteJSON(v)
+}
+
+func (c *Client) sendError(code, message string) error {
+	return c.sendJSON(errorMessage{Type: "error", Code: code, Message: message})
+}
+
+// spawn запускает обработку сообщения в своей горутине. recover цикла
+// чтения ее паники не видит, поэтому паника ловится здесь: она не должна
+// ронять весь сервер.
+func (c *Client) spawn(msgType string, handle func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.logger.Error("panic handling message", "type", msgType, "panic", r)
+			}
+		}()
+		handle()
+	}()
+}
+
+// ID — id подключения, тот же, что в clientId сообщений
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Identity — sub токена клиента, пусто без него
+func (c *Client) Identity() string {
+	return c.identity
+}
+
+// Claims — claims токена клиента
+func (c *Client) Claims() Claims {
+	return c.claims
+}
+
+// Room — текущая комната клиента, пусто вне комнаты
+func (c *Client) Room() string {
+	if room := c.roomID.Load(); room != nil {
+		return *room
+	}
+	return ""
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	s.wsHandlers.Add(1)
+	defer s.wsHandlers.Done()
+
+	if !s.checkOrigin(r) {
+		slog.Info("rejecting: origin not allowed", "remote", r.RemoteAddr, "origin", r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	version, err := requestedProtocol(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var claims Claims
+	var header http.Header
+	if s.cfg.AuthMode == "token" {
+		if _, viaProtocol := requestToken(r); viaProtocol {
+			header = http.Header{"Sec-Websocket-Protocol": {bearerSubprotocol}}
+		}
+		var err error
+		claims, err = s.validateToken(r)
+		switch {
+		case errors.Is(err, errTokenMissing):
+			slog.Info("rejecting: no token", "remote", r.RemoteAddr)
+		case errors.Is(err, errTokenExpired):
+			slog.Info("rejecting: expired token", "remote", r.RemoteAddr, "identity", claims.Subject())
+		case err != nil:
+			slog.Info("rejecting: invalid token", "remote", r.RemoteAddr)
+		}
+		if err != nil {
+			if !websocket.IsWebSocketUpgrade(r) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			s.rejectUnauthorized(w, r, header, err)
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		slog.Warn("WebSocket upgrade failed", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+	if client := s.openSession(r, conn, claims, version); client != nil {
+		s.serveConn(client, conn)
+	}
+}
+
+// openSession начинает сессию на подключении conn по параметрам запроса
+// r или возобновляет ждущую. nil — в сессии отказано, conn уже закрыт.
+func (s *Server) openSession(r *http.Request, conn signalConn, claims Claims, version int) *Client {
+	// Переподключение к сессии, ждущей после обрыва сокета. Если ее уже
+	// нет, клиент получает RESUME_FAILED и начинает новую.
+	token := r.URL.Query().Get("resume")
+	if token != "" {
+		if client := s.resumeSession(token, claims, conn); client != nil {
+			return client
+		}
+	}
+
+	client := &Client{
+		srv:         s,
+		id:          newClientID(),
+		conn:        conn,
+		remoteAddr:  r.RemoteAddr,
+		identity:    claims.Subject(),
+		msgLimiter:  s.newMessageLimiter(),
+		rooms:       claims.Rooms(),
+		claims:      claims,
+		region:      clientRegion(r),
+		tenant:      s.clientTenant(claims, r.URL.Query().Get("tenant")),
+		connectedAt: time.Now(),
+		readDone:    make(chan struct{}),
+
+		sessionToken: s.newSessionToken(),
+
+		iceConnected: make(chan struct{}, 1),
+		trickleReady: make(chan struct{}),
+	}
+	client.logger = newClientLogger(client, requestCorrelationID(r))
+	client.protocol.Store(int32(version))
+	client.authed.Store(s.cfg.AuthMode == "none" || s.cfg.AuthMode == "token")
+
+	if roomID := s.requestedRoom(r); roomID != "" {
+		if !roomIDRe.MatchString(roomID) {
+			client.sendError("INVALID_ROOM", "room must be 1-64 letters, digits, - or _")
+			conn.Close()
+			return nil
+		}
+		if !client.authorize("join", map[string]interface{}{"room": roomID}) {
+			closeWithCode(conn, closeForbidden, "room not allowed")
+			return nil
+		}
+		if s.roomQuotaExceeded(client, roomID) {
+			client.logger.Info("room quota exceeded, rejecting", "room", roomID)
+			client.sendJSON(errorMessage{
+				Type:    "error",
+				Code:    "ROOM_QUOTA",
+				Message: fmt.Sprintf("user %s is already in %d rooms", client.identity, s.cfg.MaxRoomsPerUser),
+			})
+			closeWithCode(conn, websocket.ClosePolicyViolation, "room quota exceeded")
+			return nil
+		}
+		role := r.URL.Query().Get("role")
+		if !validRole(role) {
+			client.sendError("INVALID_ROLE", "role must be publisher or viewer")
+			conn.Close()
+			return nil
+		}
+		client.viewer.Store(role == roleViewer)
+		if err := s.joinRoom(client, roomID); errors.Is(err, errPublisherLimit) {
+			client.logger.Info("publisher limit reached, rejecting", "room", roomID)
+			s.rejectPublisher(client, roomID)
+			conn.Close()
+			return nil
+		} else if err != nil {
+			client.logger.Info("room full, rejecting", "room", roomID)
+			client.sendJSON(map[string]interface{}{
+				"type":       "room-full",
+				"retryAfter": s.retryAfterSeconds(s.cfg.RetryAfter),
+			})
+			conn.Close()
+			return nil
+		}
+	}
+	s.clients.add(client)
+	if client.currentRoom() != nil {
+		s.sendRoomState(client)
+		s.announceJoin(client)
+	}
+
+	client.event("connected")
+	client.webhook("client-connected", map[string]interface{}{"remoteAddr": client.remoteAddr})
+	if client.identity != "" {
+		client.logger = client.logger.With("identity", client.identity)
+	}
+	client.logger.Info("connected")
+	if token != "" {
+		client.sendError("RESUME_FAILED", "session expired or unknown, starting a new one")
+	}
+	client.offerSession()
+
+	if s.cfg.IdleWarningBefore > 0 {
+		go s.watchIdle(client)
+	}
+	if client.currentRoom() != nil {
+		client.signaled.Store(true)
+	} else if s.cfg.NoOfferTimeout > 0 {
+		go s.watchSignaling(client)
+	}
+	return client
+}
+
+// serveConn читает сообщения клиента из conn, пока сокет жив. Сокет,
+// оборвавшийся без close-фрейма, оставляет возобновляемую сессию ждать
+// переподключения; в остальных случаях сессия закрывается.
+func (s *Server) serveConn(client *Client, conn *websocket.Conn) {
+	dropped := false
+	defer func() {
+		if dropped && client.park() {
+			return
+		}
+		client.end()
+		s.cleanupClient(client)
+	}()
+	// Ошибка в обработке сообщения не должна оставлять PeerConnection
+	// и WebSocket без очистки
+	defer func() {
+		if r := recover(); r != nil {
+			client.logger.Error("panic handling message", "panic", r)
+		}
+	}()
+
+	conn.SetReadLimit(s.cfg.MaxMessageSize)
+
+	// Настройка таймаутов
+	client.touch()
+	conn.SetPongHandler(func(string) error {
+		client.touch()
+		return nil
+	})
+
+	// Пинг-понг для поддержания соединения. WriteControl можно вызывать
+	// параллельно с sendJSON, WriteMessage — нельзя
+	connDone := make(chan struct{})
+	defer close(connDone)
+	go func() {
+		ticker := time.NewTicker(s.cfg.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-connDone:
+				return
+			case <-ticker.C:
+			}
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.cfg.PingInterval)); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			var netErr net.Error
+			// 1006 gorilla выдает сама, когда сокет оборвался без close
+			if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure {
+				client.peerClosed.Store(true)
+			} else if errors.As(err, &netErr) && netErr.Timeout() {
+				s.metrics.timeouts.Inc()
+			}
+			dropped = !client.peerClosed.Load()
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
+				client.logger.Warn("WebSocket error", "err", err)
+			}
+			return
+		}
+
+		client.touch()
+		ok, keep := client.allowMessage()
+		if !keep {
+			return
+		}
+		if ok && !s.handleMessage(client, msg) {
+			return
+		}
+	}
+}
+
+// handleMessage разбирает и выполняет одно сообщение клиента.
+// false — соединение нужно закрыть.
+func (s *Server) handleMessage(client *Client, msg []byte) bool {
+	// Тип определяем без декодирования остального сообщения
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(msg, &head); err != nil {
+		client.logger.Warn("JSON decode error", "err", err)
+		client.sendError("INVALID_MESSAGE", "message must be a JSON object with a string type")
+		return true
+	}
+	if !client.authed.Load() && head.Type != "auth" && head.Type != "hello" {
+		client.holdPreAuth(msg)
+		return true
+	}
+	s.metrics.messages.WithLabelValues(messageTypeLabel(head.Type)).Inc()
+	if head.Type == "offer" {
+		client.signaled.Store(true)
+	}
+	if head.Type == "ice-batch" {
+		if !client.hasFeature(featureICEBatch) {
+			client.sendError("FEATURE_NOT_NEGOTIATED", "ice-batch was not agreed in hello")
+			return true
+		}
+		if !client.authorize(head.Type, nil) {
+			return true
+		}
+		client.spawn(head.Type, func() { s.handleICEBatch(client, msg) })
+		return true
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(msg, &data); err != nil {
+		client.logger.Warn("JSON decode error", "err", err)
+		client.sendError("INVALID_MESSAGE", "message must be a JSON object with a string type")
+		return true
+	}
+
+	if s.cfg.SchemaValidation {
+		if fields, err := s.validateMessage(data); err != nil {
+			client.logger.Warn("schema validation failed", "err", err)
+			client.sendJSON(errorMessage{
+				Type:    "error",
+				Code:    "SCHEMA_VALIDATION_FAILED",
+				Message: err.Error(),
+				Fields:  fields,
+			})
+			return true
+		}
+	}
+
+	if head.Type != "hello" && head.Type != "auth" && !client.authorize(head.Type, data) {
+		return true
+	}
+
+	// В режиме relay сервер не отвечает на offer сам, а передает
+	// сигнализацию второму участнику комнаты
+	if s.cfg.SignalingMode == "relay" && client.currentRoom() != nil {
+		switch head.Type {
+		case "offer", "answer", "ice":
+			s.forwardToRoom(client, data)
+			return true
+		}
+	}
+
+	switch head.Type {
+	case "hello":
+		var m helloMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			client.handleHello(m.Version, m.Features)
+		}
+	case "auth":
+		var m authMessage
+		if !client.decodeMessage(head.Type, msg, &m) {
+			return true
+		}
+		if !client.authenticate(m.Key) {
+			return false
+		}
+		return client.replayPreAuth()
+	case "offer":
+		var m offerMessage
+		if !client.decodeMessage(head.Type, msg, &m) {
+			return true
+		}
+		opus, err := s.sessionOpusParams(m.Opus)
+		if err != nil {
+			client.sendError("INVALID_OPUS_PARAMS", err.Error())
+			return true
+		}
+		client.spawn(head.Type, func() { s.handleOffer(client, m.SDP, opus) })
+	case "answer":
+		var m answerMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			client.spawn(head.Type, func() { handleAnswer(client, m.SDP) })
+		}
+	case "ice":
+		var m iceMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			client.spawn(head.Type, func() { handleICE(client, *m.Candidate) })
+		}
+	case "state-set":
+		var m stateSetMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.setRoomState(client, *m.Key, m.Value)
+		}
+	case "state-get":
+		s.sendRoomState(client)
+	case "join":
+		var m joinMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.handleJoin(client, m.Room, m.Role)
+		}
+	case "leave":
+		var m leaveMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.handleLeave(client)
+		}
+	case "get-ice-servers":
+		s.handleGetICEServers(client)
+	case "open-channel":
+		var opts channelOptions
+		if err := json.Unmarshal(msg, &opts); err != nil || opts.Label == "" {
+			client.sendError("INVALID_CHANNEL_OPTIONS", "open-channel needs a label and numeric options")
+			return true
+		}
+		client.spawn(head.Type, func() { handleOpenChannel(client, opts) })
+	case "start-recording":
+		var m recordingMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.handleStartRecording(client, m.Scope)
+		}
+	case "stop-recording":
+		var m recordingMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.handleStopRecording(client, m.Scope)
+		}
+	case "restream":
+		var m restreamMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.handleRestream(client, m.URL, m.Stop)
+		}
+	case "setLayer":
+		var m setLayerMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.handleSetLayer(client, m)
+		}
+	case "file-upload":
+		var m fileUploadMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			s.handleFileUpload(client, m)
+		}
+	case "file-download":
+		var m fileDownloadMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			client.spawn(head.Type, func() { s.handleFileDownload(client, m) })
+		}
+	case "file-cancel":
+		var m fileCancelMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			handleFileCancel(client, m.ID)
+		}
+	case "media-playing":
+		var m mediaPlayingMessage
+		if client.decodeMessage(head.Type, msg, &m) {
+			client.reportPlayback(*m.OK)
+		}
+	default:
+		if client.protocol.Load() >= 2 {
+			client.sendError("UNKNOWN_TYPE", fmt.Sprintf("unknown message type %q", head.Type))
+		}
+	}
+	return true
+}
+
+func (s *Server) cleanupClient(client *Client) {
+	client.closeOnce.Do(func() {
+		client.forgetSession()
+		s.clients.remove(client)
+		client.webhook("client-disconnected", map[string]interface{}{
+			"duration": time.Since(client.connectedAt).Seconds(),
+		})
+		s.leaveRoom(client)
+		s.stopRecordingOf("peer", client.id)
+		stopEgressOf(client, "client disconnected")
+		client.dropFiles()
+		s.closeConn(client)
+		if pc := client.pc.Load(); pc != nil {
+			pc.Close()
+		}
+		s.releaseTCPRelay(client)
+		client.event("disconnected")
+		s.rememberClosed(client)
+		client.statsMu.Lock()
+		profile := client.srtpProfile
+		client.statsMu.Unlock()
+		if profile != "" {
+			client.logger.Info("disconnected", "srtp", profile)
+		} else {
+			client.logger.Info("disconnected")
+		}
+	})
+}
+
+// closeConn закрывает WebSocket. С включенным CloseHandshake сначала
+// отправляется close-фрейм и ожидается ответный (не дольше таймаута).
+func (s *Server) closeConn(client *Client) {
+	conn := client.currentConn()
+	// Если close прислал клиент, gorilla уже ответил на него сама
+	if s.cfg.CloseHandshake && !client.peerClosed.Load() && !client.closeSent.Load() {
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		deadline := time.Now().Add(s.cfg.CloseHandshakeTimeout)
+		if err := conn.WriteControl(websocket.CloseMessage, msg, deadline); err == nil {
+			select {
+			case <-client.readDone:
+			case <-time.After(s.cfg.CloseHandshakeTimeout):
+			}
+		}
+	}
+	conn.Close()
+}
+
+func (s *Server) handleOffer(client *Client, sdp string, opus media.OpusParams) {
+	client.negotiationMu.Lock()
+	defer client.negotiationMu.Unlock()
+	client.opus = opus
+
+	client.event("offer-received")
+	current := client.pc.Load()
+	client.logger.Info("offer received", "renegotiation", current != nil)
+	s.metrics.offers.Inc()
+	if client.rejectWithoutCommonCodec(sdp) {
+		return
+	}
+	if current != nil {
+		s.renegotiate(client, current, sdp)
+		return
+	}
+
+	ctx, cancel := s.setupContext()
+
+	config := webrtc.Configuration{
+		ICEServers:   s.iceServersFor(client),
+		BundlePolicy: media.BundlePolicies[s.cfg.BundlePolicy],
+	}
+
+	pc, estimator, err := s.newPeerConnection(config)
+	if errors.Is(err, errPeerLimit) {
+		cancel()
+		client.logger.Warn("rejecting offer: peer connection limit", "limit", s.cfg.MaxPeerConnections)
+		client.sendJSON(errorMessage{
+			Type:       "error",
+			Code:       "PEER_LIMIT",
+			Message:    fmt.Sprintf("server has %d peer connections, try again later", s.cfg.MaxPeerConnections),
+			RetryAfter: s.retryAfterSeconds(s.cfg.RetryAfter),
+		})
+		return
+	}
+	if err != nil {
+		cancel()
+		client.logger.Error("PeerConnection error", "err", err)
+		return
+	}
+	if ctx.Err() != nil {
+		cancel()
+		s.abortSetup(client, pc)
+		return
+	}
+
+	client.pc.Store(pc)
+	if estimator != nil {
+		client.watchBWE(estimator)
+		if s.cfg.BWEReportInterval > 0 {
+			go s.reportBWE(client, pc, estimator)
+		}
+	}
+
+	gathered := make(chan struct{})
+	var gatheredOnce sync.Once
+
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			client.event("ice-gathering-complete")
+			gatheredOnce.Do(func() { close(gathered) })
+			return
+		}
+		client.recordCandidateLatency(c)
+		client.logger.Debug("local candidate", "candidate", c.String())
+		// Без trickle кандидаты уходят в самом answer
+		if s.cfg.NonTrickle {
+			return
+		}
+		if s.cfg.AnswerCandidateDelay > 0 {
+			select {
+			case <-client.trickleReady:
+			case <-client.readDone:
+				return
+			}
+		}
+		if client.sendJSON(map[string]interface{}{
+			"type":      "ice",
+			"candidate": c.ToJSON(),
+		}) == nil {
+			s.metrics.candidates.Inc()
+		}
+	})
+
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		client.logger.Debug("ICE state changed", "state", state.String())
+		s.metrics.iceStates.WithLabelValues(state.String()).Inc()
+		switch state {
+		case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+			client.event("ice-" + state.String())
+			select {
+			case client.iceConnected <- struct{}{}:
+			default:
+			}
+		case webrtc.ICEConnectionStateFailed:
+			client.webhook("ice-failed", nil)
+			if client.noteICEFailure() {
+				go s.giveUpICE(client, pc)
+			} else if s.cfg.ICERecovery {
+				go s.recoverICE(client, pc)
+			} else {
+				client.recordFailure(iceFailure(client, pc))
+			}
+		}
+	})
+
+	pc.SCTP().Transport().OnStateChange(func(state webrtc.DTLSTransportState) {
+		switch state {
+		case webrtc.DTLSTransportStateConnected:
+			client.established.Store(true)
+			client.event("dtls-connected")
+			client.recordSRTPProfile()
+		case webrtc.DTLSTransportStateFailed:
+			client.recordFailure(failureDTLS)
+		}
+	})
+
+	s.trackTCPRelay(client, pc)
+
+	// Изменения на стороне сервера (треки sfu, open-channel) согласуются
+	// offer'ом сервера
+	pc.OnNegotiationNeeded(func() { go sendServerOffer(client, pc) })
+
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		s.handleDataChannel(client, dc)
+	})
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		codec := track.Codec()
+		client.logger.Info("track received", "kind", track.Kind().String(), "codec", codec.MimeType)
+		client.setCodec(track.Kind().String(), codec.MimeType)
+		if s.hooks.OnTrack != nil {
+			s.hooks.OnTrack(client, track)
+		}
+
+		rs := client.addReceiveStats(track)
+		rec := client.addTrackRecorder(pc, track)
+		defer client.removeTrackRecorder(rec)
+
+		var kf *keyframeTracker
+		done := make(chan struct{})
+		defer close(done)
+
+		if track.Kind() == webrtc.RTPCodecTypeVideo {
+			kf = client.addKeyframeTracker(track.ID())
+			if s.cfg.KeyframeInterval > 0 {
+				go enforceKeyframes(pc, track, kf, s.cfg.KeyframeInterval, done)
+			}
+		}
+
+		var levelExt uint8
+		if s.cfg.ActiveSpeakerInterval > 0 && track.Kind() == webrtc.RTPCodecTypeAudio {
+			levelExt = audioLevelExtension(receiver)
+		}
+
+		var ft *forwardedTrack
+		if s.forwardsMedia() && !client.viewerInSFU() {
+			var err error
+			if ft, err = client.publishTrack(pc, track); err != nil {
+				client.logger.Error("publish track error", "err", err)
+			} else {
+				defer client.unpublishTrack(ft, track.RID())
+			}
+		}
+
+		for {
+			pkt, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			if !client.firstMedia.Swap(true) {
+				client.event("first-media")
+			}
+			rs.update(pkt, time.Now())
+			if kf != nil {
+				kf.observe(pkt, codec.MimeType)
+			}
+			if levelExt != 0 {
+				client.audioLevel.observe(pkt, levelExt)
+			}
+			if ft != nil {
+				ft.write(track.RID(), pkt)
+			}
+			rec.write(pkt)
+			if e := client.egress.Load(); e != nil {
+				e.write(track.Kind(), pkt)
+			}
+		}
+	})
+
+	if s.cfg.QualityInterval > 0 {
+		go s.monitorQuality(client, pc)
+	}
+
+	// Добавляем транспондеры
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
+		client.logger.Error("AddTransceiver video error", "err", err)
+	}
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
+		client.logger.Error("AddTransceiver audio error", "err", err)
+	}
+
+	go s.watchSetup(ctx, cancel, client, pc, gathered)
+	s.answerOffer(ctx, client, pc, sdp)
+	if s.forwardsMedia() {
+		client.setProxyPC(pc)
+	}
+
+	if s.cfg.TURNTCPFallback {
+		go s.fallbackToTURNTCP(client, pc)
+	}
+}
+
+// answerOffer применяет offer клиента и отправляет ответ. Отмена ctx
+// прерывает работу между шагами.
+func (s *Server) answerOffer(ctx context.Context, client *Client, pc *webrtc.PeerConnection, sdp string) {
+	start := time.Now()
+	// Устанавливаем удаленное описание
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  sdp,
+	}); err != nil {
+		client.logger.Warn("SetRemoteDescription error", "err", err)
+		client.recordFailure(failureSDPInvalid)
+		// Неверный offer при пересогласовании не трогает работающую
+		// сессию, а PC без первого описания уже ни на что не годен
+		if pc.CurrentRemoteDescription() == nil {
+			failSetup(client, pc)
+		}
+		return
+	}
+	client.recordICELite(sdp)
+	s.serverCodecs().ApplyPreferences(pc, sdp)
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Создаем ответ
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		client.logger.Error("CreateAnswer error", "err", err)
+		failSetup(client, pc)
+		return
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Устанавливаем локальное описание
+	var gatherComplete <-chan struct{}
+	if s.cfg.NonTrickle {
+		gatherComplete = webrtc.GatheringCompletePromise(pc)
+	}
+	client.startGathering()
+	if err := pc.SetLocalDescription(answer); err != nil {
+		client.logger.Error("SetLocalDescription error", "err", err)
+		failSetup(client, pc)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if gatherComplete != nil {
+		select {
+		case <-gatherComplete:
+		case <-client.readDone:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	s.checkBundle(client, sdp, pc.LocalDescription().SDP)
+	client.recordHeaderExtensions(pc.LocalDescription().SDP)
+
+	// Ограничения разрешения нужны только отправителю видео, то есть
+	// клиенту. pion не принимает измененный answer в SetLocalDescription,
+	// поэтому они дописываются в копию, которая уходит клиенту.
+	reply, err := media.LimitResolution(*pc.LocalDescription(), s.cfg.MaxVideoWidth, s.cfg.MaxVideoHeight)
+	if err != nil {
+		client.logger.Error("resolution limit error", "err", err)
+		failSetup(client, pc)
+		return
+	}
+	reply, err = media.ApplyOpusParams(reply, client.opus)
+	if err != nil {
+		client.logger.Error("Opus params error", "err", err)
+		failSetup(client, pc)
+		return
+	}
+	if s.cfg.NonTrickle {
+		reply, err = s.limitAnswerCandidates(reply, s.cfg.AnswerMaxCandidates)
+		if errors.Is(err, errAnswerTooLarge) {
+			client.logger.Warn("answer too large", "err", err)
+			rejectSetup(client, pc, "ANSWER_TOO_LARGE", err.Error())
+			return
+		}
+		if err != nil {
+			client.logger.Error("answer candidate limit error", "err", err)
+			failSetup(client, pc)
+			return
+		}
+	}
+
+	// Отправляем ответ
+	if err := client.sendJSON(map[string]interface{}{
+		"type": "answer",
+		"sdp":  reply.SDP,
+	}); err != nil {
+		client.logger.Warn("send answer failed", "err", err)
+		return
+	}
+	client.logger.Info("answer sent", "took", time.Since(start).String())
+	s.metrics.answers.Inc()
+	s.metrics.offerDuration.Observe(time.Since(start).Seconds())
+
+	client.trickleReadyOnce.Do(func() {
+		time.AfterFunc(s.cfg.AnswerCandidateDelay, func() { close(client.trickleReady) })
+	})
+}
+
+func handleICE(client *Client, candidate webrtc.ICECandidateInit) {
+	if !client.allowCandidate() {
+		return
+	}
+	addICECandidate(client, candidate)
+}
+
+func addICECandidate(client *Client, candidate webrtc.ICECandidateInit) {
+	pc := client.pc.Load()
+	if pc == nil {
+		return
+	}
+
+	client.logger.Debug("remote candidate", "candidate", candidate.Candidate)
+	if err := pc.AddICECandidate(candidate); err != nil {
+		client.logger.Warn("AddICECandidate error", "err", err)
+	}
+}
@@ -0,0 +1,75 @@
+package signaling
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type clientShard struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// clientRegistry — активные клиенты, разбитые на CLIENT_SHARDS шардов по
+// хешу id. Подключение и отключение блокируют только свой шард, поэтому
+// не сериализуются глобально.
+type clientRegistry struct {
+	shards []clientShard
+	// gauge — webrtc_clients сервера по арендаторам
+	gauge *prometheus.GaugeVec
+}
+
+func newClientRegistry(shards int, gauge *prometheus.GaugeVec) *clientRegistry {
+	r := &clientRegistry{shards: make([]clientShard, shards), gauge: gauge}
+	for i := range r.shards {
+		r.shards[i].clients = make(map[string]*Client)
+	}
+	return r
+}
+
+func (r *clientRegistry) shard(id string) *clientShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &r.shards[h.Sum32()%uint32(len(r.shards))]
+}
+
+func (r *clientRegistry) add(client *Client) {
+	s := r.shard(client.id)
+	s.mu.Lock()
+	s.clients[client.id] = client
+	r.gauge.WithLabelValues(client.tenant).Inc()
+	s.mu.Unlock()
+}
+
+func (r *clientRegistry) remove(client *Client) {
+	s := r.shard(client.id)
+	s.mu.Lock()
+	if _, ok := s.clients[client.id]; ok {
+		delete(s.clients, client.id)
+		r.gauge.WithLabelValues(client.tenant).Dec()
+	}
+	s.mu.Unlock()
+}
+
+func (r *clientRegistry) get(id string) *Client {
+	s := r.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients[id]
+}
+
+// snapshot копирует список клиентов, держа за раз блокировку одного шарда
+func (r *clientRegistry) snapshot() []*Client {
+	var list []*Client
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		for _, client := range s.clients {
+			list = append(list, client)
+		}
+		s.mu.Unlock()
+	}
+	return list
+}
@@ -0,0 +1,38 @@
+package signaling
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Подключения и отключения клиентов параллельно со сбором статистики
+// (каждая 64-я операция — snapshot) на одном шарде и на шардах по
+// умолчанию
+func BenchmarkClientRegistryChurn(b *testing.B) {
+	for _, shards := range []int{1, 32} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "clients"}, []string{"tenant"})
+			r := newClientRegistry(shards, gauge)
+			// Постоянные клиенты, чтобы snapshot было что копировать
+			for i := 0; i < 1000; i++ {
+				r.add(&Client{id: newClientID()})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				n := 0
+				for pb.Next() {
+					n++
+					if n%64 == 0 {
+						r.snapshot()
+						continue
+					}
+					client := &Client{id: newClientID()}
+					r.add(client)
+					r.remove(client)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package signaling
+
+import "go-webrtc/media"
+
+// rejectWithoutCommonCodec отвечает NO_COMMON_CODEC, если включен
+// REQUIRE_COMMON_CODEC и в offer есть секция без общего кодека
+func (c *Client) rejectWithoutCommonCodec(sdp string) bool {
+	if !c.srv.cfg.RequireCommonCodec {
+		return false
+	}
+	reason := c.srv.serverCodecs().MissingCommon(sdp)
+	if reason == "" {
+		return false
+	}
+	c.logger.Warn("rejecting offer: no common codec", "reason", reason)
+	c.srv.metrics.codecRejections.Inc()
+	c.sendError("NO_COMMON_CODEC", reason)
+	return true
+}
+
+// serverCodecs — набор кодеков по VIDEO_CODECS, AUDIO_CODECS и
+// VIDEO_RTCP_FEEDBACK
+func (s *Server) serverCodecs() media.Codecs {
+	return media.Codecs{Video: s.cfg.VideoCodecs, Audio: s.cfg.AudioCodecs, VideoFeedback: s.cfg.VideoRTCPFeedback}
+}
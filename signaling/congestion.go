@@ -0,0 +1,97 @@
+package signaling
+
+import "time"
+
+// Управление перегрузкой при пересылке (CONGESTION_CONTROL). Полоса к
+// каждому подписчику оценивается GCC по его TWCC-отчетам, без TWCC — по
+// REMB. Подписчику "auto" идет слой, который помещается в оценку; если не
+// помещается даже нижний, пересылка видео ему приостанавливается, и он
+// получает {"type":"congestion","paused":true}. Пока видео нет, оценка
+// почти не растет, поэтому через congestionProbeInterval пересылка пробно
+// возобновляется с ключевого кадра: если полосы по-прежнему не хватает,
+// она снова встанет.
+
+const (
+	congestionProbeInterval = 10 * time.Second
+	// Сколько пересылка идет после возобновления, прежде чем ее снова
+	// можно приостановить: оценке нужно время, чтобы подняться
+	congestionHold = 3 * time.Second
+)
+
+type congestionEvent struct {
+	client   *Client
+	paused   bool
+	estimate int
+}
+
+// throttle приостанавливает или возобновляет выход out по оценке полосы
+// к подписчику. changed — состояние изменилось. Вызывается под s.mu.
+func (s *simulcastState) throttle(out *layerOutput, estimate int) (paused, changed bool) {
+	congested := estimate > 0 && len(s.layers) > 0 &&
+		float64(s.layers[0].bitrate) > float64(estimate)*simulcastHeadroom
+	since := time.Since(out.throttledAt)
+	switch {
+	case congested && !out.paused && since >= congestionHold:
+		out.paused = true
+		s.from.srv.metrics.congestionPauses.Inc()
+	case out.paused && (!congested || since >= congestionProbeInterval):
+		out.paused, out.resync = false, true
+	default:
+		return out.paused, false
+	}
+	out.throttledAt = time.Now()
+	return out.paused, true
+}
+
+func (s *simulcastState) notifyCongestion(e congestionEvent) {
+	e.client.sendJSON(map[string]interface{}{
+		"type":     "congestion",
+		"from":     s.from.id,
+		"track":    s.trackID,
+		"paused":   e.paused,
+		"estimate": e.estimate,
+	})
+	e.client.logger.Info("forwarding throttled", "from", s.from.id, "track", s.trackID, "paused", e.paused, "estimate", e.estimate)
+}
+
+// pausedFor — приостановлена ли пересылка подписчику c
+func (s *simulcastState) pausedFor(c *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.outs[c]
+	return out != nil && out.paused
+}
+
+type downlinkStats struct {
+	EstimateBps  int                    `json:"estimateBps"`
+	Source       string                 `json:"source"`
+	PausedTracks int                    `json:"pausedTracks"`
+	GCC          map[string]interface{} `json:"gcc,omitempty"`
+}
+
+// downlinkStats — оценка полосы к клиенту для /stats, nil — оценки нет.
+// Вызывается не под statsMu: выходы подписчика берутся под s.mu.
+func (c *Client) downlinkStats() *downlinkStats {
+	c.statsMu.Lock()
+	bwe, remb, estimator := c.bwe, c.remb, c.estimator
+	c.statsMu.Unlock()
+
+	d := &downlinkStats{EstimateBps: bwe, Source: "twcc"}
+	if bwe <= 0 {
+		d.EstimateBps, d.Source = remb, "remb"
+	}
+	if d.EstimateBps <= 0 {
+		return nil
+	}
+	if bwe > 0 && estimator != nil {
+		d.GCC = estimator.GetStats()
+	}
+	c.proxy.mu.Lock()
+	for _, ft := range c.proxy.senders {
+		if ft != nil && ft.simulcast != nil && ft.simulcast.pausedFor(c) {
+			d.PausedTracks++
+		}
+	}
+	c.proxy.mu.Unlock()
+	return d
+}
@@ -0,0 +1,119 @@
+package signaling
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Лимитер адреса, к которому столько не было подключений, удаляется
+const ipLimiterIdle = 5 * time.Minute
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiters — token bucket на каждый адрес клиента
+type ipLimiters struct {
+	srv      *Server
+	mu       sync.Mutex
+	limiters map[string]*ipLimiter
+}
+
+func (l *ipLimiters) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.limiters[ip]
+	if !ok {
+		e = &ipLimiter{limiter: rate.NewLimiter(rate.Limit(l.srv.cfg.ConnectRatePerIP), l.srv.cfg.ConnectBurstPerIP)}
+		l.limiters[ip] = e
+	}
+	e.lastSeen = time.Now()
+	return e.limiter.Allow()
+}
+
+// cleanup удаляет лимитеры адресов, давно не подключавшихся. К этому
+// времени их bucket все равно снова полон.
+func (l *ipLimiters) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.srv.done:
+			return
+		}
+		l.mu.Lock()
+		for ip, e := range l.limiters {
+			if time.Since(e.lastSeen) > ipLimiterIdle {
+				delete(l.limiters, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// connRejection — отказ в подключении до начала сессии
+type connRejection struct {
+	status     int
+	message    string
+	retryAfter time.Duration
+}
+
+// withConnLimits отклоняет подключение до Upgrade: 429, если адрес
+// подключается чаще CONNECT_RATE_PER_IP или держит MAX_CONNECTIONS_PER_IP
+// подключений, и 503 сверх MAX_CLIENTS или во время выключения
+func (s *Server) withConnLimits(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, rej := s.admitConn(r)
+		if rej != nil {
+			s.rejectBusy(w, rej.status, rej.message, rej.retryAfter)
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
+
+// admitConn проверяет лимиты подключений для WebSocket и gRPC. release
+// освобождает занятые подключением места.
+func (s *Server) admitConn(r *http.Request) (release func(), rej *connRejection) {
+	if s.draining.Load() {
+		return nil, &connRejection{http.StatusServiceUnavailable, "server shutting down", s.cfg.RetryAfter}
+	}
+	if s.cfg.ConnectRatePerIP > 0 {
+		ip := s.clientIP(r)
+		if !s.connectLimiters.allow(ip) {
+			slog.Info("rejecting: connection rate limit", "ip", ip)
+			return nil, &connRejection{http.StatusTooManyRequests, "too many connections", time.Duration(float64(time.Second) / s.cfg.ConnectRatePerIP)}
+		}
+	}
+	var releases []func()
+	release = func() {
+		for _, f := range releases {
+			f()
+		}
+	}
+	if s.cfg.MaxConnectionsPerIP > 0 {
+		ip := s.clientIP(r)
+		if !s.acquireIPConn(ip) {
+			slog.Info("rejecting: too many connections from address", "ip", ip, "limit", s.cfg.MaxConnectionsPerIP)
+			return nil, &connRejection{http.StatusTooManyRequests, "too many connections from this address", s.cfg.RetryAfter}
+		}
+		releases = append(releases, func() { s.releaseIPConn(ip) })
+	}
+	if s.cfg.MaxClients > 0 {
+		if s.activeConns.Add(1) > int64(s.cfg.MaxClients) {
+			s.activeConns.Add(-1)
+			release()
+			slog.Info("rejecting: server full", "remote", r.RemoteAddr, "limit", s.cfg.MaxClients)
+			return nil, &connRejection{http.StatusServiceUnavailable, "server full", s.cfg.RetryAfter}
+		}
+		releases = append(releases, func() { s.activeConns.Add(-1) })
+	}
+	return release, nil
+}
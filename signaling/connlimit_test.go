@@ -0,0 +1,172 @@
+package signaling
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"go-webrtc/config"
+)
+
+func TestConnLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*config.Config)
+		allowed   int
+		status    int
+		// Место освобождается после отключения; у rate limit — нет
+		reusable bool
+	}{
+		{"MAX_CLIENTS", func(c *config.Config) {
+			c.MaxClients = 2
+			c.MaxConnectionsPerIP = 0
+			c.ConnectRatePerIP = 0
+		}, 2, http.StatusServiceUnavailable, true},
+		{"MAX_CONNECTIONS_PER_IP", func(c *config.Config) {
+			c.MaxClients = 0
+			c.MaxConnectionsPerIP = 2
+			c.ConnectRatePerIP = 0
+		}, 2, http.StatusTooManyRequests, true},
+		{"CONNECT_RATE_PER_IP", func(c *config.Config) {
+			c.MaxClients = 0
+			c.MaxConnectionsPerIP = 0
+			c.ConnectRatePerIP = 0.001
+			c.ConnectBurstPerIP = 2
+		}, 2, http.StatusTooManyRequests, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newTestServer(t, tt.configure)
+			first := dialWS(t, ts, "")
+			for i := 1; i < tt.allowed; i++ {
+				dialWS(t, ts, "")
+			}
+			waitFor(t, "clients to connect", func() bool { return len(s.clients.snapshot()) == tt.allowed })
+
+			ws, resp, err := tryDialWS(ts, "", nil)
+			if err == nil {
+				ws.Close()
+				t.Fatalf("connection %d accepted, want %d", tt.allowed+1, tt.status)
+			}
+			if resp == nil || resp.StatusCode != tt.status {
+				t.Fatalf("dial error %v, response %v, want status %d", err, resp, tt.status)
+			}
+			if resp.Header.Get("Retry-After") == "" {
+				t.Fatal("rejection without Retry-After")
+			}
+
+			first.Close()
+			waitFor(t, "client to disconnect", func() bool { return len(s.clients.snapshot()) == tt.allowed-1 })
+			if tt.reusable {
+				// Место освобождается, когда обработчик /ws завершится,
+				// чуть позже удаления клиента из списка
+				waitFor(t, "slot to be released", func() bool {
+					ws, _, err := tryDialWS(ts, "", nil)
+					if err != nil {
+						return false
+					}
+					ws.Close()
+					return true
+				})
+				return
+			}
+			if _, resp, err = tryDialWS(ts, "", nil); err == nil || resp == nil || resp.StatusCode != tt.status {
+				t.Fatalf("rate limit reset by disconnect: %v, %v", err, resp)
+			}
+		})
+	}
+}
+
+// MAX_ROOMS_PER_USER действует и на комнату из ?room= при подключении,
+// а не только на join
+func TestRoomQuotaOnConnect(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.AuthMode = "token"
+		c.AuthTokenSecret = testTokenSecret
+		c.MaxRoomsPerUser = 2
+	})
+	token := testToken(t, map[string]interface{}{"sub": "alice", "exp": float64(time.Now().Add(time.Hour).Unix())})
+	for _, room := range []string{"a", "b"} {
+		readType(t, dialWS(t, ts, "room="+room+"&token="+token), "state")
+	}
+	waitFor(t, "clients to join", func() bool { return len(s.clients.snapshot()) == 2 })
+
+	ws := dialWS(t, ts, "room=c&token="+token)
+	readError(t, ws, "ROOM_QUOTA")
+	expectClose(t, ws, websocket.ClosePolicyViolation)
+	if n := len(s.clients.snapshot()); n != 2 {
+		t.Fatalf("%d clients connected, want 2", n)
+	}
+}
+
+// В режиме sfu публикующий сверх MAX_PUBLISHERS_PER_ROOM получает
+// PUBLISHER_LIMIT_EXCEEDED и при подключении, и по join; зрителей предел
+// не касается
+func TestPublisherLimit(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.SignalingMode = "sfu"
+		c.MaxPublishersPerRoom = 1
+	})
+	readType(t, dialWS(t, ts, "room=show"), "state")
+	readError(t, dialWS(t, ts, "room=show"), "PUBLISHER_LIMIT_EXCEEDED")
+	readType(t, dialWS(t, ts, "room=show&role=viewer"), "state")
+
+	ws := dialWS(t, ts, "room=lobby")
+	readType(t, ws, "state")
+	sendJSON(t, ws, map[string]string{"type": "join", "room": "show"})
+	readError(t, ws, "PUBLISHER_LIMIT_EXCEEDED")
+	sendJSON(t, ws, map[string]string{"type": "join", "room": "show", "role": "viewer"})
+	readType(t, ws, "joined")
+
+	info, ok := s.rooms.Get("show")
+	if !ok {
+		t.Fatal("room show does not exist")
+	}
+	if publishers, viewers := roomRoles(info.Members); publishers != 1 || viewers != 2 {
+		t.Fatalf("room show has %d publishers and %d viewers, want 1 and 2", publishers, viewers)
+	}
+}
+
+// Ушедшие из очереди ACCEPT_QUEUE клиенты не держат свои слоты: ни
+// следующий клиент, ни Retry-After их не ждут
+func TestAcceptQueueReleasesCancelledSlots(t *testing.T) {
+	s, _ := newTestServer(t, func(c *config.Config) {
+		c.AcceptRate = 10
+		c.AcceptQueue = 100
+	})
+	first := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	if !s.accepts.wait(first) {
+		t.Fatal("first connection was not accepted")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil).WithContext(ctx)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.accepts.wait(r) {
+				t.Error("cancelled connection was accepted")
+			}
+		}()
+		time.AfterFunc(10*time.Millisecond, cancel)
+	}
+	wg.Wait()
+
+	if backlog := s.accepts.backlog(); backlog > 200*time.Millisecond {
+		t.Fatalf("backlog = %s after all waiters left, want at most one interval", backlog)
+	}
+	start := time.Now()
+	if !s.accepts.wait(httptest.NewRequest(http.MethodGet, "/ws", nil)) {
+		t.Fatal("next connection was not accepted")
+	}
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Fatalf("next connection waited %s for slots of cancelled clients", took)
+	}
+}
@@ -0,0 +1,47 @@
+package signaling
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withCORS добавляет CORS-заголовки для HTTP-эндпоинтов.
+// WebSocket сюда не относится: там работает upgrader.CheckOrigin.
+func (s *Server) withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && originAllowed(origin, s.cfg.CORSAllowedOrigins) {
+			h := w.Header()
+			if len(s.cfg.CORSAllowedOrigins) == 1 && s.cfg.CORSAllowedOrigins[0] == "*" {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Add("Vary", "Origin")
+			}
+
+			// Preflight
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", strings.Join(s.cfg.CORSAllowedMethods, ", "))
+				h.Set("Access-Control-Allow-Headers", strings.Join(s.cfg.CORSAllowedHeaders, ", "))
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func originAllowed(origin string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+	}
+	return false
+}
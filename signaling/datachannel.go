@@ -0,0 +1,160 @@
+package signaling
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// handleDataChannel учитывает каналы, открытые клиентом, и закрывает
+// те, что превышают лимит MaxDataChannels.
+func (s *Server) handleDataChannel(client *Client, dc *webrtc.DataChannel) {
+	if n := client.dataChannels.Add(1); s.cfg.MaxDataChannels > 0 && int(n) > s.cfg.MaxDataChannels {
+		client.dataChannels.Add(-1)
+		client.logger.Warn("data channel limit exceeded", "label", dc.Label(), "limit", s.cfg.MaxDataChannels)
+		if err := dc.Close(); err != nil {
+			client.logger.Warn("data channel close error", "label", dc.Label(), "err", err)
+		}
+		client.sendError("DATA_CHANNEL_LIMIT", fmt.Sprintf("data channel %q rejected: at most %d channels per session", dc.Label(), s.cfg.MaxDataChannels))
+		return
+	}
+
+	// Каналы файлов не пересылаются участникам
+	if strings.HasPrefix(dc.Label(), fileLabelPrefix) {
+		handleFileChannel(client, dc)
+		return
+	}
+
+	client.logger.Info("data channel opened", "label", dc.Label())
+	client.addChannel(dc)
+	s.watchChannel(client, dc, nil)
+}
+
+// watchChannel снимает канал с учета при закрытии и подключает его к
+// пересылке; opened, если задан, вызывается при открытии. Без комнаты
+// пересылать некому, но клиент может войти в нее позже.
+func (s *Server) watchChannel(client *Client, dc *webrtc.DataChannel, opened func()) {
+	dc.OnClose(func() {
+		client.dataChannels.Add(-1)
+		client.removeChannel(dc)
+		client.logger.Info("data channel closed", "label", dc.Label())
+	})
+	s.relayDataChannel(client, dc, opened)
+}
+
+// channelOptions — параметры канала из сообщения open-channel
+type channelOptions struct {
+	Label             string  `json:"label"`
+	Ordered           *bool   `json:"ordered"`
+	MaxRetransmits    *uint16 `json:"maxRetransmits"`
+	MaxPacketLifeTime *uint16 `json:"maxPacketLifeTime"`
+	Protocol          *string `json:"protocol"`
+}
+
+func (o channelOptions) init() *webrtc.DataChannelInit {
+	return &webrtc.DataChannelInit{
+		Ordered:           o.Ordered,
+		MaxRetransmits:    o.MaxRetransmits,
+		MaxPacketLifeTime: o.MaxPacketLifeTime,
+		Protocol:          o.Protocol,
+	}
+}
+
+// sourceChannelInit повторяет параметры канала-источника для канала,
+// который сервер открывает у получателя
+func sourceChannelInit(dc *webrtc.DataChannel) *webrtc.DataChannelInit {
+	ordered := dc.Ordered()
+	protocol := dc.Protocol()
+	return &webrtc.DataChannelInit{
+		Ordered:           &ordered,
+		MaxRetransmits:    dc.MaxRetransmits(),
+		MaxPacketLifeTime: dc.MaxPacketLifeTime(),
+		Protocol:          &protocol,
+	}
+}
+
+// handleOpenChannel открывает со стороны сервера канал с параметрами из
+// {"type":"open-channel","label":"chat","ordered":false,"maxRetransmits":0}.
+// Клиент получает его через ondatachannel и channel-opened, когда канал
+// откроется; сообщения пересылаются участникам комнаты, как и в каналах
+// клиента.
+func handleOpenChannel(client *Client, opts channelOptions) {
+	if opts.MaxRetransmits != nil && opts.MaxPacketLifeTime != nil {
+		client.sendError("INVALID_CHANNEL_OPTIONS", "maxRetransmits and maxPacketLifeTime are mutually exclusive")
+		return
+	}
+
+	client.negotiationMu.Lock()
+	defer client.negotiationMu.Unlock()
+	pc := client.pc.Load()
+	if pc == nil {
+		client.sendError("NO_PEER_CONNECTION", "send an offer before opening channels")
+		return
+	}
+	// Первый канал без m=application сервер согласует своим offer'ом
+	dc, err := client.createChannel(pc, opts.Label, opts.init())
+	if err != nil {
+		client.sendError("CHANNEL_ERROR", err.Error())
+		return
+	}
+	if dc == nil {
+		client.sendError("CHANNEL_EXISTS", fmt.Sprintf("data channel %q is already open", opts.Label))
+	}
+}
+
+// createChannel открывает канал label у клиента, если его еще нет, и
+// ставит его на учет, как канал клиента. nil без ошибки — канал уже
+// есть.
+func (c *Client) createChannel(pc *webrtc.PeerConnection, label string, init *webrtc.DataChannelInit) (*webrtc.DataChannel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.channels[label] != nil {
+		return nil, nil
+	}
+	if n := c.dataChannels.Add(1); c.srv.cfg.MaxDataChannels > 0 && int(n) > c.srv.cfg.MaxDataChannels {
+		c.dataChannels.Add(-1)
+		return nil, fmt.Errorf("at most %d channels per session", c.srv.cfg.MaxDataChannels)
+	}
+	dc, err := pc.CreateDataChannel(label, init)
+	if err != nil {
+		c.dataChannels.Add(-1)
+		return nil, err
+	}
+	if c.channels == nil {
+		c.channels = make(map[string]*webrtc.DataChannel)
+	}
+	c.channels[label] = dc
+	c.logger.Info("data channel created", "label", label)
+	c.srv.watchChannel(c, dc, func() {
+		c.sendJSON(map[string]interface{}{
+			"type":    "channel-opened",
+			"label":   label,
+			"ordered": dc.Ordered(),
+		})
+	})
+	return dc, nil
+}
+
+// hasDataSection — есть ли в согласованном offer секция каналов данных
+func hasDataSection(pc *webrtc.PeerConnection) bool {
+	desc := pc.RemoteDescription()
+	return desc != nil && strings.Contains(desc.SDP, "m=application")
+}
+
+func (c *Client) addChannel(dc *webrtc.DataChannel) {
+	c.mu.Lock()
+	if c.channels == nil {
+		c.channels = make(map[string]*webrtc.DataChannel)
+	}
+	c.channels[dc.Label()] = dc
+	c.mu.Unlock()
+}
+
+func (c *Client) removeChannel(dc *webrtc.DataChannel) {
+	c.mu.Lock()
+	if c.channels[dc.Label()] == dc {
+		delete(c.channels, dc.Label())
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,109 @@
+package signaling
+
+import (
+	"bytes"
+	"compress/flate"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Сжатие пересылаемых сообщений каналов данных. Получатель, согласовавший
+// dc-deflate в hello, получает бинарные сообщения с байтом-маркером
+// впереди:
+//
+//	0 — дальше исходные байты бинарного сообщения
+//	1 — deflate (RFC 1951) бинарного сообщения
+//	2 — deflate текстового сообщения в UTF-8
+//
+// Текст меньше DATA_CHANNEL_COMPRESS_MIN или не ставший от сжатия меньше
+// приходит текстом без изменений: маркер есть только у бинарных.
+const (
+	dcMarkerRaw byte = iota
+	dcMarkerBinary
+	dcMarkerText
+)
+
+var flateWriters = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return w
+}}
+
+// encodeDC — сообщение участника комнаты в том виде, в котором его
+// получает клиент c
+func (c *Client) encodeDC(msg webrtc.DataChannelMessage) webrtc.DataChannelMessage {
+	if !c.agreedFeature(featureDCDeflate) {
+		return msg
+	}
+	if threshold := c.srv.cfg.DataChannelCompressMin; threshold > 0 && len(msg.Data) >= threshold {
+		packed := deflateDC(msg)
+		saved := len(packed) < len(msg.Data)
+		sent := len(msg.Data)
+		if saved {
+			sent = len(packed)
+		}
+		c.dcCompression.add(len(msg.Data), sent)
+		c.srv.dcCompression.add(len(msg.Data), sent)
+		if saved {
+			return webrtc.DataChannelMessage{Data: packed}
+		}
+	}
+	if msg.IsString {
+		return msg
+	}
+	return webrtc.DataChannelMessage{Data: append([]byte{dcMarkerRaw}, msg.Data...)}
+}
+
+// deflateDC сжимает сообщение вместе с маркером
+func deflateDC(msg webrtc.DataChannelMessage) []byte {
+	marker := dcMarkerBinary
+	if msg.IsString {
+		marker = dcMarkerText
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(marker)
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	w.Write(msg.Data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// compressionCounter считает сообщения не меньше DATA_CHANNEL_COMPRESS_MIN:
+// байты до сжатия и отправленные байты (сжатые или исходные, если сжатие
+// не помогло)
+type compressionCounter struct {
+	messages atomic.Uint64
+	in       atomic.Uint64
+	out      atomic.Uint64
+}
+
+func (cc *compressionCounter) add(in, out int) {
+	cc.messages.Add(1)
+	cc.in.Add(uint64(in))
+	cc.out.Add(uint64(out))
+}
+
+type compressionStats struct {
+	Messages uint64  `json:"messages"`
+	BytesIn  uint64  `json:"bytesIn"`
+	BytesOut uint64  `json:"bytesOut"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// stats — счетчики и коэффициент сжатия bytesIn/bytesOut; nil, если
+// сжимать было нечего
+func (cc *compressionCounter) stats() *compressionStats {
+	st := &compressionStats{
+		Messages: cc.messages.Load(),
+		BytesIn:  cc.in.Load(),
+		BytesOut: cc.out.Load(),
+	}
+	if st.Messages == 0 || st.BytesOut == 0 {
+		return nil
+	}
+	st.Ratio = float64(st.BytesIn) / float64(st.BytesOut)
+	return st
+}
@@ -0,0 +1,93 @@
+package signaling
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// Сколько сообщений держать для канала участника, который еще не открыт
+const maxPendingDCMessages = 16
+
+// relayDataChannel пересылает сообщения канала клиента в одноименные
+// каналы остальных участников комнаты, сохраняя текстовый или бинарный
+// тип. Если у участника такого канала нет, сервер открывает его с теми
+// же параметрами (ordered, maxRetransmits, ...).
+func (s *Server) relayDataChannel(client *Client, dc *webrtc.DataChannel, opened func()) {
+	label := dc.Label()
+	// У канала один обработчик OnOpen, поэтому opened вызывается отсюда
+	dc.OnOpen(func() {
+		client.flushPendingDC(label, dc)
+		if opened != nil {
+			opened()
+		}
+	})
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		for _, peer := range s.roomPeers(client) {
+			peer.ensureChannel(dc)
+			peer.deliverDC(label, msg)
+		}
+	})
+}
+
+// ensureChannel открывает у клиента канал как src, если его нет и
+// PeerConnection уже договорился о каналах данных
+func (c *Client) ensureChannel(src *webrtc.DataChannel) {
+	c.mu.Lock()
+	exists := c.channels[src.Label()] != nil
+	c.mu.Unlock()
+	if exists {
+		return
+	}
+
+	c.negotiationMu.Lock()
+	defer c.negotiationMu.Unlock()
+	pc := c.pc.Load()
+	if pc == nil || !hasDataSection(pc) {
+		return
+	}
+	if _, err := c.createChannel(pc, src.Label(), sourceChannelInit(src)); err != nil {
+		c.logger.Warn("relayed data channel error", "label", src.Label(), "err", err)
+	}
+}
+
+// deliverDC отправляет сообщение в канал label клиента. Пока канал не
+// открыт, сообщения копятся; очередь и отправка под mu сохраняют порядок.
+func (c *Client) deliverDC(label string, msg webrtc.DataChannelMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dc := c.channels[label]
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen || len(c.pendingDC[label]) > 0 {
+		if len(c.pendingDC[label]) >= maxPendingDCMessages {
+			c.logger.Warn("data channel not open, dropping message", "label", label)
+			return
+		}
+		if c.pendingDC == nil {
+			c.pendingDC = make(map[string][]webrtc.DataChannelMessage)
+		}
+		c.pendingDC[label] = append(c.pendingDC[label], msg)
+		return
+	}
+	c.sendDC(dc, msg)
+}
+
+// flushPendingDC отправляет накопленные сообщения после открытия канала
+func (c *Client) flushPendingDC(label string, dc *webrtc.DataChannel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range c.pendingDC[label] {
+		c.sendDC(dc, msg)
+	}
+	delete(c.pendingDC, label)
+}
+
+func (c *Client) sendDC(dc *webrtc.DataChannel, msg webrtc.DataChannelMessage) {
+	msg = c.encodeDC(msg)
+	var err error
+	if msg.IsString {
+		err = dc.SendText(string(msg.Data))
+	} else {
+		err = dc.Send(msg.Data)
+	}
+	if err != nil {
+		c.logger.Warn("data channel relay error", "label", dc.Label(), "err", err)
+	}
+}
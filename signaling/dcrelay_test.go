@@ -0,0 +1,230 @@
+package signaling
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+
+	"go-webrtc/config"
+)
+
+// Два пира в одной комнате: сообщения канала "test" одного приходят в
+// одноименный канал другого через сервер, текст остается текстом, а
+// бинарные данные — бинарными
+func TestDataChannelRelay(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.NonTrickle = true
+		c.AnswerCandidateDelay = 0
+	})
+
+	received := make(chan webrtc.DataChannelMessage, 2)
+	receiver, receiverDC := newRelayPeer(t)
+	receiverDC.OnMessage(func(msg webrtc.DataChannelMessage) { received <- msg })
+	connectPeer(t, dialWS(t, ts, "room=relay"), receiver)
+
+	sender, senderDC := newRelayPeer(t)
+	opened := make(chan struct{})
+	senderDC.OnOpen(func() { close(opened) })
+	connectPeer(t, dialWS(t, ts, "room=relay"), sender)
+	select {
+	case <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the data channel to open")
+	}
+
+	if err := senderDC.SendText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := senderDC.Send([]byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	want := []webrtc.DataChannelMessage{
+		{IsString: true, Data: []byte("hello")},
+		{IsString: false, Data: []byte{1, 2, 3}},
+	}
+	for _, w := range want {
+		select {
+		case msg := <-received:
+			if msg.IsString != w.IsString || !bytes.Equal(msg.Data, w.Data) {
+				t.Fatalf("relayed %q (string %v), want %q (string %v)", msg.Data, msg.IsString, w.Data, w.IsString)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for relayed %q", w.Data)
+		}
+	}
+}
+
+// Получатель, согласовавший dc-deflate, получает длинный текст сжатым
+// с маркером 2, а короткое бинарное сообщение — с маркером 0; в /stats
+// виден коэффициент сжатия
+func TestDataChannelCompression(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.NonTrickle = true
+		c.AnswerCandidateDelay = 0
+		c.DataChannelCompressMin = 64
+	})
+
+	received := make(chan webrtc.DataChannelMessage, 2)
+	receiver, receiverDC := newRelayPeer(t)
+	receiverDC.OnMessage(func(msg webrtc.DataChannelMessage) { received <- msg })
+	receiverWS := dialWS(t, ts, "room=deflate")
+	sendJSON(t, receiverWS, map[string]interface{}{"type": "hello", "features": []string{"dc-deflate"}})
+	readType(t, receiverWS, "hello-ack")
+	connectPeer(t, receiverWS, receiver)
+
+	sender, senderDC := newRelayPeer(t)
+	opened := make(chan struct{})
+	senderDC.OnOpen(func() { close(opened) })
+	connectPeer(t, dialWS(t, ts, "room=deflate"), sender)
+	select {
+	case <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the data channel to open")
+	}
+
+	text := strings.Repeat("compressible text ", 20)
+	if err := senderDC.SendText(text); err != nil {
+		t.Fatal(err)
+	}
+	if err := senderDC.Send([]byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := receiveDC(t, received)
+	if msg.IsString || len(msg.Data) == 0 || msg.Data[0] != dcMarkerText || len(msg.Data) >= len(text) {
+		t.Fatalf("long text relayed as %d bytes (string %v), want a smaller deflated binary message", len(msg.Data), msg.IsString)
+	}
+	inflated, err := io.ReadAll(flate.NewReader(bytes.NewReader(msg.Data[1:])))
+	if err != nil || string(inflated) != text {
+		t.Fatalf("inflated %q, %v; want the original text", inflated, err)
+	}
+	if msg := receiveDC(t, received); msg.IsString || !bytes.Equal(msg.Data, []byte{dcMarkerRaw, 1, 2, 3}) {
+		t.Fatalf("short binary relayed as %v (string %v), want raw with marker 0", msg.Data, msg.IsString)
+	}
+
+	st := s.dcCompression.stats()
+	if st == nil || st.Messages != 1 || st.Ratio <= 1 {
+		t.Fatalf("dcCompression stats = %+v, want one message with ratio above 1", st)
+	}
+}
+
+func receiveDC(t *testing.T, received <-chan webrtc.DataChannelMessage) webrtc.DataChannelMessage {
+	t.Helper()
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a relayed message")
+		return webrtc.DataChannelMessage{}
+	}
+}
+
+// В режиме sfu аудио одного пира приходит второму треком сервера
+func TestMediaRelay(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.SignalingMode = "sfu"
+		c.NonTrickle = true
+		c.AnswerCandidateDelay = 0
+	})
+
+	tracks := make(chan *webrtc.TrackRemote, 1)
+	receiver := newPeer(t)
+	receiver.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		select {
+		case tracks <- track:
+		default:
+		}
+	})
+	receiverWS := dialWS(t, ts, "room=media")
+	connectPeer(t, receiverWS, receiver)
+
+	sender := newPeer(t)
+	audio, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "sender")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.AddTrack(audio); err != nil {
+		t.Fatal(err)
+	}
+	connectPeer(t, dialWS(t, ts, "room=media"), sender)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				audio.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+
+	// Трек отправителя добавляется получателю offer'ом сервера; до него
+	// могут прийти offer'ы на транспондеры сервера
+	go answerServerOffers(t, receiverWS, receiver)
+
+	select {
+	case track := <-tracks:
+		if track.Kind() != webrtc.RTPCodecTypeAudio || track.StreamID() != "sender" {
+			t.Fatalf("relayed %s track of stream %q, want audio of sender", track.Kind(), track.StreamID())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the relayed track")
+	}
+}
+
+// answerServerOffers отвечает на offer'ы сервера, пока соединение
+// открыто
+func answerServerOffers(t *testing.T, ws *websocket.Conn, pc *webrtc.PeerConnection) {
+	for {
+		var msg map[string]interface{}
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg["type"] != "offer" {
+			continue
+		}
+		sdp, _ := msg["sdp"].(string)
+		if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}); err != nil {
+			t.Errorf("server offer: %v", err)
+			return
+		}
+		answer, err := pc.CreateAnswer(nil)
+		if err == nil {
+			err = pc.SetLocalDescription(answer)
+		}
+		if err != nil {
+			t.Errorf("answer to server offer: %v", err)
+			return
+		}
+		if err := ws.WriteJSON(map[string]string{"type": "answer", "sdp": answer.SDP}); err != nil {
+			return
+		}
+	}
+}
+
+// newRelayPeer — пир с каналом "test", который пересылается сервером
+func newRelayPeer(t *testing.T) (*webrtc.PeerConnection, *webrtc.DataChannel) {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	dc, err := pc.CreateDataChannel("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pc, dc
+}
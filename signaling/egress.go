@@ -0,0 +1,445 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/config"
+)
+
+// egress — рестрим медиа клиента во внешний приемник через ffmpeg:
+// RTMP (YouTube, Twitch) или HLS в EGRESS_HLS_DIR/<id>/, который
+// раздается по /hls/. Первый видео- и первый аудиотрек клиента уходят
+// в ffmpeg по RTP на локальные порты с описанием сессии в SDP-файле.
+// VP8 и Opus перекодируются в H264 и AAC, H264 копируется как есть.
+// У клиента один рестрим за раз.
+type egress struct {
+	srv    *Server
+	ID     string
+	Client *Client
+	Target string // URL RTMP или путь плейлиста HLS
+	HLS    bool
+
+	startedAt time.Time
+	cmd       *exec.Cmd
+	sdpPath   string
+	hlsDir    string
+	// Локальные UDP-сокеты к ffmpeg и SSRC треков по типу
+	conns map[webrtc.RTPCodecType]*net.UDPConn
+	ssrcs map[webrtc.RTPCodecType]webrtc.SSRC
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+	exited   chan struct{}
+}
+
+type egressInfo struct {
+	ID        string    `json:"id"`
+	ClientID  string    `json:"clientId"`
+	Target    string    `json:"target"`
+	HLS       bool      `json:"hls"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+func (e *egress) info() egressInfo {
+	target := e.Target
+	if !e.HLS {
+		target = config.RedactURL(target)
+	}
+	return egressInfo{ID: e.ID, ClientID: e.Client.id, Target: target, HLS: e.HLS, StartedAt: e.startedAt}
+}
+
+// Payload type пакетов, уходящих в ffmpeg
+const (
+	egressVideoPT = 96
+	egressAudioPT = 111
+)
+
+// Сколько времени после старта повторять PLI: ffmpeg начинает слушать
+// порты не сразу, и первый ключевой кадр может до него не дойти
+const egressKeyframeWindow = 10 * time.Second
+
+// egressSDP — описание RTP-сессии для ffmpeg: треки egressMedia на
+// портах ports
+func egressSDP(media map[webrtc.RTPCodecType]webrtc.RTPCodecParameters, ports map[webrtc.RTPCodecType]int) string {
+	var sb strings.Builder
+	sb.WriteString("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=restream\r\nc=IN IP4 127.0.0.1\r\nt=0 0\r\n")
+	if codec, ok := media[webrtc.RTPCodecTypeVideo]; ok {
+		fmt.Fprintf(&sb, "m=video %d RTP/AVP %d\r\n", ports[webrtc.RTPCodecTypeVideo], egressVideoPT)
+		switch {
+		case strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8):
+			fmt.Fprintf(&sb, "a=rtpmap:%d VP8/90000\r\n", egressVideoPT)
+		case strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264):
+			fmt.Fprintf(&sb, "a=rtpmap:%d H264/90000\r\na=fmtp:%d packetization-mode=1\r\n", egressVideoPT, egressVideoPT)
+		}
+	}
+	if codec, ok := media[webrtc.RTPCodecTypeAudio]; ok {
+		fmt.Fprintf(&sb, "m=audio %d RTP/AVP %d\r\na=rtpmap:%d opus/%d/2\r\n", ports[webrtc.RTPCodecTypeAudio], egressAudioPT, egressAudioPT, codec.ClockRate)
+	}
+	return sb.String()
+}
+
+// egressArgs — аргументы ffmpeg: вход из SDP-файла, выход в RTMP или HLS
+func egressArgs(e *egress, media map[webrtc.RTPCodecType]webrtc.RTPCodecParameters) []string {
+	args := []string{"-hide_banner", "-loglevel", "warning", "-protocol_whitelist", "file,udp,rtp", "-i", e.sdpPath}
+	if codec, ok := media[webrtc.RTPCodecTypeVideo]; ok {
+		if strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264) {
+			args = append(args, "-c:v", "copy")
+		} else {
+			args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-g", "60")
+		}
+	}
+	if _, ok := media[webrtc.RTPCodecTypeAudio]; ok {
+		args = append(args, "-c:a", "aac", "-b:a", "128k")
+	}
+	if e.HLS {
+		return append(args, "-f", "hls", "-hls_time", "4", "-hls_list_size", "6", "-hls_flags", "delete_segments", e.Target)
+	}
+	return append(args, "-f", "flv", e.Target)
+}
+
+// egressMedia — первый видео- и первый аудиотрек клиента, которые можно
+// отдать ffmpeg
+func egressMedia(pc *webrtc.PeerConnection) (map[webrtc.RTPCodecType]webrtc.RTPCodecParameters, map[webrtc.RTPCodecType]webrtc.SSRC) {
+	media := make(map[webrtc.RTPCodecType]webrtc.RTPCodecParameters)
+	ssrcs := make(map[webrtc.RTPCodecType]webrtc.SSRC)
+	for _, receiver := range pc.GetReceivers() {
+		track := receiver.Track()
+		if track == nil || track.SSRC() == 0 {
+			continue
+		}
+		kind, codec := track.Kind(), track.Codec()
+		if _, seen := media[kind]; seen {
+			continue
+		}
+		supported := strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8) ||
+			strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264) ||
+			strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus)
+		if supported {
+			media[kind] = codec
+			ssrcs[kind] = track.SSRC()
+		}
+	}
+	return media, ssrcs
+}
+
+// restreamURLAllowed — URL RTMP из разрешенных EGRESS_URL_PREFIXES
+func (s *Server) restreamURLAllowed(raw string) bool {
+	for _, prefix := range s.cfg.EgressURLPrefixes {
+		if strings.HasPrefix(raw, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// startEgress запускает рестрим медиа клиента: в RTMP url или, если url
+// пустой, в HLS. Ошибка — код для клиента и текст.
+func (s *Server) startEgress(client *Client, url string) (*egress, string, error) {
+	if !s.cfg.EgressEnabled {
+		return nil, "RESTREAM_DISABLED", fmt.Errorf("restreaming is not enabled")
+	}
+	if url != "" && !s.restreamURLAllowed(url) {
+		return nil, "INVALID_RESTREAM_URL", fmt.Errorf("url must start with one of %s", strings.Join(s.cfg.EgressURLPrefixes, ", "))
+	}
+	pc := client.pc.Load()
+	if pc == nil {
+		return nil, "NO_PEER_CONNECTION", fmt.Errorf("no media yet: send an offer first")
+	}
+	media, ssrcs := egressMedia(pc)
+	if len(media) == 0 {
+		return nil, "NO_MEDIA", fmt.Errorf("no VP8, H264 or Opus tracks received yet")
+	}
+
+	e := &egress{
+		srv:       s,
+		ID:        newClientID(),
+		Client:    client,
+		Target:    url,
+		HLS:       url == "",
+		startedAt: time.Now(),
+		conns:     make(map[webrtc.RTPCodecType]*net.UDPConn),
+		ssrcs:     ssrcs,
+		stopped:   make(chan struct{}),
+		exited:    make(chan struct{}),
+	}
+	if !client.egress.CompareAndSwap(nil, e) {
+		return nil, "ALREADY_RESTREAMING", fmt.Errorf("a restream is already running")
+	}
+	if err := e.start(media); err != nil {
+		client.egress.Store(nil)
+		e.cleanup()
+		return nil, "RESTREAM_ERROR", err
+	}
+
+	s.egressesMu.Lock()
+	s.egresses[e.ID] = e
+	s.egressesMu.Unlock()
+	client.logger.Info("restream started", "id", e.ID, "target", e.info().Target)
+	go e.requestKeyframes(pc, e.ssrcs[webrtc.RTPCodecTypeVideo])
+	go e.wait()
+	return e, "", nil
+}
+
+func (e *egress) start(media map[webrtc.RTPCodecType]webrtc.RTPCodecParameters) error {
+	// Порты выбирает система: сокет открывается и сразу закрывается,
+	// чтобы его занял ffmpeg
+	ports := make(map[webrtc.RTPCodecType]int)
+	for kind := range media {
+		l, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return err
+		}
+		port := l.LocalAddr().(*net.UDPAddr).Port
+		l.Close()
+		conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		if err != nil {
+			return err
+		}
+		ports[kind] = port
+		e.conns[kind] = conn
+	}
+
+	f, err := os.CreateTemp("", "restream-*.sdp")
+	if err != nil {
+		return err
+	}
+	e.sdpPath = f.Name()
+	_, err = f.WriteString(egressSDP(media, ports))
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if e.HLS {
+		e.hlsDir = filepath.Join(e.srv.cfg.EgressHLSDir, e.ID)
+		if err := os.MkdirAll(e.hlsDir, 0o755); err != nil {
+			return err
+		}
+		e.Target = filepath.Join(e.hlsDir, "index.m3u8")
+	}
+
+	e.cmd = exec.Command(e.srv.cfg.EgressFFmpeg, egressArgs(e, media)...)
+	e.cmd.Stdout = os.Stderr
+	e.cmd.Stderr = os.Stderr
+	return e.cmd.Start()
+}
+
+// write отправляет пакет трека в ffmpeg со своим payload type.
+// Вызывается из цикла чтения трека.
+func (e *egress) write(kind webrtc.RTPCodecType, pkt *rtp.Packet) {
+	conn := e.conns[kind]
+	if conn == nil || pkt.SSRC != uint32(e.ssrcs[kind]) {
+		return
+	}
+	out := *pkt
+	out.PayloadType = egressAudioPT
+	if kind == webrtc.RTPCodecTypeVideo {
+		out.PayloadType = egressVideoPT
+	}
+	buf, err := out.Marshal()
+	if err != nil {
+		return
+	}
+	// ffmpeg мог еще не открыть порт — потерянные пакеты не важны
+	conn.Write(buf)
+}
+
+func (e *egress) requestKeyframes(pc *webrtc.PeerConnection, ssrc webrtc.SSRC) {
+	if ssrc == 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.After(egressKeyframeWindow)
+	for {
+		select {
+		case <-e.stopped:
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+			if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(ssrc)}}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// wait ждет завершения ffmpeg: сам по себе он выходит, когда приемник
+// закрыл соединение или не принял поток
+func (e *egress) wait() {
+	err := e.cmd.Wait()
+	close(e.exited)
+	select {
+	case <-e.stopped:
+		return
+	default:
+	}
+	e.Client.logger.Warn("restream ended", "id", e.ID, "err", err)
+	reason := "ffmpeg exited"
+	if err != nil {
+		reason = err.Error()
+	}
+	e.stop(reason)
+}
+
+// stop останавливает ffmpeg и сообщает клиенту о конце рестрима
+func (e *egress) stop(reason string) {
+	e.stopOnce.Do(func() {
+		close(e.stopped)
+		e.Client.egress.CompareAndSwap(e, nil)
+		e.srv.egressesMu.Lock()
+		delete(e.srv.egresses, e.ID)
+		e.srv.egressesMu.Unlock()
+
+		select {
+		case <-e.exited:
+		default:
+			// ffmpeg дописывает HLS-плейлист по SIGINT
+			e.cmd.Process.Signal(os.Interrupt)
+			go func() {
+				select {
+				case <-e.exited:
+				case <-time.After(5 * time.Second):
+					e.cmd.Process.Kill()
+				}
+			}()
+		}
+		e.cleanup()
+		e.Client.logger.Info("restream stopped", "id", e.ID, "reason", reason)
+		e.Client.sendJSON(map[string]interface{}{"type": "restream-stopped", "id": e.ID, "reason": reason})
+	})
+}
+
+// cleanup закрывает сокеты и удаляет SDP-файл. Сегменты HLS остаются на
+// диске.
+func (e *egress) cleanup() {
+	for _, conn := range e.conns {
+		conn.Close()
+	}
+	if e.sdpPath != "" {
+		os.Remove(e.sdpPath)
+	}
+}
+
+// playlistURL — адрес HLS-плейлиста рестрима для клиента
+func (e *egress) playlistURL() string {
+	if !e.HLS {
+		return ""
+	}
+	return "/hls/" + e.ID + "/index.m3u8"
+}
+
+// stopEgressOf останавливает рестрим клиента, если он идет
+func stopEgressOf(client *Client, reason string) {
+	if e := client.egress.Load(); e != nil {
+		e.stop(reason)
+	}
+}
+
+// handleRestream — {"type":"restream","url":"rtmp://..."} или без url
+// для HLS; {"type":"restream","stop":true} останавливает
+func (s *Server) handleRestream(client *Client, url string, stop bool) {
+	if stop {
+		if client.egress.Load() == nil {
+			client.sendError("NOT_RESTREAMING", "no active restream")
+			return
+		}
+		stopEgressOf(client, "stopped by client")
+		return
+	}
+	e, code, err := s.startEgress(client, url)
+	if err != nil {
+		client.sendError(code, err.Error())
+		return
+	}
+	reply := map[string]interface{}{"type": "restream-started", "id": e.ID}
+	if e.HLS {
+		reply["playlist"] = e.playlistURL()
+	}
+	client.sendJSON(reply)
+}
+
+// handleRestreams — GET /restreams: активные рестримы
+func (s *Server) handleRestreams(w http.ResponseWriter, r *http.Request) {
+	s.egressesMu.Lock()
+	infos := make([]egressInfo, 0, len(s.egresses))
+	for _, e := range s.egresses {
+		infos = append(infos, e.info())
+	}
+	s.egressesMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		slog.Warn("restreams encode error", "err", err)
+	}
+}
+
+// handleCreateRestream — POST /restreams с {"clientId":"...","url":"..."}
+// (без url — HLS)
+func (s *Server) handleCreateRestream(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ClientID string `json:"clientId"`
+		URL      string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ClientID == "" {
+		http.Error(w, "body must be {\"clientId\":...,\"url\":...}", http.StatusBadRequest)
+		return
+	}
+	client := s.clients.get(req.ClientID)
+	if client == nil {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+
+	e, code, err := s.startEgress(client, req.URL)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch code {
+		case "RESTREAM_DISABLED":
+			status = http.StatusNotFound
+		case "INVALID_RESTREAM_URL":
+			status = http.StatusBadRequest
+		case "ALREADY_RESTREAMING", "NO_PEER_CONNECTION", "NO_MEDIA":
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	info := map[string]interface{}{"id": e.ID, "clientId": client.id, "hls": e.HLS}
+	if e.HLS {
+		info["playlist"] = e.playlistURL()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		slog.Warn("restream encode error", "id", e.ID, "err", err)
+	}
+}
+
+// handleDeleteRestream — DELETE /restreams/{id}
+func (s *Server) handleDeleteRestream(w http.ResponseWriter, r *http.Request) {
+	s.egressesMu.Lock()
+	e := s.egresses[r.PathValue("id")]
+	s.egressesMu.Unlock()
+	if e == nil {
+		http.Error(w, "restream not found", http.StatusNotFound)
+		return
+	}
+	e.stop("stopped by operator")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// serverEvent — событие жизненного цикла или качества сессии для /events
+type serverEvent struct {
+	ID       uint64                 `json:"id"`
+	Type     string                 `json:"type"`
+	ClientID string                 `json:"clientId"`
+	Time     time.Time              `json:"time"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+type eventSubscriber struct {
+	events   chan serverEvent
+	kicked   chan struct{}
+	kickOnce sync.Once
+}
+
+// eventHub раздает события сессий подписчикам /events и хранит
+// последние EVENT_HISTORY из них, чтобы переподключившийся подписчик мог
+// продолжить с Last-Event-ID
+type eventHub struct {
+	srv     *Server
+	mu      sync.Mutex
+	nextID  uint64
+	history []serverEvent
+	subs    map[*eventSubscriber]struct{}
+}
+
+func (h *eventHub) publish(typ, clientID string, data map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	ev := serverEvent{ID: h.nextID, Type: typ, ClientID: clientID, Time: time.Now(), Data: data}
+	if len(h.history) == h.srv.cfg.EventHistory {
+		h.history = h.history[1:]
+	}
+	h.history = append(h.history, ev)
+
+	for sub := range h.subs {
+		select {
+		case sub.events <- ev:
+		default:
+			// Отстающий подписчик отключается и догоняет по Last-Event-ID
+			sub.kickOnce.Do(func() { close(sub.kicked) })
+		}
+	}
+}
+
+// subscribe регистрирует подписчика и возвращает события после lastID.
+// gap — часть пропущенных событий уже вытеснена из истории.
+func (h *eventHub) subscribe(lastID uint64) (sub *eventSubscriber, replay []serverEvent, gap bool) {
+	sub = &eventSubscriber{
+		events: make(chan serverEvent, h.srv.cfg.EventBuffer),
+		kicked: make(chan struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub] = struct{}{}
+	if lastID == 0 {
+		return sub, nil, false
+	}
+	for _, ev := range h.history {
+		if ev.ID > lastID {
+			replay = append(replay, ev)
+		}
+	}
+	// lastID из будущего — история была до перезапуска сервера
+	gap = lastID > h.nextID || (len(h.history) > 0 && h.history[0].ID > lastID+1)
+	return sub, replay, gap
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+}
+
+func writeSSE(w http.ResponseWriter, ev serverEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
+
+// handleEvents транслирует события сессий как Server-Sent Events:
+// GET /events. Last-Event-ID (или ?lastEventId=) продолжает поток с
+// места обрыва, пока события еще в истории.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastHeader := r.Header.Get("Last-Event-ID")
+	if lastHeader == "" {
+		lastHeader = r.URL.Query().Get("lastEventId")
+	}
+	var lastID uint64
+	if lastHeader != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(lastHeader, 10, 64); err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub, replay, gap := s.events.subscribe(lastID)
+	defer s.events.unsubscribe(sub)
+	slog.Info("event stream opened", "remote", r.RemoteAddr, "from", lastID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx не должен буферизовать поток
+	w.Header().Set("X-Accel-Buffering", "no")
+	if gap {
+		fmt.Fprintf(w, ": events after %d are no longer in history\n\n", lastID)
+	}
+	for _, ev := range replay {
+		if writeSSE(w, ev) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.cfg.EventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev := <-sub.events:
+			if writeSSE(w, ev) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// Комментарий не дает прокси закрыть молчащее соединение
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-sub.kicked:
+			slog.Warn("event stream dropped: too slow", "remote", r.RemoteAddr)
+			return
+		case <-r.Context().Done():
+			slog.Info("event stream closed", "remote", r.RemoteAddr)
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,12 @@
+package signaling
+
+import (
+	"go-webrtc/media"
+)
+
+func (c *Client) recordHeaderExtensions(answer string) {
+	exts := media.HeaderExtensions(answer)
+	c.statsMu.Lock()
+	c.headerExtensions = exts
+	c.statsMu.Unlock()
+}
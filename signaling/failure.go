@@ -0,0 +1,68 @@
+package signaling
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// setupFailure — причина, по которой сессия так и не установилась
+type setupFailure string
+
+const (
+	failureICE           setupFailure = "ice-failed"
+	failureDTLS          setupFailure = "dtls-failed"
+	failureNoCandidates  setupFailure = "no-candidates"
+	failureAnswerTimeout setupFailure = "answer-timeout"
+	failureSDPInvalid    setupFailure = "sdp-invalid"
+)
+
+var setupFailures = []setupFailure{
+	failureICE,
+	failureDTLS,
+	failureNoCandidates,
+	failureAnswerTimeout,
+	failureSDPInvalid,
+}
+
+// recordFailure учитывает первую причину отказа сессии. Сессии, у которых
+// DTLS уже поднимался, не считаются: это обрыв, а не отказ установки.
+func (c *Client) recordFailure(reason setupFailure) {
+	if c.established.Load() {
+		return
+	}
+	c.statsMu.Lock()
+	first := c.failure == ""
+	if first {
+		c.failure = reason
+	}
+	c.statsMu.Unlock()
+	if !first {
+		return
+	}
+
+	c.srv.setupFailureCounts[reason].Add(1)
+	c.logger.Warn("session setup failed", "reason", reason)
+	c.srv.events.publish("session-failed", c.id, map[string]interface{}{"reason": reason})
+	c.webhook("session-failed", map[string]interface{}{"reason": reason})
+}
+
+// iceFailure отличает отказ ICE от случая, когда клиент не дал ни одного
+// кандидата — ни в SDP, ни через trickle
+func iceFailure(client *Client, pc *webrtc.PeerConnection) setupFailure {
+	if client.candidates.Load() > 0 {
+		return failureICE
+	}
+	if remote := pc.RemoteDescription(); remote != nil && strings.Contains(remote.SDP, "a=candidate:") {
+		return failureICE
+	}
+	return failureNoCandidates
+}
+
+func (s *Server) setupFailureStats() map[setupFailure]int64 {
+	counts := make(map[setupFailure]int64, len(setupFailures))
+	for _, reason := range setupFailures {
+		counts[reason] = s.setupFailureCounts[reason].Load()
+	}
+	return counts
+}
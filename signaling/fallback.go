@@ -0,0 +1,74 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// fallbackToTURNTCP ждет подключения ICE. Если за TURN_TCP_FALLBACK_TIMEOUT
+// его нет, клиенту отправляются TURN-серверы только по TCP/TLS с политикой
+// relay и offer с ICE restart. Сервер свои ICE-серверы не меняет: pion не
+// умеет менять их на живом PeerConnection, а TURN все равно ходит к серверу
+// по UDP.
+func (s *Server) fallbackToTURNTCP(client *Client, pc *webrtc.PeerConnection) {
+	select {
+	case <-client.readDone:
+		return
+	case <-time.After(s.cfg.TURNTCPFallbackTimeout):
+	}
+
+	switch pc.ICEConnectionState() {
+	case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted, webrtc.ICEConnectionStateClosed:
+		return
+	}
+	if client.recovering.Load() {
+		return
+	}
+
+	templates, ok := s.tcpRelayURLs()
+	if !ok {
+		client.logger.Warn("TCP relay limit reached, no TURN-TCP fallback", "limit", s.cfg.TCPRelayLimit)
+		return
+	}
+	servers, err := s.turnTCPServersFor(client, templates)
+	if err != nil {
+		client.logger.Error("TURN-TCP fallback error", "err", err)
+		return
+	}
+
+	client.logger.Info("ICE not connected, falling back to TURN over TCP", "after", s.cfg.TURNTCPFallbackTimeout)
+	client.statsMu.Lock()
+	client.tcpFallback = true
+	client.statsMu.Unlock()
+	client.event("turn-tcp-fallback")
+
+	if err := client.sendJSON(map[string]interface{}{
+		"type":               "ice-servers",
+		"iceServers":         servers,
+		"iceTransportPolicy": webrtc.ICETransportPolicyRelay.String(),
+	}); err != nil {
+		client.logger.Warn("send ice-servers error", "err", err)
+		return
+	}
+	if err := sendRestartOffer(client, pc); err != nil {
+		client.logger.Warn("ICE restart offer error", "err", err)
+	}
+}
+
+func (s *Server) turnTCPServersFor(client *Client, templates []string) ([]webrtc.ICEServer, error) {
+	urls := make([]string, 0, len(templates))
+	for _, tmpl := range templates {
+		u, err := resolveTURNTemplate(tmpl, client)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	username, credential := s.turnCredentialsFor(client)
+	return []webrtc.ICEServer{{
+		URLs:       urls,
+		Username:   username,
+		Credential: credential,
+	}}, nil
+}
@@ -0,0 +1,65 @@
+package signaling
+
+import (
+	"sort"
+)
+
+// Необязательные возможности протокола, которые поддерживает сервер
+const (
+	featureICEBatch      = "ice-batch"
+	featureQualityEvents = "quality-events"
+	featureDCDeflate     = "dc-deflate"
+)
+
+var serverFeatures = []string{featureICEBatch, featureQualityEvents, featureDCDeflate}
+
+// handleHello отвечает hello-ack с пересечением возможностей клиента и
+// сервера и запоминает его за клиентом. version — версия протокола
+// клиента, 0 — оставить выбранную при подключении.
+func (c *Client) handleHello(version int, requested []string) {
+	if version > 0 {
+		c.protocol.Store(int32(min(version, protocolVersion)))
+	}
+
+	agreed := make(map[string]bool)
+	for _, name := range requested {
+		for _, supported := range serverFeatures {
+			if name == supported {
+				agreed[name] = true
+			}
+		}
+	}
+
+	list := make([]string, 0, len(agreed))
+	for name := range agreed {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	c.statsMu.Lock()
+	c.features = agreed
+	c.statsMu.Unlock()
+
+	c.logger.Info("features agreed", "features", list, "protocol", c.protocol.Load())
+	c.sendJSON(map[string]interface{}{
+		"type":     "hello-ack",
+		"version":  c.protocol.Load(),
+		"features": list,
+	})
+}
+
+// hasFeature сообщает, включена ли возможность. Клиенты без hello
+// получают все возможности, как до появления согласования.
+func (c *Client) hasFeature(name string) bool {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.features == nil || c.features[name]
+}
+
+// agreedFeature — возможность, которую клиент явно запросил в hello.
+// Нужна там, где клиент без поддержки не разберет ответ сервера.
+func (c *Client) agreedFeature(name string) bool {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.features[name]
+}
@@ -0,0 +1,532 @@
+package signaling
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Передача файлов по каналам данных (FILE_TRANSFER_DIR).
+//
+// Загрузка на сервер: клиент шлет {"type":"file-upload","name":...,"size":N}
+// и получает file-ready с id, меткой канала "file:<id>" и offset. Затем
+// открывает канал с этой меткой и шлет файл бинарными сообщениями с
+// offset. Прогресс приходит в file-progress, конец — file-complete с
+// sha256. Если канал закрылся раньше (пересогласование, ICE restart),
+// приходит file-paused, и загрузка продолжается повторным file-upload с
+// тем же id: file-ready скажет, сколько байт уже получено.
+//
+// Скачивание загруженного файла: {"type":"file-download","id":...,
+// "offset":n}. Сервер сам открывает канал "file:<id>" и шлет файл
+// кусками по FILE_CHUNK_SIZE, притормаживая по bufferedAmount.
+
+const (
+	fileLabelPrefix = "file:"
+	// Сколько передач держит одна сессия, включая завершенные
+	maxFileTransfers = 32
+	// Отправка ждет, пока в буфере канала больше fileBufferHigh, и
+	// продолжает, когда он опустится до fileBufferLow
+	fileBufferHigh = 1 << 20
+	fileBufferLow  = 256 << 10
+	// Не чаще одного file-progress за интервал
+	fileProgressInterval = 250 * time.Millisecond
+	fileOpenTimeout      = 30 * time.Second
+)
+
+type fileTransfer struct {
+	id   string
+	dir  string // FILE_TRANSFER_DIR
+	name string
+	size int64
+
+	mu       sync.Mutex
+	received int64
+	complete bool
+	sum      string
+	file     *os.File            // открыт, пока идет загрузка
+	upload   *webrtc.DataChannel // канал текущей загрузки
+	download *webrtc.DataChannel // канал текущего скачивания
+	progress time.Time
+}
+
+func (ft *fileTransfer) partPath() string { return filepath.Join(ft.dir, ft.id+".part") }
+func (ft *fileTransfer) path() string     { return filepath.Join(ft.dir, ft.id) }
+
+func fileLabel(id string) string { return fileLabelPrefix + id }
+
+// handleFileUpload начинает загрузку или продолжает прерванную с id
+func (s *Server) handleFileUpload(client *Client, m fileUploadMessage) {
+	if s.cfg.FileTransferDir == "" {
+		client.sendError("NOT_SUPPORTED", "file transfer is disabled")
+		return
+	}
+	if m.ID != "" {
+		ft := client.fileTransfer(m.ID)
+		if ft == nil {
+			client.sendError("UNKNOWN_FILE", fmt.Sprintf("no transfer %q in this session", m.ID))
+			return
+		}
+		ft.mu.Lock()
+		complete, received := ft.complete, ft.received
+		ft.mu.Unlock()
+		if complete {
+			client.sendError("FILE_COMPLETE", fmt.Sprintf("transfer %q is already complete", m.ID))
+			return
+		}
+		client.sendFileReady(ft, "upload", received)
+		return
+	}
+
+	if m.Size > int64(s.cfg.FileTransferMaxSizeMB)<<20 {
+		client.sendError("FILE_TOO_LARGE", fmt.Sprintf("files up to %d MB are accepted", s.cfg.FileTransferMaxSizeMB))
+		return
+	}
+	ft := &fileTransfer{id: newClientID(), dir: s.cfg.FileTransferDir, name: filepath.Base(m.Name), size: m.Size}
+	err := os.MkdirAll(s.cfg.FileTransferDir, 0o755)
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(ft.partPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	}
+	if err != nil {
+		client.logger.Error("file transfer create error", "err", err)
+		client.sendError("FILE_ERROR", "cannot store the file")
+		return
+	}
+	f.Close()
+
+	client.mu.Lock()
+	if len(client.files) >= maxFileTransfers {
+		client.mu.Unlock()
+		os.Remove(ft.partPath())
+		client.sendError("FILE_LIMIT", fmt.Sprintf("at most %d file transfers per session", maxFileTransfers))
+		return
+	}
+	if client.files == nil {
+		client.files = make(map[string]*fileTransfer)
+	}
+	client.files[ft.id] = ft
+	client.mu.Unlock()
+
+	client.logger.Info("file upload started", "file", ft.id, "name", ft.name, "size", ft.size)
+	client.sendFileReady(ft, "upload", 0)
+}
+
+func (c *Client) sendFileReady(ft *fileTransfer, direction string, offset int64) {
+	c.sendJSON(map[string]interface{}{
+		"type":      "file-ready",
+		"id":        ft.id,
+		"direction": direction,
+		"label":     fileLabel(ft.id),
+		"name":      ft.name,
+		"size":      ft.size,
+		"offset":    offset,
+		"chunkSize": c.srv.cfg.FileChunkSize,
+	})
+}
+
+func (c *Client) fileTransfer(id string) *fileTransfer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.files[id]
+}
+
+// handleFileChannel принимает канал "file:<id>", открытый клиентом для
+// загрузки. Прежний канал той же загрузки, если он еще жив, закрывается.
+func handleFileChannel(client *Client, dc *webrtc.DataChannel) {
+	id := strings.TrimPrefix(dc.Label(), fileLabelPrefix)
+	ft := client.fileTransfer(id)
+	dc.OnClose(func() {
+		client.dataChannels.Add(-1)
+		if ft != nil {
+			client.fileChannelClosed(ft, dc)
+		}
+	})
+	if ft == nil {
+		client.sendError("UNKNOWN_FILE", fmt.Sprintf("no transfer %q in this session, send file-upload first", id))
+		dc.Close()
+		return
+	}
+
+	ft.mu.Lock()
+	if ft.complete {
+		ft.mu.Unlock()
+		client.sendError("FILE_COMPLETE", fmt.Sprintf("transfer %q is already complete", id))
+		dc.Close()
+		return
+	}
+	prev := ft.upload
+	if ft.file == nil {
+		f, err := os.OpenFile(ft.partPath(), os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			ft.mu.Unlock()
+			client.logger.Error("file transfer open error", "file", id, "err", err)
+			client.sendError("FILE_ERROR", "cannot store the file")
+			dc.Close()
+			return
+		}
+		ft.file = f
+	}
+	ft.upload = dc
+	ft.mu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if msg.IsString {
+			client.sendError("INVALID_MESSAGE", "file data must be sent as binary messages")
+			return
+		}
+		client.receiveFileChunk(ft, dc, msg.Data)
+	})
+}
+
+// receiveFileChunk дописывает кусок загрузки и завершает ее, когда
+// получен весь файл
+func (c *Client) receiveFileChunk(ft *fileTransfer, dc *webrtc.DataChannel, data []byte) {
+	ft.mu.Lock()
+	if ft.upload != dc || ft.complete {
+		ft.mu.Unlock()
+		return
+	}
+	if ft.received+int64(len(data)) > ft.size {
+		ft.mu.Unlock()
+		c.sendError("FILE_TOO_LARGE", fmt.Sprintf("transfer %q got more than the announced %d bytes", ft.id, ft.size))
+		c.cancelFile(ft)
+		return
+	}
+	if _, err := ft.file.Write(data); err != nil {
+		ft.mu.Unlock()
+		c.logger.Error("file transfer write error", "file", ft.id, "err", err)
+		c.sendError("FILE_ERROR", "cannot store the file")
+		c.cancelFile(ft)
+		return
+	}
+	ft.received += int64(len(data))
+	if ft.received < ft.size {
+		report := time.Since(ft.progress) >= fileProgressInterval
+		if report {
+			ft.progress = time.Now()
+		}
+		received := ft.received
+		ft.mu.Unlock()
+		if report {
+			c.sendFileProgress(ft, "upload", received)
+		}
+		return
+	}
+
+	err := ft.file.Close()
+	ft.file = nil
+	if err == nil {
+		err = os.Rename(ft.partPath(), ft.path())
+	}
+	if err == nil {
+		ft.sum, err = fileSHA256(ft.path())
+	}
+	ft.complete = err == nil
+	ft.upload = nil
+	ft.mu.Unlock()
+	dc.Close()
+	if err != nil {
+		c.logger.Error("file transfer finish error", "file", ft.id, "err", err)
+		c.sendError("FILE_ERROR", "cannot store the file")
+		return
+	}
+
+	c.logger.Info("file upload complete", "file", ft.id, "name", ft.name, "size", ft.size)
+	c.event("file-uploaded")
+	c.sendFileProgress(ft, "upload", ft.size)
+	c.sendJSON(map[string]interface{}{
+		"type":      "file-complete",
+		"id":        ft.id,
+		"direction": "upload",
+		"name":      ft.name,
+		"size":      ft.size,
+		"sha256":    ft.sum,
+	})
+}
+
+func (c *Client) sendFileProgress(ft *fileTransfer, direction string, bytes int64) {
+	c.sendJSON(map[string]interface{}{
+		"type":      "file-progress",
+		"id":        ft.id,
+		"direction": direction,
+		"bytes":     bytes,
+		"size":      ft.size,
+	})
+}
+
+// fileChannelClosed ставит передачу на паузу, если ее канал закрылся
+// до конца: ее можно продолжить с того же места
+func (c *Client) fileChannelClosed(ft *fileTransfer, dc *webrtc.DataChannel) {
+	ft.mu.Lock()
+	if ft.upload != dc {
+		ft.mu.Unlock()
+		return
+	}
+	ft.upload = nil
+	if ft.file != nil {
+		ft.file.Close()
+		ft.file = nil
+	}
+	received := ft.received
+	ft.mu.Unlock()
+
+	c.logger.Info("file upload paused", "file", ft.id, "bytes", received)
+	c.sendJSON(map[string]interface{}{
+		"type":      "file-paused",
+		"id":        ft.id,
+		"direction": "upload",
+		"offset":    received,
+	})
+}
+
+// handleFileDownload отправляет клиенту загруженный в этой сессии файл
+// начиная с offset
+func (s *Server) handleFileDownload(client *Client, m fileDownloadMessage) {
+	if s.cfg.FileTransferDir == "" {
+		client.sendError("NOT_SUPPORTED", "file transfer is disabled")
+		return
+	}
+	ft := client.fileTransfer(m.ID)
+	if ft == nil {
+		client.sendError("UNKNOWN_FILE", fmt.Sprintf("no transfer %q in this session", m.ID))
+		return
+	}
+	ft.mu.Lock()
+	complete := ft.complete
+	ft.mu.Unlock()
+	if !complete {
+		client.sendError("FILE_INCOMPLETE", fmt.Sprintf("transfer %q is not uploaded yet", m.ID))
+		return
+	}
+	if m.Offset > ft.size {
+		client.sendError("INVALID_MESSAGE", fmt.Sprintf("offset %d is past the end of the %d byte file", m.Offset, ft.size))
+		return
+	}
+
+	client.negotiationMu.Lock()
+	pc := client.pc.Load()
+	if pc == nil {
+		client.negotiationMu.Unlock()
+		client.sendError("NO_PEER_CONNECTION", "send an offer before downloading files")
+		return
+	}
+	if n := client.dataChannels.Add(1); s.cfg.MaxDataChannels > 0 && int(n) > s.cfg.MaxDataChannels {
+		client.dataChannels.Add(-1)
+		client.negotiationMu.Unlock()
+		client.sendError("DATA_CHANNEL_LIMIT", fmt.Sprintf("at most %d channels per session", s.cfg.MaxDataChannels))
+		return
+	}
+	ordered := true
+	dc, err := pc.CreateDataChannel(fileLabel(ft.id), &webrtc.DataChannelInit{Ordered: &ordered})
+	client.negotiationMu.Unlock()
+	if err != nil {
+		client.dataChannels.Add(-1)
+		client.sendError("CHANNEL_ERROR", err.Error())
+		return
+	}
+
+	ft.mu.Lock()
+	prev := ft.download
+	ft.download = dc
+	ft.mu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+	client.sendFileReady(ft, "download", m.Offset)
+	go client.sendFile(ft, dc, m.Offset)
+}
+
+// sendFile шлет файл в канал dc кусками по FILE_CHUNK_SIZE. Пока в буфере
+// канала больше fileBufferHigh, отправка ждет OnBufferedAmountLow.
+func (c *Client) sendFile(ft *fileTransfer, dc *webrtc.DataChannel, offset int64) {
+	opened := make(chan struct{})
+	closed := make(chan struct{})
+	low := make(chan struct{}, 1)
+	dc.OnOpen(func() { close(opened) })
+	dc.OnClose(func() {
+		c.dataChannels.Add(-1)
+		close(closed)
+	})
+	dc.SetBufferedAmountLowThreshold(fileBufferLow)
+	dc.OnBufferedAmountLow(func() {
+		select {
+		case low <- struct{}{}:
+		default:
+		}
+	})
+
+	sent := offset
+	// Канал, замененный новым скачиванием или отмененный, паузы не дает
+	current := func() bool {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		if ft.download != dc {
+			return false
+		}
+		ft.download = nil
+		return true
+	}
+	paused := func() {
+		if !current() {
+			return
+		}
+		c.logger.Info("file download paused", "file", ft.id, "bytes", sent)
+		c.sendJSON(map[string]interface{}{
+			"type":      "file-paused",
+			"id":        ft.id,
+			"direction": "download",
+			"offset":    sent,
+		})
+	}
+	select {
+	case <-opened:
+	case <-closed:
+		paused()
+		return
+	case <-time.After(fileOpenTimeout):
+		c.sendError("CHANNEL_ERROR", fmt.Sprintf("data channel %q did not open", dc.Label()))
+		dc.Close()
+		return
+	}
+
+	f, err := os.Open(ft.path())
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		c.logger.Error("file download open error", "file", ft.id, "err", err)
+		c.sendError("FILE_ERROR", "cannot read the file")
+		dc.Close()
+		return
+	}
+	defer f.Close()
+
+	buf := make([]byte, c.srv.cfg.FileChunkSize)
+	var progress time.Time
+	for sent < ft.size {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := dc.Send(buf[:n]); err != nil {
+				paused()
+				return
+			}
+			sent += int64(n)
+		}
+		if err != nil {
+			// Файл короче, чем был при загрузке
+			c.logger.Error("file download read error", "file", ft.id, "err", err)
+			c.sendError("FILE_ERROR", "cannot read the file")
+			dc.Close()
+			return
+		}
+		if time.Since(progress) >= fileProgressInterval {
+			progress = time.Now()
+			c.sendFileProgress(ft, "download", sent)
+		}
+		for dc.BufferedAmount() > fileBufferHigh {
+			select {
+			case <-low:
+			case <-closed:
+				paused()
+				return
+			}
+		}
+	}
+
+	// Канал закрывается, когда все отправленное ушло
+	for dc.BufferedAmount() > 0 {
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-closed:
+			paused()
+			return
+		}
+	}
+	if !current() {
+		return
+	}
+	c.logger.Info("file download complete", "file", ft.id, "size", ft.size)
+	c.sendFileProgress(ft, "download", ft.size)
+	c.sendJSON(map[string]interface{}{
+		"type":      "file-complete",
+		"id":        ft.id,
+		"direction": "download",
+		"name":      ft.name,
+		"size":      ft.size,
+		"sha256":    ft.sum,
+	})
+	dc.Close()
+}
+
+// handleFileCancel прекращает передачу; недозагруженный файл удаляется
+func handleFileCancel(client *Client, id string) {
+	ft := client.fileTransfer(id)
+	if ft == nil {
+		client.sendError("UNKNOWN_FILE", fmt.Sprintf("no transfer %q in this session", id))
+		return
+	}
+	client.cancelFile(ft)
+	client.sendJSON(map[string]interface{}{"type": "file-cancelled", "id": id})
+}
+
+// cancelFile закрывает каналы передачи и забывает ее. Загруженный
+// целиком файл остается в FILE_TRANSFER_DIR.
+func (c *Client) cancelFile(ft *fileTransfer) {
+	c.mu.Lock()
+	delete(c.files, ft.id)
+	c.mu.Unlock()
+
+	ft.mu.Lock()
+	upload, download := ft.upload, ft.download
+	ft.upload, ft.download = nil, nil
+	if ft.file != nil {
+		ft.file.Close()
+		ft.file = nil
+	}
+	if !ft.complete {
+		os.Remove(ft.partPath())
+	}
+	ft.mu.Unlock()
+	for _, dc := range []*webrtc.DataChannel{upload, download} {
+		if dc != nil {
+			dc.Close()
+		}
+	}
+}
+
+// dropFiles прекращает передачи закрытой сессии
+func (c *Client) dropFiles() {
+	c.mu.Lock()
+	list := make([]*fileTransfer, 0, len(c.files))
+	for _, ft := range c.files {
+		list = append(list, ft)
+	}
+	c.mu.Unlock()
+	for _, ft := range list {
+		c.cancelFile(ft)
+	}
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
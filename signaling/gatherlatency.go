@@ -0,0 +1,94 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// latencyAcc копит min/avg/max задержки появления кандидатов
+type latencyAcc struct {
+	count    int
+	sum      time.Duration
+	min, max time.Duration
+}
+
+func (a *latencyAcc) add(d time.Duration) {
+	if a.count == 0 || d < a.min {
+		a.min = d
+	}
+	if d > a.max {
+		a.max = d
+	}
+	a.count++
+	a.sum += d
+}
+
+type latencyStats struct {
+	Count int     `json:"count"`
+	MinMs float64 `json:"minMs"`
+	AvgMs float64 `json:"avgMs"`
+	MaxMs float64 `json:"maxMs"`
+}
+
+func (a latencyAcc) stats() latencyStats {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return latencyStats{
+		Count: a.count,
+		MinMs: ms(a.min),
+		AvgMs: ms(a.sum / time.Duration(a.count)),
+		MaxMs: ms(a.max),
+	}
+}
+
+func latencyMap(accs map[string]*latencyAcc) map[string]latencyStats {
+	if len(accs) == 0 {
+		return nil
+	}
+	m := make(map[string]latencyStats, len(accs))
+	for typ, a := range accs {
+		m[typ] = a.stats()
+	}
+	return m
+}
+
+// startGathering отмечает начало сбора кандидатов: pion начинает его в
+// SetLocalDescription
+func (c *Client) startGathering() {
+	c.statsMu.Lock()
+	c.gatherStart = time.Now()
+	c.statsMu.Unlock()
+}
+
+// recordCandidateLatency учитывает, через сколько после начала сбора
+// появился локальный кандидат, по его типу (host, srflx, prflx, relay)
+func (c *Client) recordCandidateLatency(candidate *webrtc.ICECandidate) {
+	typ := candidate.Typ.String()
+	c.statsMu.Lock()
+	if c.gatherStart.IsZero() {
+		c.statsMu.Unlock()
+		return
+	}
+	d := time.Since(c.gatherStart)
+	if c.gatherLatency == nil {
+		c.gatherLatency = make(map[string]*latencyAcc)
+	}
+	if c.gatherLatency[typ] == nil {
+		c.gatherLatency[typ] = &latencyAcc{}
+	}
+	c.gatherLatency[typ].add(d)
+	c.statsMu.Unlock()
+
+	c.srv.gatherLatencyMu.Lock()
+	if c.srv.gatherLatencyAll[typ] == nil {
+		c.srv.gatherLatencyAll[typ] = &latencyAcc{}
+	}
+	c.srv.gatherLatencyAll[typ].add(d)
+	c.srv.gatherLatencyMu.Unlock()
+}
+
+func (s *Server) gatherLatencyStats() map[string]latencyStats {
+	s.gatherLatencyMu.Lock()
+	defer s.gatherLatencyMu.Unlock()
+	return latencyMap(s.gatherLatencyAll)
+}
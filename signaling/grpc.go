@@ -0,0 +1,513 @@
+package signaling
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=go-webrtc --go-grpc_out=.. --go-grpc_opt=module=go-webrtc signaling.proto
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"go-webrtc/signalingpb"
+)
+
+// Сигнализация по gRPC (GRPC_LISTEN_ADDR). Поток Signaling.Session —
+// одна сессия: он оборачивается в grpcConn, и дальше сессия живет так же,
+// как на WebSocket, с теми же обработчиками, комнатами и пересылкой.
+// Поэтому участники обоих транспортов оказываются в одной комнате и
+// сигнализируют друг другу. Основные сообщения (offer, answer, ice, join,
+// leave и ответы на них) имеют свои protobuf-типы, остальные ходят как
+// JSON протокола WebSocket.
+
+// Сколько исходящих сообщений может ждать отправки в поток
+const grpcOutbox = 64
+
+type signalingServer struct {
+	signalingpb.UnimplementedSignalingServer
+	srv *Server
+}
+
+// startGRPCServer слушает GRPC_LISTEN_ADDR, если он задан. При TLS —
+// с тем же сертификатом, что и HTTP-сервер. Ошибка Serve уходит в errs.
+func (s *Server) startGRPCServer(manager *autocert.Manager, errs chan<- error) error {
+	if s.cfg.GRPCListenAddr == "" {
+		return nil
+	}
+	var opts []grpc.ServerOption
+	if s.cfg.TLSEnabled() {
+		config := s.newTLSConfig(manager)
+		if manager == nil {
+			cert, err := tls.LoadX509KeyPair(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+			if err != nil {
+				return err
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+	ln, err := net.Listen("tcp", s.cfg.GRPCListenAddr)
+	if err != nil {
+		return err
+	}
+	s.grpcServer = grpc.NewServer(opts...)
+	signalingpb.RegisterSignalingServer(s.grpcServer, signalingServer{srv: s})
+	slog.Info("gRPC signaling starting", "addr", s.cfg.GRPCListenAddr)
+	go func() {
+		// После Stop Serve возвращает nil
+		if err := s.grpcServer.Serve(ln); err != nil {
+			errs <- fmt.Errorf("gRPC server: %w", err)
+		}
+	}()
+	return nil
+}
+
+// stopGRPCServer закрывает оставшиеся потоки; сессии к этому времени уже
+// закрыты выключением
+func (s *Server) stopGRPCServer() {
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+}
+
+// Session обслуживает поток как подключение к /ws: те же лимиты
+// подключений, токен и параметры, только из метаданных
+func (g signalingServer) Session(stream signalingpb.Signaling_SessionServer) error {
+	g.srv.wsHandlers.Add(1)
+	defer g.srv.wsHandlers.Done()
+
+	r := grpcRequest(stream)
+	release, rej := g.srv.admitConn(r)
+	if rej != nil {
+		code := codes.ResourceExhausted
+		if rej.status == http.StatusServiceUnavailable {
+			code = codes.Unavailable
+		}
+		stream.SetTrailer(metadata.Pairs("retry-after", strconv.Itoa(g.srv.retryAfterSeconds(rej.retryAfter))))
+		return status.Error(code, rej.message)
+	}
+	defer release()
+
+	version, err := requestedProtocol(r)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var claims Claims
+	if g.srv.cfg.AuthMode == "token" {
+		if claims, err = g.srv.validateToken(r); err != nil {
+			slog.Info("rejecting gRPC session", "remote", r.RemoteAddr, "err", err)
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+	}
+
+	conn := newGRPCConn()
+	go conn.readFrom(stream)
+	if client := g.srv.openSession(r, conn, claims, version); client != nil {
+		go g.srv.serveGRPC(client, conn)
+	}
+	return conn.writeTo(stream)
+}
+
+// grpcRequest собирает из метаданных потока запрос, какой пришел бы на
+// /ws, чтобы параметры подключения разбирались одинаково
+func grpcRequest(stream grpc.ServerStream) *http.Request {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	r := &http.Request{Header: make(http.Header), URL: &url.URL{}}
+	query := url.Values{}
+	for _, key := range []string{"room", "role", "tenant", "region", "v", "resume", "cid"} {
+		if v := md.Get(key); len(v) > 0 {
+			query.Set(key, v[0])
+		}
+	}
+	r.URL.RawQuery = query.Encode()
+	for _, key := range []string{"authorization", "x-client-region", "x-correlation-id", "x-forwarded-for"} {
+		for _, v := range md.Get(key) {
+			r.Header.Add(key, v)
+		}
+	}
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	return r.WithContext(stream.Context())
+}
+
+// grpcConn — поток gRPC в роли signalConn. Отправляет в поток только
+// обработчик Session (writeTo), остальные кладут сообщения в out.
+type grpcConn struct {
+	in     chan *signalingpb.ClientMessage
+	inErr  error // почему закончилось чтение, после закрытия in
+	out    chan *signalingpb.ServerMessage
+	closed chan struct{}
+
+	mu            sync.Mutex
+	closeOnce     sync.Once
+	closeStatus   error // с чем завершится поток
+	writeDeadline time.Time
+	readTimer     *time.Timer
+	timedOut      bool
+}
+
+func newGRPCConn() *grpcConn {
+	return &grpcConn{
+		in:     make(chan *signalingpb.ClientMessage),
+		out:    make(chan *signalingpb.ServerMessage, grpcOutbox),
+		closed: make(chan struct{}),
+	}
+}
+
+// readFrom переносит сообщения из потока в in до его конца
+func (c *grpcConn) readFrom(stream signalingpb.Signaling_SessionServer) {
+	defer close(c.in)
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			c.inErr = err
+			return
+		}
+		select {
+		case c.in <- msg:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// writeTo отправляет сообщения сессии, пока ее не закроют или клиент не
+// уйдет, и возвращает статус завершения потока
+func (c *grpcConn) writeTo(stream signalingpb.Signaling_SessionServer) error {
+	for {
+		select {
+		case msg := <-c.out:
+			if err := stream.Send(msg); err != nil {
+				c.Close()
+				return err
+			}
+		case <-c.closed:
+			// Отправленное до закрытия еще уходит клиенту
+			for {
+				select {
+				case msg := <-c.out:
+					if stream.Send(msg) != nil {
+						return c.status()
+					}
+				default:
+					return c.status()
+				}
+			}
+		case <-stream.Context().Done():
+			c.Close()
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (c *grpcConn) status() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeStatus
+}
+
+func (c *grpcConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// WriteMessage ставит сообщение в очередь не дольше write deadline.
+// Клиент, который не успевает читать, отключается, как и на WebSocket.
+func (c *grpcConn) WriteMessage(_ int, data []byte) error {
+	msg := serverMessage(data)
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	default:
+	}
+	select {
+	case c.out <- msg:
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	case <-timeout:
+		c.closeWithStatus(status.Error(codes.Unavailable, "write timeout"))
+		return errors.New("gRPC write timeout")
+	}
+}
+
+// WriteControl понимает только close-фрейм: его код становится статусом
+// потока. Пинги не нужны, у gRPC свой keepalive.
+func (c *grpcConn) WriteControl(messageType int, data []byte, _ time.Time) error {
+	if messageType != websocket.CloseMessage {
+		return nil
+	}
+	code, reason := websocket.CloseNormalClosure, ""
+	if len(data) >= 2 {
+		code, reason = int(binary.BigEndian.Uint16(data)), string(data[2:])
+	}
+	c.closeWithStatus(closeStatus(code, reason))
+	return nil
+}
+
+// closeStatus — статус потока для кода закрытия WebSocket
+func closeStatus(code int, reason string) error {
+	switch code {
+	case websocket.CloseNormalClosure:
+		return nil
+	case closeUnauthorized:
+		return status.Error(codes.Unauthenticated, reason)
+	case closeForbidden:
+		return status.Error(codes.PermissionDenied, reason)
+	case websocket.ClosePolicyViolation:
+		return status.Error(codes.ResourceExhausted, reason)
+	}
+	return status.Error(codes.Unavailable, reason)
+}
+
+// SetReadDeadline закрывает поток по таймауту, если до t от клиента
+// ничего не придет
+func (c *grpcConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+	}
+	if !t.IsZero() {
+		c.readTimer = time.AfterFunc(time.Until(t), func() {
+			c.mu.Lock()
+			c.timedOut = true
+			c.mu.Unlock()
+			c.closeWithStatus(status.Error(codes.DeadlineExceeded, "read timeout"))
+		})
+	}
+	return nil
+}
+
+func (c *grpcConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *grpcConn) Close() error {
+	c.closeWithStatus(nil)
+	return nil
+}
+
+// closeWithStatus закрывает поток; статус берется от первого закрытия
+func (c *grpcConn) closeWithStatus(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closeStatus = err
+		if c.readTimer != nil {
+			c.readTimer.Stop()
+		}
+		c.mu.Unlock()
+		close(c.closed)
+	})
+}
+
+// serveGRPC — serveConn для потока gRPC
+func (s *Server) serveGRPC(client *Client, conn *grpcConn) {
+	dropped := false
+	defer func() {
+		if dropped && client.park() {
+			return
+		}
+		client.end()
+		s.cleanupClient(client)
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			client.logger.Error("panic handling message", "panic", r)
+		}
+	}()
+
+	client.touch()
+	for {
+		var msg *signalingpb.ClientMessage
+		select {
+		case m, ok := <-conn.in:
+			if !ok {
+				// Клиент закончил поток сам (CloseSend) — как close-фрейм
+				if errors.Is(conn.inErr, io.EOF) {
+					client.peerClosed.Store(true)
+				}
+				dropped = !client.peerClosed.Load()
+				return
+			}
+			msg = m
+		case <-conn.closed:
+			// Закрыт сервером или по таймауту чтения: как оборванный сокет
+			conn.mu.Lock()
+			if conn.timedOut {
+				s.metrics.timeouts.Inc()
+			}
+			conn.mu.Unlock()
+			dropped = !client.peerClosed.Load()
+			return
+		}
+
+		data, err := clientMessageJSON(msg)
+		if err != nil {
+			client.sendError("INVALID_MESSAGE", err.Error())
+			continue
+		}
+		client.touch()
+		ok, keep := client.allowMessage()
+		if !keep {
+			return
+		}
+		if ok && !s.handleMessage(client, data) {
+			return
+		}
+	}
+}
+
+// clientMessageJSON переводит сообщение клиента в JSON протокола WebSocket
+func clientMessageJSON(m *signalingpb.ClientMessage) ([]byte, error) {
+	var v interface{}
+	switch msg := m.Message.(type) {
+	case *signalingpb.ClientMessage_Offer:
+		v = map[string]interface{}{"type": "offer", "sdp": msg.Offer.Sdp}
+	case *signalingpb.ClientMessage_Answer:
+		v = map[string]interface{}{"type": "answer", "sdp": msg.Answer.Sdp}
+	case *signalingpb.ClientMessage_Ice:
+		c := msg.Ice
+		candidate := webrtc.ICECandidateInit{
+			Candidate:        c.Candidate,
+			SDPMid:           c.SdpMid,
+			UsernameFragment: c.UsernameFragment,
+		}
+		if c.SdpMlineIndex != nil {
+			index := uint16(*c.SdpMlineIndex)
+			candidate.SDPMLineIndex = &index
+		}
+		v = map[string]interface{}{"type": "ice", "candidate": candidate}
+	case *signalingpb.ClientMessage_Join:
+		v = map[string]interface{}{"type": "join", "room": msg.Join.Room}
+	case *signalingpb.ClientMessage_Leave:
+		v = map[string]interface{}{"type": "leave"}
+	case *signalingpb.ClientMessage_Json:
+		return msg.Json.Data, nil
+	default:
+		return nil, errors.New("empty message")
+	}
+	return json.Marshal(v)
+}
+
+// wireMessage — поля исходящих сообщений, у которых есть protobuf-типы
+type wireMessage struct {
+	Type       string                   `json:"type"`
+	SDP        string                   `json:"sdp"`
+	From       string                   `json:"from"`
+	Candidate  *webrtc.ICECandidateInit `json:"candidate"`
+	Room       string                   `json:"room"`
+	Peers      []string                 `json:"peers"`
+	ClientID   string                   `json:"clientId"`
+	Code       string                   `json:"code"`
+	Message    string                   `json:"message"`
+	Field      string                   `json:"field"`
+	Fields     []string                 `json:"fields"`
+	RetryAfter int                      `json:"retryAfter"`
+}
+
+// Поля, которые переносят protobuf-типы; сообщение с другими полями
+// уходит как JSON, чтобы ничего не потерять
+var wireFields = map[string][]string{
+	"offer":       {"sdp", "from"},
+	"answer":      {"sdp", "from"},
+	"ice":         {"candidate", "from"},
+	"joined":      {"room", "peers"},
+	"left":        {"room"},
+	"peer-joined": {"clientId"},
+	"peer-left":   {"clientId"},
+	"error":       {"code", "message", "field", "fields", "retryAfter"},
+}
+
+// serverMessage переводит исходящее JSON-сообщение в protobuf
+func serverMessage(data []byte) *signalingpb.ServerMessage {
+	raw := &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_Json{Json: &signalingpb.Json{Data: data}}}
+	var fields map[string]json.RawMessage
+	var m wireMessage
+	if json.Unmarshal(data, &fields) != nil || json.Unmarshal(data, &m) != nil {
+		return raw
+	}
+	known, ok := wireFields[m.Type]
+	if !ok {
+		return raw
+	}
+	for name := range fields {
+		if name != "type" && !slices.Contains(known, name) {
+			return raw
+		}
+	}
+
+	switch m.Type {
+	case "offer":
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_Offer{Offer: &signalingpb.Offer{Sdp: m.SDP, From: m.From}}}
+	case "answer":
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_Answer{Answer: &signalingpb.Answer{Sdp: m.SDP, From: m.From}}}
+	case "ice":
+		if m.Candidate == nil {
+			return raw
+		}
+		ice := &signalingpb.IceCandidate{
+			Candidate:        m.Candidate.Candidate,
+			SdpMid:           m.Candidate.SDPMid,
+			UsernameFragment: m.Candidate.UsernameFragment,
+			From:             m.From,
+		}
+		if m.Candidate.SDPMLineIndex != nil {
+			index := uint32(*m.Candidate.SDPMLineIndex)
+			ice.SdpMlineIndex = &index
+		}
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_Ice{Ice: ice}}
+	case "joined":
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_Joined{Joined: &signalingpb.Joined{Room: m.Room, Peers: m.Peers}}}
+	case "left":
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_Left{Left: &signalingpb.Left{Room: m.Room}}}
+	case "peer-joined":
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_PeerJoined{PeerJoined: &signalingpb.PeerJoined{ClientId: m.ClientID}}}
+	case "peer-left":
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_PeerLeft{PeerLeft: &signalingpb.PeerLeft{ClientId: m.ClientID}}}
+	case "error":
+		return &signalingpb.ServerMessage{Message: &signalingpb.ServerMessage_Error{Error: &signalingpb.Error{
+			Code:       m.Code,
+			Message:    m.Message,
+			Field:      m.Field,
+			Fields:     m.Fields,
+			RetryAfter: int32(m.RetryAfter),
+		}}}
+	}
+	return raw
+}
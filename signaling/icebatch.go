@@ -0,0 +1,115 @@
+package signaling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// allowCandidate учитывает кандидата клиента и проверяет лимит на сессию.
+// О превышении клиенту сообщается один раз.
+func (c *Client) allowCandidate() bool {
+	n := c.candidates.Add(1)
+	if c.srv.cfg.MaxCandidates <= 0 || int(n) <= c.srv.cfg.MaxCandidates {
+		return true
+	}
+	if int(n) == c.srv.cfg.MaxCandidates+1 {
+		c.logger.Warn("candidate limit reached", "limit", c.srv.cfg.MaxCandidates)
+		c.sendError("CANDIDATE_LIMIT", fmt.Sprintf("at most %d ICE candidates per session", c.srv.cfg.MaxCandidates))
+	}
+	return false
+}
+
+// handleICEBatch разбирает {"type":"ice-batch","candidates":[...]} потоково:
+// кандидаты декодируются по одному, и разбор останавливается, как только
+// исчерпан лимит на сессию. Массив целиком в память не собирается.
+func (s *Server) handleICEBatch(client *Client, msg []byte) {
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	if err := seekKey(dec, "candidates"); err != nil {
+		client.logger.Warn("ice-batch decode error", "err", err)
+		client.sendError("INVALID_MESSAGE", "ice-batch: candidates: "+err.Error())
+		return
+	}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		client.logger.Warn("ice-batch decode error: candidates is not an array")
+		client.sendJSON(errorMessage{Type: "error", Code: "INVALID_MESSAGE", Message: "ice-batch: candidates: expected array", Field: "candidates"})
+		return
+	}
+
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			client.logger.Warn("ice-batch decode error", "err", err)
+			client.sendError("INVALID_MESSAGE", "ice-batch: "+err.Error())
+			return
+		}
+
+		if s.cfg.SchemaValidation {
+			var candidate map[string]interface{}
+			json.Unmarshal(raw, &candidate)
+			if _, err := s.validateMessage(map[string]interface{}{"type": "ice", "candidate": candidate}); err != nil {
+				client.logger.Warn("ice-batch candidate rejected", "err", err)
+				continue
+			}
+		}
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(raw, &candidate); err != nil {
+			client.logger.Warn("ice-batch entry rejected", "index", i, "err", err)
+			client.sendJSON(errorMessage{
+				Type:    "error",
+				Code:    "INVALID_MESSAGE",
+				Message: fmt.Sprintf("ice-batch: candidates[%d]: %v", i, err),
+				Field:   fmt.Sprintf("candidates[%d]", i),
+			})
+			continue
+		}
+
+		if !client.allowCandidate() {
+			return
+		}
+		addICECandidate(client, candidate)
+	}
+}
+
+// seekKey перемещает декодер к значению ключа key объекта верхнего уровня,
+// пропуская остальные значения без их декодирования
+func seekKey(dec *json.Decoder, key string) error {
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return errors.New("message is not an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == key {
+			return nil
+		}
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("no %q field", key)
+}
+
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package signaling
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// noteICEFailure учитывает неудачу ICE: переход в failed или попытку
+// восстановления, не вернувшую соединение. true — за ICE_FAILURE_WINDOW
+// набралось ICE_FAILURE_LIMIT неудач и пытаться дальше бессмысленно.
+func (c *Client) noteICEFailure() bool {
+	if c.srv.cfg.ICEFailureLimit == 0 {
+		return false
+	}
+	now := time.Now()
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	recent := c.iceFailures[:0]
+	for _, t := range c.iceFailures {
+		if now.Sub(t) < c.srv.cfg.ICEFailureWindow {
+			recent = append(recent, t)
+		}
+	}
+	c.iceFailures = append(recent, now)
+	return len(c.iceFailures) >= c.srv.cfg.ICEFailureLimit
+}
+
+// giveUpICE отключает клиента, сеть которого раз за разом не проходит ICE
+func (s *Server) giveUpICE(client *Client, pc *webrtc.PeerConnection) {
+	client.logger.Info("persistent ICE failure, disconnecting", "failures", s.cfg.ICEFailureLimit, "window", s.cfg.ICEFailureWindow.String())
+	client.event("persistent-ice-failure")
+	client.recordFailure(iceFailure(client, pc))
+	client.sendError("PERSISTENT_ICE_FAILURE", fmt.Sprintf("ICE failed %d times within %s", s.cfg.ICEFailureLimit, s.cfg.ICEFailureWindow))
+	s.cleanupClient(client)
+}
@@ -0,0 +1,20 @@
+package signaling
+
+import (
+	"go-webrtc/media"
+)
+
+// recordICELite отмечает ICE-lite пира. Роль controlling сервер берет
+// сам: pion при lite-пире всегда назначает себя контролирующим агентом,
+// поэтому здесь только учет и лог.
+func (c *Client) recordICELite(offer string) {
+	lite := media.IsICELite(offer)
+	c.statsMu.Lock()
+	changed := lite && !c.iceLite
+	c.iceLite = lite
+	c.statsMu.Unlock()
+	if changed {
+		c.event("ice-lite-peer")
+		c.logger.Info("ICE-lite peer detected, server is controlling")
+	}
+}
@@ -0,0 +1,30 @@
+package signaling
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestICELitePeerRecorded(t *testing.T) {
+	s, ts := newTestServer(t, nil)
+	ws := dialWS(t, ts, "")
+
+	var se webrtc.SettingEngine
+	se.SetLite(true)
+	pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.CreateDataChannel("test", nil); err != nil {
+		t.Fatal(err)
+	}
+	offer := createOffer(t, pc)
+	sendJSON(t, ws, map[string]string{"type": "offer", "sdp": offer.SDP})
+	readType(t, ws, "answer")
+
+	if st := s.clients.snapshot()[0].stats(); !st.ICELite {
+		t.Fatal("ICE-lite offer not reported as iceLite in stats")
+	}
+}
@@ -0,0 +1,65 @@
+package signaling
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/config"
+)
+
+// Значения переменных config.TURNTemplateVars в шаблонах
+// TURN_URL_TEMPLATES
+var turnTemplateVars = map[string]func(*Client) string{
+	"region":   func(c *Client) string { return c.region },
+	"clientId": func(c *Client) string { return c.id },
+}
+
+// Значения подставляются в hostname, поэтому допускаем только
+// безопасные символы
+var templateValueRe = regexp.MustCompile(`^[A-Za-z0-9-]{1,63}$`)
+
+// iceServersFor собирает список ICE-серверов для клиента, включая
+// встроенный TURN. Если хоть одну переменную шаблона не удалось
+// подставить, используется список по умолчанию.
+func (s *Server) iceServersFor(client *Client) []webrtc.ICEServer {
+	templates := append(s.embeddedTURNURLs(), s.cfg.TURNURLTemplates...)
+	if len(templates) == 0 {
+		return s.currentICEServers()
+	}
+
+	urls := make([]string, 0, len(templates))
+	for _, tmpl := range templates {
+		u, err := resolveTURNTemplate(tmpl, client)
+		if err != nil {
+			client.logger.Warn("TURN template error, using default ICE servers", "template", tmpl, "err", err)
+			return s.currentICEServers()
+		}
+		urls = append(urls, u)
+	}
+
+	username, credential := s.turnCredentialsFor(client)
+	servers := append([]webrtc.ICEServer(nil), s.currentICEServers()...)
+	return append(servers, webrtc.ICEServer{
+		URLs:       urls,
+		Username:   username,
+		Credential: credential,
+	})
+}
+
+func resolveTURNTemplate(tmpl string, client *Client) (string, error) {
+	var resolveErr error
+	resolved := config.TURNTemplateVarRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := m[1 : len(m)-1]
+		value := turnTemplateVars[name](client)
+		if !templateValueRe.MatchString(value) {
+			if resolveErr == nil {
+				resolveErr = fmt.Errorf("variable {%s} has no usable value", name)
+			}
+			return m
+		}
+		return value
+	})
+	return resolved, resolveErr
+}
@@ -0,0 +1,64 @@
+package signaling
+
+import (
+	"time"
+)
+
+// touch отмечает активность клиента и продлевает read deadline на
+// ReadTimeout. Это единственное место, где двигается дедлайн; вызывается
+// только из читающей горутины (цикл чтения и pong handler), а
+// lastActivity атомарен, потому что его читает watchIdle.
+func (c *Client) touch() {
+	now := time.Now()
+	c.lastActivity.Store(now.UnixNano())
+	c.conn.SetReadDeadline(now.Add(c.srv.cfg.ReadTimeout))
+}
+
+// watchIdle за IdleWarningBefore до истечения read deadline отправляет
+// idle-warning, чтобы клиент успел проявить активность. Если ее не
+// будет, соединение закроется по таймауту чтения, как и раньше.
+func (s *Server) watchIdle(client *Client) {
+	for {
+		last := client.lastActivity.Load()
+		warnAt := time.Unix(0, last).Add(s.cfg.ReadTimeout - s.cfg.IdleWarningBefore)
+		select {
+		case <-client.readDone:
+			return
+		case <-time.After(time.Until(warnAt)):
+		}
+		if client.lastActivity.Load() != last {
+			continue
+		}
+
+		client.logger.Info("idle, warning before disconnect")
+		client.sendJSON(map[string]interface{}{
+			"type":        "idle-warning",
+			"secondsLeft": int(s.cfg.IdleWarningBefore.Seconds()),
+		})
+
+		// Ждем до дедлайна: либо активность, либо закрытие
+		select {
+		case <-client.readDone:
+			return
+		case <-time.After(s.cfg.IdleWarningBefore):
+		}
+	}
+}
+
+// watchSignaling отключает клиента, который подключился (и, возможно,
+// прошел auth), но за NO_OFFER_TIMEOUT так и не прислал offer. Клиент в
+// комнате считается занятым сигнализацией с момента подключения.
+func (s *Server) watchSignaling(client *Client) {
+	select {
+	case <-client.readDone:
+		return
+	case <-time.After(s.cfg.NoOfferTimeout):
+	}
+	if client.signaled.Load() {
+		return
+	}
+	client.logger.Info("no offer, disconnecting", "after", s.cfg.NoOfferTimeout.String())
+	client.event("no-signaling")
+	client.sendError("NO_SIGNALING", "no offer within "+s.cfg.NoOfferTimeout.String())
+	s.cleanupClient(client)
+}
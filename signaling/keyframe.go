@@ -0,0 +1,172 @@
+package signaling
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+)
+
+type keyframeStats struct {
+	TrackID         string  `json:"trackId"`
+	Keyframes       int     `json:"keyframes"`
+	PLIsSent        int     `json:"plisSent"`
+	LastIntervalSec float64 `json:"lastIntervalSec"`
+	MaxIntervalSec  float64 `json:"maxIntervalSec"`
+}
+
+// keyframeTracker следит за ключевыми кадрами входящего видеотрека
+type keyframeTracker struct {
+	mu           sync.Mutex
+	trackID      string
+	lastKeyframe time.Time
+	lastTS       uint32
+	lastPLI      time.Time
+	keyframes    int
+	plisSent     int
+	lastInterval time.Duration
+	maxInterval  time.Duration
+}
+
+func (k *keyframeTracker) observe(pkt *rtp.Packet, mimeType string) {
+	if !isKeyframe(pkt, mimeType) {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Один кадр приходит несколькими пакетами с одинаковым timestamp
+	if k.keyframes > 0 && pkt.Timestamp == k.lastTS {
+		return
+	}
+
+	now := time.Now()
+	if !k.lastKeyframe.IsZero() {
+		k.lastInterval = now.Sub(k.lastKeyframe)
+		if k.lastInterval > k.maxInterval {
+			k.maxInterval = k.lastInterval
+		}
+	}
+	k.lastKeyframe = now
+	k.lastTS = pkt.Timestamp
+	k.keyframes++
+}
+
+// needPLI сообщает, пора ли запросить ключевой кадр у издателя
+func (k *keyframeTracker) needPLI(interval time.Duration) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	if !k.lastKeyframe.IsZero() && now.Sub(k.lastKeyframe) < interval {
+		return false
+	}
+	if !k.lastPLI.IsZero() && now.Sub(k.lastPLI) < interval {
+		return false
+	}
+	k.lastPLI = now
+	k.plisSent++
+	return true
+}
+
+func (k *keyframeTracker) stats() keyframeStats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return keyframeStats{
+		TrackID:         k.trackID,
+		Keyframes:       k.keyframes,
+		PLIsSent:        k.plisSent,
+		LastIntervalSec: k.lastInterval.Seconds(),
+		MaxIntervalSec:  k.maxInterval.Seconds(),
+	}
+}
+
+// enforceKeyframes периодически шлет PLI, если ключевых кадров
+// не было дольше interval. Останавливается при закрытии done.
+func enforceKeyframes(pc *webrtc.PeerConnection, track *webrtc.TrackRemote, k *keyframeTracker, interval time.Duration, done <-chan struct{}) {
+	tick := interval / 4
+	if tick > time.Second {
+		tick = time.Second
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !k.needPLI(interval) {
+				continue
+			}
+			if err := pc.WriteRTCP([]rtcp.Packet{
+				&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())},
+			}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func isKeyframe(pkt *rtp.Packet, mimeType string) bool {
+	switch {
+	case strings.EqualFold(mimeType, webrtc.MimeTypeVP8):
+		vp8 := &codecs.VP8Packet{}
+		if _, err := vp8.Unmarshal(pkt.Payload); err != nil {
+			return false
+		}
+		// Начало первой партиции и сброшенный бит P в заголовке кадра
+		return vp8.S == 1 && vp8.PID == 0 && len(vp8.Payload) > 0 && vp8.Payload[0]&0x01 == 0
+	case strings.EqualFold(mimeType, webrtc.MimeTypeVP9):
+		vp9 := &codecs.VP9Packet{}
+		if _, err := vp9.Unmarshal(pkt.Payload); err != nil {
+			return false
+		}
+		return vp9.B && !vp9.P
+	case strings.EqualFold(mimeType, webrtc.MimeTypeH264):
+		return isH264Keyframe(pkt.Payload)
+	}
+	return false
+}
+
+func isH264Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	const (
+		naluIDR  = 5
+		naluSPS  = 7
+		naluSTAP = 24
+		naluFUA  = 28
+	)
+
+	switch naluType := payload[0] & 0x1F; naluType {
+	case naluIDR, naluSPS:
+		return true
+	case naluSTAP:
+		for i := 1; i+2 < len(payload); {
+			size := int(payload[i])<<8 | int(payload[i+1])
+			i += 2
+			if i >= len(payload) {
+				break
+			}
+			if t := payload[i] & 0x1F; t == naluIDR || t == naluSPS {
+				return true
+			}
+			i += size
+		}
+	case naluFUA:
+		if len(payload) < 2 {
+			return false
+		}
+		// Только первый фрагмент IDR
+		return payload[1]&0x80 != 0 && payload[1]&0x1F == naluIDR
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/pion/logging"
+
+	"go-webrtc/config"
+)
+
+// SetupLogging переводит лог процесса на slog в формате LOG_FORMAT: json
+// или text, с уровнями сервера и копией в /admin/logs. Вызовы пакета log
+// попадают туда же на уровне Info. Встраивающий код со своим логом может
+// не вызывать.
+func (s *Server) SetupLogging() {
+	opts := &slog.HandlerOptions{Level: s.logLevel}
+	out := io.MultiWriter(os.Stderr, s.logs)
+	var handler slog.Handler = slog.NewJSONHandler(out, opts)
+	if s.cfg.LogFormat == "text" {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// applyLogLevels применяет уровни из настроек. Неверные значения
+// отсеивает Validate, здесь они оставляют уровень прежним.
+func (s *Server) applyLogLevels(c config.Config) {
+	if level, err := config.ParseLogLevel(c.LogLevel); err == nil {
+		s.logLevel.Set(level)
+	}
+	if level, err := config.ParseLogLevel(c.LogLevelPion); err == nil {
+		s.pionLevel.Set(level)
+	}
+}
+
+// Id корреляции, который клиент передает в ?cid= или X-Correlation-ID,
+// чтобы связать записи сервера со своими
+var correlationIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// newClientLogger — логгер сессии: id подключения, адрес, id корреляции
+// клиента и текущая комната в каждой записи
+func newClientLogger(c *Client, correlationID string) *slog.Logger {
+	args := []any{"conn", c.id, "remote", c.remoteAddr}
+	if correlationID != "" {
+		args = append(args, "cid", correlationID)
+	}
+	return slog.New(&roomHandler{Handler: slog.Default().Handler(), client: c}).With(args...)
+}
+
+// roomHandler добавляет к записи комнату клиента на момент записи:
+// клиент переходит между комнатами, а логгер остается тем же
+type roomHandler struct {
+	slog.Handler
+	client *Client
+}
+
+func (h *roomHandler) Handle(ctx context.Context, r slog.Record) error {
+	if room := h.client.roomID.Load(); room != nil {
+		r.AddAttrs(slog.String("room", *room))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *roomHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &roomHandler{Handler: h.Handler.WithAttrs(attrs), client: h.client}
+}
+
+func (h *roomHandler) WithGroup(name string) slog.Handler {
+	return &roomHandler{Handler: h.Handler.WithGroup(name), client: h.client}
+}
+
+// pionLoggerFactory направляет внутренние логи pion (ICE, DTLS, SCTP...)
+// в slog с полем pion=<подсистема> и своим уровнем LOG_LEVEL_PION.
+// Trace pion пишется на уровне debug-4.
+type pionLoggerFactory struct {
+	level *slog.LevelVar
+}
+
+func (f pionLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return &pionLogger{logger: slog.Default().With("pion", scope), level: f.level}
+}
+
+type pionLogger struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+}
+
+const pionTraceLevel = slog.LevelDebug - 4
+
+func (p *pionLogger) log(level slog.Level, msg string) {
+	if level < p.level.Level() {
+		return
+	}
+	p.logger.Log(context.Background(), level, msg)
+}
+
+func (p *pionLogger) Trace(msg string) { p.log(pionTraceLevel, msg) }
+func (p *pionLogger) Tracef(format string, args ...interface{}) {
+	p.log(pionTraceLevel, fmt.Sprintf(format, args...))
+}
+func (p *pionLogger) Debug(msg string) { p.log(slog.LevelDebug, msg) }
+func (p *pionLogger) Debugf(format string, args ...interface{}) {
+	p.log(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+func (p *pionLogger) Info(msg string) { p.log(slog.LevelInfo, msg) }
+func (p *pionLogger) Infof(format string, args ...interface{}) {
+	p.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+func (p *pionLogger) Warn(msg string) { p.log(slog.LevelWarn, msg) }
+func (p *pionLogger) Warnf(format string, args ...interface{}) {
+	p.log(slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+func (p *pionLogger) Error(msg string) { p.log(slog.LevelError, msg) }
+func (p *pionLogger) Errorf(format string, args ...interface{}) {
+	p.log(slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+// requestCorrelationID — id корреляции из ?cid= или X-Correlation-ID;
+// неподходящий игнорируется
+func requestCorrelationID(r *http.Request) string {
+	id := r.URL.Query().Get("cid")
+	if id == "" {
+		id = r.Header.Get("X-Correlation-ID")
+	}
+	if !correlationIDRe.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+// handleLogLevel — GET и PUT /admin/log-level: текущие уровни лога и их
+// смена на ходу {"level":"debug","pion":"info"}, любое из полей. До
+// перезапуска или SIGHUP.
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var req struct {
+			Level string `json:"level"`
+			Pion  string `json:"pion"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "body must be {\"level\":...,\"pion\":...}", http.StatusBadRequest)
+			return
+		}
+		level, pion := s.logLevel.Level(), s.pionLevel.Level()
+		var err error
+		if req.Level != "" {
+			level, err = config.ParseLogLevel(req.Level)
+		}
+		if err == nil && req.Pion != "" {
+			pion, err = config.ParseLogLevel(req.Pion)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logLevel.Set(level)
+		s.pionLevel.Set(pion)
+		slog.Info("log level changed", "level", s.logLevel.Level().String(), "pion", s.pionLevel.Level().String(), "by", r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"level": s.logLevel.Level().String(),
+		"pion":  s.pionLevel.Level().String(),
+	})
+}
@@ -0,0 +1,135 @@
+package signaling
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type logEvent struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	// Сколько событий пропущено перед этим из-за медленного чтения
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+type logSubscriber struct {
+	events   chan logEvent
+	dropped  atomic.Int64
+	kicked   chan struct{}
+	kickOnce sync.Once
+}
+
+// logHub раздает строки стандартного логгера подписчикам /admin/logs.
+// Подключается через log.SetOutput вместе с stderr.
+type logHub struct {
+	srv  *Server
+	mu   sync.Mutex
+	subs map[*logSubscriber]struct{}
+}
+
+// Write вызывается логгером на каждую строку. Логировать отсюда нельзя.
+func (h *logHub) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs) == 0 {
+		return len(p), nil
+	}
+
+	ev := logEvent{Time: time.Now(), Message: h.srv.redactSecrets(strings.TrimSuffix(string(p), "\n"))}
+	for sub := range h.subs {
+		select {
+		case sub.events <- ev:
+		default:
+			if h.srv.cfg.LogStreamDrop == "disconnect" {
+				sub.kickOnce.Do(func() { close(sub.kicked) })
+			} else {
+				sub.dropped.Add(1)
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (h *logHub) subscribe() *logSubscriber {
+	sub := &logSubscriber{
+		events: make(chan logEvent, h.srv.cfg.LogStreamBuffer),
+		kicked: make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *logHub) unsubscribe(sub *logSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+}
+
+// redactSecrets вырезает значения секретов из настроек, если они
+// случайно попали в строку лога
+func (s *Server) redactSecrets(line string) string {
+	secrets := []string{s.cfg.TURNCredential, s.cfg.TURNSecret, s.cfg.AuthPSK, s.cfg.AuthTokenSecret, s.cfg.AdminToken}
+	for _, entry := range s.cfg.AuthAPIKeys {
+		_, key, _ := strings.Cut(entry, ":")
+		secrets = append(secrets, key)
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			line = strings.ReplaceAll(line, secret, "<redacted>")
+		}
+	}
+	return line
+}
+
+// handleAdminLogs транслирует лог сервера по WebSocket. Медленный
+// подписчик теряет события (LOG_STREAM_DROP=drop) или отключается
+// (disconnect).
+func (s *Server) handleAdminLogs(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("log stream upgrade error", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := s.logs.subscribe()
+	defer s.logs.unsubscribe(sub)
+	slog.Info("log stream opened", "remote", r.RemoteAddr)
+
+	// Входящие сообщения не нужны, читаем только ради close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-sub.events:
+			ev.Dropped = sub.dropped.Swap(0)
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-sub.kicked:
+			msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "log stream buffer overflow")
+			conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+			slog.Warn("log stream dropped: too slow", "remote", r.RemoteAddr)
+			return
+		case <-closed:
+			slog.Info("log stream closed", "remote", r.RemoteAddr)
+			return
+		}
+	}
+}
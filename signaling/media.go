@@ -0,0 +1,19 @@
+package signaling
+
+import (
+	"go-webrtc/media"
+)
+
+func (s *Server) newWebRTCAPI() (*media.API, error) {
+	return media.NewAPI(media.Options{
+		Codecs:            s.serverCodecs(),
+		AudioLevel:        s.cfg.ActiveSpeakerInterval > 0,
+		BWE:               s.bweEnabled(),
+		BWEInitialBitrate: s.cfg.BWEInitialBitrate,
+		SRTPProfiles:      s.cfg.SRTPProfiles,
+		ICEUDPPort:        s.cfg.ICEUDPPort,
+		TestICEUfrag:      s.cfg.TestICEUfrag,
+		TestICEPwd:        s.cfg.TestICEPwd,
+		LoggerFactory:     pionLoggerFactory{level: s.pionLevel},
+	})
+}
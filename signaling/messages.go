@@ -0,0 +1,255 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Версии протокола сигнализации. Клиент называет свою в ?v= при
+// подключении или в hello, сервер работает по меньшей из нее и
+// protocolVersion. Без версии — 1.
+//
+//	1 — исходный протокол: сообщения неизвестного типа игнорируются
+//	2 — на сообщение неизвестного типа приходит ошибка UNKNOWN_TYPE
+const (
+	protocolVersionMin = 1
+	protocolVersion    = 2
+)
+
+// requestedProtocol — версия из ?v=; ошибка, если сервер ее не знает
+func requestedProtocol(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("v")
+	if v == "" {
+		return protocolVersionMin, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < protocolVersionMin {
+		return 0, fmt.Errorf("unsupported protocol version %q, server speaks %d-%d", v, protocolVersionMin, protocolVersion)
+	}
+	return min(n, protocolVersion), nil
+}
+
+// Входящие сообщения. Тип уже известен по полю type, здесь остальные поля.
+
+type helloMessage struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
+}
+
+type authMessage struct {
+	Key string `json:"key"`
+}
+
+type offerMessage struct {
+	SDP  string      `json:"sdp"`
+	Opus interface{} `json:"opus"`
+}
+
+type answerMessage struct {
+	SDP string `json:"sdp"`
+}
+
+type iceMessage struct {
+	Candidate *webrtc.ICECandidateInit `json:"candidate"`
+}
+
+type joinMessage struct {
+	Room string `json:"room"`
+	Role string `json:"role"`
+}
+
+type leaveMessage struct{}
+
+type stateSetMessage struct {
+	Key   *string     `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+type recordingMessage struct {
+	Scope string `json:"scope"`
+}
+
+type restreamMessage struct {
+	URL  string `json:"url"`
+	Stop bool   `json:"stop"`
+}
+
+type mediaPlayingMessage struct {
+	OK *bool `json:"ok"`
+}
+
+type setLayerMessage struct {
+	Track string `json:"track"`
+	RID   string `json:"rid"`
+	From  string `json:"from"`
+}
+
+type fileUploadMessage struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type fileDownloadMessage struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+type fileCancelMessage struct {
+	ID string `json:"id"`
+}
+
+func (m *helloMessage) validate() error {
+	if m.Version != 0 && m.Version < protocolVersionMin {
+		return &fieldError{"version", fmt.Sprintf("must be %d-%d", protocolVersionMin, protocolVersion)}
+	}
+	return nil
+}
+
+func (m *authMessage) validate() error { return nil }
+
+func (m *offerMessage) validate() error {
+	if m.SDP == "" {
+		return &fieldError{"sdp", "required"}
+	}
+	return nil
+}
+
+func (m *answerMessage) validate() error {
+	if m.SDP == "" {
+		return &fieldError{"sdp", "required"}
+	}
+	return nil
+}
+
+func (m *iceMessage) validate() error {
+	if m.Candidate == nil {
+		return &fieldError{"candidate", "required"}
+	}
+	return nil
+}
+
+func (m *joinMessage) validate() error {
+	if m.Room == "" {
+		return &fieldError{"room", "required"}
+	}
+	return nil
+}
+
+func (m *leaveMessage) validate() error { return nil }
+
+func (m *stateSetMessage) validate() error {
+	if m.Key == nil {
+		return &fieldError{"key", "required"}
+	}
+	return nil
+}
+
+func (m *recordingMessage) validate() error {
+	if m.Scope == "" {
+		m.Scope = "peer"
+	}
+	return nil
+}
+
+func (m *restreamMessage) validate() error { return nil }
+
+func (m *mediaPlayingMessage) validate() error {
+	if m.OK == nil {
+		return &fieldError{"ok", "required"}
+	}
+	return nil
+}
+
+func (m *setLayerMessage) validate() error {
+	if m.Track == "" {
+		return &fieldError{"track", "required"}
+	}
+	if m.RID == "" {
+		return &fieldError{"rid", "required"}
+	}
+	return nil
+}
+
+func (m *fileUploadMessage) validate() error {
+	if m.ID != "" {
+		return nil
+	}
+	if m.Name == "" {
+		return &fieldError{"name", "required"}
+	}
+	if m.Size < 1 {
+		return &fieldError{"size", "must be positive"}
+	}
+	return nil
+}
+
+func (m *fileDownloadMessage) validate() error {
+	if m.ID == "" {
+		return &fieldError{"id", "required"}
+	}
+	if m.Offset < 0 {
+		return &fieldError{"offset", "must not be negative"}
+	}
+	return nil
+}
+
+func (m *fileCancelMessage) validate() error {
+	if m.ID == "" {
+		return &fieldError{"id", "required"}
+	}
+	return nil
+}
+
+// errorMessage — ответ error. Field — поле сообщения, из-за которого оно
+// отклонено, Fields — поля, не прошедшие проверку схемой.
+type errorMessage struct {
+	Type    string   `json:"type"`
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Field   string   `json:"field,omitempty"`
+	Fields  []string `json:"fields,omitempty"`
+	// Через сколько секунд повторить, для отказов по квотам
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+type fieldError struct {
+	field  string
+	reason string
+}
+
+func (e *fieldError) Error() string { return e.field + ": " + e.reason }
+
+type messageValidator interface {
+	validate() error
+}
+
+// decodeMessage разбирает сообщение в v и проверяет его поля. Неверное
+// сообщение не выполняется: клиент получает INVALID_MESSAGE с полем.
+func (c *Client) decodeMessage(msgType string, msg []byte, v messageValidator) bool {
+	err := json.Unmarshal(msg, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		err = &fieldError{typeErr.Field, fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	}
+	if err == nil {
+		err = v.validate()
+	}
+	if err == nil {
+		return true
+	}
+
+	reply := errorMessage{Type: "error", Code: "INVALID_MESSAGE", Message: msgType + ": " + err.Error()}
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		reply.Field = fe.field
+	}
+	c.logger.Warn("invalid message", "type", msgType, "err", err)
+	c.sendJSON(reply)
+	return false
+}
@@ -0,0 +1,47 @@
+package signaling
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// Некорректные сообщения получают INVALID_MESSAGE, а соединение
+// остается открытым и продолжает обрабатывать следующие сообщения
+func TestMalformedMessagesKeepConnection(t *testing.T) {
+	s, ts := newTestServer(t, nil)
+	ws := dialWS(t, ts, "")
+
+	tests := []struct {
+		name  string
+		raw   string
+		field string
+	}{
+		{"not JSON", `{"type":`, ""},
+		{"not an object", `[1,2,3]`, ""},
+		{"numeric type", `{"type":42}`, ""},
+		{"offer without sdp", `{"type":"offer"}`, "sdp"},
+		{"numeric sdp", `{"type":"offer","sdp":123}`, "sdp"},
+		{"answer with object sdp", `{"type":"answer","sdp":{}}`, "sdp"},
+		{"ice without candidate", `{"type":"ice"}`, "candidate"},
+		{"ice with string candidate", `{"type":"ice","candidate":"x"}`, "candidate"},
+		{"ice with numeric candidate string", `{"type":"ice","candidate":{"candidate":5}}`, "candidate.candidate"},
+		{"join with numeric room", `{"type":"join","room":7}`, "room"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(tt.raw)); err != nil {
+				t.Fatal(err)
+			}
+			reply := readError(t, ws, "INVALID_MESSAGE")
+			if tt.field != "" && reply["field"] != tt.field {
+				t.Errorf("field = %v, want %s", reply["field"], tt.field)
+			}
+			sendJSON(t, ws, map[string]string{"type": "get-ice-servers"})
+			readType(t, ws, "ice-servers")
+		})
+	}
+	if n := len(s.clients.snapshot()); n != 1 {
+		t.Fatalf("%d clients connected after malformed messages, want 1", n)
+	}
+}
@@ -0,0 +1,119 @@
+package signaling
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metrics — метрики для /metrics (Prometheus). У каждого Server свой
+// набор в собственном реестре, поэтому несколько серверов в одном
+// процессе (тесты, встраивание) не смешивают счетчики.
+type metrics struct {
+	clients       *prometheus.GaugeVec
+	offers        prometheus.Counter
+	answers       prometheus.Counter
+	candidates    prometheus.Counter
+	timeouts      prometheus.Counter
+	offerDuration prometheus.Histogram
+
+	// По типам сигнальных сообщений и состояниям ICE
+	messages  *prometheus.CounterVec
+	iceStates *prometheus.CounterVec
+
+	speakerChanges   prometheus.Counter
+	codecRejections  prometheus.Counter
+	congestionPauses prometheus.Counter
+	quotaRejections  *prometheus.CounterVec
+	sessionsParked   prometheus.Gauge
+	sessionResumes   *prometheus.CounterVec
+	webhooks         *prometheus.CounterVec
+}
+
+// newMetrics создает метрики сервера и регистрирует их в reg
+func newMetrics(reg prometheus.Registerer) *metrics {
+	f := promauto.With(reg)
+	return &metrics{
+		clients: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "webrtc_clients",
+			Help: "Connected WebSocket clients, by tenant.",
+		}, []string{"tenant"}),
+		offers: f.NewCounter(prometheus.CounterOpts{
+			Name: "webrtc_offers_received_total",
+			Help: "Offers received from clients.",
+		}),
+		answers: f.NewCounter(prometheus.CounterOpts{
+			Name: "webrtc_answers_sent_total",
+			Help: "Answers sent to clients.",
+		}),
+		candidates: f.NewCounter(prometheus.CounterOpts{
+			Name: "webrtc_ice_candidates_forwarded_total",
+			Help: "ICE candidates sent to clients, server-gathered or relayed from a room peer.",
+		}),
+		timeouts: f.NewCounter(prometheus.CounterOpts{
+			Name: "webrtc_connection_timeouts_total",
+			Help: "WebSocket connections closed by the read timeout.",
+		}),
+		offerDuration: f.NewHistogram(prometheus.HistogramOpts{
+			Name:    "webrtc_offer_answer_seconds",
+			Help:    "Time from SetRemoteDescription to the answer being sent.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		}),
+		messages: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "webrtc_signaling_messages_total",
+			Help: "Signaling messages received from clients, by type.",
+		}, []string{"type"}),
+		iceStates: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "webrtc_ice_state_transitions_total",
+			Help: "ICE connection state changes of server PeerConnections, by new state.",
+		}, []string{"state"}),
+		speakerChanges: f.NewCounter(prometheus.CounterOpts{
+			Name: "webrtc_active_speaker_changes_total",
+			Help: "Times the loudest participant of a room changed and activeSpeaker was sent.",
+		}),
+		codecRejections: f.NewCounter(prometheus.CounterOpts{
+			Name: "webrtc_codec_rejections_total",
+			Help: "Offers rejected because a media section had no codec supported by the server.",
+		}),
+		congestionPauses: f.NewCounter(prometheus.CounterOpts{
+			Name: "webrtc_congestion_pauses_total",
+			Help: "Forwarded video streams paused because even the lowest layer did not fit the subscriber's downlink estimate.",
+		}),
+		quotaRejections: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "webrtc_quota_rejections_total",
+			Help: "Requests rejected by a quota: ip_connections, user_rooms, message_rate or peer_connections.",
+		}, []string{"quota"}),
+		sessionsParked: f.NewGauge(prometheus.GaugeOpts{
+			Name: "webrtc_sessions_parked",
+			Help: "Sessions waiting for the client to reconnect after the WebSocket dropped.",
+		}),
+		sessionResumes: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "webrtc_session_resumes_total",
+			Help: "Resume attempts by result: resumed or failed.",
+		}, []string{"result"}),
+		webhooks: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "webrtc_webhook_deliveries_total",
+			Help: "Webhook events by outcome: delivered, failed after all retries, or dropped on a full queue.",
+		}, []string{"result"}),
+	}
+}
+
+// knownMessageTypes — типы, у которых есть схема; остальные считаются
+// как "other", чтобы клиент не мог раздуть число серий
+var knownMessageTypes = sync.OnceValue(func() map[string]bool {
+	known := make(map[string]bool)
+	entries, _ := schemaFiles.ReadDir("schemas")
+	for _, e := range entries {
+		known[strings.TrimSuffix(e.Name(), ".json")] = true
+	}
+	return known
+})
+
+func messageTypeLabel(msgType string) string {
+	if knownMessageTypes()[msgType] {
+		return msgType
+	}
+	return "other"
+}
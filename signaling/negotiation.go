@@ -0,0 +1,105 @@
+package signaling
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// renegotiate обрабатывает offer клиента на уже созданном PeerConnection:
+// ICE и DTLS остаются прежними, добавленные клиентом треки и каналы
+// приходят через OnTrack/OnDataChannel. Если у сервера в этот момент
+// висит свой offer (ICE restart, новые треки sfu, open-channel),
+// получается glare: сервер всегда impolite, offer клиента отбрасывается
+// с ошибкой GLARE, и клиент должен сделать rollback и ответить на offer
+// сервера. Уступить сам сервер не может — pion v3 не откатывает
+// have-local-offer (SDPTypeRollback отклоняется), поэтому роль сервера
+// не настраивается.
+//
+// Вызывается под client.negotiationMu.
+func (s *Server) renegotiate(client *Client, pc *webrtc.PeerConnection, sdp string) {
+	if !client.countRenegotiation(pc, sdp) {
+		return
+	}
+
+	if state := pc.SignalingState(); state != webrtc.SignalingStateStable {
+		client.logger.Info("glare: ignoring client offer", "state", state.String())
+		client.sendError("GLARE", "server offer pending: roll back and answer it")
+		return
+	}
+
+	s.answerOffer(context.Background(), client, pc, sdp)
+}
+
+// sendServerOffer отправляет клиенту offer сервера, когда pion сообщил
+// об изменениях, требующих согласования (OnNegotiationNeeded). Если
+// согласование уже идет, pion повторит событие, когда состояние
+// вернется в stable.
+func sendServerOffer(client *Client, pc *webrtc.PeerConnection) {
+	client.negotiationMu.Lock()
+	defer client.negotiationMu.Unlock()
+	if client.pc.Load() != pc || pc.SignalingState() != webrtc.SignalingStateStable {
+		return
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		client.logger.Error("server offer error", "err", err)
+		return
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		client.logger.Error("server offer SetLocalDescription error", "err", err)
+		return
+	}
+	client.event("server-offer")
+	client.sendJSON(map[string]interface{}{
+		"type": "offer",
+		"sdp":  pc.LocalDescription().SDP,
+	})
+}
+
+// countRenegotiation учитывает offer клиента. ICE restart (новый ufrag)
+// считается отдельно и не ограничивается. false — лимит исчерпан.
+func (c *Client) countRenegotiation(pc *webrtc.PeerConnection, sdp string) bool {
+	restart := false
+	if remote := pc.RemoteDescription(); remote != nil {
+		restart = iceUfrag(sdp) != iceUfrag(remote.SDP)
+	}
+
+	c.statsMu.Lock()
+	allowed := true
+	switch {
+	case restart:
+		c.iceRestarts++
+	case c.srv.cfg.MaxRenegotiations > 0 && c.renegotiations >= c.srv.cfg.MaxRenegotiations:
+		allowed = false
+	default:
+		c.renegotiations++
+	}
+	c.statsMu.Unlock()
+
+	if !allowed {
+		c.logger.Warn("renegotiation limit reached")
+		c.sendError("RENEGOTIATION_LIMIT", fmt.Sprintf("at most %d renegotiations per session", c.srv.cfg.MaxRenegotiations))
+	}
+	return allowed
+}
+
+// iceUfrag возвращает первый ice-ufrag описания: на сессии или в m-line
+func iceUfrag(raw string) string {
+	var d sdp.SessionDescription
+	if err := d.Unmarshal([]byte(raw)); err != nil {
+		return ""
+	}
+	if v, ok := d.Attribute("ice-ufrag"); ok {
+		return v
+	}
+	for _, m := range d.MediaDescriptions {
+		if v, ok := m.Attribute("ice-ufrag"); ok {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package signaling
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/config"
+)
+
+// Клиент и сервер одновременно предлагают изменения: сервер открывает
+// канал по open-channel и шлет свой offer, а клиент, не ответив на него,
+// присылает свой. Сервер impolite: offer клиента отклоняется с GLARE, а
+// offer сервера остается в силе.
+func TestGlareRejectsClientOffer(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.NonTrickle = true
+		c.AnswerCandidateDelay = 0
+	})
+	ws := dialWS(t, ts, "")
+
+	// Без data channel в offer нет m=application, и open-channel
+	// потребует offer сервера
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
+		t.Fatal(err)
+	}
+	connectPeer(t, ws, pc)
+
+	sendJSON(t, ws, map[string]string{"type": "open-channel", "label": "chat"})
+	readType(t, ws, "offer")
+
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
+		t.Fatal(err)
+	}
+	offer := createOffer(t, pc)
+	sendJSON(t, ws, map[string]string{"type": "offer", "sdp": offer.SDP})
+	readError(t, ws, "GLARE")
+
+	serverPC := s.clients.snapshot()[0].pc.Load()
+	if state := serverPC.SignalingState(); state != webrtc.SignalingStateHaveLocalOffer {
+		t.Fatalf("server signaling state %s after glare, want have-local-offer", state)
+	}
+}
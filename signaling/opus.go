@@ -0,0 +1,40 @@
+package signaling
+
+import (
+	"fmt"
+
+	"go-webrtc/media"
+)
+
+func (s *Server) defaultOpusParams() media.OpusParams {
+	return media.OpusParams{
+		FEC:               s.cfg.OpusFEC,
+		DTX:               s.cfg.OpusDTX,
+		MaxAverageBitrate: s.cfg.OpusMaxAverageBitrate,
+	}
+}
+
+// sessionOpusParams накладывает поле opus из offer на настройки сервера
+func (s *Server) sessionOpusParams(raw interface{}) (media.OpusParams, error) {
+	p := s.defaultOpusParams()
+	if raw == nil {
+		return p, nil
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return p, fmt.Errorf("opus must be an object")
+	}
+	if v, ok := m["useinbandfec"].(bool); ok {
+		p.FEC = v
+	}
+	if v, ok := m["usedtx"].(bool); ok {
+		p.DTX = v
+	}
+	if v, ok := m["maxaveragebitrate"].(float64); ok {
+		if v != float64(int(v)) {
+			return p, fmt.Errorf("maxaveragebitrate must be an integer")
+		}
+		p.MaxAverageBitrate = int(v)
+	}
+	return p, media.ValidateOpusBitrate(p.MaxAverageBitrate)
+}
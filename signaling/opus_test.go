@@ -0,0 +1,45 @@
+package signaling
+
+import (
+	"testing"
+
+	"go-webrtc/config"
+	"go-webrtc/media"
+)
+
+func TestSessionOpusParams(t *testing.T) {
+	s, _ := newTestServer(t, func(c *config.Config) {
+		c.OpusFEC = true
+		c.OpusDTX = false
+		c.OpusMaxAverageBitrate = 32000
+	})
+	defaults := media.OpusParams{FEC: true, MaxAverageBitrate: 32000}
+
+	tests := []struct {
+		name    string
+		raw     interface{}
+		want    media.OpusParams
+		wantErr bool
+	}{
+		{"absent", nil, defaults, false},
+		{"empty object", map[string]interface{}{}, defaults, false},
+		{"override", map[string]interface{}{"useinbandfec": false, "usedtx": true, "maxaveragebitrate": float64(12000)},
+			media.OpusParams{DTX: true, MaxAverageBitrate: 12000}, false},
+		{"wrong types ignored", map[string]interface{}{"usedtx": "yes"}, defaults, false},
+		{"not an object", "fec", media.OpusParams{}, true},
+		{"fractional bitrate", map[string]interface{}{"maxaveragebitrate": 12000.5}, media.OpusParams{}, true},
+		{"bitrate too low", map[string]interface{}{"maxaveragebitrate": float64(5999)}, media.OpusParams{}, true},
+		{"bitrate too high", map[string]interface{}{"maxaveragebitrate": float64(510001)}, media.OpusParams{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.sessionOpusParams(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("params = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package signaling
+
+import (
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// peerCollector на каждый сбор метрик читает GetStats() PeerConnection
+// всех клиентов сервера и число выделений встроенного TURN. Серии
+// помечены id клиента и его арендатором (TENANTS) и пропадают вместе с
+// клиентом.
+type peerCollector struct {
+	srv *Server
+}
+
+var (
+	peerConnectionsDesc = prometheus.NewDesc("webrtc_peer_connections",
+		"Active server PeerConnections, by tenant.", []string{"tenant"}, nil)
+	peerBytesSentDesc = prometheus.NewDesc("webrtc_peer_bytes_sent_total",
+		"Bytes sent to the client over its transport.", []string{"client", "tenant"}, nil)
+	peerBytesReceivedDesc = prometheus.NewDesc("webrtc_peer_bytes_received_total",
+		"Bytes received from the client over its transport.", []string{"client", "tenant"}, nil)
+	peerRTTDesc = prometheus.NewDesc("webrtc_peer_rtt_seconds",
+		"Current round trip time of the selected ICE candidate pair.", []string{"client", "tenant"}, nil)
+	peerPacketsReceivedDesc = prometheus.NewDesc("webrtc_peer_packets_received_total",
+		"RTP packets received from the client, by media kind.", []string{"client", "tenant", "kind"}, nil)
+	peerPacketsLostDesc = prometheus.NewDesc("webrtc_peer_packets_lost_total",
+		"RTP packets from the client that never arrived, by media kind.", []string{"client", "tenant", "kind"}, nil)
+	turnAllocationsDesc = prometheus.NewDesc("webrtc_turn_allocations",
+		"Active allocations on the embedded TURN server.", nil, nil)
+)
+
+func (peerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- peerConnectionsDesc
+	ch <- peerBytesSentDesc
+	ch <- peerBytesReceivedDesc
+	ch <- peerRTTDesc
+	ch <- peerPacketsReceivedDesc
+	ch <- peerPacketsLostDesc
+	ch <- turnAllocationsDesc
+}
+
+func (c peerCollector) Collect(ch chan<- prometheus.Metric) {
+	active := make(map[string]int)
+	for _, client := range c.srv.clients.snapshot() {
+		pc := client.pc.Load()
+		if pc == nil {
+			continue
+		}
+		active[client.tenant]++
+		if c.srv.cfg.MetricsPeerStats {
+			collectPeer(ch, client, pc)
+		}
+	}
+	if len(active) == 0 {
+		active[""] = 0
+	}
+	for tenant, n := range active {
+		ch <- prometheus.MustNewConstMetric(peerConnectionsDesc, prometheus.GaugeValue, float64(n), tenant)
+	}
+
+	allocations := 0
+	if c.srv.turnServer != nil {
+		allocations = c.srv.turnServer.AllocationCount()
+	}
+	ch <- prometheus.MustNewConstMetric(turnAllocationsDesc, prometheus.GaugeValue, float64(allocations))
+}
+
+func collectPeer(ch chan<- prometheus.Metric, client *Client, pc *webrtc.PeerConnection) {
+	for _, stat := range pc.GetStats() {
+		switch s := stat.(type) {
+		case webrtc.TransportStats:
+			ch <- prometheus.MustNewConstMetric(peerBytesSentDesc, prometheus.CounterValue, float64(s.BytesSent), client.id, client.tenant)
+			ch <- prometheus.MustNewConstMetric(peerBytesReceivedDesc, prometheus.CounterValue, float64(s.BytesReceived), client.id, client.tenant)
+		case webrtc.ICECandidatePairStats:
+			if s.Nominated && s.State == webrtc.StatsICECandidatePairStateSucceeded {
+				ch <- prometheus.MustNewConstMetric(peerRTTDesc, prometheus.GaugeValue, s.CurrentRoundTripTime, client.id, client.tenant)
+			}
+		}
+	}
+
+	// pion не дает inbound-rtp, поэтому прием и потери — из своих
+	// счетчиков потоков, суммарно по типу медиа
+	client.statsMu.Lock()
+	streams := append([]*rtpReceiveStats(nil), client.receiveStats...)
+	client.statsMu.Unlock()
+	received := make(map[string]uint64)
+	lost := make(map[string]int64)
+	for _, rs := range streams {
+		expected, got, _ := rs.snapshot()
+		received[rs.kind] += got
+		lost[rs.kind] += int64(expected) - int64(got)
+	}
+	for kind, n := range received {
+		ch <- prometheus.MustNewConstMetric(peerPacketsReceivedDesc, prometheus.CounterValue, float64(n), client.id, client.tenant, kind)
+		ch <- prometheus.MustNewConstMetric(peerPacketsLostDesc, prometheus.CounterValue, float64(max(lost[kind], 0)), client.id, client.tenant, kind)
+	}
+}
@@ -0,0 +1,275 @@
+package signaling
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// forwardPLIInterval — не чаще одного запроса ключевого кадра у
+// источника пересылаемого трека: PLI и FIR подписчиков сверх этого не
+// доходят до издателя, иначе каждый из них стоит ему лишнего ключевого
+// кадра
+const forwardPLIInterval = 500 * time.Millisecond
+
+// forwardedTrack — входящий трек клиента, который сервер отдает второму
+// участнику комнаты своим отправителем. Пакеты расшифровываются и
+// шифруются заново, поэтому участники видят только адрес сервера.
+type forwardedTrack struct {
+	from   *Client
+	source *webrtc.PeerConnection
+	remote *webrtc.TrackRemote
+	local  *webrtc.TrackLocalStaticRTP
+	// Слои и выходы подписчиков simulcast-трека; у обычного трека nil,
+	// и все подписчики получают local. При CONGESTION_CONTROL у обычного
+	// видео — один слой, чтобы пересылку можно было ограничить подписчику.
+	simulcast *simulcastState
+
+	// Время последнего PLI источнику: запросы всех подписчиков трека
+	// сводятся к одному за forwardPLIInterval
+	pliMu   sync.Mutex
+	lastPLI time.Time
+
+	bytes   atomic.Uint64
+	packets atomic.Uint64
+}
+
+// proxyState — пересылка медиа клиента в режиме proxy. Свой мьютекс,
+// потому что треки подключаются и под negotiationMu, и из OnTrack.
+type proxyState struct {
+	mu sync.Mutex
+	// PeerConnection клиента, на отправители которого ставятся треки
+	pc *webrtc.PeerConnection
+	// Треки клиента, доступные второму участнику
+	published []*forwardedTrack
+	// Что сейчас отправляет каждый отправитель клиента
+	senders map[*webrtc.RTPSender]*forwardedTrack
+}
+
+// publishTrack делает входящий трек доступным второму участнику и сразу
+// подключает его, если у того уже есть PeerConnection. Слои simulcast
+// одного трека (с rid) собираются в один forwardedTrack.
+func (c *Client) publishTrack(pc *webrtc.PeerConnection, track *webrtc.TrackRemote) (*forwardedTrack, error) {
+	if track.RID() != "" {
+		c.proxy.mu.Lock()
+		for _, ft := range c.proxy.published {
+			if ft.simulcast != nil && ft.source == pc && ft.local.ID() == track.ID() {
+				c.proxy.mu.Unlock()
+				ft.simulcast.addLayer(track)
+				c.logger.Info("simulcast layer added", "track", track.ID(), "rid", track.RID())
+				return ft, nil
+			}
+		}
+		c.proxy.mu.Unlock()
+	}
+
+	local, err := webrtc.NewTrackLocalStaticRTP(track.Codec().RTPCodecCapability, track.ID(), track.StreamID())
+	if err != nil {
+		return nil, err
+	}
+	ft := &forwardedTrack{from: c, source: pc, remote: track, local: local}
+	if track.RID() != "" {
+		ft.simulcast = newSimulcastState(c, pc, track)
+		ft.simulcast.addLayer(track)
+		c.logger.Info("simulcast layer added", "track", track.ID(), "rid", track.RID())
+	} else if c.srv.cfg.CongestionControl && track.Kind() == webrtc.RTPCodecTypeVideo {
+		// Обычному видео — выходы одного слоя: подписчику на перегруженном
+		// канале пересылку можно приостановить, не трогая остальных
+		ft.simulcast = newSimulcastState(c, pc, track)
+		ft.simulcast.single = true
+		ft.simulcast.addLayer(track)
+	}
+	c.proxy.mu.Lock()
+	c.proxy.published = append(c.proxy.published, ft)
+	c.proxy.mu.Unlock()
+
+	for _, peer := range c.srv.roomPeers(c) {
+		peer.attachForwarded()
+	}
+	return ft, nil
+}
+
+// write пересылает пакет трека, у simulcast — пакет слоя rid
+func (ft *forwardedTrack) write(rid string, pkt *rtp.Packet) {
+	if ft.simulcast != nil {
+		ft.simulcast.write(rid, pkt)
+	} else if err := ft.local.WriteRTP(pkt); err != nil {
+		return
+	}
+	n := uint64(pkt.MarshalSize())
+	ft.bytes.Add(n)
+	ft.packets.Add(1)
+	ft.from.srv.proxyForwardedBytes.Add(n)
+}
+
+// attachForwarded подключает клиенту треки участников комнаты. В режиме
+// sfu — отдельным отправителем на трек (subscribeForwarded). В режиме
+// proxy — на отправители PeerConnection клиента того же типа: они уже
+// согласованы
+// (транспондеры sendrecv), поэтому ReplaceTrack обходится без
+// повторного offer. Трек с кодеком, которого нет в сессии получателя,
+// не подключается: перекодирования нет.
+func (c *Client) attachForwarded() {
+	var offered []*forwardedTrack
+	for _, peer := range c.srv.roomPeers(c) {
+		peer.proxy.mu.Lock()
+		offered = append(offered, peer.proxy.published...)
+		peer.proxy.mu.Unlock()
+	}
+
+	c.proxy.mu.Lock()
+	defer c.proxy.mu.Unlock()
+	pc := c.proxy.pc
+	if pc == nil {
+		return
+	}
+	if c.proxy.senders == nil {
+		c.proxy.senders = make(map[*webrtc.RTPSender]*forwardedTrack)
+	}
+	if c.srv.cfg.SignalingMode == "sfu" {
+		c.subscribeForwarded(pc, offered)
+		return
+	}
+	for _, ft := range offered {
+		sender := findSender(pc, ft.local.Kind())
+		if sender == nil || c.proxy.senders[sender] == ft {
+			continue
+		}
+		local, err := ft.localFor(c)
+		if err == nil {
+			err = sender.ReplaceTrack(local)
+		}
+		if err != nil {
+			ft.release(c)
+			c.logger.Warn("forwarding track failed", "kind", ft.local.Kind().String(), "codec", ft.local.Codec().MimeType, "err", err)
+			continue
+		}
+		if prev := c.proxy.senders[sender]; prev != nil {
+			prev.release(c)
+		}
+		if _, started := c.proxy.senders[sender]; !started {
+			go c.readSenderRTCP(sender)
+		}
+		c.proxy.senders[sender] = ft
+		c.logger.Info("forwarding track", "from", ft.from.id, "kind", ft.local.Kind().String())
+		ft.requestKeyframe()
+	}
+}
+
+// findSender — отправитель нужного типа у PeerConnection клиента
+func findSender(pc *webrtc.PeerConnection, kind webrtc.RTPCodecType) *webrtc.RTPSender {
+	for _, t := range pc.GetTransceivers() {
+		if t.Kind() == kind && t.Sender() != nil {
+			return t.Sender()
+		}
+	}
+	return nil
+}
+
+// setProxyPC запоминает PeerConnection клиента и подключает к нему
+// треки, которые второй участник уже публикует
+func (c *Client) setProxyPC(pc *webrtc.PeerConnection) {
+	c.proxy.mu.Lock()
+	c.proxy.pc = pc
+	c.proxy.senders = nil
+	c.proxy.mu.Unlock()
+	c.attachForwarded()
+}
+
+// readSenderRTCP передает запросы ключевого кадра получателя источнику.
+// Чтение RTCP заодно нужно интерсепторам отправителя.
+func (c *Client) readSenderRTCP(sender *webrtc.RTPSender) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, p := range packets {
+			switch p := p.(type) {
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				c.noteREMB(p)
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				c.proxy.mu.Lock()
+				ft := c.proxy.senders[sender]
+				c.proxy.mu.Unlock()
+				if ft != nil {
+					ft.requestKeyframe()
+				}
+			}
+		}
+	}
+}
+
+// requestKeyframe просит у источника ключевой кадр: новому получателю
+// видео без него не декодируется. Запросы чаще forwardPLIInterval
+// отбрасываются.
+func (ft *forwardedTrack) requestKeyframe() {
+	if ft.remote.Kind() != webrtc.RTPCodecTypeVideo || !ft.allowPLI() {
+		return
+	}
+	if ft.simulcast != nil {
+		ft.simulcast.requestKeyframe()
+		return
+	}
+	ft.source.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(ft.remote.SSRC())}})
+}
+
+// allowPLI отмечает запрос ключевого кадра; false — предыдущий был
+// меньше forwardPLIInterval назад
+func (ft *forwardedTrack) allowPLI() bool {
+	ft.pliMu.Lock()
+	defer ft.pliMu.Unlock()
+	if !ft.lastPLI.IsZero() && time.Since(ft.lastPLI) < forwardPLIInterval {
+		return false
+	}
+	ft.lastPLI = time.Now()
+	return true
+}
+
+// localFor — трек, который получает подписчик c: общий local или, у
+// simulcast, собственный выход со своим слоем
+func (ft *forwardedTrack) localFor(c *Client) (*webrtc.TrackLocalStaticRTP, error) {
+	if ft.simulcast == nil {
+		return ft.local, nil
+	}
+	return ft.simulcast.subscribe(c, ft.local)
+}
+
+// release освобождает выход подписчика c
+func (ft *forwardedTrack) release(c *Client) {
+	if ft.simulcast != nil {
+		ft.simulcast.unsubscribe(c)
+	}
+}
+
+type proxyStats struct {
+	ForwardedTracks  int    `json:"forwardedTracks"`
+	ForwardedBytes   uint64 `json:"forwardedBytes"`
+	ForwardedPackets uint64 `json:"forwardedPackets"`
+	Subscriptions    int    `json:"subscriptions"`
+}
+
+// proxyStats — что клиент отдает участникам и на сколько треков
+// подписан; nil, если сервер не пересылает медиа
+func (c *Client) proxyStats() *proxyStats {
+	if !c.srv.forwardsMedia() {
+		return nil
+	}
+	c.proxy.mu.Lock()
+	defer c.proxy.mu.Unlock()
+	s := &proxyStats{ForwardedTracks: len(c.proxy.published)}
+	for _, ft := range c.proxy.senders {
+		if ft != nil {
+			s.Subscriptions++
+		}
+	}
+	for _, ft := range c.proxy.published {
+		s.ForwardedBytes += ft.bytes.Load()
+		s.ForwardedPackets += ft.packets.Load()
+	}
+	return s
+}
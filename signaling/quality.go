@@ -0,0 +1,226 @@
+package signaling
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/config"
+)
+
+type qualityLevel string
+
+const (
+	qualityGood     qualityLevel = "good"
+	qualityPoor     qualityLevel = "poor"
+	qualityCritical qualityLevel = "critical"
+)
+
+func (l qualityLevel) rank() int {
+	switch l {
+	case qualityPoor:
+		return 1
+	case qualityCritical:
+		return 2
+	}
+	return 0
+}
+
+func levelForScore(score float64) qualityLevel {
+	switch {
+	case score < config.QualityCriticalBelow:
+		return qualityCritical
+	case score < config.QualityPoorBelow:
+		return qualityPoor
+	}
+	return qualityGood
+}
+
+// nextQualityLevel меняет уровень только если оценка ушла за порог
+// больше чем на margin, чтобы уровень не дребезжал около границы.
+func nextQualityLevel(cur qualityLevel, score, margin float64) qualityLevel {
+	raw := levelForScore(score)
+	switch {
+	case raw.rank() > cur.rank():
+		if l := levelForScore(score + margin); l.rank() > cur.rank() {
+			return l
+		}
+	case raw.rank() < cur.rank():
+		if l := levelForScore(score - margin); l.rank() < cur.rank() {
+			return l
+		}
+	}
+	return cur
+}
+
+// rtpReceiveStats считает потери и джиттер входящего потока по RFC 3550
+type rtpReceiveStats struct {
+	// Описание потока, задается при создании
+	ssrc     uint32
+	kind     string
+	mimeType string
+
+	mu          sync.Mutex
+	clockRate   float64
+	started     bool
+	baseSeq     uint16
+	maxSeq      uint16
+	cycles      uint64
+	received    uint64
+	lastTransit float64
+	jitter      float64
+}
+
+func newRTPReceiveStats(clockRate uint32) *rtpReceiveStats {
+	return &rtpReceiveStats{clockRate: float64(clockRate)}
+}
+
+func (s *rtpReceiveStats) update(pkt *rtp.Packet, arrival time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transit := float64(arrival.UnixNano())*s.clockRate/1e9 - float64(pkt.Timestamp)
+	if !s.started {
+		s.started = true
+		s.baseSeq = pkt.SequenceNumber
+		s.maxSeq = pkt.SequenceNumber
+		s.lastTransit = transit
+		s.received = 1
+		return
+	}
+
+	s.received++
+	if d := int16(pkt.SequenceNumber - s.maxSeq); d > 0 {
+		if pkt.SequenceNumber < s.maxSeq {
+			s.cycles += 1 << 16
+		}
+		s.maxSeq = pkt.SequenceNumber
+	}
+
+	d := math.Abs(transit - s.lastTransit)
+	s.lastTransit = transit
+	s.jitter += (d - s.jitter) / 16
+}
+
+// snapshot возвращает ожидаемое и полученное число пакетов с начала
+// потока и текущий джиттер в секундах
+func (s *rtpReceiveStats) snapshot() (expected, received uint64, jitter float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return 0, 0, 0
+	}
+	expected = s.cycles + uint64(s.maxSeq) - uint64(s.baseSeq) + 1
+	if s.clockRate > 0 {
+		jitter = s.jitter / s.clockRate
+	}
+	return expected, s.received, jitter
+}
+
+type qualityStats struct {
+	Score float64      `json:"score"`
+	Level qualityLevel `json:"level"`
+}
+
+func (c *Client) addReceiveStats(track *webrtc.TrackRemote) *rtpReceiveStats {
+	codec := track.Codec()
+	s := newRTPReceiveStats(codec.ClockRate)
+	s.ssrc = uint32(track.SSRC())
+	s.kind = track.Kind().String()
+	s.mimeType = codec.MimeType
+	c.statsMu.Lock()
+	c.receiveStats = append(c.receiveStats, s)
+	c.statsMu.Unlock()
+	return s
+}
+
+// monitorQuality периодически вычисляет оценку качества соединения и
+// отправляет клиенту quality-change при смене уровня.
+func (s *Server) monitorQuality(client *Client, pc *webrtc.PeerConnection) {
+	ticker := time.NewTicker(s.cfg.QualityInterval)
+	defer ticker.Stop()
+
+	var prevExpected, prevReceived uint64
+	level := qualityGood
+
+	for {
+		select {
+		case <-client.readDone:
+			return
+		case <-ticker.C:
+		}
+		if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+
+		client.statsMu.Lock()
+		streams := append([]*rtpReceiveStats(nil), client.receiveStats...)
+		client.statsMu.Unlock()
+
+		var expected, received uint64
+		var jitter float64
+		for _, rs := range streams {
+			e, r, j := rs.snapshot()
+			expected += e
+			received += r
+			jitter = math.Max(jitter, j)
+		}
+
+		var loss float64
+		if de := expected - prevExpected; expected > prevExpected && de > 0 {
+			dr := received - prevReceived
+			if dr < de {
+				loss = float64(de-dr) / float64(de)
+			}
+		}
+		prevExpected, prevReceived = expected, received
+
+		score := qualityScore(loss, jitter, currentRTT(pc))
+		next := nextQualityLevel(level, score, s.cfg.QualityHysteresis)
+
+		client.statsMu.Lock()
+		client.quality = &qualityStats{Score: math.Round(score*10) / 10, Level: next}
+		client.statsMu.Unlock()
+
+		if next == level {
+			continue
+		}
+		client.logger.Info("quality changed", "from", level, "to", next, "score", math.Round(score))
+		s.events.publish("quality-change", client.id, map[string]interface{}{
+			"level":    next,
+			"previous": level,
+			"score":    math.Round(score),
+		})
+		if client.hasFeature(featureQualityEvents) {
+			client.sendJSON(map[string]interface{}{
+				"type":     "quality-change",
+				"level":    next,
+				"previous": level,
+				"score":    math.Round(score),
+			})
+		}
+		level = next
+	}
+}
+
+// qualityScore: 100 — идеально. Потери, джиттер и RTT снижают оценку.
+func qualityScore(loss, jitter, rtt float64) float64 {
+	score := 100.0
+	score -= math.Min(loss*400, 60)      // 5% потерь — минус 20
+	score -= math.Min(jitter*1000/2, 20) // 40 мс джиттера — минус 20
+	score -= math.Min(rtt*1000/20, 20)   // 400 мс RTT — минус 20
+	return math.Max(score, 0)
+}
+
+func currentRTT(pc *webrtc.PeerConnection) float64 {
+	for _, s := range pc.GetStats() {
+		pair, ok := s.(webrtc.ICECandidatePairStats)
+		if ok && pair.Nominated && pair.State == webrtc.StatsICECandidatePairStateSucceeded {
+			return pair.CurrentRoundTripTime
+		}
+	}
+	return 0
+}
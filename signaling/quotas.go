@@ -0,0 +1,132 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"golang.org/x/time/rate"
+)
+
+// Квоты против злоупотреблений: подключения с одного адреса, комнаты
+// одного пользователя, частота сигнальных сообщений и PeerConnection на
+// весь сервер. Считаются в пределах экземпляра.
+
+// acquireIPConn занимает место под MAX_CONNECTIONS_PER_IP; false — мест нет
+func (s *Server) acquireIPConn(ip string) bool {
+	s.ipConns.mu.Lock()
+	defer s.ipConns.mu.Unlock()
+	if s.ipConns.n[ip] >= s.cfg.MaxConnectionsPerIP {
+		s.metrics.quotaRejections.WithLabelValues("ip_connections").Inc()
+		return false
+	}
+	s.ipConns.n[ip]++
+	return true
+}
+
+func (s *Server) releaseIPConn(ip string) {
+	s.ipConns.mu.Lock()
+	defer s.ipConns.mu.Unlock()
+	if s.ipConns.n[ip]--; s.ipConns.n[ip] <= 0 {
+		delete(s.ipConns.n, ip)
+	}
+}
+
+// roomQuotaExceeded — войдя в room, пользователь клиента окажется больше
+// чем в MAX_ROOMS_PER_USER комнатах. Анонимные клиенты не ограничены.
+func (s *Server) roomQuotaExceeded(client *Client, room string) bool {
+	if s.cfg.MaxRoomsPerUser == 0 || client.identity == "" {
+		return false
+	}
+	rooms := map[string]bool{room: true}
+	for _, c := range s.clients.snapshot() {
+		if c == client || c.identity != client.identity {
+			continue
+		}
+		if id := c.roomID.Load(); id != nil {
+			rooms[*id] = true
+		}
+	}
+	if len(rooms) <= s.cfg.MaxRoomsPerUser {
+		return false
+	}
+	s.metrics.quotaRejections.WithLabelValues("user_rooms").Inc()
+	return true
+}
+
+// newMessageLimiter — token bucket сигнальных сообщений клиента, nil без
+// MESSAGE_RATE
+func (s *Server) newMessageLimiter() *rate.Limiter {
+	if s.cfg.MessageRate <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(s.cfg.MessageRate), s.cfg.MessageBurst)
+}
+
+// allowMessage списывает сообщение из bucket клиента. Сверх лимита
+// сообщение не выполняется: первое в серии получает RATE_LIMITED, а
+// клиент, продолжающий слать после MESSAGE_BURST отказов подряд,
+// отключается с кодом 1008. ok — сообщение можно выполнить, keep —
+// соединение остается.
+func (c *Client) allowMessage() (ok, keep bool) {
+	if c.msgLimiter == nil || c.msgLimiter.Allow() {
+		c.msgDropped = 0
+		return true, true
+	}
+	c.srv.metrics.quotaRejections.WithLabelValues("message_rate").Inc()
+	c.msgDropped++
+	if c.msgDropped == 1 {
+		c.sendJSON(errorMessage{
+			Type:       "error",
+			Code:       "RATE_LIMITED",
+			Message:    fmt.Sprintf("more than %g messages per second, message dropped", c.srv.cfg.MessageRate),
+			RetryAfter: c.srv.retryAfterSeconds(time.Duration(float64(time.Second) / c.srv.cfg.MessageRate)),
+		})
+	}
+	if c.msgDropped < c.srv.cfg.MessageBurst {
+		return false, true
+	}
+	c.logger.Warn("message rate exceeded, disconnecting", "rate", c.srv.cfg.MessageRate, "dropped", c.msgDropped)
+	c.closeWith(websocket.ClosePolicyViolation, "message rate exceeded")
+	return false, false
+}
+
+// closeWith отправляет close-фрейм с кодом, после которого closeConn
+// уже не шлет свой
+func (c *Client) closeWith(code int, reason string) {
+	c.closeSent.Store(true)
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.currentConn().WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.srv.cfg.WriteTimeout))
+}
+
+var errPeerLimit = errors.New("peer connection limit reached")
+
+// reservePeer проверяет квоту перед созданием PeerConnection
+func (s *Server) reservePeer() error {
+	if s.cfg.MaxPeerConnections == 0 {
+		return nil
+	}
+	s.livePeers.mu.Lock()
+	defer s.livePeers.mu.Unlock()
+	for pc := range s.livePeers.set {
+		if pc.SignalingState() == webrtc.SignalingStateClosed {
+			delete(s.livePeers.set, pc)
+		}
+	}
+	if len(s.livePeers.set) >= s.cfg.MaxPeerConnections {
+		s.metrics.quotaRejections.WithLabelValues("peer_connections").Inc()
+		return errPeerLimit
+	}
+	return nil
+}
+
+func (s *Server) trackPeer(pc *webrtc.PeerConnection) {
+	if s.cfg.MaxPeerConnections == 0 {
+		return
+	}
+	s.livePeers.mu.Lock()
+	s.livePeers.set[pc] = struct{}{}
+	s.livePeers.mu.Unlock()
+}
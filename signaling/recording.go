@@ -0,0 +1,469 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/h264writer"
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// recording — запись входящих треков клиента (scope peer) или всех
+// участников комнаты (scope room) в RECORDING_DIR/<id>/. Каждый трек
+// пишется в свой файл: VP8 в IVF, H264 в Annex B, Opus в OGG; остальные
+// кодеки пропускаются. Запись комнаты включается и новым участникам и
+// заканчивается, когда комната пустеет.
+type recording struct {
+	ID        string
+	Scope     string
+	Target    string // id комнаты или клиента
+	StartedAt time.Time
+
+	mu    sync.Mutex
+	files []string
+}
+
+type recordingInfo struct {
+	ID        string    `json:"id"`
+	Scope     string    `json:"scope"`
+	Target    string    `json:"target"`
+	StartedAt time.Time `json:"startedAt"`
+	Files     []string  `json:"files"`
+}
+
+func (r *recording) info() recordingInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return recordingInfo{
+		ID:        r.ID,
+		Scope:     r.Scope,
+		Target:    r.Target,
+		StartedAt: r.StartedAt,
+		Files:     append([]string{}, r.files...),
+	}
+}
+
+func (r *recording) addFile(path string) {
+	r.mu.Lock()
+	r.files = append(r.files, path)
+	r.mu.Unlock()
+}
+
+// recordingOf — активная запись цели или nil. Под recordingsMu.
+func (s *Server) recordingOf(scope, target string) *recording {
+	for _, rec := range s.recordings {
+		if rec.Scope == scope && rec.Target == target {
+			return rec
+		}
+	}
+	return nil
+}
+
+// recordingFor — запись, в которую идут треки клиента: своя запись
+// клиента важнее записи комнаты
+func (s *Server) recordingFor(client *Client) *recording {
+	roomID := ""
+	if room := client.currentRoom(); room != nil {
+		roomID = room.ID
+	}
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	if rec := s.recordingOf("peer", client.id); rec != nil {
+		return rec
+	}
+	if roomID != "" {
+		return s.recordingOf("room", roomID)
+	}
+	return nil
+}
+
+// recordingTargets — клиенты, чьи треки попадают в запись цели
+func (s *Server) recordingTargets(scope, target string) []*Client {
+	if scope == "peer" {
+		if c := s.clients.get(target); c != nil {
+			return []*Client{c}
+		}
+		return nil
+	}
+	members, _ := s.rooms.Members(target)
+	return members
+}
+
+// startRecording начинает запись цели. Ошибка — код для клиента и
+// текст.
+func (s *Server) startRecording(scope, target string) (*recording, string, error) {
+	if s.cfg.RecordingDir == "" {
+		return nil, "RECORDING_DISABLED", fmt.Errorf("recording is not configured")
+	}
+	targets := s.recordingTargets(scope, target)
+	if len(targets) == 0 {
+		return nil, "NOT_FOUND", fmt.Errorf("%s %s not found", scope, target)
+	}
+
+	s.recordingsMu.Lock()
+	if s.recordingOf(scope, target) != nil {
+		s.recordingsMu.Unlock()
+		return nil, "ALREADY_RECORDING", fmt.Errorf("%s %s is already being recorded", scope, target)
+	}
+	rec := &recording{ID: newClientID(), Scope: scope, Target: target, StartedAt: time.Now()}
+	if err := os.MkdirAll(filepath.Join(s.cfg.RecordingDir, rec.ID), 0o755); err != nil {
+		s.recordingsMu.Unlock()
+		return nil, "RECORDING_ERROR", err
+	}
+	s.recordings[rec.ID] = rec
+	s.recordingsMu.Unlock()
+
+	slog.Info("recording started", "recording", rec.ID, "scope", scope, "target", target)
+	s.postWebhook(map[string]interface{}{"type": "recording-started", "recordingId": rec.ID, "scope": scope, "target": target})
+	s.applyRecording(targets)
+	s.broadcast(targets, map[string]interface{}{"type": "recording-started", "id": rec.ID, "scope": scope})
+	return rec, "", nil
+}
+
+// stopRecording заканчивает запись: файлы закрываются, треки клиентов
+// переходят в другую подходящую запись, если она есть
+func (s *Server) stopRecording(id string) *recording {
+	s.recordingsMu.Lock()
+	rec := s.recordings[id]
+	delete(s.recordings, id)
+	s.recordingsMu.Unlock()
+	if rec == nil {
+		return nil
+	}
+
+	slog.Info("recording stopped", "recording", rec.ID, "scope", rec.Scope, "target", rec.Target)
+	s.postWebhook(map[string]interface{}{
+		"type":        "recording-finished",
+		"recordingId": rec.ID,
+		"scope":       rec.Scope,
+		"target":      rec.Target,
+		"files":       rec.info().Files,
+		"duration":    time.Since(rec.StartedAt).Seconds(),
+	})
+	targets := s.recordingTargets(rec.Scope, rec.Target)
+	s.applyRecording(targets)
+	s.broadcast(targets, map[string]interface{}{"type": "recording-stopped", "id": rec.ID, "scope": rec.Scope})
+	return rec
+}
+
+// stopRecordingOf заканчивает запись цели, если она идет
+func (s *Server) stopRecordingOf(scope, target string) {
+	s.recordingsMu.Lock()
+	rec := s.recordingOf(scope, target)
+	s.recordingsMu.Unlock()
+	if rec != nil {
+		s.stopRecording(rec.ID)
+	}
+}
+
+// applyRecording переключает треки клиентов на их текущую запись
+func (s *Server) applyRecording(list []*Client) {
+	for _, c := range list {
+		rec := s.recordingFor(c)
+		c.statsMu.Lock()
+		recorders := append([]*trackRecorder(nil), c.recorders...)
+		c.statsMu.Unlock()
+		for _, t := range recorders {
+			t.setRecording(rec)
+		}
+	}
+}
+
+// trackRecorder пишет один входящий трек в файлы текущей записи. Видео
+// начинается с ключевого кадра, файлы сменяются по
+// RECORDING_MAX_DURATION и RECORDING_MAX_SIZE_MB — тоже на ключевом
+// кадре.
+type trackRecorder struct {
+	client *Client
+	pc     *webrtc.PeerConnection
+	track  *webrtc.TrackRemote
+	codec  webrtc.RTPCodecParameters
+
+	mu           sync.Mutex
+	rec          *recording
+	writer       media.Writer
+	openedAt     time.Time
+	size         int64
+	part         int
+	waitKeyframe bool
+	lastPLI      time.Time
+}
+
+// Как часто повторять PLI, пока запись ждет ключевого кадра
+const recordingPLIInterval = time.Second
+
+// recordingExt — расширение файла для кодека, "" — кодек не пишется
+func recordingExt(mimeType string) string {
+	switch {
+	case strings.EqualFold(mimeType, webrtc.MimeTypeVP8):
+		return ".ivf"
+	case strings.EqualFold(mimeType, webrtc.MimeTypeH264):
+		return ".h264"
+	case strings.EqualFold(mimeType, webrtc.MimeTypeOpus):
+		return ".ogg"
+	}
+	return ""
+}
+
+func (c *Client) addTrackRecorder(pc *webrtc.PeerConnection, track *webrtc.TrackRemote) *trackRecorder {
+	t := &trackRecorder{client: c, pc: pc, track: track, codec: track.Codec()}
+	c.statsMu.Lock()
+	c.recorders = append(c.recorders, t)
+	c.statsMu.Unlock()
+	t.setRecording(c.srv.recordingFor(c))
+	return t
+}
+
+// removeTrackRecorder закрывает файл трека, когда трек закончился
+func (c *Client) removeTrackRecorder(t *trackRecorder) {
+	c.statsMu.Lock()
+	for i, r := range c.recorders {
+		if r == t {
+			c.recorders = append(c.recorders[:i], c.recorders[i+1:]...)
+			break
+		}
+	}
+	c.statsMu.Unlock()
+	t.setRecording(nil)
+}
+
+func (t *trackRecorder) video() bool {
+	return t.track.Kind() == webrtc.RTPCodecTypeVideo
+}
+
+func (t *trackRecorder) setRecording(rec *recording) {
+	if rec != nil && recordingExt(t.codec.MimeType) == "" {
+		t.client.logger.Info("codec is not recorded", "codec", t.codec.MimeType)
+		rec = nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rec == rec {
+		return
+	}
+	t.closeFile()
+	t.rec = rec
+	t.part = 0
+	t.waitKeyframe = rec != nil && t.video()
+}
+
+// write пишет пакет, если трек записывается. Вызывается из цикла
+// чтения трека.
+func (t *trackRecorder) write(pkt *rtp.Packet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rec == nil {
+		return
+	}
+
+	if t.writer != nil && t.rotationDue() {
+		if t.video() {
+			// Старый файл пишется до ключевого кадра, с которого начнется
+			// новый
+			t.waitKeyframe = true
+		} else {
+			t.closeFile()
+		}
+	}
+	if t.waitKeyframe {
+		if !isKeyframe(pkt, t.codec.MimeType) {
+			t.requestKeyframe()
+			if t.writer != nil {
+				t.writePacket(pkt)
+			}
+			return
+		}
+		t.closeFile()
+		t.waitKeyframe = false
+	}
+	if t.writer == nil && !t.openFile() {
+		return
+	}
+	t.writePacket(pkt)
+}
+
+func (t *trackRecorder) rotationDue() bool {
+	if t.client.srv.cfg.RecordingMaxDuration > 0 && time.Since(t.openedAt) >= t.client.srv.cfg.RecordingMaxDuration {
+		return true
+	}
+	return t.client.srv.cfg.RecordingMaxSizeMB > 0 && t.size >= int64(t.client.srv.cfg.RecordingMaxSizeMB)<<20
+}
+
+func (t *trackRecorder) writePacket(pkt *rtp.Packet) {
+	if err := t.writer.WriteRTP(pkt); err != nil {
+		t.client.logger.Warn("recording write error", "recording", t.rec.ID, "err", err)
+		return
+	}
+	t.size += int64(len(pkt.Payload))
+}
+
+// openFile начинает очередную часть записи трека. При ошибке трек
+// перестает записываться.
+func (t *trackRecorder) openFile() bool {
+	name := fmt.Sprintf("%s-%s-%d-%03d%s", t.client.id, t.track.Kind(), t.track.SSRC(), t.part, recordingExt(t.codec.MimeType))
+	path := filepath.Join(t.client.srv.cfg.RecordingDir, t.rec.ID, name)
+
+	var err error
+	switch {
+	case strings.EqualFold(t.codec.MimeType, webrtc.MimeTypeVP8):
+		t.writer, err = ivfwriter.New(path, ivfwriter.WithCodec(webrtc.MimeTypeVP8))
+	case strings.EqualFold(t.codec.MimeType, webrtc.MimeTypeH264):
+		t.writer, err = h264writer.New(path)
+	default:
+		channels := t.codec.Channels
+		if channels == 0 {
+			channels = 2
+		}
+		t.writer, err = oggwriter.New(path, t.codec.ClockRate, channels)
+	}
+	if err != nil {
+		t.client.logger.Error("recording file error", "recording", t.rec.ID, "err", err)
+		t.writer = nil
+		t.rec = nil
+		return false
+	}
+
+	t.openedAt = time.Now()
+	t.size = 0
+	t.part++
+	t.rec.addFile(path)
+	t.client.logger.Info("recording file opened", "recording", t.rec.ID, "file", name)
+	return true
+}
+
+func (t *trackRecorder) closeFile() {
+	if t.writer == nil {
+		return
+	}
+	if err := t.writer.Close(); err != nil {
+		t.client.logger.Warn("recording close error", "err", err)
+	}
+	t.writer = nil
+}
+
+func (t *trackRecorder) requestKeyframe() {
+	if time.Since(t.lastPLI) < recordingPLIInterval {
+		return
+	}
+	t.lastPLI = time.Now()
+	if err := t.pc.WriteRTCP([]rtcp.Packet{
+		&rtcp.PictureLossIndication{MediaSSRC: uint32(t.track.SSRC())},
+	}); err != nil {
+		t.client.logger.Debug("recording PLI error", "err", err)
+	}
+}
+
+// handleStartRecording — {"type":"start-recording","scope":"peer|room"}
+// от клиента: запись своих треков или своей комнаты
+func (s *Server) handleStartRecording(client *Client, scope string) {
+	target := client.id
+	if scope == "room" {
+		room := client.currentRoom()
+		if room == nil {
+			client.sendError("NOT_IN_ROOM", "not in a room")
+			return
+		}
+		target = room.ID
+	}
+	if _, code, err := s.startRecording(scope, target); err != nil {
+		client.sendError(code, err.Error())
+	}
+}
+
+// handleStopRecording — {"type":"stop-recording","scope":"peer|room"}
+func (s *Server) handleStopRecording(client *Client, scope string) {
+	target := client.id
+	if scope == "room" {
+		if room := client.currentRoom(); room != nil {
+			target = room.ID
+		}
+	}
+	s.recordingsMu.Lock()
+	rec := s.recordingOf(scope, target)
+	s.recordingsMu.Unlock()
+	if rec == nil {
+		client.sendError("NOT_RECORDING", "no active "+scope+" recording")
+		return
+	}
+	s.stopRecording(rec.ID)
+}
+
+// handleRecordings — GET /recordings: активные записи
+func (s *Server) handleRecordings(w http.ResponseWriter, r *http.Request) {
+	s.recordingsMu.Lock()
+	list := make([]*recording, 0, len(s.recordings))
+	for _, rec := range s.recordings {
+		list = append(list, rec)
+	}
+	s.recordingsMu.Unlock()
+
+	infos := make([]recordingInfo, 0, len(list))
+	for _, rec := range list {
+		infos = append(infos, rec.info())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		slog.Warn("recordings encode error", "err", err)
+	}
+}
+
+// handleCreateRecording — POST /recordings с {"room":"..."} или
+// {"clientId":"..."}: начинает запись
+func (s *Server) handleCreateRecording(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Room     string `json:"room"`
+		ClientID string `json:"clientId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Room == "") == (req.ClientID == "") {
+		http.Error(w, "body must be {\"room\":...} or {\"clientId\":...}", http.StatusBadRequest)
+		return
+	}
+	scope, target := "room", req.Room
+	if req.ClientID != "" {
+		scope, target = "peer", req.ClientID
+	}
+
+	rec, code, err := s.startRecording(scope, target)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch code {
+		case "RECORDING_DISABLED", "NOT_FOUND":
+			status = http.StatusNotFound
+		case "ALREADY_RECORDING":
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(rec.info()); err != nil {
+		slog.Warn("recording encode error", "err", err)
+	}
+}
+
+// handleDeleteRecording — DELETE /recordings/{id}: останавливает запись
+// и возвращает ее файлы
+func (s *Server) handleDeleteRecording(w http.ResponseWriter, r *http.Request) {
+	rec := s.stopRecording(r.PathValue("id"))
+	if rec == nil {
+		http.Error(w, "recording not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rec.info()); err != nil {
+		slog.Warn("recording encode error", "err", err)
+	}
+}
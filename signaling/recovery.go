@@ -0,0 +1,99 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// recoverICE пытается восстановить упавший ICE, пока WebSocket жив:
+// сервер сам отправляет offer с ICE restart, с экспоненциальной паузой
+// между попытками. После последней неудачной попытки клиент отключается
+// с RECOVERY_FAILED, а если неудачи ICE копятся и между вызовами — с
+// PERSISTENT_ICE_FAILURE (см. noteICEFailure).
+func (s *Server) recoverICE(client *Client, pc *webrtc.PeerConnection) {
+	if !client.recovering.CompareAndSwap(false, true) {
+		return
+	}
+	defer client.recovering.Store(false)
+
+	// Сбрасываем старый сигнал о подключении
+	select {
+	case <-client.iceConnected:
+	default:
+	}
+
+	backoff := s.cfg.ICERecoveryBackoff
+	for attempt := 1; attempt <= s.cfg.ICERecoveryMaxAttempts; attempt++ {
+		client.logger.Info("ICE recovery attempt", "attempt", attempt, "max", s.cfg.ICERecoveryMaxAttempts)
+
+		client.statsMu.Lock()
+		client.iceRecoveries++
+		client.statsMu.Unlock()
+		if err := sendRestartOffer(client, pc); err != nil {
+			client.logger.Warn("ICE restart offer error", "attempt", attempt, "err", err)
+		}
+
+		select {
+		case <-client.iceConnected:
+			client.logger.Info("ICE recovered", "attempts", attempt)
+			return
+		case <-client.readDone:
+			return
+		case <-time.After(backoff):
+		}
+		if client.noteICEFailure() {
+			s.giveUpICE(client, pc)
+			return
+		}
+		backoff *= 2
+	}
+
+	client.logger.Warn("ICE recovery failed, disconnecting")
+	if pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		client.recordFailure(failureAnswerTimeout)
+	} else {
+		client.recordFailure(iceFailure(client, pc))
+	}
+	client.sendError("RECOVERY_FAILED", "ICE connection could not be restored")
+	s.cleanupClient(client)
+}
+
+func sendRestartOffer(client *Client, pc *webrtc.PeerConnection) error {
+	client.negotiationMu.Lock()
+	defer client.negotiationMu.Unlock()
+
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return err
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	return client.sendJSON(map[string]interface{}{
+		"type": "offer",
+		"sdp":  pc.LocalDescription().SDP,
+	})
+}
+
+func handleAnswer(client *Client, sdp string) {
+	client.negotiationMu.Lock()
+	defer client.negotiationMu.Unlock()
+
+	pc := client.pc.Load()
+	if pc == nil {
+		return
+	}
+	// Повторный answer или answer без offer сервера
+	if state := pc.SignalingState(); state != webrtc.SignalingStateHaveLocalOffer {
+		client.logger.Info("ignoring answer without pending offer", "state", state.String())
+		return
+	}
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  sdp,
+	}); err != nil {
+		client.logger.Warn("SetRemoteDescription answer error", "err", err)
+	}
+}
@@ -0,0 +1,342 @@
+package signaling
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisBackplane — backplane на Redis pub/sub: канал <prefix><room> на
+// комнату. Публикация и подписка идут по разным соединениям, потому что
+// соединение в режиме SUBSCRIBE не принимает других команд. После обрыва
+// соединение подписки восстанавливается и подписывается заново на все
+// комнаты; сообщения, пришедшие за время обрыва, теряются.
+type redisBackplane struct {
+	opts   redisOptions
+	prefix string
+
+	pubMu sync.Mutex
+	pub   *redisConn
+
+	subMu  sync.Mutex
+	sub    *redisConn
+	rooms  map[string]bool
+	acks   map[string]chan struct{}
+	msgs   chan backplaneDelivery
+	closed chan struct{}
+}
+
+// Сколько ждать подтверждения SUBSCRIBE: до него сообщения комнаты
+// могут пройти мимо
+const redisSubscribeTimeout = 2 * time.Second
+
+// redisOptions — параметры подключения из REDIS_URL
+type redisOptions struct {
+	addr     string
+	username string // пользователь ACL (Redis 6+), "" — default
+	password string
+	tls      bool // rediss://
+	db       int
+}
+
+// parseRedisURL разбирает redis://[user:password@]host[:port][/db] и
+// rediss:// с теми же полями для TLS, как стандартные клиенты Redis
+func parseRedisURL(rawURL string) (redisOptions, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redisOptions{}, err
+	}
+	var opts redisOptions
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		opts.tls = true
+	default:
+		return opts, fmt.Errorf("redis URL scheme must be redis or rediss, got %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return opts, errors.New("redis URL has no host")
+	}
+	opts.addr = u.Host
+	if u.Port() == "" {
+		opts.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		opts.username = u.User.Username()
+		opts.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if opts.db, err = strconv.Atoi(db); err != nil || opts.db < 0 {
+			return opts, fmt.Errorf("redis URL database must be a non-negative number, got %q", db)
+		}
+	}
+	return opts, nil
+}
+
+func newRedisBackplane(rawURL, prefix string) (*redisBackplane, error) {
+	opts, err := parseRedisURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	b := &redisBackplane{
+		opts:   opts,
+		prefix: prefix,
+		rooms:  make(map[string]bool),
+		acks:   make(map[string]chan struct{}),
+		msgs:   make(chan backplaneDelivery, 256),
+		closed: make(chan struct{}),
+	}
+	if b.pub, err = b.dial(); err != nil {
+		return nil, err
+	}
+	if b.sub, err = b.dial(); err != nil {
+		b.pub.Close()
+		return nil, err
+	}
+	go b.readLoop(b.sub)
+	return b, nil
+}
+
+// dial открывает соединение, проходит AUTH (с пользователем ACL, если
+// он задан) и выбирает базу. Pub/sub от базы не зависит, но SELECT
+// отправляется, чтобы соединение было таким же, как у других клиентов
+// с этим URL.
+func (b *redisBackplane) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if b.opts.tls {
+		host, _, _ := net.SplitHostPort(b.opts.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.opts.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", b.opts.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+	if b.opts.password != "" {
+		args := []string{"AUTH", b.opts.password}
+		if b.opts.username != "" {
+			args = []string{"AUTH", b.opts.username, b.opts.password}
+		}
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis AUTH: %w", err)
+		}
+	}
+	if b.opts.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(b.opts.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis SELECT: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (b *redisBackplane) Publish(room string, payload []byte) error {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub == nil {
+		conn, err := b.dial()
+		if err != nil {
+			return err
+		}
+		b.pub = conn
+	}
+	if _, err := b.pub.do("PUBLISH", b.prefix+room, string(payload)); err != nil {
+		// Соединение, скорее всего, оборвано: следующая публикация
+		// откроет новое
+		b.pub.Close()
+		b.pub = nil
+		return err
+	}
+	return nil
+}
+
+func (b *redisBackplane) Subscribe(room string) error {
+	ack := make(chan struct{})
+	b.subMu.Lock()
+	b.rooms[room] = true
+	b.acks[b.prefix+room] = ack
+	err := b.sub.send("SUBSCRIBE", b.prefix+room)
+	b.subMu.Unlock()
+	if err != nil {
+		// readLoop переподключится и подпишется заново
+		return err
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-time.After(redisSubscribeTimeout):
+		return errors.New("redis SUBSCRIBE not confirmed")
+	}
+}
+
+func (b *redisBackplane) Unsubscribe(room string) error {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	delete(b.rooms, room)
+	return b.sub.send("UNSUBSCRIBE", b.prefix+room)
+}
+
+func (b *redisBackplane) Messages() <-chan backplaneDelivery { return b.msgs }
+
+func (b *redisBackplane) Close() error {
+	close(b.closed)
+	b.subMu.Lock()
+	b.sub.Close()
+	b.subMu.Unlock()
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub != nil {
+		return b.pub.Close()
+	}
+	return nil
+}
+
+// readLoop читает сообщения подписки, а при обрыве переподключается с
+// растущей паузой и восстанавливает подписки
+func (b *redisBackplane) readLoop(conn *redisConn) {
+	for {
+		err := b.readMessages(conn)
+		select {
+		case <-b.closed:
+			close(b.msgs)
+			return
+		default:
+		}
+		slog.Warn("redis subscription lost", "err", err)
+
+		for backoff := time.Second; ; backoff = min(backoff*2, 30*time.Second) {
+			time.Sleep(backoff)
+			next, err := b.dial()
+			if err != nil {
+				slog.Warn("redis reconnect error", "err", err, "retry", backoff.String())
+				continue
+			}
+			b.subMu.Lock()
+			b.sub = next
+			for room := range b.rooms {
+				err = next.send("SUBSCRIBE", b.prefix+room)
+			}
+			n := len(b.rooms)
+			b.subMu.Unlock()
+			if err == nil {
+				conn = next
+				slog.Info("redis subscription restored", "rooms", n)
+				break
+			}
+			next.Close()
+		}
+	}
+}
+
+func (b *redisBackplane) readMessages(conn *redisConn) error {
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) < 3 {
+			continue
+		}
+		kind, _ := parts[0].(string)
+		channel, _ := parts[1].(string)
+		switch kind {
+		case "message":
+			payload, _ := parts[2].(string)
+			b.msgs <- backplaneDelivery{Room: strings.TrimPrefix(channel, b.prefix), Payload: []byte(payload)}
+		case "subscribe":
+			b.subMu.Lock()
+			if ack := b.acks[channel]; ack != nil {
+				close(ack)
+				delete(b.acks, channel)
+			}
+			b.subMu.Unlock()
+		}
+	}
+}
+
+// redisConn — соединение с Redis по протоколу RESP2, ровно столько,
+// сколько нужно для AUTH, SELECT, PUBLISH и SUBSCRIBE
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *redisConn) send(args ...string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(a), a)
+	}
+	c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.WriteString(c.Conn, sb.String())
+	return err
+}
+
+// do отправляет команду и читает ответ. Только для соединений не в
+// режиме подписки.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer c.SetReadDeadline(time.Time{})
+	return c.read()
+}
+
+// read читает одно значение RESP: строки, числа, массивы; ошибка Redis
+// возвращается как error
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
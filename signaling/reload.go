@@ -0,0 +1,39 @@
+package signaling
+
+import (
+	"log/slog"
+
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/config"
+)
+
+// currentICEServers — действующий список ICE-серверов
+func (s *Server) currentICEServers() []webrtc.ICEServer {
+	if servers := s.reloadedICEServers.Load(); servers != nil {
+		return *servers
+	}
+	return s.cfg.ICEServers
+}
+
+// Reload перечитывает конфигурацию (SIGHUP у cmd/server) и применяет
+// новый список ICE-серверов к следующим подключениям и уровни лога.
+// Остальные настройки меняются только перезапуском. При ошибке остается
+// прежний список.
+func (s *Server) Reload() {
+	next := s.cfg.Reload()
+	s.applyLogLevels(next)
+	failed := false
+	for _, p := range next.Validate() {
+		if p.Fatal && p.Key == next.ICEServersKey() {
+			logConfigProblem("config reload problem", p)
+			failed = true
+		}
+	}
+	if failed {
+		slog.Error("config reload failed, keeping ICE servers")
+		return
+	}
+	s.reloadedICEServers.Store(&next.ICEServers)
+	slog.Info("config reloaded", "iceServers", config.ICEServerURLs(next.ICEServers))
+}
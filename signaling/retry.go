@@ -0,0 +1,40 @@
+package signaling
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryAfter приводит подсказку к границам RETRY_AFTER..RETRY_AFTER_MAX
+func (s *Server) retryAfter(d time.Duration) time.Duration {
+	if d < s.cfg.RetryAfter {
+		d = s.cfg.RetryAfter
+	}
+	if d > s.cfg.RetryAfterMax {
+		d = s.cfg.RetryAfterMax
+	}
+	return d
+}
+
+// retryAfterSeconds — значение для Retry-After и поля retryAfter: целые
+// секунды, округленные вверх
+func (s *Server) retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(s.retryAfter(d).Seconds()))
+}
+
+// rejectBusy отвечает 503 или 429 с заголовком Retry-After
+func (s *Server) rejectBusy(w http.ResponseWriter, status int, message string, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(s.retryAfterSeconds(d)))
+	http.Error(w, message, status)
+}
+
+// reconnectDelay разводит переподключения клиентов после выключения:
+// i-й клиент возвращается не раньше, чем очередь приема дойдет до него
+func (s *Server) reconnectDelay(i int) time.Duration {
+	if s.cfg.AcceptRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(i) / s.cfg.AcceptRate * float64(time.Second))
+}
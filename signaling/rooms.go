@@ -0,0 +1,225 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go-webrtc/room"
+)
+
+const (
+	// Комната по умолчанию для клиентов без ?room=
+	defaultRoom = "default"
+	// В комнате не больше двух участников: это пара для P2P-звонка.
+	// В режиме sfu предел задает SFU_MAX_ROOM_MEMBERS
+	maxRoomMembers = 2
+)
+
+var roomIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Room — клиенты, между которыми пересылаются offer/answer/ice (режим
+// relay), медиа через сервер (режим proxy) или сообщения каналов данных
+// (режимы server и proxy).
+type Room = room.Room[*Client]
+
+// requestedRoom возвращает комнату подключения. В режимах relay и proxy
+// это ?room= или комната по умолчанию; в режиме server комната нужна
+// только для пересылки каналов данных и задается явно.
+func (s *Server) requestedRoom(r *http.Request) string {
+	room := r.URL.Query().Get("room")
+	if room == "" && s.cfg.SignalingMode != "server" {
+		return defaultRoom
+	}
+	return room
+}
+
+// currentRoom — комната клиента или nil. Клиент может войти и выйти
+// сообщениями join/leave.
+func (c *Client) currentRoom() *Room {
+	return c.srv.rooms.Of(c)
+}
+
+// roomPeers возвращает остальных участников комнаты клиента
+func (s *Server) roomPeers(client *Client) []*Client {
+	return s.rooms.Peers(client)
+}
+
+// joinRoom добавляет клиента в комнату. room.ErrFull — комната
+// заполнена, errPublisherLimit — в ней уже MAX_PUBLISHERS_PER_ROOM
+// публикующих.
+// Участники с других экземпляров учитываются в пределе, насколько они
+// уже известны. Первый локальный участник подписывает экземпляр на
+// комнату в backplane и ждет списка ее участников.
+func (s *Server) joinRoom(client *Client, id string) error {
+	room, created, err := s.rooms.Join(id, client, s.roomCapacity(), s.admitPublisher(client))
+	if err != nil {
+		return err
+	}
+	client.roomID.Store(&room.ID)
+
+	if created {
+		s.postWebhook(map[string]interface{}{"type": "room-created", "room": id, "clientId": client.id})
+		if err := s.backplane.Subscribe(id); err != nil {
+			slog.Warn("backplane subscribe error", "room", id, "err", err)
+		}
+		s.syncRoom(room)
+	}
+	if s.hooks.OnClientJoin != nil {
+		s.hooks.OnClientJoin(client, id)
+	}
+	return nil
+}
+
+// remotePeers — id участников комнаты клиента на других экземплярах
+func (s *Server) remotePeers(client *Client) []string {
+	return s.rooms.RemotePeers(client)
+}
+
+// leaveRoom убирает клиента из комнаты и сообщает об этом остальным
+func (s *Server) leaveRoom(client *Client) {
+	room, peers, emptied := s.rooms.Leave(client)
+	if room == nil {
+		return
+	}
+	client.roomID.Store(nil)
+	if s.hooks.OnClientLeave != nil {
+		s.hooks.OnClientLeave(client, room.ID)
+	}
+
+	s.publishRoom(room.ID, busMessage{Kind: "left", Client: client.id})
+	if emptied {
+		s.postWebhook(map[string]interface{}{
+			"type":     "room-destroyed",
+			"room":     room.ID,
+			"duration": time.Since(room.Created).Seconds(),
+		})
+		if err := s.backplane.Unsubscribe(room.ID); err != nil {
+			slog.Warn("backplane unsubscribe error", "room", room.ID, "err", err)
+		}
+		s.stopRecordingOf("room", room.ID)
+	}
+	s.applyRecording([]*Client{client})
+
+	if s.forwardsMedia() {
+		leaveForwarding(client, peers)
+	}
+	s.broadcast(peers, map[string]interface{}{
+		"type":     "peer-left",
+		"clientId": client.id,
+	})
+}
+
+// forwardToRoom пересылает сигнальное сообщение остальным участникам
+// комнаты, добавляя id отправителя
+func (s *Server) forwardToRoom(client *Client, data map[string]interface{}) {
+	if data["type"] == "offer" {
+		s.metrics.offers.Inc()
+	}
+	peers := s.roomPeers(client)
+	remote := s.remotePeers(client)
+	if len(peers) == 0 && len(remote) == 0 {
+		client.sendError("NO_PEER", "no other participant in room")
+		return
+	}
+	data["from"] = client.id
+	if room := client.currentRoom(); room != nil && len(remote) > 0 {
+		s.publishRoom(room.ID, busMessage{Kind: "signal", Client: client.id, Data: data})
+	}
+	result := s.broadcast(peers, data)
+	for peer, err := range result.Failed {
+		client.logger.Warn("forward error", "type", data["type"], "to", peer.id, "err", err)
+	}
+	switch data["type"] {
+	case "answer":
+		s.metrics.answers.Add(float64(len(result.Delivered)))
+	case "ice":
+		s.metrics.candidates.Add(float64(len(result.Delivered)))
+	}
+}
+
+// announceJoin сообщает остальным участникам о новом и подключает
+// пересылку медиа в режиме proxy
+func (s *Server) announceJoin(client *Client) {
+	peers := s.roomPeers(client)
+	s.broadcast(peers, map[string]interface{}{
+		"type":     "peer-joined",
+		"clientId": client.id,
+	})
+	if room := client.currentRoom(); room != nil {
+		s.publishRoom(room.ID, busMessage{Kind: "joined", Client: client.id})
+	}
+	if s.forwardsMedia() {
+		client.attachForwarded()
+		for _, peer := range peers {
+			peer.attachForwarded()
+		}
+	}
+}
+
+// handleJoin переводит клиента в комнату по
+// {"type":"join","room":"...","role":"viewer"}. Из прежней комнаты он
+// выходит; в заполненную не попадает и остается без комнаты.
+func (s *Server) handleJoin(client *Client, id, role string) {
+	if !roomIDRe.MatchString(id) {
+		client.sendError("INVALID_ROOM", "room must be 1-64 letters, digits, - or _")
+		return
+	}
+	if room := client.currentRoom(); room != nil && room.ID == id {
+		client.sendError("ALREADY_IN_ROOM", "already in room "+id)
+		return
+	}
+	if s.roomQuotaExceeded(client, id) {
+		client.sendJSON(errorMessage{
+			Type:    "error",
+			Code:    "ROOM_QUOTA",
+			Message: fmt.Sprintf("user %s is already in %d rooms", client.identity, s.cfg.MaxRoomsPerUser),
+		})
+		return
+	}
+	s.leaveRoom(client)
+	client.viewer.Store(role == roleViewer)
+	if err := s.joinRoom(client, id); errors.Is(err, errPublisherLimit) {
+		s.rejectPublisher(client, id)
+		return
+	} else if err != nil {
+		client.sendJSON(map[string]interface{}{
+			"type":       "room-full",
+			"room":       id,
+			"retryAfter": s.retryAfterSeconds(s.cfg.RetryAfter),
+		})
+		return
+	}
+	client.signaled.Store(true)
+	client.logger.Info("joined room", "room", id)
+
+	peers := s.roomPeers(client)
+	ids := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		ids = append(ids, peer.id)
+	}
+	ids = append(ids, s.remotePeers(client)...)
+	client.sendJSON(map[string]interface{}{
+		"type":  "joined",
+		"room":  id,
+		"peers": ids,
+	})
+	s.sendRoomState(client)
+	s.announceJoin(client)
+	s.applyRecording([]*Client{client})
+}
+
+// handleLeave выводит клиента из комнаты по {"type":"leave"}
+func (s *Server) handleLeave(client *Client) {
+	room := client.currentRoom()
+	if room == nil {
+		client.sendError("NOT_IN_ROOM", "not in a room")
+		return
+	}
+	s.leaveRoom(client)
+	client.logger.Info("left room", "room", room.ID)
+	client.sendJSON(map[string]interface{}{"type": "left", "room": room.ID})
+}
@@ -0,0 +1,63 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Пределы общего состояния комнаты
+const (
+	maxRoomStateKeys    = 256
+	maxRoomStateKeyLen  = 128
+	maxRoomStateValueSz = 4096
+)
+
+// setRoomState применяет state-set: последняя запись побеждает, порядок
+// задает сервер. value null удаляет ключ. Изменение рассылается всем
+// участникам комнаты, включая отправителя.
+func (s *Server) setRoomState(client *Client, key string, value interface{}) {
+	room := client.currentRoom()
+	if room == nil {
+		client.sendError("NOT_IN_ROOM", "shared state is only available in rooms")
+		return
+	}
+	if key == "" || len(key) > maxRoomStateKeyLen {
+		client.sendError("INVALID_STATE", fmt.Sprintf("key must be 1-%d bytes", maxRoomStateKeyLen))
+		return
+	}
+	raw, err := json.Marshal(value)
+	if err != nil || len(raw) > maxRoomStateValueSz {
+		client.sendError("INVALID_STATE", fmt.Sprintf("value must encode to at most %d bytes", maxRoomStateValueSz))
+		return
+	}
+
+	if value == nil {
+		raw = nil
+	}
+	members, err := s.rooms.SetState(room, key, raw, maxRoomStateKeys)
+	if err != nil {
+		client.sendError("STATE_FULL", fmt.Sprintf("room state holds at most %d keys", maxRoomStateKeys))
+		return
+	}
+
+	update := map[string]interface{}{
+		"type":  "state-update",
+		"key":   key,
+		"value": value,
+		"from":  client.id,
+	}
+	s.broadcast(members, update)
+}
+
+// sendRoomState отправляет клиенту снимок состояния его комнаты
+func (s *Server) sendRoomState(client *Client) {
+	room := client.currentRoom()
+	if room == nil {
+		client.sendError("NOT_IN_ROOM", "shared state is only available in rooms")
+		return
+	}
+	client.sendJSON(map[string]interface{}{
+		"type":  "state",
+		"state": s.rooms.State(room),
+	})
+}
@@ -0,0 +1,96 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// runtimeFeature — включена ли возможность в текущей конфигурации.
+// Available=false — в этой сборке ее нет вовсе.
+type runtimeFeature struct {
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Available bool   `json:"available"`
+	Mode      string `json:"mode,omitempty"`
+}
+
+// runtimeFeatures описывает возможности без значений секретов: только
+// факт, что они заданы
+func (s *Server) runtimeFeatures() []runtimeFeature {
+	on := func(name string, enabled bool) runtimeFeature {
+		return runtimeFeature{Name: name, Enabled: enabled, Available: true}
+	}
+	mode := func(name string, enabled bool, m string) runtimeFeature {
+		return runtimeFeature{Name: name, Enabled: enabled, Available: true, Mode: m}
+	}
+	missing := func(name string) runtimeFeature {
+		return runtimeFeature{Name: name}
+	}
+
+	return []runtimeFeature{
+		mode("auth", s.cfg.AuthMode != "none", s.cfg.AuthMode),
+		mode("signaling", true, s.cfg.SignalingMode),
+		on("media-proxy", s.cfg.SignalingMode == "proxy"),
+		on("sfu", s.cfg.SignalingMode == "sfu"),
+		on("simulcast", s.forwardsMedia()),
+		on("tls", s.cfg.TLSEnabled()),
+		on("tls-autocert", len(s.cfg.TLSAutocertDomains) > 0),
+		on("schema-validation", s.cfg.SchemaValidation),
+		on("turn-credentials", s.cfg.TURNSecret != ""),
+		on("turn-tcp-fallback", s.cfg.TURNTCPFallback),
+		on("embedded-turn", s.cfg.TURNServerPort > 0),
+		on("file-transfer", s.cfg.FileTransferDir != ""),
+		on("ice-recovery", s.cfg.ICERecovery),
+		on("non-trickle", s.cfg.NonTrickle),
+		on("codec-selection", s.cfg.VideoCodecs != nil || s.cfg.AudioCodecs != nil),
+		on("common-codec-check", s.cfg.RequireCommonCodec),
+		on("bandwidth-estimation", s.cfg.BWEReportInterval > 0),
+		on("congestion-control", s.cfg.CongestionControl && s.forwardsMedia()),
+		on("active-speaker", s.cfg.ActiveSpeakerInterval > 0 && s.cfg.SignalingMode != "relay"),
+		on("quality-monitoring", s.cfg.QualityInterval > 0),
+		on("keyframe-enforcement", s.cfg.KeyframeInterval > 0),
+		on("accept-queue", s.cfg.AcceptRate > 0),
+		on("connection-rate-limit", s.cfg.ConnectRatePerIP > 0),
+		on("message-rate-limit", s.cfg.MessageRate > 0),
+		on("admin-api", s.cfg.AdminToken != ""),
+		on("pprof", s.cfg.PprofEnabled && s.cfg.AdminToken != ""),
+		on("webhooks", len(s.cfg.WebhookURLs) > 0),
+		on("recording", s.cfg.RecordingDir != ""),
+		on("whip", true),
+		on("grpc", s.cfg.GRPCListenAddr != ""),
+		on("restream", s.cfg.EgressEnabled),
+		on("session-resume", s.cfg.SessionResumeGrace > 0),
+		on("metrics", true),
+		mode("negotiation", true, "impolite"),
+		on("dc-compression", s.cfg.DataChannelCompressMin > 0),
+		missing("tracing"),
+	}
+}
+
+// buildInfo — версия Go и ревизия, из которой собран сервер
+func buildInfo() map[string]string {
+	info := map[string]string{"go": runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				info[s.Key] = s.Value
+			}
+		}
+	}
+	return info
+}
+
+// handleFeatures: GET /features — какие возможности включены
+func (s *Server) handleFeatures(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"build":    buildInfo(),
+		"features": s.runtimeFeatures(),
+	}); err != nil {
+		slog.Warn("features encode error", "err", err)
+	}
+}
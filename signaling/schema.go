@@ -0,0 +1,110 @@
+package signaling
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Схемы входящих сообщений, по одной на тип: schemas/<type>.json
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+func (s *Server) loadMessageSchemas() error {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		return err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	for _, e := range entries {
+		f, err := schemaFiles.Open("schemas/" + e.Name())
+		if err != nil {
+			return err
+		}
+		err = compiler.AddResource(e.Name(), f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("schema %s: %w", e.Name(), err)
+		}
+	}
+
+	schemas := make(map[string]*jsonschema.Schema, len(entries))
+	for _, e := range entries {
+		schema, err := compiler.Compile(e.Name())
+		if err != nil {
+			return fmt.Errorf("schema %s: %w", e.Name(), err)
+		}
+		schemas[strings.TrimSuffix(e.Name(), path.Ext(e.Name()))] = schema
+	}
+	s.messageSchemas = schemas
+	return nil
+}
+
+// validateMessage проверяет сообщение по схеме его типа. Возвращает
+// список полей (JSON pointer), которые не прошли проверку.
+func (s *Server) validateMessage(data map[string]interface{}) ([]string, error) {
+	msgType, _ := data["type"].(string)
+	schema, ok := s.messageSchemas[msgType]
+	if !ok {
+		return []string{"/type"}, fmt.Errorf("unknown message type %q", msgType)
+	}
+
+	err := schema.Validate(data)
+	if err == nil {
+		return nil, nil
+	}
+
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var fields, details []string
+	for _, unit := range ve.BasicOutput().Errors {
+		if unit.Error == "" || strings.HasPrefix(unit.Error, "doesn't validate with") {
+			continue
+		}
+		for _, field := range offendingFields(unit.InstanceLocation, unit.Error) {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+		loc := unit.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		details = append(details, loc+": "+unit.Error)
+	}
+	sort.Strings(fields)
+	return fields, errors.New(strings.Join(details, "; "))
+}
+
+// offendingFields переводит ошибки про отсутствующие и лишние свойства
+// в пути к самим свойствам, а не к объекту, в котором они лежат
+func offendingFields(loc, msg string) []string {
+	for _, prefix := range []string{"missing properties: ", "additionalProperties "} {
+		rest, ok := strings.CutPrefix(msg, prefix)
+		if !ok {
+			continue
+		}
+		rest = strings.TrimSuffix(rest, " not allowed")
+		var fields []string
+		for _, name := range strings.Split(rest, ",") {
+			fields = append(fields, loc+"/"+strings.Trim(strings.TrimSpace(name), "'"))
+		}
+		return fields
+	}
+	if loc == "" {
+		loc = "/"
+	}
+	return []string{loc}
+}
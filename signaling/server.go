@@ -0,0 +1,444 @@
+// Package signaling — встраиваемый сигнальный WebRTC-сервер: сессии по
+// WebSocket и gRPC, комнаты, медиа через сервер, WHIP/WHEP и админские
+// эндпоинты. Сервер создает New, подключения принимает его Handler или
+// ListenAndServe; cmd/server — готовый бинарник на его основе.
+package signaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"google.golang.org/grpc"
+
+	"go-webrtc/config"
+	"go-webrtc/media"
+	"go-webrtc/room"
+)
+
+// Hooks — обработчики событий сервера для встраивающего кода. Вызываются
+// из горутин сессий и не должны надолго их задерживать. Nil — нет
+// обработчика.
+type Hooks struct {
+	// OnClientJoin — клиент вошел в комнату
+	OnClientJoin func(client *Client, room string)
+	// OnClientLeave — клиент вышел из комнаты, в том числе при отключении
+	OnClientLeave func(client *Client, room string)
+	// OnTrack — от клиента пришел трек медиа. Трек читает сам сервер,
+	// обработчик его только видит.
+	OnTrack func(client *Client, track *webrtc.TrackRemote)
+
+	// Authorize решает, можно ли клиенту выполнить действие: msgType —
+	// тип сообщения (offer, state-set, ...) или "join" при входе в
+	// комнату, data — само сообщение (для join — {"room": id}, для
+	// ice-batch — nil, он разбирается отдельно). Ошибка уходит клиенту как
+	// FORBIDDEN. hello и auth не проверяются: это уровень подключения.
+	// Nil — разрешено все.
+	Authorize func(claims Claims, msgType string, data map[string]interface{}) error
+}
+
+// Options — настройки New
+type Options struct {
+	Config config.Config
+	// Перевести лог процесса на slog (SetupLogging) до запуска, чтобы
+	// запуск уже логировался в LOG_FORMAT
+	Logging bool
+	Hooks
+}
+
+// Server — сигнальный сервер со всем своим состоянием: несколько Server
+// в одном процессе друг другу не мешают. Общие на процесс только
+// счетчики Prometheus и лог, который переключает SetupLogging.
+type Server struct {
+	cfg   config.Config
+	hooks Hooks
+
+	api      *media.API
+	upgrader websocket.Upgrader
+	// Админские эндпоинты на ADMIN_LISTEN_ADDR, если он задан, иначе
+	// adminMux — это mux
+	mux      *http.ServeMux
+	adminMux *http.ServeMux
+
+	// Метрики сервера в собственном реестре, его отдает /metrics
+	registry *prometheus.Registry
+	metrics  *metrics
+
+	// Уровни лога сервера и pion. Меняются на ходу: Reload с новыми
+	// LOG_LEVEL и LOG_LEVEL_PION или PUT /admin/log-level.
+	logLevel  *slog.LevelVar
+	pionLevel *slog.LevelVar
+	logs      *logHub
+	events    *eventHub
+
+	clients *clientRegistry
+	rooms   *room.Registry[*Client]
+
+	backplane Backplane
+	// Id экземпляра в сообщениях backplane, чтобы не обрабатывать свои
+	instanceID string
+
+	// Список ICE-серверов после Reload; nil — cfg.ICEServers
+	reloadedICEServers atomic.Pointer[[]webrtc.ICEServer]
+	messageSchemas     map[string]*jsonschema.Schema
+
+	accepts         acceptQueue
+	connectLimiters *ipLimiters
+	// activeConns — занятые места под MAX_CLIENTS. Место берется до
+	// Upgrade и освобождается, когда обработчик WebSocket завершился.
+	activeConns atomic.Int64
+	// ipConns — открытые WebSocket-подключения по адресу клиента
+	ipConns struct {
+		mu sync.Mutex
+		n  map[string]int
+	}
+	// livePeers — открытые PeerConnection под MAX_PEER_CONNECTIONS.
+	// Закрытые вычищаются при следующей проверке: путей закрытия много, а
+	// состояние Closed PeerConnection выставляет сам.
+	livePeers struct {
+		mu  sync.Mutex
+		set map[*webrtc.PeerConnection]struct{}
+	}
+	peersMu sync.Mutex
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*Client // возобновляемые сессии по токену
+	// Сигнал о том, что сессия отключилась от сокета или закрылась
+	sessionsCond *sync.Cond
+
+	// Снимки недавно закрытых сессий, чтобы их хронологию можно было
+	// посмотреть после отключения
+	closedSessions   []sessionDiagnostics
+	closedSessionsMu sync.Mutex
+
+	// Счетчики неудачных сессий по причинам с момента запуска
+	setupFailureCounts map[setupFailure]*atomic.Int64
+	// Задержки сбора кандидатов по всем сессиям с момента запуска
+	gatherLatencyMu  sync.Mutex
+	gatherLatencyAll map[string]*latencyAcc
+	// Сессии, сообщившие о воспроизведении, и сколько из них хотя бы раз
+	// упирались в блокировку autoplay. Считаются с момента запуска.
+	playbackSessionsReported atomic.Int64
+	playbackSessionsBlocked  atomic.Int64
+	// Сессии, идущие через TURN по TCP. Сервер видит только
+	// relay-кандидат клиента, а не протокол до TURN, поэтому TCP-релеем
+	// считается relay-пара у сессии, которой выдали TURN_TCP_URLS (других
+	// TURN клиенту не выдается).
+	tcpRelaySessions atomic.Int64
+	// Байты медиа, пересланные между участниками в режиме proxy
+	proxyForwardedBytes atomic.Uint64
+	// Сжатие пересылаемых сообщений каналов данных по всем клиентам
+	dcCompression compressionCounter
+
+	egresses     map[string]*egress
+	egressesMu   sync.Mutex
+	recordings   map[string]*recording
+	recordingsMu sync.Mutex
+	whipStreams  map[string]*whipStream
+	whipSessions map[string]*whipSession
+	whipMu       sync.Mutex
+
+	webhookClient  *http.Client
+	webhookTargets []*webhookTarget
+	// События в очередях и в доставке, их ждет flushWebhooks
+	webhookPending sync.WaitGroup
+
+	turnServer *turn.Server
+	grpcServer *grpc.Server
+	servers    []*http.Server
+
+	// draining — сервер выключается: новые WebSocket-подключения
+	// отклоняются, а подключенные клиенты дорабатывают до DRAIN_TIMEOUT
+	draining atomic.Bool
+	// wsHandlers — работающие обработчики WebSocket и gRPC; выключение
+	// ждет их завершения, потому что http.Server.Shutdown о них не знает
+	wsHandlers   sync.WaitGroup
+	shutdownOnce sync.Once
+	// done останавливает фоновые циклы, когда клиенты уже закрыты;
+	// stopped закрывается, когда Shutdown закончен
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// New создает сервер по opts.Config и запускает его фоновую работу:
+// webhooks, backplane, определение говорящего и встроенный TURN.
+// Подключения принимает Handler или ListenAndServe. Замечания Validate
+// уходят в лог, фатальные из них — ошибка.
+func New(opts Options) (*Server, error) {
+	cfg := opts.Config
+	registry := prometheus.NewRegistry()
+	metrics := newMetrics(registry)
+	s := &Server{
+		cfg:              cfg,
+		registry:         registry,
+		metrics:          metrics,
+		hooks:            opts.Hooks,
+		logLevel:         new(slog.LevelVar),
+		pionLevel:        new(slog.LevelVar),
+		clients:          newClientRegistry(cfg.ClientShards, metrics.clients),
+		rooms:            room.NewRegistry[*Client](),
+		instanceID:       newClientID(),
+		sessions:         make(map[string]*Client),
+		gatherLatencyAll: make(map[string]*latencyAcc),
+		egresses:         make(map[string]*egress),
+		recordings:       make(map[string]*recording),
+		whipStreams:      make(map[string]*whipStream),
+		whipSessions:     make(map[string]*whipSession),
+		webhookClient:    &http.Client{},
+		done:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		peerCollector{srv: s},
+	)
+	s.upgrader = websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	s.logs = &logHub{srv: s, subs: make(map[*logSubscriber]struct{})}
+	s.events = &eventHub{srv: s, subs: make(map[*eventSubscriber]struct{})}
+	s.accepts.srv = s
+	s.connectLimiters = &ipLimiters{srv: s, limiters: make(map[string]*ipLimiter)}
+	s.ipConns.n = make(map[string]int)
+	s.livePeers.set = make(map[*webrtc.PeerConnection]struct{})
+	s.sessionsCond = sync.NewCond(&s.sessionsMu)
+	s.setupFailureCounts = make(map[setupFailure]*atomic.Int64, len(setupFailures))
+	for _, reason := range setupFailures {
+		s.setupFailureCounts[reason] = new(atomic.Int64)
+	}
+	s.applyLogLevels(cfg)
+	if opts.Logging {
+		s.SetupLogging()
+	}
+
+	fatal := false
+	for _, p := range cfg.Validate() {
+		logConfigProblem("config problem", p)
+		fatal = fatal || p.Fatal
+	}
+	if fatal {
+		return nil, errors.New("invalid configuration")
+	}
+	cfg.LogEffective()
+
+	if cfg.SchemaValidation {
+		if err := s.loadMessageSchemas(); err != nil {
+			return nil, fmt.Errorf("message schema: %w", err)
+		}
+	}
+
+	var err error
+	if s.backplane, err = s.newBackplane(); err != nil {
+		return nil, fmt.Errorf("backplane: %w", err)
+	}
+	if s.api, err = s.newWebRTCAPI(); err != nil {
+		s.backplane.Close()
+		return nil, fmt.Errorf("WebRTC API: %w", err)
+	}
+	if err = s.startTURNServer(); err != nil {
+		s.backplane.Close()
+		s.api.Close()
+		return nil, fmt.Errorf("TURN server: %w", err)
+	}
+
+	s.startWebhooks()
+	go s.runBackplane()
+	if cfg.ActiveSpeakerInterval > 0 {
+		go s.runActiveSpeaker()
+	}
+	go s.connectLimiters.cleanup()
+	s.routes()
+	return s, nil
+}
+
+func (s *Server) routes() {
+	mux := http.NewServeMux()
+	adminMux := mux
+	if s.cfg.AdminListenAddr != "" {
+		adminMux = http.NewServeMux()
+	}
+	s.mux, s.adminMux = mux, adminMux
+
+	mux.HandleFunc("/ws", s.withConnLimits(s.withAcceptQueue(s.handleWebSocket)))
+	mux.HandleFunc("/stats", s.withCORS(s.handleStats))
+	mux.HandleFunc("/whoami", s.withCORS(s.handleWhoami))
+	mux.HandleFunc("GET /features", s.withCORS(s.handleFeatures))
+	mux.HandleFunc("GET /turn-credentials", s.withCORS(s.handleTURNCredentials))
+	mux.HandleFunc("/stats/webrtc", s.withCORS(s.handleWebRTCStats))
+	mux.Handle("/metrics", promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))
+	adminMux.HandleFunc("GET /clients", s.withAdmin(s.handleClients))
+	adminMux.HandleFunc("DELETE /clients/{id}", s.withAdmin(s.handleKickClient))
+	adminMux.HandleFunc("GET /api/rooms", s.withAdmin(s.handleAPIRooms))
+	adminMux.HandleFunc("POST /api/rooms/{id}/close", s.withAdmin(s.handleAPICloseRoom))
+	adminMux.HandleFunc("GET /api/clients", s.withAdmin(s.handleClients))
+	adminMux.HandleFunc("GET /api/clients/{id}/stats", s.withAdmin(s.handleAPIClientStats))
+	adminMux.HandleFunc("POST /api/clients/{id}/kick", s.withAdmin(s.handleKickClient))
+	adminMux.HandleFunc("/diagnostics", s.withAdmin(s.handleDiagnostics))
+	adminMux.HandleFunc("/admin/logs", s.withAdmin(s.handleAdminLogs))
+	adminMux.HandleFunc("GET /admin/log-level", s.withAdmin(s.handleLogLevel))
+	adminMux.HandleFunc("PUT /admin/log-level", s.withAdmin(s.handleLogLevel))
+	adminMux.HandleFunc("GET /events", s.withAdmin(s.handleEvents))
+	mux.HandleFunc("POST /whip", s.withCORS(s.handleWHIP))
+	mux.HandleFunc("POST /whip/{stream}", s.withCORS(s.handleWHIP))
+	mux.HandleFunc("POST /whep/{stream}", s.withCORS(s.handleWHEP))
+	mux.HandleFunc("PATCH /whip/session/{id}", s.withCORS(s.handleWHIPPatch("whip")))
+	mux.HandleFunc("DELETE /whip/session/{id}", s.withCORS(s.handleWHIPDelete("whip")))
+	mux.HandleFunc("PATCH /whep/session/{id}", s.withCORS(s.handleWHIPPatch("whep")))
+	mux.HandleFunc("DELETE /whep/session/{id}", s.withCORS(s.handleWHIPDelete("whep")))
+	// Preflight браузерных клиентов WHIP/WHEP отвечает withCORS
+	mux.HandleFunc("OPTIONS /whip/", s.withCORS(http.NotFound))
+	mux.HandleFunc("OPTIONS /whep/", s.withCORS(http.NotFound))
+	adminMux.HandleFunc("GET /restreams", s.withAdmin(s.handleRestreams))
+	adminMux.HandleFunc("POST /restreams", s.withAdmin(s.handleCreateRestream))
+	adminMux.HandleFunc("DELETE /restreams/{id}", s.withAdmin(s.handleDeleteRestream))
+	if s.cfg.EgressEnabled {
+		mux.Handle("GET /hls/", s.withCORS(http.StripPrefix("/hls/", http.FileServer(http.Dir(s.cfg.EgressHLSDir))).ServeHTTP))
+	}
+	adminMux.HandleFunc("GET /recordings", s.withAdmin(s.handleRecordings))
+	adminMux.HandleFunc("POST /recordings", s.withAdmin(s.handleCreateRecording))
+	adminMux.HandleFunc("DELETE /recordings/{id}", s.withAdmin(s.handleDeleteRecording))
+	mux.Handle("/", http.FileServer(http.Dir("./static")))
+	if s.cfg.PprofEnabled {
+		s.registerPprof(adminMux)
+	}
+}
+
+// logConfigProblem пишет замечание Validate: фатальное — как ошибку,
+// остальные — как предупреждение
+func logConfigProblem(msg string, p config.Problem) {
+	level := slog.LevelWarn
+	if p.Fatal {
+		level = slog.LevelError
+	}
+	slog.Log(context.Background(), level, msg, "key", p.Key, "problem", p.Message)
+}
+
+// Handler — эндпоинты сервера: /ws, WHIP/WHEP, статистика, статика и,
+// если ADMIN_LISTEN_ADDR не задан, админские
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// AdminHandler — админские эндпоинты. Без ADMIN_LISTEN_ADDR это тот же
+// Handler.
+func (s *Server) AdminHandler() http.Handler {
+	return s.adminMux
+}
+
+// Registry — реестр Prometheus этого сервера, который отдает /metrics:
+// сигнальные счетчики, метрики PeerConnection и встроенного TURN, Go
+// runtime и процесса
+func (s *Server) Registry() *prometheus.Registry {
+	return s.registry
+}
+
+// ListenAndServe слушает LISTEN_ADDR, а также ADMIN_LISTEN_ADDR,
+// HTTP_REDIRECT_ADDR и GRPC_LISTEN_ADDR, если они заданы, по TLS, если
+// он настроен. Возвращает nil, когда Shutdown закончен, или первую
+// ошибку любого из слушателей; остальные при этом продолжают работать
+// до Shutdown.
+func (s *Server) ListenAndServe() error {
+	manager := s.newAutocertManager()
+	// По одному месту на слушателя, чтобы горутины не зависали, когда
+	// ListenAndServe уже вернул первую ошибку
+	errs := make(chan error, 4)
+	if err := s.startGRPCServer(manager, errs); err != nil {
+		return fmt.Errorf("gRPC server: %w", err)
+	}
+	newServer := func(addr string, handler http.Handler) *http.Server {
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		if s.cfg.TLSEnabled() {
+			server.TLSConfig = s.newTLSConfig(manager)
+		}
+		return server
+	}
+	server := newServer(s.cfg.ListenAddr, s.mux)
+	s.servers = append(s.servers, server)
+
+	if s.cfg.AdminListenAddr != "" {
+		admin := newServer(s.cfg.AdminListenAddr, s.adminMux)
+		s.servers = append(s.servers, admin)
+		go func() {
+			if err := s.serve(admin, "Admin server"); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("admin server: %w", err)
+			}
+		}()
+	}
+	if s.cfg.TLSEnabled() && s.cfg.HTTPRedirectAddr != "" {
+		redirect := &http.Server{
+			Addr:              s.cfg.HTTPRedirectAddr,
+			Handler:           s.redirectToHTTPS(manager),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		s.servers = append(s.servers, redirect)
+		go func() {
+			slog.Info("HTTPS redirect starting", "addr", s.cfg.HTTPRedirectAddr)
+			if err := redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("HTTPS redirect: %w", err)
+			}
+		}()
+	}
+	go func() {
+		if err := s.serve(server, "Server"); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-s.stopped:
+		return nil
+	}
+}
+
+// Shutdown перестает принимать подключения и закрывает всех клиентов.
+// С DRAIN_TIMEOUT клиенты сначала получают server-closing и время уйти
+// сами, остальное ограничено SHUTDOWN_TIMEOUT. Повторный вызов ждет
+// завершения первого.
+func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		defer close(s.stopped)
+		s.draining.Store(true)
+		if s.cfg.DrainTimeout > 0 {
+			s.drainClients()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+		defer cancel()
+
+		// Shutdown не ждет WebSocket-соединений: после Upgrade они
+		// принадлежат обработчику, поэтому закрываем их сами
+		for _, server := range s.servers {
+			if err := server.Shutdown(ctx); err != nil {
+				slog.Warn("HTTP shutdown error", "err", err)
+			}
+		}
+		s.closeAllClients(ctx)
+		s.closeWHIPSessions()
+		s.waitHandlers(ctx)
+		s.flushWebhooks(ctx)
+
+		close(s.done)
+		s.stopGRPCServer()
+		s.stopTURNServer()
+		s.backplane.Close()
+		s.api.Close()
+	})
+	<-s.stopped
+}
@@ -0,0 +1,320 @@
+package signaling
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/config"
+)
+
+// Лог сервера в тестах виден только с -v
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestServer — сервер на httptest с настройками по умолчанию,
+// поправленными configure. Выключается в конце теста.
+func newTestServer(t *testing.T, configure func(*config.Config)) (*Server, *httptest.Server) {
+	return newTestServerHooks(t, configure, Hooks{})
+}
+
+func newTestServerHooks(t *testing.T, configure func(*config.Config), hooks Hooks) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.ICEServers = nil
+	cfg.ShutdownTimeout = 2 * time.Second
+	if configure != nil {
+		configure(&cfg)
+	}
+	s, err := New(Options{Config: cfg, Hooks: hooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		s.Shutdown()
+		ts.Close()
+	})
+	return s, ts
+}
+
+// dialWS подключается к /ws с параметрами query
+func dialWS(t *testing.T, ts *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	ws, resp, err := tryDialWS(ts, query, nil)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial /ws?%s: %v (status %d)", query, err, status)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func tryDialWS(ts *httptest.Server, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	if query != "" {
+		url += "?" + query
+	}
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// readType читает сообщения, пока не придет сообщение типа typ, и
+// возвращает его. Остальные пропускаются.
+func readType(t *testing.T, ws *websocket.Conn, typ string) map[string]interface{} {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		var msg map[string]interface{}
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		if msg["type"] == typ {
+			return msg
+		}
+	}
+}
+
+// readError ждет ошибку с кодом code
+func readError(t *testing.T, ws *websocket.Conn, code string) map[string]interface{} {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		var msg map[string]interface{}
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for error %s: %v", code, err)
+		}
+		if msg["type"] == "error" && msg["code"] == code {
+			return msg
+		}
+	}
+}
+
+func sendJSON(t *testing.T, ws *websocket.Conn, v interface{}) {
+	t.Helper()
+	if err := ws.WriteJSON(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor ждет, пока cond не станет истинным
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func decodeJSON(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newPeer — клиентский PeerConnection с data channel, чтобы в offer была
+// m-line. Закрывается в конце теста.
+func newPeer(t *testing.T) *webrtc.PeerConnection {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.CreateDataChannel("test", nil); err != nil {
+		t.Fatal(err)
+	}
+	return pc
+}
+
+// createOffer создает offer на pc и применяет его как local description
+func createOffer(t *testing.T, pc *webrtc.PeerConnection) webrtc.SessionDescription {
+	t.Helper()
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	return offer
+}
+
+// connectPeer отправляет offer pc вместе с кандидатами, применяет
+// answer и ждет, пока ICE соединится. Сервер должен работать с
+// NonTrickle: кандидаты сервера приходят в самом answer.
+func connectPeer(t *testing.T, ws *websocket.Conn, pc *webrtc.PeerConnection) {
+	t.Helper()
+	connected := make(chan struct{})
+	var once sync.Once
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			once.Do(func() { close(connected) })
+		}
+	})
+
+	gathered := webrtc.GatheringCompletePromise(pc)
+	createOffer(t, pc)
+	<-gathered
+	sendJSON(t, ws, map[string]string{"type": "offer", "sdp": pc.LocalDescription().SDP})
+	answer := readType(t, ws, "answer")
+	sdp, _ := answer["sdp"].(string)
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sdp}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ICE to connect")
+	}
+}
+
+func TestKeepaliveClosesSilentConnection(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.ReadTimeout = 300 * time.Millisecond
+		c.PingInterval = 100 * time.Millisecond
+		c.IdleWarningBefore = 0
+	})
+
+	// Клиент, который читает, отвечает на ping и остается подключенным
+	alive := dialWS(t, ts, "")
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Клиент, который не читает, pong не отправляет и отключается по
+	// READ_TIMEOUT
+	silent := dialWS(t, ts, "")
+	waitFor(t, "two clients", func() bool { return len(s.clients.snapshot()) == 2 })
+	waitFor(t, "silent client to time out", func() bool { return len(s.clients.snapshot()) == 1 })
+
+	time.Sleep(3 * s.cfg.ReadTimeout)
+	if n := len(s.clients.snapshot()); n != 1 {
+		t.Fatalf("%d clients connected, want the reading one", n)
+	}
+	silent.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := silent.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
+
+func TestIdleWarningBeforeTimeout(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.ReadTimeout = 600 * time.Millisecond
+		c.PingInterval = 500 * time.Millisecond
+		c.IdleWarningBefore = 300 * time.Millisecond
+	})
+	ws := dialWS(t, ts, "")
+	warning := readType(t, ws, "idle-warning")
+	if _, ok := warning["secondsLeft"]; !ok {
+		t.Fatalf("idle-warning without secondsLeft: %v", warning)
+	}
+}
+
+// Ошибка вспомогательного слушателя возвращается из ListenAndServe, а не
+// завершает процесс
+func TestListenAndServeReturnsListenerError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	s, _ := newTestServer(t, func(c *config.Config) {
+		c.ListenAddr = "127.0.0.1:0"
+		c.AdminListenAddr = busy.Addr().String()
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- s.ListenAndServe() }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "admin server") {
+			t.Fatalf("ListenAndServe = %v, want admin server error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe did not report the admin listener error")
+	}
+}
+
+// У каждого сервера свой реестр метрик: клиент одного не виден в
+// /metrics другого
+func TestMetricsPerServer(t *testing.T) {
+	_, ts1 := newTestServer(t, nil)
+	_, ts2 := newTestServer(t, nil)
+	dialWS(t, ts1, "")
+
+	waitMetric(t, ts1, `webrtc_clients{tenant=""}`, "1")
+	if got := scrapeMetric(t, ts2, `webrtc_clients{tenant=""}`); got != "" {
+		t.Fatalf("webrtc_clients of the second server = %s, want none", got)
+	}
+}
+
+// waitMetric ждет, пока series в /metrics не примет значение want
+func waitMetric(t *testing.T, ts *httptest.Server, series, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := scrapeMetric(t, ts, series)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q, want %s", series, got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// scrapeMetric — значение серии series (имя с метками) из /metrics,
+// пусто, если ее нет
+func scrapeMetric(t *testing.T, ts *httptest.Server, series string) string {
+	t.Helper()
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+package signaling
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Возобновление сессии после обрыва WebSocket. При подключении клиент
+// получает {"type":"session","token":...}. Если сокет оборвался без
+// close-фрейма, сессия (PeerConnection, комната, состояние) ждет
+// SESSION_RESUME_GRACE переподключения с ?resume=<токен>. Сообщения,
+// отправленные за это время, копятся и уходят после session-resumed.
+// Если сервер еще не заметил обрыва старого сокета, переподключение
+// закрывает его само.
+
+// Сколько сообщений копится за время обрыва; остальные теряются, и
+// клиент узнает об этом по lost в session-resumed
+const maxOutbox = 256
+
+// newSessionToken — токен возобновления новой сессии, пустой, если
+// возобновление выключено
+func (s *Server) newSessionToken() string {
+	if s.cfg.SessionResumeGrace <= 0 {
+		return ""
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		slog.Warn("session token error", "err", err)
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// offerSession регистрирует сессию и сообщает клиенту ее токен
+func (c *Client) offerSession() {
+	if c.sessionToken == "" {
+		return
+	}
+	c.srv.sessionsMu.Lock()
+	c.srv.sessions[c.sessionToken] = c
+	c.srv.sessionsMu.Unlock()
+	c.sendJSON(map[string]interface{}{
+		"type":  "session",
+		"token": c.sessionToken,
+		"grace": int(c.srv.cfg.SessionResumeGrace.Seconds()),
+	})
+}
+
+// resumable — переживет ли сессия обрыв сокета
+func (c *Client) resumable() bool {
+	return c.srv.cfg.SessionResumeGrace > 0 && c.sessionToken != "" && !c.srv.draining.Load()
+}
+
+// park отключает сессию от оборванного сокета и оставляет ждать
+// переподключения. false — сессию нужно закрыть.
+func (c *Client) park() bool {
+	if !c.resumable() {
+		return false
+	}
+	c.srv.sessionsMu.Lock()
+	defer c.srv.sessionsMu.Unlock()
+	if c.closing.Load() {
+		return false
+	}
+	c.mu.Lock()
+	c.detached = true
+	c.conn.Close()
+	c.mu.Unlock()
+
+	c.parked = true
+	c.parkTimer = time.AfterFunc(c.srv.cfg.SessionResumeGrace, func() { c.srv.expireSession(c) })
+	c.srv.sessionsCond.Broadcast()
+	c.srv.metrics.sessionsParked.Inc()
+	c.event("detached")
+	c.logger.Info("WebSocket dropped, session parked", "grace", c.srv.cfg.SessionResumeGrace.String())
+	return true
+}
+
+// unpark снимает сессию с ожидания. true — она ждала переподключения.
+// Вызывается под sessionsMu.
+func (c *Client) unpark() bool {
+	if !c.parked {
+		return false
+	}
+	c.parked = false
+	c.parkTimer.Stop()
+	c.srv.metrics.sessionsParked.Dec()
+	return true
+}
+
+// forgetSession вызывается при закрытии сессии: после него park не
+// сработает, а ожидавшая сессия больше не возобновится
+func (c *Client) forgetSession() {
+	c.srv.sessionsMu.Lock()
+	c.closing.Store(true)
+	if c.sessionToken != "" {
+		delete(c.srv.sessions, c.sessionToken)
+	}
+	wasParked := c.unpark()
+	c.srv.sessionsCond.Broadcast()
+	c.srv.sessionsMu.Unlock()
+	if wasParked {
+		c.end()
+	}
+}
+
+func (s *Server) expireSession(c *Client) {
+	s.sessionsMu.Lock()
+	expired := c.unpark()
+	s.sessionsMu.Unlock()
+	if !expired {
+		return
+	}
+	c.logger.Info("session not resumed in time, closing")
+	c.end()
+	s.cleanupClient(c)
+}
+
+// expireParkedSessions закрывает все ожидающие сессии: при выключении
+// переподключиться к ним уже не получится
+func (s *Server) expireParkedSessions() {
+	s.sessionsMu.Lock()
+	var list []*Client
+	for _, c := range s.sessions {
+		if c.parked {
+			list = append(list, c)
+		}
+	}
+	s.sessionsMu.Unlock()
+	for _, c := range list {
+		s.expireSession(c)
+	}
+}
+
+// resumeSession подключает сокет conn к сессии с токеном token. Старый
+// сокет сессии, если он еще числится живым, закрывается. В режиме token
+// сессия достается только владельцу того же sub. nil — такой сессии нет.
+func (s *Server) resumeSession(token string, claims Claims, conn signalConn) *Client {
+	s.sessionsMu.Lock()
+	c := s.sessions[token]
+	if c != nil && c.identity == claims.Subject() && !c.parked {
+		s.sessionsMu.Unlock()
+		c.dropConn()
+		s.sessionsMu.Lock()
+		for !c.parked && !c.closing.Load() {
+			s.sessionsCond.Wait()
+		}
+	}
+	if c == nil || c.identity != claims.Subject() || !c.unpark() {
+		s.sessionsMu.Unlock()
+		s.metrics.sessionResumes.WithLabelValues("failed").Inc()
+		return nil
+	}
+	s.sessionsMu.Unlock()
+
+	c.peerClosed.Store(false)
+	c.mu.Lock()
+	c.conn = conn
+	c.detached = false
+	queued, lost := c.outbox, c.outboxLost
+	c.outbox, c.outboxLost = nil, false
+	// Накопленное уходит раньше всего, что отправят после разблокировки
+	conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+	err := conn.WriteJSON(map[string]interface{}{
+		"type":   "session-resumed",
+		"id":     c.id,
+		"queued": len(queued),
+		"lost":   lost,
+	})
+	for _, msg := range queued {
+		if err != nil {
+			break
+		}
+		err = conn.WriteMessage(websocket.TextMessage, msg)
+	}
+	conn.SetWriteDeadline(time.Time{})
+	c.mu.Unlock()
+
+	s.metrics.sessionResumes.WithLabelValues("resumed").Inc()
+	c.event("resumed")
+	c.logger.Info("session resumed", "queued", len(queued), "lost", lost)
+	if err != nil {
+		c.logger.Warn("session resume write failed", "err", err)
+	}
+	if c.currentRoom() != nil {
+		s.sendRoomState(c)
+	}
+	return c
+}
+
+// enqueue копит сообщение отключенной сессии. Вызывается под c.mu.
+func (c *Client) enqueue(data []byte) {
+	if len(c.outbox) >= maxOutbox {
+		c.outboxLost = true
+		return
+	}
+	c.outbox = append(c.outbox, data)
+}
+
+// enqueueJSON — enqueue для еще не сериализованного сообщения
+func (c *Client) enqueueJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.enqueue(data)
+	return nil
+}
+
+// currentConn — сокет, к которому сейчас подключена сессия
+func (c *Client) currentConn() signalConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// dropConn рвет сокет возобновляемой сессии: цикл чтения завершится,
+// и сессия будет ждать переподключения
+func (c *Client) dropConn() {
+	c.currentConn().Close()
+}
+
+// end сообщает горутинам сессии, что она закончилась
+func (c *Client) end() {
+	c.endOnce.Do(func() { close(c.readDone) })
+}
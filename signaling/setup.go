@@ -0,0 +1,63 @@
+package signaling
+
+import (
+	"context"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// setupContext ограничивает первичную установку сессии SETUP_TIMEOUT
+func (s *Server) setupContext() (context.Context, context.CancelFunc) {
+	if s.cfg.SetupTimeout > 0 {
+		return context.WithTimeout(context.Background(), s.cfg.SetupTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// watchSetup ждет окончания сбора кандидатов. Если бюджет кончился
+// раньше, недостроенный PeerConnection закрывается, и клиент может
+// прислать новый offer.
+func (s *Server) watchSetup(ctx context.Context, cancel context.CancelFunc, client *Client, pc *webrtc.PeerConnection, gathered <-chan struct{}) {
+	defer cancel()
+	select {
+	case <-gathered:
+		return
+	case <-client.readDone:
+		return
+	case <-ctx.Done():
+	}
+
+	client.negotiationMu.Lock()
+	defer client.negotiationMu.Unlock()
+	// PeerConnection уже сброшен, например после failSetup
+	if !client.pc.CompareAndSwap(pc, nil) {
+		return
+	}
+	s.abortSetup(client, pc)
+}
+
+func (s *Server) abortSetup(client *Client, pc *webrtc.PeerConnection) {
+	client.logger.Warn("session setup timed out, aborting", "timeout", s.cfg.SetupTimeout)
+	client.event("setup-timeout")
+	if err := pc.Close(); err != nil {
+		client.logger.Warn("PeerConnection close error", "err", err)
+	}
+	client.sendError("SETUP_TIMEOUT", "session setup took longer than "+s.cfg.SetupTimeout.String())
+}
+
+// failSetup закрывает PeerConnection, на котором не удалось создать или
+// применить answer, чтобы следующие сообщения не попадали в сломанный PC.
+// Клиент может прислать новый offer. Вызывается под client.negotiationMu.
+func failSetup(client *Client, pc *webrtc.PeerConnection) {
+	rejectSetup(client, pc, "SETUP_FAILED", "could not create the answer, send a new offer")
+}
+
+// rejectSetup — failSetup с кодом ошибки code для клиента
+func rejectSetup(client *Client, pc *webrtc.PeerConnection, code, message string) {
+	client.event("setup-failed")
+	client.pc.CompareAndSwap(pc, nil)
+	if err := pc.Close(); err != nil {
+		client.logger.Warn("PeerConnection close error", "err", err)
+	}
+	client.sendError(code, message)
+}
@@ -0,0 +1,50 @@
+package signaling
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/config"
+)
+
+// livePeerCount — PeerConnection под MAX_PEER_CONNECTIONS, которые еще
+// не закрыты
+func livePeerCount(s *Server) int {
+	s.livePeers.mu.Lock()
+	defer s.livePeers.mu.Unlock()
+	n := 0
+	for pc := range s.livePeers.set {
+		if pc.SignalingState() != webrtc.SignalingStateClosed {
+			n++
+		}
+	}
+	return n
+}
+
+// Offer, который pion не принимает, закрывает созданный под него PC:
+// он не занимает место под MAX_PEER_CONNECTIONS, а следующий offer
+// начинает сессию заново
+func TestInvalidOfferTearsDownPeer(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.MaxPeerConnections = 1
+	})
+	ws := dialWS(t, ts, "")
+
+	sendJSON(t, ws, map[string]string{"type": "offer", "sdp": "v=0\r\nnot an offer\r\n"})
+	readError(t, ws, "SETUP_FAILED")
+	client := s.clients.snapshot()[0]
+	if client.pc.Load() != nil {
+		t.Fatal("PeerConnection kept after invalid offer")
+	}
+	if n := livePeerCount(s); n != 0 {
+		t.Fatalf("%d live peer connections after invalid offer, want 0", n)
+	}
+
+	offer := createOffer(t, newPeer(t))
+	sendJSON(t, ws, map[string]string{"type": "offer", "sdp": offer.SDP})
+	readType(t, ws, "answer")
+	if n := livePeerCount(s); n != 1 {
+		t.Fatalf("%d live peer connections after a fresh offer, want 1", n)
+	}
+}
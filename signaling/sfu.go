@@ -0,0 +1,159 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Роли участника комнаты sfu: publisher (по умолчанию) публикует и
+// получает треки, viewer только получает
+const (
+	rolePublisher = "publisher"
+	roleViewer    = "viewer"
+)
+
+var errPublisherLimit = errors.New("publisher limit exceeded")
+
+func validRole(role string) bool {
+	return role == "" || role == rolePublisher || role == roleViewer
+}
+
+// viewerInSFU — клиент-зритель комнаты sfu: его треки не пересылаются
+func (c *Client) viewerInSFU() bool {
+	return c.srv.cfg.SignalingMode == "sfu" && c.viewer.Load()
+}
+
+// admitPublisher — проверка MAX_PUBLISHERS_PER_ROOM при входе клиента в
+// комнату sfu; nil, если предела нет или клиент — зритель. Считаются
+// публикующие участники этого экземпляра.
+func (s *Server) admitPublisher(client *Client) func([]*Client) error {
+	limit := s.cfg.MaxPublishersPerRoom
+	if s.cfg.SignalingMode != "sfu" || limit == 0 || client.viewer.Load() {
+		return nil
+	}
+	return func(members []*Client) error {
+		if publishers, _ := roomRoles(members); publishers >= limit {
+			return errPublisherLimit
+		}
+		return nil
+	}
+}
+
+// rejectPublisher отвечает PUBLISHER_LIMIT_EXCEEDED: войти в комнату id
+// можно только зрителем
+func (s *Server) rejectPublisher(client *Client, id string) {
+	client.sendError("PUBLISHER_LIMIT_EXCEEDED", fmt.Sprintf("room %s already has %d publishers, join as viewer", id, s.cfg.MaxPublishersPerRoom))
+}
+
+// roomRoles — публикующие и зрители среди локальных участников комнаты
+func roomRoles(members []*Client) (publishers, viewers int) {
+	for _, m := range members {
+		if m.viewer.Load() {
+			viewers++
+		} else {
+			publishers++
+		}
+	}
+	return publishers, viewers
+}
+
+// forwardsMedia — пересылает ли сервер медиа между участниками комнаты
+func (s *Server) forwardsMedia() bool {
+	return s.cfg.SignalingMode == "proxy" || s.cfg.SignalingMode == "sfu"
+}
+
+// roomCapacity — сколько участников помещается в комнату
+func (s *Server) roomCapacity() int {
+	if s.cfg.SignalingMode == "sfu" {
+		return s.cfg.SFUMaxRoomMembers
+	}
+	return maxRoomMembers
+}
+
+// subscribeForwarded добавляет клиенту по отправителю на каждый трек
+// участников, на который он еще не подписан. Новые транспондеры требуют
+// повторного согласования: pion вызывает OnNegotiationNeeded, и сервер
+// сам отправляет offer (sendServerOffer). Вызывается под c.proxy.mu.
+func (c *Client) subscribeForwarded(pc *webrtc.PeerConnection, offered []*forwardedTrack) {
+	subscribed := make(map[*forwardedTrack]bool, len(c.proxy.senders))
+	for _, ft := range c.proxy.senders {
+		subscribed[ft] = true
+	}
+	for _, ft := range offered {
+		if subscribed[ft] {
+			continue
+		}
+		local, err := ft.localFor(c)
+		if err != nil {
+			c.logger.Warn("subscribing to track failed", "from", ft.from.id, "kind", ft.local.Kind().String(), "err", err)
+			continue
+		}
+		sender, err := pc.AddTrack(local)
+		if err != nil {
+			ft.release(c)
+			c.logger.Warn("subscribing to track failed", "from", ft.from.id, "kind", ft.local.Kind().String(), "err", err)
+			continue
+		}
+		c.proxy.senders[sender] = ft
+		go c.readSenderRTCP(sender)
+		c.logger.Info("subscribed to track", "from", ft.from.id, "kind", ft.local.Kind().String())
+		ft.requestKeyframe()
+	}
+}
+
+// dropForwarded отписывает клиента от треков, для которых drop
+// возвращает true. В режиме sfu отправитель удаляется, и клиенту уходит
+// новый offer; в режиме proxy отправитель остается без трека.
+func (c *Client) dropForwarded(drop func(*forwardedTrack) bool) {
+	c.proxy.mu.Lock()
+	defer c.proxy.mu.Unlock()
+	pc := c.proxy.pc
+	for sender, ft := range c.proxy.senders {
+		if ft == nil || !drop(ft) {
+			continue
+		}
+		ft.release(c)
+		if c.srv.cfg.SignalingMode == "sfu" && pc != nil {
+			if err := pc.RemoveTrack(sender); err != nil {
+				c.logger.Warn("unsubscribing from track failed", "from", ft.from.id, "err", err)
+			}
+			delete(c.proxy.senders, sender)
+		} else {
+			// Отправитель proxy общий для всех треков своего типа
+			// и живет, пока жив PeerConnection
+			sender.ReplaceTrack(nil)
+			c.proxy.senders[sender] = nil
+		}
+	}
+}
+
+// unpublishTrack убирает закончившийся трек клиента у всех подписчиков.
+// У simulcast трек уходит вместе с последним слоем.
+func (c *Client) unpublishTrack(ft *forwardedTrack, rid string) {
+	if ft.simulcast != nil && ft.simulcast.removeLayer(rid) > 0 {
+		return
+	}
+	c.proxy.mu.Lock()
+	for i, p := range c.proxy.published {
+		if p == ft {
+			c.proxy.published = append(c.proxy.published[:i], c.proxy.published[i+1:]...)
+			break
+		}
+	}
+	c.proxy.mu.Unlock()
+
+	for _, peer := range c.srv.roomPeers(c) {
+		peer.dropForwarded(func(f *forwardedTrack) bool { return f == ft })
+	}
+}
+
+// leaveForwarding разрывает пересылку между ушедшим клиентом и
+// оставшимися участниками комнаты
+func leaveForwarding(client *Client, peers []*Client) {
+	for _, peer := range peers {
+		peer.dropForwarded(func(f *forwardedTrack) bool { return f.from == client })
+	}
+	client.dropForwarded(func(*forwardedTrack) bool { return true })
+}
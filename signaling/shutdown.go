@@ -0,0 +1,79 @@
+package signaling
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// drainClients предупреждает клиентов о выключении и ждет, пока они
+// отключатся сами, но не дольше DRAIN_TIMEOUT
+func (s *Server) drainClients() {
+	s.expireParkedSessions()
+	list := s.clients.snapshot()
+	slog.Info("draining clients", "clients", len(list), "timeout", s.cfg.DrainTimeout.String())
+	s.broadcast(list, map[string]interface{}{
+		"type":         "server-closing",
+		"drainTimeout": int(s.cfg.DrainTimeout.Seconds()),
+	})
+
+	deadline := time.After(s.cfg.DrainTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for len(s.clients.snapshot()) > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			slog.Warn("drain timeout", "clients", len(s.clients.snapshot()))
+			return
+		}
+	}
+	slog.Info("all clients left during drain")
+}
+
+// waitHandlers ждет завершения обработчиков WebSocket после закрытия
+// клиентов
+func (s *Server) waitHandlers(ctx context.Context) {
+	finished := make(chan struct{})
+	go func() {
+		s.wsHandlers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		slog.Warn("shutdown timeout, some connection handlers are still running")
+	}
+}
+
+// closeAllClients сообщает клиентам о выключении и закрывает их сессии
+// параллельно, чтобы медленный клиент не задерживал остальных. Повторный
+// cleanupClient из цикла чтения ничего не делает благодаря closeOnce.
+func (s *Server) closeAllClients(ctx context.Context) {
+	list := s.clients.snapshot()
+	var wg sync.WaitGroup
+	for i, client := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.sendJSON(map[string]interface{}{
+				"type":       "server-shutdown",
+				"retryAfter": s.retryAfterSeconds(s.cfg.RetryAfter + s.reconnectDelay(i)),
+			})
+			s.cleanupClient(client)
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		slog.Info("clients closed", "clients", len(list))
+	case <-ctx.Done():
+		slog.Warn("shutdown timeout, some clients were not closed cleanly")
+	}
+}
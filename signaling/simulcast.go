@@ -0,0 +1,431 @@
+package signaling
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// Simulcast: клиент публикует один видеотрек несколькими слоями по rid
+// (RFC 8853), сервер отдает каждому подписчику один слой. Подписчик
+// выбирает его сам (setLayer) или доверяет выбор серверу ("auto"): тогда
+// слой определяет оценка полосы к подписчику — GCC по TWCC или REMB.
+// Переключение происходит на ключевом кадре нового слоя, номера пакетов и
+// метки времени переписываются, поэтому поток у подписчика непрерывен.
+
+const (
+	// Раз в сколько пересчитываются битрейты слоев и выбор "auto"
+	simulcastSampleInterval = time.Second
+	// Доля оценки полосы, которую может занять слой в режиме "auto"
+	simulcastHeadroom = 0.85
+	// Шаг метки времени при переключении: кадр при 30 fps и 90 кГц
+	simulcastFrameTicks = 3000
+)
+
+const ridAuto = "auto"
+
+// simulcastState — слои одного трека и выходы его подписчиков
+type simulcastState struct {
+	from    *Client
+	source  *webrtc.PeerConnection
+	trackID string
+	mime    string
+	// Единственный слой обычного видеотрека: выходы нужны только для
+	// управления перегрузкой, слои подписчику не объявляются
+	single bool
+
+	mu         sync.Mutex
+	layers     []*simulcastLayer // по возрастанию битрейта
+	outs       map[*Client]*layerOutput
+	lastSample time.Time
+}
+
+type simulcastLayer struct {
+	rid     string
+	remote  *webrtc.TrackRemote
+	bytes   uint64 // с последнего пересчета
+	bitrate int    // bps за последний интервал
+}
+
+// layerOutput — поток одного подписчика: свой трек, чтобы у каждого был
+// свой слой и своя нумерация пакетов
+type layerOutput struct {
+	local   *webrtc.TrackLocalStaticRTP
+	auto    bool
+	current string // rid слоя, который идет сейчас
+	target  string // rid слоя, на который переключаемся
+
+	// Пересылка приостановлена из-за перегрузки (CONGESTION_CONTROL);
+	// после нее поток продолжается с ключевого кадра (resync).
+	// throttledAt — когда ее последний раз приостановили или возобновили.
+	paused      bool
+	resync      bool
+	throttledAt time.Time
+
+	started   bool
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTS    uint32
+}
+
+func newSimulcastState(from *Client, source *webrtc.PeerConnection, track *webrtc.TrackRemote) *simulcastState {
+	return &simulcastState{
+		from:       from,
+		source:     source,
+		trackID:    track.ID(),
+		mime:       track.Codec().MimeType,
+		outs:       make(map[*Client]*layerOutput),
+		lastSample: time.Now(),
+	}
+}
+
+// addLayer добавляет слой; новому слою битрейт еще неизвестен, он встает
+// в конец до первого пересчета
+func (s *simulcastState) addLayer(track *webrtc.TrackRemote) {
+	s.mu.Lock()
+	s.layers = append(s.layers, &simulcastLayer{rid: track.RID(), remote: track})
+	var pli []uint32
+	for _, out := range s.outs {
+		if out.target == "" {
+			out.target = track.RID()
+			pli = append(pli, uint32(track.SSRC()))
+		}
+	}
+	subscribers := s.subscribers()
+	s.mu.Unlock()
+	s.requestKeyframes(pli)
+	for _, c := range subscribers {
+		s.announce(c)
+	}
+}
+
+// removeLayer убирает закончившийся слой и возвращает, сколько осталось.
+// Подписчики ушедшего слоя переходят на лучший из оставшихся.
+func (s *simulcastState) removeLayer(rid string) int {
+	s.mu.Lock()
+	s.layers = slices.DeleteFunc(s.layers, func(l *simulcastLayer) bool { return l.rid == rid })
+	var pli []uint32
+	for _, out := range s.outs {
+		if (out.current == rid || out.target == rid) && len(s.layers) > 0 {
+			top := s.layers[len(s.layers)-1]
+			out.target = top.rid
+			pli = append(pli, uint32(top.remote.SSRC()))
+		}
+	}
+	n := len(s.layers)
+	subscribers := s.subscribers()
+	s.mu.Unlock()
+	s.requestKeyframes(pli)
+	if n > 0 {
+		for _, c := range subscribers {
+			s.announce(c)
+		}
+	}
+	return n
+}
+
+// subscribers вызывается под s.mu
+func (s *simulcastState) subscribers() []*Client {
+	list := make([]*Client, 0, len(s.outs))
+	for c := range s.outs {
+		list = append(list, c)
+	}
+	return list
+}
+
+// announce сообщает подписчику, какие слои есть у трека, от нижнего к
+// верхнему
+func (s *simulcastState) announce(c *Client) {
+	if s.single {
+		return
+	}
+	c.sendJSON(map[string]interface{}{
+		"type":  "layers",
+		"from":  s.from.id,
+		"track": s.trackID,
+		"rids":  s.rids(),
+	})
+}
+
+func (s *simulcastState) layer(rid string) *simulcastLayer {
+	for _, l := range s.layers {
+		if l.rid == rid {
+			return l
+		}
+	}
+	return nil
+}
+
+func (s *simulcastState) rids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rids := make([]string, len(s.layers))
+	for i, l := range s.layers {
+		rids[i] = l.rid
+	}
+	return rids
+}
+
+// subscribe создает выход для подписчика в режиме "auto". При известной
+// оценке полосы он начинает с нижнего слоя и поднимается, иначе получает
+// верхний.
+func (s *simulcastState) subscribe(c *Client, template *webrtc.TrackLocalStaticRTP) (*webrtc.TrackLocalStaticRTP, error) {
+	local, err := webrtc.NewTrackLocalStaticRTP(template.Codec(), template.ID(), template.StreamID())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	out := &layerOutput{local: local, auto: true}
+	if len(s.layers) > 0 {
+		out.target = s.layers[len(s.layers)-1].rid
+		if c.downlinkEstimate() > 0 {
+			out.target = s.layers[0].rid
+		}
+	}
+	s.outs[c] = out
+	s.mu.Unlock()
+	s.announce(c)
+	return local, nil
+}
+
+func (s *simulcastState) unsubscribe(c *Client) {
+	s.mu.Lock()
+	delete(s.outs, c)
+	s.mu.Unlock()
+}
+
+// setLayer задает подписчику слой rid или "auto". false — такого слоя нет.
+func (s *simulcastState) setLayer(c *Client, rid string) bool {
+	s.mu.Lock()
+	out := s.outs[c]
+	if out == nil {
+		s.mu.Unlock()
+		return false
+	}
+	if rid == ridAuto {
+		out.auto = true
+		s.mu.Unlock()
+		return true
+	}
+	l := s.layer(rid)
+	if l == nil {
+		s.mu.Unlock()
+		return false
+	}
+	out.auto = false
+	if out.paused {
+		out.paused, out.resync = false, true
+	}
+	out.target = rid
+	ssrc := uint32(l.remote.SSRC())
+	switching := out.current != rid || out.resync
+	s.mu.Unlock()
+	if switching {
+		s.requestKeyframes([]uint32{ssrc})
+	}
+	return true
+}
+
+// write отдает пакет слоя rid подписчикам этого слоя
+func (s *simulcastState) write(rid string, pkt *rtp.Packet) {
+	s.mu.Lock()
+	if l := s.layer(rid); l != nil {
+		l.bytes += uint64(pkt.MarshalSize())
+	}
+	var pli []uint32
+	var reordered bool
+	var congestion []congestionEvent
+	if time.Since(s.lastSample) >= simulcastSampleInterval {
+		pli, reordered, congestion = s.sample()
+	}
+
+	var switched []*Client
+	for c, out := range s.outs {
+		if out.paused {
+			continue
+		}
+		if out.target == rid && (out.current != rid || out.resync) && isKeyframe(pkt, s.mime) {
+			if out.current != rid {
+				switched = append(switched, c)
+			}
+			out.switchTo(rid, pkt)
+		}
+		if out.current == rid && !out.resync {
+			out.forward(pkt)
+		}
+	}
+	var subscribers []*Client
+	if reordered {
+		subscribers = s.subscribers()
+	}
+	s.mu.Unlock()
+
+	s.requestKeyframes(pli)
+	for _, c := range subscribers {
+		s.announce(c)
+	}
+	for _, e := range congestion {
+		s.notifyCongestion(e)
+	}
+	if s.single {
+		return
+	}
+	for _, c := range switched {
+		c.sendJSON(map[string]interface{}{
+			"type":  "layer-changed",
+			"from":  s.from.id,
+			"track": s.trackID,
+			"rid":   rid,
+		})
+	}
+}
+
+// sample пересчитывает битрейты, упорядочивает слои и выбирает слой
+// подписчикам "auto". Возвращает SSRC слоев, от которых ждут ключевой
+// кадр, изменился ли порядок слоев и чья пересылка приостановлена или
+// возобновлена. Вызывается под s.mu.
+func (s *simulcastState) sample() ([]uint32, bool, []congestionEvent) {
+	elapsed := time.Since(s.lastSample).Seconds()
+	s.lastSample = time.Now()
+	for _, l := range s.layers {
+		l.bitrate = int(float64(l.bytes*8) / elapsed)
+		l.bytes = 0
+	}
+	before := slices.Clone(s.layers)
+	slices.SortStableFunc(s.layers, func(a, b *simulcastLayer) int { return a.bitrate - b.bitrate })
+	reordered := !slices.Equal(before, s.layers)
+
+	var pli []uint32
+	var congestion []congestionEvent
+	for c, out := range s.outs {
+		estimate := c.downlinkEstimate()
+		if out.auto && s.from.srv.cfg.CongestionControl {
+			if paused, changed := s.throttle(out, estimate); changed {
+				congestion = append(congestion, congestionEvent{c, paused, estimate})
+			}
+		}
+		if out.auto && !out.paused {
+			if l := s.fitting(estimate); l != nil {
+				out.target = l.rid
+			}
+		}
+		// Переключение еще ждет ключевого кадра: просим снова
+		if !out.paused && (out.target != out.current || out.resync) {
+			if l := s.layer(out.target); l != nil {
+				pli = append(pli, uint32(l.remote.SSRC()))
+			}
+		}
+	}
+	return pli, reordered, congestion
+}
+
+// fitting — верхний слой, который помещается в оценку полосы, или
+// нижний, если не помещается ни один. Без оценки — верхний.
+func (s *simulcastState) fitting(estimate int) *simulcastLayer {
+	if len(s.layers) == 0 {
+		return nil
+	}
+	if estimate <= 0 {
+		return s.layers[len(s.layers)-1]
+	}
+	best := s.layers[0]
+	for _, l := range s.layers[1:] {
+		if float64(l.bitrate) <= float64(estimate)*simulcastHeadroom {
+			best = l
+		}
+	}
+	return best
+}
+
+// requestKeyframe просит ключевой кадр у всех слоев
+func (s *simulcastState) requestKeyframe() {
+	s.mu.Lock()
+	ssrcs := make([]uint32, len(s.layers))
+	for i, l := range s.layers {
+		ssrcs[i] = uint32(l.remote.SSRC())
+	}
+	s.mu.Unlock()
+	s.requestKeyframes(ssrcs)
+}
+
+func (s *simulcastState) requestKeyframes(ssrcs []uint32) {
+	if len(ssrcs) == 0 {
+		return
+	}
+	slices.Sort(ssrcs)
+	ssrcs = slices.Compact(ssrcs)
+	packets := make([]rtcp.Packet, len(ssrcs))
+	for i, ssrc := range ssrcs {
+		packets[i] = &rtcp.PictureLossIndication{MediaSSRC: ssrc}
+	}
+	s.source.WriteRTCP(packets)
+}
+
+// switchTo начинает слой rid с ключевого кадра pkt так, чтобы его номера
+// и метки времени продолжали уже отданные подписчику
+func (o *layerOutput) switchTo(rid string, pkt *rtp.Packet) {
+	if o.started {
+		o.seqOffset = o.lastSeq + 1 - pkt.SequenceNumber
+		o.tsOffset = o.lastTS + simulcastFrameTicks - pkt.Timestamp
+	}
+	o.current = rid
+	o.resync = false
+}
+
+func (o *layerOutput) forward(pkt *rtp.Packet) {
+	p := *pkt
+	p.SequenceNumber += o.seqOffset
+	p.Timestamp += o.tsOffset
+	o.lastSeq, o.lastTS, o.started = p.SequenceNumber, p.Timestamp, true
+	o.local.WriteRTP(&p)
+}
+
+// downlinkEstimate — оценка полосы к клиенту: GCC, если он включен,
+// иначе последний REMB клиента; 0 — оценки нет
+func (c *Client) downlinkEstimate() int {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.bwe > 0 {
+		return c.bwe
+	}
+	return c.remb
+}
+
+func (c *Client) noteREMB(p *rtcp.ReceiverEstimatedMaximumBitrate) {
+	c.statsMu.Lock()
+	c.remb = int(p.Bitrate)
+	c.statsMu.Unlock()
+}
+
+// handleSetLayer — {"type":"setLayer","track":...,"rid":"h"}: слой
+// simulcast-трека, который нужен подписчику, или "auto". from уточняет
+// отправителя, если id треков у участников совпадают.
+func (s *Server) handleSetLayer(client *Client, m setLayerMessage) {
+	if !s.forwardsMedia() {
+		client.sendError("NOT_SUPPORTED", "layers are only selectable when the server forwards media")
+		return
+	}
+	client.proxy.mu.Lock()
+	var found *forwardedTrack
+	for _, ft := range client.proxy.senders {
+		if ft != nil && ft.simulcast != nil && !ft.simulcast.single && ft.local.ID() == m.Track && (m.From == "" || ft.from.id == m.From) {
+			found = ft
+			break
+		}
+	}
+	client.proxy.mu.Unlock()
+	if found == nil {
+		client.sendError("UNKNOWN_TRACK", "no simulcast track "+m.Track+" among subscriptions")
+		return
+	}
+	if !found.simulcast.setLayer(client, m.RID) {
+		client.sendError("UNKNOWN_LAYER", "track "+m.Track+" has no layer "+m.RID)
+		return
+	}
+	client.logger.Info("layer requested", "from", found.from.id, "track", m.Track, "rid", m.RID)
+}
@@ -0,0 +1,23 @@
+package signaling
+
+// negotiatedSRTPProfile возвращает профиль, о котором договорится DTLS.
+// pion не отдает выбранный профиль наружу, поэтому он известен только
+// когда в SRTP_PROFILES разрешен ровно один.
+func (s *Server) negotiatedSRTPProfile() string {
+	if len(s.cfg.SRTPProfiles) == 1 {
+		return s.cfg.SRTPProfiles[0]
+	}
+	return ""
+}
+
+// recordSRTPProfile запоминает профиль после успешного DTLS-рукопожатия
+func (c *Client) recordSRTPProfile() {
+	profile := c.srv.negotiatedSRTPProfile()
+	if profile == "" {
+		return
+	}
+	c.statsMu.Lock()
+	c.srtpProfile = profile
+	c.statsMu.Unlock()
+	c.logger.Info("DTLS connected", "srtp", profile)
+}
@@ -0,0 +1,201 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type clientStats struct {
+	ID               string                  `json:"id"`
+	RemoteAddr       string                  `json:"remoteAddr"`
+	Tenant           string                  `json:"tenant,omitempty"`
+	Room             string                  `json:"room,omitempty"`
+	Role             string                  `json:"role,omitempty"`
+	ConnectedAt      time.Time               `json:"connectedAt"`
+	Codecs           map[string]string       `json:"codecs"`
+	DataChannels     int                     `json:"dataChannels"`
+	Bundle           string                  `json:"bundle"`
+	ICELite          bool                    `json:"iceLite"`
+	TCPFallback      bool                    `json:"tcpFallback"`
+	TCPRelay         bool                    `json:"tcpRelay"`
+	Renegotiations   int                     `json:"renegotiations"`
+	ICERestarts      int                     `json:"iceRestarts"`
+	ICERecoveries    int                     `json:"iceRestartAttempts"`
+	BWE              int                     `json:"bweBps,omitempty"`
+	GatherLatency    map[string]latencyStats `json:"gatherLatency,omitempty"`
+	HeaderExtensions map[string][]string     `json:"headerExtensions,omitempty"`
+	SRTPProfile      string                  `json:"srtpProfile,omitempty"`
+	Failure          setupFailure            `json:"failure,omitempty"`
+	Features         []string                `json:"features,omitempty"`
+	Keyframes        []keyframeStats         `json:"keyframes,omitempty"`
+	Playback         *playbackStats          `json:"playback,omitempty"`
+	Quality          *qualityStats           `json:"quality,omitempty"`
+	Proxy            *proxyStats             `json:"proxy,omitempty"`
+	Downlink         *downlinkStats          `json:"downlink,omitempty"`
+	DCCompression    *compressionStats       `json:"dcCompression,omitempty"`
+}
+
+type playbackStats struct {
+	Playing bool `json:"playing"`
+	Reports int  `json:"reports"`
+	Blocked int  `json:"blocked"`
+}
+
+func (c *Client) reportPlayback(playing bool) {
+	c.statsMu.Lock()
+	first := c.playbackReports == 0
+	firstBlock := !playing && c.playbackBlocked == 0
+	c.mediaPlaying = &playing
+	c.playbackReports++
+	if !playing {
+		c.playbackBlocked++
+	}
+	c.statsMu.Unlock()
+
+	if first {
+		c.srv.playbackSessionsReported.Add(1)
+	}
+	if firstBlock {
+		c.srv.playbackSessionsBlocked.Add(1)
+		c.logger.Info("playback blocked")
+	}
+}
+
+func (c *Client) setCodec(kind, mimeType string) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.codecs == nil {
+		c.codecs = make(map[string]string)
+	}
+	c.codecs[kind] = mimeType
+}
+
+func (c *Client) addKeyframeTracker(trackID string) *keyframeTracker {
+	k := &keyframeTracker{trackID: trackID}
+	c.statsMu.Lock()
+	c.keyframes = append(c.keyframes, k)
+	c.statsMu.Unlock()
+	return k
+}
+
+func (c *Client) stats() clientStats {
+	downlink := c.downlinkStats()
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	codecs := make(map[string]string, len(c.codecs))
+	for kind, mimeType := range c.codecs {
+		codecs[kind] = mimeType
+	}
+
+	var keyframes []keyframeStats
+	for _, k := range c.keyframes {
+		keyframes = append(keyframes, k.stats())
+	}
+
+	var features []string
+	for name := range c.features {
+		features = append(features, name)
+	}
+	sort.Strings(features)
+
+	var playback *playbackStats
+	if c.mediaPlaying != nil {
+		playback = &playbackStats{
+			Playing: *c.mediaPlaying,
+			Reports: c.playbackReports,
+			Blocked: c.playbackBlocked,
+		}
+	}
+	proxy := c.proxyStats()
+	var room, role string
+	if r := c.currentRoom(); r != nil {
+		room, role = r.ID, rolePublisher
+		if c.viewer.Load() {
+			role = roleViewer
+		}
+	}
+
+	return clientStats{
+		ID:               c.id,
+		RemoteAddr:       c.remoteAddr,
+		Tenant:           c.tenant,
+		Room:             room,
+		Role:             role,
+		ConnectedAt:      c.connectedAt,
+		Codecs:           codecs,
+		DataChannels:     int(c.dataChannels.Load()),
+		Bundle:           c.bundle,
+		ICELite:          c.iceLite,
+		TCPFallback:      c.tcpFallback,
+		TCPRelay:         c.tcpRelay,
+		Renegotiations:   c.renegotiations,
+		ICERestarts:      c.iceRestarts,
+		ICERecoveries:    c.iceRecoveries,
+		BWE:              c.bwe,
+		GatherLatency:    latencyMap(c.gatherLatency),
+		HeaderExtensions: c.headerExtensions,
+		SRTPProfile:      c.srtpProfile,
+		Failure:          c.failure,
+		Features:         features,
+		Keyframes:        keyframes,
+		Playback:         playback,
+		Quality:          c.quality,
+		Proxy:            proxy,
+		Downlink:         downlink,
+		DCCompression:    c.dcCompression.stats(),
+	}
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	active := s.clients.snapshot()
+	list := make([]clientStats, 0, len(active))
+	tenants := make(map[string]int)
+	for _, client := range active {
+		list = append(list, client.stats())
+		if client.tenant != "" {
+			tenants[client.tenant]++
+		}
+	}
+
+	type roomRoleStats struct {
+		Publishers int `json:"publishers"`
+		Viewers    int `json:"viewers"`
+	}
+	rooms := make(map[string]roomRoleStats)
+	for _, info := range s.rooms.List() {
+		var st roomRoleStats
+		st.Publishers, st.Viewers = roomRoles(info.Members)
+		rooms[info.Room.ID] = st
+	}
+
+	reported := s.playbackSessionsReported.Load()
+	blocked := s.playbackSessionsBlocked.Load()
+	var blockedRate float64
+	if reported > 0 {
+		blockedRate = float64(blocked) / float64(reported)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":   len(list),
+		"clients": list,
+		"playback": map[string]interface{}{
+			"sessionsReported": reported,
+			"sessionsBlocked":  blocked,
+			"blockedRate":      blockedRate,
+		},
+		"failures":      s.setupFailureStats(),
+		"tenants":       tenants,
+		"rooms":         rooms,
+		"tcpRelay":      s.tcpRelaySessions.Load(),
+		"gatherLatency": s.gatherLatencyStats(),
+		"proxyBytes":    s.proxyForwardedBytes.Load(),
+		"dcCompression": s.dcCompression.stats(),
+	}); err != nil {
+		slog.Warn("stats encode error", "err", err)
+	}
+}
@@ -0,0 +1,50 @@
+package signaling
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// trackTCPRelay следит за выбранной парой кандидатов сессии
+func (s *Server) trackTCPRelay(client *Client, pc *webrtc.PeerConnection) {
+	pc.SCTP().Transport().ICETransport().OnSelectedCandidatePairChange(func(pair *webrtc.ICECandidatePair) {
+		client.statsMu.Lock()
+		relay := client.tcpFallback && pair != nil && pair.Remote != nil && pair.Remote.Typ == webrtc.ICECandidateTypeRelay
+		changed := relay != client.tcpRelay
+		client.tcpRelay = relay
+		client.statsMu.Unlock()
+
+		if !changed {
+			return
+		}
+		if relay {
+			n := s.tcpRelaySessions.Add(1)
+			client.logger.Info("session uses TCP relay", "active", n)
+		} else {
+			s.tcpRelaySessions.Add(-1)
+		}
+	})
+}
+
+// releaseTCPRelay снимает сессию со счета при отключении
+func (s *Server) releaseTCPRelay(client *Client) {
+	client.statsMu.Lock()
+	relay := client.tcpRelay
+	client.tcpRelay = false
+	client.statsMu.Unlock()
+	if relay {
+		s.tcpRelaySessions.Add(-1)
+	}
+}
+
+// tcpRelayURLs выбирает TURN для перехода на TCP. Когда TCP-релеев уже
+// TCP_RELAY_LIMIT, новые сессии уводятся на запасной TURN, а без него —
+// остаются на UDP (перехода нет).
+func (s *Server) tcpRelayURLs() ([]string, bool) {
+	if s.cfg.TCPRelayLimit == 0 || s.tcpRelaySessions.Load() < int64(s.cfg.TCPRelayLimit) {
+		return s.cfg.TURNTCPURLs, true
+	}
+	if len(s.cfg.TURNTCPSecondaryURLs) > 0 {
+		return s.cfg.TURNTCPSecondaryURLs, true
+	}
+	return nil, false
+}
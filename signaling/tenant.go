@@ -0,0 +1,23 @@
+package signaling
+
+import (
+	"slices"
+
+	"go-webrtc/config"
+)
+
+// clientTenant берет арендатора из claim tenant токена, а без него — из
+// ?tenant= при подключении. Пусто, если TENANTS не задан.
+func (s *Server) clientTenant(claims Claims, query string) string {
+	if len(s.cfg.Tenants) == 0 {
+		return ""
+	}
+	tenant := claims.Tenant()
+	if tenant == "" {
+		tenant = query
+	}
+	if slices.Contains(s.cfg.Tenants, tenant) {
+		return tenant
+	}
+	return config.TenantOther
+}
@@ -0,0 +1,84 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// Событий в хронологии одной сессии, лишние отбрасываются
+	maxTimelineEvents = 64
+	// Сколько закрытых сессий держать для диагностики
+	maxClosedSessions = 100
+)
+
+type timelineEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+}
+
+type sessionDiagnostics struct {
+	Stats    clientStats     `json:"stats"`
+	Timeline []timelineEvent `json:"timeline"`
+}
+
+func (c *Client) event(name string) {
+	c.statsMu.Lock()
+	if len(c.timeline) < maxTimelineEvents {
+		c.timeline = append(c.timeline, timelineEvent{Event: name, Time: time.Now()})
+	}
+	c.statsMu.Unlock()
+	c.srv.events.publish(name, c.id, nil)
+}
+
+func (c *Client) diagnostics() sessionDiagnostics {
+	stats := c.stats()
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return sessionDiagnostics{
+		Stats:    stats,
+		Timeline: append([]timelineEvent(nil), c.timeline...),
+	}
+}
+
+func (s *Server) rememberClosed(client *Client) {
+	d := client.diagnostics()
+	s.closedSessionsMu.Lock()
+	defer s.closedSessionsMu.Unlock()
+	if len(s.closedSessions) == maxClosedSessions {
+		s.closedSessions = s.closedSessions[1:]
+	}
+	s.closedSessions = append(s.closedSessions, d)
+}
+
+// findSession ищет сессию по id среди активных, затем среди закрытых
+func (s *Server) findSession(id string) (sessionDiagnostics, bool) {
+	if client := s.clients.get(id); client != nil {
+		return client.diagnostics(), true
+	}
+
+	s.closedSessionsMu.Lock()
+	defer s.closedSessionsMu.Unlock()
+	for i := len(s.closedSessions) - 1; i >= 0; i-- {
+		if s.closedSessions[i].Stats.ID == id {
+			return s.closedSessions[i], true
+		}
+	}
+	return sessionDiagnostics{}, false
+}
+
+// handleDiagnostics отдает статистику и хронологию сессии: GET /diagnostics?id=
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.findSession(r.URL.Query().Get("id"))
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d); err != nil {
+		slog.Warn("diagnostics encode error", "err", err)
+	}
+}
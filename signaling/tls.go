@@ -0,0 +1,72 @@
+package signaling
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newTLSConfig собирает tls.Config из уже проверенных настроек. С
+// autocert сертификаты выдает и продлевает manager.
+func (s *Server) newTLSConfig(manager *autocert.Manager) *tls.Config {
+	config := s.cfg.TLSConfig()
+	if manager != nil {
+		config.GetCertificate = manager.GetCertificate
+		// Проверка tls-alpn-01 идет на тот же порт, что и HTTPS
+		config.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	}
+	return config
+}
+
+// newAutocertManager — получение сертификатов Let's Encrypt для
+// TLS_AUTOCERT_DOMAINS, nil без autocert
+func (s *Server) newAutocertManager() *autocert.Manager {
+	if len(s.cfg.TLSAutocertDomains) == 0 {
+		return nil
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(s.cfg.TLSAutocertDomains...),
+		Email:      s.cfg.TLSAutocertEmail,
+	}
+	if s.cfg.TLSAutocertCache != "" {
+		m.Cache = autocert.DirCache(s.cfg.TLSAutocertCache)
+	}
+	return m
+}
+
+// serve запускает server по HTTPS, если TLS настроен, иначе по HTTP.
+// Возвращает ошибку как ListenAndServe.
+func (s *Server) serve(server *http.Server, name string) error {
+	if !s.cfg.TLSEnabled() {
+		slog.Info("server starting", "server", name, "addr", server.Addr)
+		return server.ListenAndServe()
+	}
+	slog.Info("server starting", "server", name, "addr", server.Addr, "tls", s.cfg.TLSMinVersion+"+")
+	// С autocert сертификат отдает GetCertificate, файлы не нужны
+	return server.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+}
+
+// redirectToHTTPS перенаправляет обычный HTTP на тот же путь по HTTPS на
+// порту LISTEN_ADDR. С autocert сначала отвечает на проверки http-01.
+func (s *Server) redirectToHTTPS(manager *autocert.Manager) http.Handler {
+	_, port, _ := net.SplitHostPort(s.cfg.ListenAddr)
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if manager != nil {
+		return manager.HTTPHandler(redirect)
+	}
+	return redirect
+}
@@ -0,0 +1,76 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	errTokenMissing = errors.New("token missing")
+	errTokenExpired = errors.New("token expired")
+	errTokenInvalid = errors.New("token invalid")
+)
+
+// validateToken проверяет токен запроса (см. requestToken): JWT (HS256)
+// или ключ из AUTH_API_KEYS, и возвращает claims; идентичность клиента
+// — sub. В JWT sub и exp обязательны.
+func (s *Server) validateToken(r *http.Request) (Claims, error) {
+	token, _ := requestToken(r)
+	if token == "" {
+		return nil, errTokenMissing
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		if len(s.cfg.AuthAPIKeys) > 0 {
+			return s.validateAPIKey(token)
+		}
+		return nil, errTokenInvalid
+	}
+	if s.cfg.AuthTokenSecret == "" {
+		return nil, errTokenInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, errTokenInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+	mac := hmac.New(sha256.New, []byte(s.cfg.AuthTokenSecret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errTokenInvalid
+	}
+
+	var claims Claims
+	if err := decodeTokenPart(parts[1], &claims); err != nil || claims.Subject() == "" {
+		return nil, errTokenInvalid
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || exp == 0 {
+		return nil, errTokenInvalid
+	}
+	if float64(time.Now().Unix()) >= exp {
+		return claims, errTokenExpired
+	}
+	return claims, nil
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
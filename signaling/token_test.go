@@ -0,0 +1,175 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"go-webrtc/config"
+)
+
+const testTokenSecret = "token-secret-0123456789abcdef0123"
+
+// signToken собирает JWT с заголовком header и claims, подписанный
+// HMAC-SHA256 ключом secret
+func signToken(t *testing.T, secret string, header, claims map[string]interface{}) string {
+	t.Helper()
+	part := func(v interface{}) string {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	signed := part(header) + "." + part(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func testToken(t *testing.T, claims map[string]interface{}) string {
+	return signToken(t, testTokenSecret, map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims)
+}
+
+func tokenServer(t *testing.T) (*Server, *httptest.Server) {
+	return newTestServer(t, func(c *config.Config) {
+		c.AuthMode = "token"
+		c.AuthTokenSecret = testTokenSecret
+	})
+}
+
+func TestValidateToken(t *testing.T) {
+	s, _ := tokenServer(t)
+	future := float64(time.Now().Add(time.Hour).Unix())
+	past := float64(time.Now().Add(-time.Hour).Unix())
+
+	valid := testToken(t, map[string]interface{}{"sub": "alice", "exp": future})
+	parts := strings.Split(valid, ".")
+	tamperedClaims, _ := json.Marshal(map[string]interface{}{"sub": "mallory", "exp": future})
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(tamperedClaims) + "." + parts[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantSub string
+		wantErr error
+	}{
+		{"valid", valid, "alice", nil},
+		{"expired", testToken(t, map[string]interface{}{"sub": "alice", "exp": past}), "alice", errTokenExpired},
+		{"missing exp", testToken(t, map[string]interface{}{"sub": "alice"}), "", errTokenInvalid},
+		{"missing sub", testToken(t, map[string]interface{}{"exp": future}), "", errTokenInvalid},
+		{"tampered claims", tampered, "", errTokenInvalid},
+		{"wrong secret", signToken(t, "other-secret", map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice", "exp": future}), "", errTokenInvalid},
+		{"alg none", signToken(t, testTokenSecret, map[string]interface{}{"alg": "none"}, map[string]interface{}{"sub": "alice", "exp": future}), "", errTokenInvalid},
+		{"alg HS512", signToken(t, testTokenSecret, map[string]interface{}{"alg": "HS512"}, map[string]interface{}{"sub": "alice", "exp": future}), "", errTokenInvalid},
+		{"not a JWT", "garbage", "", errTokenInvalid},
+		{"no token", "", "", errTokenMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			claims, err := s.validateToken(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantSub != "" && claims.Subject() != tt.wantSub {
+				t.Fatalf("sub = %q, want %q", claims.Subject(), tt.wantSub)
+			}
+		})
+	}
+}
+
+func TestRequestTokenSources(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws?token=q", nil)
+	if token, viaProtocol := requestToken(r); token != "q" || viaProtocol {
+		t.Fatalf("query token = %q, %v", token, viaProtocol)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "bearer, p")
+	if token, viaProtocol := requestToken(r); token != "p" || !viaProtocol {
+		t.Fatalf("subprotocol token = %q, %v", token, viaProtocol)
+	}
+}
+
+// expectClose ждет close-фрейм с кодом code
+func expectClose(t *testing.T, ws *websocket.Conn, code int) {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) {
+			t.Fatalf("read error %v, want close %d", err, code)
+		}
+		if ce.Code != code {
+			t.Fatalf("close code %d (%s), want %d", ce.Code, ce.Text, code)
+		}
+		return
+	}
+}
+
+func TestWebSocketAuthCloseCodes(t *testing.T) {
+	_, ts := tokenServer(t)
+	future := float64(time.Now().Add(time.Hour).Unix())
+
+	t.Run("no token", func(t *testing.T) {
+		expectClose(t, dialWS(t, ts, ""), closeUnauthorized)
+	})
+	t.Run("expired", func(t *testing.T) {
+		token := testToken(t, map[string]interface{}{"sub": "alice", "exp": float64(time.Now().Add(-time.Minute).Unix())})
+		expectClose(t, dialWS(t, ts, "token="+token), closeUnauthorized)
+	})
+	t.Run("room not allowed", func(t *testing.T) {
+		token := testToken(t, map[string]interface{}{"sub": "alice", "exp": future, "rooms": []string{"allowed"}})
+		expectClose(t, dialWS(t, ts, "room=other&token="+token), closeForbidden)
+	})
+	t.Run("valid", func(t *testing.T) {
+		token := testToken(t, map[string]interface{}{"sub": "alice", "exp": future, "rooms": []string{"allowed"}})
+		ws := dialWS(t, ts, "room=allowed&token="+token)
+		readType(t, ws, "state")
+	})
+	t.Run("plain HTTP gets 401", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/ws")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("status %d, want 401", resp.StatusCode)
+		}
+	})
+}
+
+// Арендатор из claim tenant важнее ?tenant=, неизвестный считается как
+// other
+func TestTenantFromClaims(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.AuthMode = "token"
+		c.AuthTokenSecret = testTokenSecret
+		c.Tenants = []string{"acme", "globex"}
+	})
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	dialWS(t, ts, "tenant=globex&token="+testToken(t, map[string]interface{}{"sub": "a", "exp": exp, "tenant": "acme"}))
+	dialWS(t, ts, "tenant=globex&token="+testToken(t, map[string]interface{}{"sub": "b", "exp": exp}))
+	dialWS(t, ts, "token="+testToken(t, map[string]interface{}{"sub": "c", "exp": exp, "tenant": "initech"}))
+
+	waitMetric(t, ts, `webrtc_clients{tenant="acme"}`, "1")
+	waitMetric(t, ts, `webrtc_clients{tenant="globex"}`, "1")
+	waitMetric(t, ts, `webrtc_clients{tenant="other"}`, "1")
+}
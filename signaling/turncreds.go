@@ -0,0 +1,115 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// turnCredentialsFor возвращает логин и пароль TURN для клиента. С
+// TURN_SECRET каждому клиенту выдаются свои временные данные с его id в
+// логине, без секрета — общие TURN_USERNAME и TURN_CREDENTIAL.
+func (s *Server) turnCredentialsFor(client *Client) (username, credential string) {
+	if s.cfg.TURNSecret == "" {
+		return s.cfg.TURNUsername, s.cfg.TURNCredential
+	}
+	return generateTURNCredentials(s.cfg.TURNSecret, s.cfg.TURNCredentialTTL, client.id)
+}
+
+// generateTURNCredentials выдает временные учетные данные по схеме TURN
+// REST API (use-auth-secret в coturn): логин — unix-время истечения,
+// через ":" с user, если он задан; пароль — base64(HMAC-SHA1(secret, логин)).
+func generateTURNCredentials(secret string, ttl time.Duration, user string) (username, credential string) {
+	username = strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	if user != "" {
+		username += ":" + user
+	}
+	return username, turnRESTPassword(secret, username)
+}
+
+// turnRESTPassword — пароль TURN REST API для логина
+func turnRESTPassword(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// handleGetICEServers отдает клиенту его ICE-серверы, чтобы он мог
+// передать их своему RTCPeerConnection без сервера в роли пира
+func (s *Server) handleGetICEServers(client *Client) {
+	reply := map[string]interface{}{
+		"type":       "ice-servers",
+		"iceServers": s.iceServersFor(client),
+	}
+	if s.cfg.TURNSecret != "" && (len(s.cfg.TURNURLTemplates) > 0 || s.cfg.TURNServerPort > 0) {
+		reply["ttl"] = int(s.cfg.TURNCredentialTTL.Seconds())
+	}
+	client.sendJSON(reply)
+}
+
+// handleTURNCredentials выдает временные учетные данные TURN по HTTP в
+// формате TURN REST API (username, password, ttl, uris) вместе с полным
+// списком ICE-серверов — для клиентов, которым они нужны до WebSocket.
+// Аутентификация и проверка Origin те же, что у /ws: токен в режиме
+// token, ключ PSK как Bearer в режиме psk, страницы с чужих origin без
+// WS_ALLOWED_ORIGINS получают 403, даже если CORS их пропускает.
+func (s *Server) handleTURNCredentials(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.TURNSecret == "" {
+		http.Error(w, "TURN_SECRET is not configured", http.StatusNotFound)
+		return
+	}
+	if !s.checkOrigin(r) {
+		slog.Info("rejecting TURN credentials: origin not allowed", "remote", r.RemoteAddr, "origin", r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	ip := s.clientIP(r)
+	if s.cfg.ConnectRatePerIP > 0 && !s.connectLimiters.allow(ip) {
+		s.rejectBusy(w, http.StatusTooManyRequests, "too many requests", time.Duration(float64(time.Second)/s.cfg.ConnectRatePerIP))
+		return
+	}
+
+	claims, ok := s.authenticateHTTP(w, r)
+	if !ok {
+		return
+	}
+	user := newClientID()
+	if s.cfg.AuthMode == "token" {
+		user = claims.Subject()
+	}
+
+	// Учетные данные и шаблоны считаются как для клиента WebSocket,
+	// только с пользователем вместо id подключения
+	client := &Client{srv: s, id: user, remoteAddr: r.RemoteAddr, region: clientRegion(r)}
+	client.logger = newClientLogger(client, requestCorrelationID(r))
+	servers := s.iceServersFor(client)
+	var username, credential string
+	var uris []string
+	for _, server := range servers {
+		if secret, ok := server.Credential.(string); ok && server.Username != "" {
+			username, credential = server.Username, secret
+			uris = server.URLs
+		}
+	}
+	if username == "" {
+		username, credential = s.turnCredentialsFor(client)
+	}
+	slog.Info("TURN credentials issued", "remote", ip, "username", username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"username":   username,
+		"password":   credential,
+		"ttl":        int(s.cfg.TURNCredentialTTL.Seconds()),
+		"uris":       uris,
+		"iceServers": servers,
+	}); err != nil {
+		slog.Warn("TURN credentials encode error", "err", err)
+	}
+}
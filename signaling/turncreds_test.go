@@ -0,0 +1,108 @@
+package signaling
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-webrtc/config"
+)
+
+// Пароли посчитаны независимо, как это делает coturn с use-auth-secret:
+// printf '1700000000:alice' | openssl dgst -sha1 -hmac coturn-secret -binary | base64
+func TestTURNRESTPassword(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"1700000000:alice", "xDhekumuF8MOMl2uq3DuHW5R3Es="},
+		{"1700000000", "5wcUxQPFvVqsA3zUYmtz9OvlArE="},
+	}
+	for _, tt := range tests {
+		if got := turnRESTPassword("coturn-secret", tt.username); got != tt.want {
+			t.Errorf("turnRESTPassword(%q) = %q, want %q", tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateTURNCredentials(t *testing.T) {
+	ttl := time.Hour
+	before := time.Now().Add(ttl).Unix()
+	username, credential := generateTURNCredentials("coturn-secret", ttl, "alice")
+	after := time.Now().Add(ttl).Unix()
+
+	expiry, user, ok := strings.Cut(username, ":")
+	if !ok || user != "alice" {
+		t.Fatalf("username %q, want <expiry>:alice", username)
+	}
+	ts, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || ts < before || ts > after {
+		t.Fatalf("expiry %q, want unix time in [%d, %d]", expiry, before, after)
+	}
+	if want := turnRESTPassword("coturn-secret", username); credential != want {
+		t.Fatalf("credential %q, want %q", credential, want)
+	}
+
+	username, _ = generateTURNCredentials("coturn-secret", ttl, "")
+	if strings.Contains(username, ":") {
+		t.Fatalf("username %q without user must be just the expiry", username)
+	}
+}
+
+func TestTURNCredentialsForStaticAndSecret(t *testing.T) {
+	s, _ := newTestServer(t, func(c *config.Config) {
+		c.TURNUsername = "user1"
+		c.TURNCredential = "pass1"
+	})
+	client := &Client{srv: s, id: "c1"}
+	if u, p := s.turnCredentialsFor(client); u != "user1" || p != "pass1" {
+		t.Fatalf("static credentials = %q/%q", u, p)
+	}
+
+	s, _ = newTestServer(t, func(c *config.Config) {
+		c.TURNSecret = "coturn-secret"
+	})
+	client = &Client{srv: s, id: "c1"}
+	u, p := s.turnCredentialsFor(client)
+	if !strings.HasSuffix(u, ":c1") || p != turnRESTPassword("coturn-secret", u) {
+		t.Fatalf("REST credentials = %q/%q", u, p)
+	}
+}
+
+// /turn-credentials проверяет Origin, как /ws: CORS по умолчанию
+// разрешает любой origin, но чужие страницы данные TURN не получают
+func TestTURNCredentialsOrigin(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.TURNSecret = "coturn-secret"
+	})
+	tests := []struct {
+		name   string
+		origin string
+		status int
+	}{
+		{"no origin", "", http.StatusOK},
+		{"same origin", ts.URL, http.StatusOK},
+		{"cross origin", "https://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/turn-credentials", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package signaling
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v2"
+)
+
+// Встроенный TURN/STUN-сервер для установки на одной машине без coturn.
+// Слушает TURN_SERVER_PORT по UDP и TCP, пускает по тем же учетным
+// данным, что выдает /turn-credentials, а ICE-конфигурация клиентов
+// сама указывает на него.
+
+// startTURNServer запускает встроенный TURN, если задан TURN_SERVER_PORT
+func (s *Server) startTURNServer() error {
+	if s.cfg.TURNServerPort == 0 {
+		return nil
+	}
+	addr := net.JoinHostPort("", strconv.Itoa(s.cfg.TURNServerPort))
+	udp, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return fmt.Errorf("listen udp %s: %w", addr, err)
+	}
+	tcp, err := net.Listen("tcp4", addr)
+	if err != nil {
+		udp.Close()
+		return fmt.Errorf("listen tcp %s: %w", addr, err)
+	}
+	relay := func() turn.RelayAddressGenerator {
+		return &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: net.ParseIP(s.cfg.TURNServerPublicIP),
+			Address:      "0.0.0.0",
+			MinPort:      uint16(s.cfg.TURNServerRelayMinPort),
+			MaxPort:      uint16(s.cfg.TURNServerRelayMaxPort),
+		}
+	}
+
+	s.turnServer, err = turn.NewServer(turn.ServerConfig{
+		Realm:             s.cfg.TURNServerRealm,
+		AuthHandler:       s.turnAuth,
+		LoggerFactory:     pionLoggerFactory{},
+		PacketConnConfigs: []turn.PacketConnConfig{{PacketConn: udp, RelayAddressGenerator: relay()}},
+		ListenerConfigs:   []turn.ListenerConfig{{Listener: tcp, RelayAddressGenerator: relay()}},
+	})
+	if err != nil {
+		udp.Close()
+		tcp.Close()
+		return err
+	}
+	slog.Info("TURN server starting", "addr", addr, "relayIP", s.cfg.TURNServerPublicIP,
+		"relayPorts", fmt.Sprintf("%d-%d", s.cfg.TURNServerRelayMinPort, s.cfg.TURNServerRelayMaxPort))
+	return nil
+}
+
+// turnAuth проверяет учетные данные так же, как их выдает
+// turnCredentialsFor: с TURN_SECRET — временные по схеме TURN REST API,
+// без него — общие TURN_USERNAME и TURN_CREDENTIAL
+func (s *Server) turnAuth(username, realm string, src net.Addr) ([]byte, bool) {
+	if s.cfg.TURNSecret == "" {
+		if username != s.cfg.TURNUsername {
+			slog.Info("TURN auth rejected: unknown user", "remote", src.String(), "user", username)
+			return nil, false
+		}
+		return turn.GenerateAuthKey(username, realm, s.cfg.TURNCredential), true
+	}
+
+	expiry, _, _ := strings.Cut(username, ":")
+	t, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > t {
+		slog.Info("TURN auth rejected: expired or malformed user", "remote", src.String(), "user", username)
+		return nil, false
+	}
+	return turn.GenerateAuthKey(username, realm, turnRESTPassword(s.cfg.TURNSecret, username)), true
+}
+
+// embeddedTURNURLs — адреса встроенного TURN для ICE-конфигурации
+// клиентов, пусто, если он выключен
+func (s *Server) embeddedTURNURLs() []string {
+	if s.cfg.TURNServerPort == 0 {
+		return nil
+	}
+	hostPort := net.JoinHostPort(s.cfg.TURNHost(), strconv.Itoa(s.cfg.TURNServerPort))
+	return []string{
+		"turn:" + hostPort + "?transport=udp",
+		"turn:" + hostPort + "?transport=tcp",
+	}
+}
+
+func (s *Server) stopTURNServer() {
+	if s.turnServer == nil {
+		return
+	}
+	if err := s.turnServer.Close(); err != nil {
+		slog.Warn("TURN server close error", "err", err)
+	}
+}
@@ -0,0 +1,195 @@
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// События для WEBHOOK_URL (config.WebhookEventTypes). Тело — JSON с
+// полями id, type, time и полями события. С WEBHOOK_SECRET заголовок
+// X-Webhook-Signature содержит "sha256=" и hex HMAC-SHA256 от
+// "<X-Webhook-Timestamp>.<тело>", а X-Webhook-Id одинаков во всех
+// попытках, чтобы получатель мог отбросить повтор.
+
+const (
+	// Событий в очереди одного адреса; при переполнении новые теряются
+	webhookQueueSize = 1024
+	// Предел паузы между попытками, в том числе по Retry-After
+	webhookMaxBackoff = time.Minute
+)
+
+type webhookEvent struct {
+	id   string
+	typ  string
+	body []byte
+}
+
+// webhookTarget — адрес и его очередь. Очередь разбирает одна горутина,
+// поэтому события доходят до адреса в порядке возникновения, а
+// недоступный адрес не задерживает остальные.
+type webhookTarget struct {
+	srv   *Server
+	url   string
+	queue chan webhookEvent
+}
+
+// startWebhooks запускает доставку на адреса WEBHOOK_URL
+func (s *Server) startWebhooks() {
+	s.webhookClient.Timeout = s.cfg.WebhookTimeout
+	for _, u := range s.cfg.WebhookURLs {
+		t := &webhookTarget{srv: s, url: u, queue: make(chan webhookEvent, webhookQueueSize)}
+		s.webhookTargets = append(s.webhookTargets, t)
+		go t.run()
+	}
+}
+
+// postWebhook ставит событие в очереди всех адресов. Вызывающего не
+// задерживает.
+func (s *Server) postWebhook(event map[string]interface{}) {
+	typ, _ := event["type"].(string)
+	if len(s.webhookTargets) == 0 || (s.cfg.WebhookEvents != nil && !slices.Contains(s.cfg.WebhookEvents, typ)) {
+		return
+	}
+	ev := webhookEvent{id: newClientID(), typ: typ}
+	event["id"] = ev.id
+	if _, ok := event["time"]; !ok {
+		event["time"] = time.Now()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("webhook encode error", "err", err)
+		return
+	}
+	ev.body = body
+
+	for _, t := range s.webhookTargets {
+		s.webhookPending.Add(1)
+		select {
+		case t.queue <- ev:
+		default:
+			s.webhookPending.Done()
+			t.srv.metrics.webhooks.WithLabelValues("dropped").Inc()
+			slog.Warn("webhook queue full, event dropped", "url", t.url, "event", typ)
+		}
+	}
+}
+
+// webhook отправляет событие клиента с его id, комнатой и личностью
+func (c *Client) webhook(typ string, data map[string]interface{}) {
+	event := map[string]interface{}{"type": typ, "clientId": c.id}
+	if room := c.roomID.Load(); room != nil {
+		event["room"] = *room
+	}
+	if c.identity != "" {
+		event["identity"] = c.identity
+	}
+	if c.tenant != "" {
+		event["tenant"] = c.tenant
+	}
+	for k, v := range data {
+		event[k] = v
+	}
+	c.srv.postWebhook(event)
+}
+
+func (t *webhookTarget) run() {
+	for ev := range t.queue {
+		t.deliver(ev)
+		t.srv.webhookPending.Done()
+	}
+}
+
+// deliver отправляет событие, повторяя при сетевых ошибках, 408, 429 и
+// 5xx. Пауза растет вдвое от WEBHOOK_RETRY_BACKOFF; Retry-After
+// получателя может ее только увеличить.
+func (t *webhookTarget) deliver(ev webhookEvent) {
+	backoff := t.srv.cfg.WebhookRetryBackoff
+	for attempt := 1; ; attempt++ {
+		retry, wait, err := t.post(ev, attempt)
+		if err == nil {
+			t.srv.metrics.webhooks.WithLabelValues("delivered").Inc()
+			return
+		}
+		if !retry || attempt > t.srv.cfg.WebhookRetries {
+			t.srv.metrics.webhooks.WithLabelValues("failed").Inc()
+			slog.Warn("webhook failed", "event", ev.typ, "url", t.url, "attempts", attempt, "err", err)
+			return
+		}
+		slog.Warn("webhook attempt failed", "event", ev.typ, "url", t.url, "attempt", attempt, "err", err)
+		time.Sleep(min(max(wait, backoff), webhookMaxBackoff))
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+}
+
+// post — одна попытка доставки. retry — ошибку стоит повторить, wait —
+// пауза из Retry-After получателя.
+func (t *webhookTarget) post(ev webhookEvent, attempt int) (retry bool, wait time.Duration, err error) {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(ev.body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", ev.id)
+	req.Header.Set("X-Webhook-Event", ev.typ)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(attempt))
+	if t.srv.cfg.WebhookSecret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", ts)
+		req.Header.Set("X-Webhook-Signature", "sha256="+t.srv.webhookSignature(ts, ev.body))
+	}
+
+	resp, err := t.srv.webhookClient.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return false, 0, nil
+	}
+
+	err = fmt.Errorf("returned %s", resp.Status)
+	if resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return false, 0, err
+	}
+	if s, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && s > 0 {
+		wait = time.Duration(s) * time.Second
+	}
+	return true, wait, err
+}
+
+func (s *Server) webhookSignature(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// flushWebhooks при выключении ждет, пока очереди доставятся, но не
+// дольше ctx: события об отключении клиентов приходят последними
+func (s *Server) flushWebhooks(ctx context.Context) {
+	if len(s.webhookTargets) == 0 {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		s.webhookPending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("shutdown timeout, undelivered webhooks dropped")
+	}
+}
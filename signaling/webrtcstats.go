@@ -0,0 +1,115 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// w3cStats приводит StatsReport pion к виду RTCStatsReport из браузерного
+// getStats(): объект id -> статистика. Поля pion уже названы по W3C, но
+// незаполненные значения ("", "unknown", нулевое время) в браузере просто
+// отсутствуют, поэтому они убираются. pion не дает inbound-rtp и не
+// заполняет состояние DTLS в transport — это дополняется своими данными.
+func w3cStats(client *Client, pc *webrtc.PeerConnection) map[string]map[string]interface{} {
+	report := make(map[string]map[string]interface{})
+	codecIDs := make(map[string]string)
+	var nominatedPair string
+
+	for id, stat := range pc.GetStats() {
+		raw, err := json.Marshal(stat)
+		if err != nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			continue
+		}
+		for key, value := range fields {
+			if unsetStatValue(key, value) {
+				delete(fields, key)
+			}
+		}
+		report[id] = fields
+
+		switch s := stat.(type) {
+		case webrtc.CodecStats:
+			codecIDs[s.MimeType] = id
+		case webrtc.ICECandidatePairStats:
+			if s.Nominated && s.State == webrtc.StatsICECandidatePairStateSucceeded {
+				nominatedPair = id
+			}
+		}
+	}
+
+	for _, fields := range report {
+		if fields["type"] != string(webrtc.StatsTypeTransport) {
+			continue
+		}
+		fields["dtlsState"] = pc.SCTP().Transport().State().String()
+		if nominatedPair != "" {
+			fields["selectedCandidatePairId"] = nominatedPair
+		}
+	}
+
+	client.statsMu.Lock()
+	streams := append([]*rtpReceiveStats(nil), client.receiveStats...)
+	client.statsMu.Unlock()
+
+	now := float64(time.Now().UnixNano()) / 1e6
+	for _, rs := range streams {
+		expected, received, jitter := rs.snapshot()
+		id := fmt.Sprintf("IT%s%d", strings.ToUpper(rs.kind[:1]), rs.ssrc)
+		fields := map[string]interface{}{
+			"id":              id,
+			"type":            "inbound-rtp",
+			"timestamp":       now,
+			"ssrc":            rs.ssrc,
+			"kind":            rs.kind,
+			"packetsReceived": received,
+			"packetsLost":     int64(expected) - int64(received),
+			"jitter":          jitter,
+		}
+		if codecID, ok := codecIDs[rs.mimeType]; ok {
+			fields["codecId"] = codecID
+		}
+		report[id] = fields
+	}
+	return report
+}
+
+// unsetStatValue — значения, которыми pion обозначает незаполненное поле
+func unsetStatValue(key string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == "" || v == "unknown"
+	case float64:
+		return strings.HasSuffix(key, "Timestamp") && v <= 0
+	}
+	return false
+}
+
+// handleWebRTCStats отдает getStats() сессии в формате W3C:
+// GET /stats/webrtc?clientId=
+func (s *Server) handleWebRTCStats(w http.ResponseWriter, r *http.Request) {
+	client := s.clients.get(r.URL.Query().Get("clientId"))
+	if client == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	pc := client.pc.Load()
+	if pc == nil {
+		http.Error(w, "session has no PeerConnection", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(w3cStats(client, pc)); err != nil {
+		slog.Warn("WebRTC stats encode error", "err", err)
+	}
+}
@@ -0,0 +1,405 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+
+	"go-webrtc/media"
+)
+
+// WHIP (публикация) и WHEP (просмотр) — сигнализация одним HTTP-запросом
+// для OBS, GStreamer и стандартных плееров, без WebSocket:
+//   - POST /whip/{stream} и POST /whep/{stream} с offer в теле
+//     (application/sdp) отвечают 201 с answer и Location сессии; POST
+//     /whip публикует поток default;
+//   - PATCH на Location с application/trickle-ice-sdpfrag добавляет
+//     кандидаты клиента;
+//   - DELETE на Location закрывает сессию.
+//
+// Answer отдается после сбора кандидатов сервера: WHIP не передает их
+// от сервера отдельно. Потоки не связаны с комнатами WebSocket.
+
+// whipStream — опубликованный по WHIP поток: входящие треки издателя,
+// которые отдаются каждому зрителю WHEP
+type whipStream struct {
+	publisher *whipSession
+	tracks    []*whipTrack
+}
+
+// whipTrack — трек издателя для зрителей. Один TrackLocalStaticRTP
+// пишет во все PeerConnection, к которым он подключен.
+type whipTrack struct {
+	local  *webrtc.TrackLocalStaticRTP
+	source *webrtc.PeerConnection
+	ssrc   webrtc.SSRC
+}
+
+type whipSession struct {
+	id     string
+	kind   string // whip или whep
+	stream string
+	pc     *webrtc.PeerConnection
+	logger *slog.Logger // с id сессии, видом и потоком
+}
+
+func newWHIPSession(kind, stream string, pc *webrtc.PeerConnection) *whipSession {
+	id := newClientID()
+	return &whipSession{
+		id:     id,
+		kind:   kind,
+		stream: stream,
+		pc:     pc,
+		logger: slog.With("session", id, "kind", kind, "stream", stream),
+	}
+}
+
+// Сколько ждать сбора кандидатов сервера перед ответом
+const whipGatherTimeout = 5 * time.Second
+
+// handleWHIP — POST /whip/{stream}: издатель отправляет offer с треками.
+// На поток одновременно один издатель.
+func (s *Server) handleWHIP(w http.ResponseWriter, r *http.Request) {
+	stream, offer, claims, ok := s.readWHIPOffer(w, r)
+	if !ok {
+		return
+	}
+
+	pc, err := s.newWHIPPeerConnection(r, claims)
+	if errors.Is(err, errPeerLimit) {
+		s.rejectBusy(w, http.StatusServiceUnavailable, "peer connection limit reached", s.cfg.RetryAfter)
+		return
+	}
+	if err != nil {
+		slog.Error("WHIP PeerConnection error", "stream", stream, "err", err)
+		http.Error(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+	session := newWHIPSession("whip", stream, pc)
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		local, err := webrtc.NewTrackLocalStaticRTP(track.Codec().RTPCodecCapability, track.ID(), stream)
+		if err != nil {
+			session.logger.Error("track error", "err", err)
+			return
+		}
+		wt := &whipTrack{local: local, source: pc, ssrc: track.SSRC()}
+		s.whipMu.Lock()
+		if st := s.whipStreams[stream]; st != nil && st.publisher == session {
+			st.tracks = append(st.tracks, wt)
+		}
+		s.whipMu.Unlock()
+		session.logger.Info("track published", "kind", track.Kind().String(), "codec", track.Codec().MimeType)
+
+		for {
+			pkt, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			if err := local.WriteRTP(pkt); err != nil {
+				return
+			}
+		}
+	})
+
+	s.whipMu.Lock()
+	if st := s.whipStreams[stream]; st != nil && st.publisher != nil {
+		s.whipMu.Unlock()
+		pc.Close()
+		http.Error(w, "stream "+stream+" is already being published", http.StatusConflict)
+		return
+	}
+	s.whipStreams[stream] = &whipStream{publisher: session}
+	s.whipMu.Unlock()
+
+	s.answerWHIP(w, r, session, offer)
+}
+
+// handleWHEP — POST /whep/{stream}: зритель получает треки
+// опубликованного потока
+func (s *Server) handleWHEP(w http.ResponseWriter, r *http.Request) {
+	stream, offer, claims, ok := s.readWHIPOffer(w, r)
+	if !ok {
+		return
+	}
+
+	s.whipMu.Lock()
+	var tracks []*whipTrack
+	if st := s.whipStreams[stream]; st != nil {
+		tracks = append(tracks, st.tracks...)
+	}
+	s.whipMu.Unlock()
+	if len(tracks) == 0 {
+		http.Error(w, "stream "+stream+" is not being published", http.StatusNotFound)
+		return
+	}
+
+	pc, err := s.newWHIPPeerConnection(r, claims)
+	if errors.Is(err, errPeerLimit) {
+		s.rejectBusy(w, http.StatusServiceUnavailable, "peer connection limit reached", s.cfg.RetryAfter)
+		return
+	}
+	if err != nil {
+		slog.Error("WHEP PeerConnection error", "stream", stream, "err", err)
+		http.Error(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+	session := newWHIPSession("whep", stream, pc)
+	for _, t := range tracks {
+		sender, err := pc.AddTrack(t.local)
+		if err != nil {
+			session.logger.Error("track error", "err", err)
+			continue
+		}
+		go relayViewerRTCP(sender, t)
+	}
+	s.answerWHIP(w, r, session, offer)
+}
+
+// relayViewerRTCP передает PLI и FIR зрителя издателю, чтобы новый
+// зритель быстро получил ключевой кадр
+func relayViewerRTCP(sender *webrtc.RTPSender, t *whipTrack) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, p := range packets {
+			switch p.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				if err := t.source.WriteRTCP([]rtcp.Packet{
+					&rtcp.PictureLossIndication{MediaSSRC: uint32(t.ssrc)},
+				}); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// readWHIPOffer проверяет запрос WHIP/WHEP и читает offer. При ошибке
+// ответ уже отправлен.
+func (s *Server) readWHIPOffer(w http.ResponseWriter, r *http.Request) (string, string, Claims, bool) {
+	w.Header().Set("Access-Control-Expose-Headers", "Location, Link")
+	claims, ok := s.authenticateHTTP(w, r)
+	if !ok {
+		return "", "", nil, false
+	}
+	stream := r.PathValue("stream")
+	if stream == "" {
+		stream = defaultRoom
+	}
+	if !roomIDRe.MatchString(stream) {
+		http.Error(w, "stream must be 1-64 letters, digits, - or _", http.StatusBadRequest)
+		return "", "", nil, false
+	}
+	if !(&Client{srv: s, rooms: claims.Rooms()}).roomAllowed(stream) {
+		http.Error(w, "stream "+stream+" is not allowed", http.StatusForbidden)
+		return "", "", nil, false
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/sdp") {
+		http.Error(w, "offer must be application/sdp", http.StatusUnsupportedMediaType)
+		return "", "", nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.cfg.MaxMessageSize))
+	if err != nil || len(body) == 0 {
+		http.Error(w, "empty offer", http.StatusBadRequest)
+		return "", "", nil, false
+	}
+	return stream, string(body), claims, true
+}
+
+func (s *Server) newWHIPPeerConnection(r *http.Request, claims Claims) (*webrtc.PeerConnection, error) {
+	client := &Client{srv: s, id: newClientID(), remoteAddr: r.RemoteAddr, identity: claims.Subject(), region: clientRegion(r)}
+	client.logger = newClientLogger(client, requestCorrelationID(r))
+	pc, _, err := s.newPeerConnection(webrtc.Configuration{
+		ICEServers:   s.iceServersFor(client),
+		BundlePolicy: media.BundlePolicies[s.cfg.BundlePolicy],
+	})
+	return pc, err
+}
+
+// answerWHIP применяет offer, ждет кандидатов сервера и отвечает 201 с
+// answer. Сессия живет, пока ее не удалят DELETE или пока ICE не
+// разорвется.
+func (s *Server) answerWHIP(w http.ResponseWriter, r *http.Request, session *whipSession, offer string) {
+	pc := session.pc
+	fail := func(status int, msg string, err error) {
+		session.logger.Warn("session failed", "reason", msg, "err", err)
+		s.closeWHIPSession(session)
+		http.Error(w, msg, status)
+	}
+
+	if s.cfg.RequireCommonCodec {
+		if reason := s.serverCodecs().MissingCommon(offer); reason != "" {
+			s.metrics.codecRejections.Inc()
+			fail(http.StatusNotAcceptable, reason, errors.New("no common codec"))
+			return
+		}
+	}
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		fail(http.StatusBadRequest, "invalid offer", err)
+		return
+	}
+	s.serverCodecs().ApplyPreferences(pc, offer)
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		fail(http.StatusInternalServerError, "failed to create answer", err)
+		return
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		fail(http.StatusInternalServerError, "failed to set answer", err)
+		return
+	}
+	select {
+	case <-gathered:
+	case <-time.After(whipGatherTimeout):
+	case <-r.Context().Done():
+		s.closeWHIPSession(session)
+		return
+	}
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			s.closeWHIPSession(session)
+		}
+	})
+	s.whipMu.Lock()
+	s.whipSessions[session.id] = session
+	s.whipMu.Unlock()
+	session.logger.Info("session started", "remote", s.clientIP(r))
+
+	h := w.Header()
+	h.Set("Content-Type", "application/sdp")
+	h.Set("Location", "/"+session.kind+"/session/"+session.id)
+	for _, link := range whipICELinks(pc) {
+		h.Add("Link", link)
+	}
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, pc.LocalDescription().SDP)
+}
+
+// whipICELinks — ICE-серверы сессии в заголовках Link (rel="ice-server"),
+// как их ждут клиенты WHIP
+func whipICELinks(pc *webrtc.PeerConnection) []string {
+	var links []string
+	for _, server := range pc.GetConfiguration().ICEServers {
+		for _, u := range server.URLs {
+			link := fmt.Sprintf("<%s>; rel=\"ice-server\"", u)
+			if secret, ok := server.Credential.(string); ok && server.Username != "" {
+				link += fmt.Sprintf("; username=%q; credential=%q; credential-type=\"password\"", server.Username, secret)
+			}
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// closeWHIPSession закрывает сессию; поток издателя исчезает вместе с
+// ним, зрители перестают получать медиа
+func (s *Server) closeWHIPSession(session *whipSession) {
+	s.whipMu.Lock()
+	_, known := s.whipSessions[session.id]
+	delete(s.whipSessions, session.id)
+	if st := s.whipStreams[session.stream]; st != nil && st.publisher == session {
+		delete(s.whipStreams, session.stream)
+	}
+	s.whipMu.Unlock()
+	if known {
+		session.logger.Info("session closed")
+	}
+	session.pc.Close()
+}
+
+// closeWHIPSessions закрывает все сессии WHIP и WHEP при выключении
+func (s *Server) closeWHIPSessions() {
+	s.whipMu.Lock()
+	sessions := make([]*whipSession, 0, len(s.whipSessions))
+	for _, session := range s.whipSessions {
+		sessions = append(sessions, session)
+	}
+	s.whipMu.Unlock()
+	for _, session := range sessions {
+		s.closeWHIPSession(session)
+	}
+}
+
+// whipSessionFor находит сессию по Location. При ошибке ответ уже
+// отправлен.
+func (s *Server) whipSessionFor(w http.ResponseWriter, r *http.Request, kind string) *whipSession {
+	if _, ok := s.authenticateHTTP(w, r); !ok {
+		return nil
+	}
+	s.whipMu.Lock()
+	session := s.whipSessions[r.PathValue("id")]
+	s.whipMu.Unlock()
+	if session == nil || session.kind != kind {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return nil
+	}
+	return session
+}
+
+// handleWHIPPatch — PATCH на сессию: кандидаты клиента в виде
+// SDP-фрагмента (trickle ICE, RFC 8840). ICE restart не поддерживается.
+func (s *Server) handleWHIPPatch(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := s.whipSessionFor(w, r, kind)
+		if session == nil {
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/trickle-ice-sdpfrag") {
+			http.Error(w, "body must be application/trickle-ice-sdpfrag", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, s.cfg.MaxMessageSize))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		var mid *string
+		for _, line := range strings.Split(string(body), "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "a=ice-ufrag:"):
+				if remote := session.pc.RemoteDescription(); remote != nil && strings.TrimPrefix(line, "a=ice-ufrag:") != iceUfrag(remote.SDP) {
+					http.Error(w, "ICE restart is not supported", http.StatusUnprocessableEntity)
+					return
+				}
+			case strings.HasPrefix(line, "a=mid:"):
+				m := strings.TrimPrefix(line, "a=mid:")
+				mid = &m
+			case strings.HasPrefix(line, "a=candidate:"):
+				candidate := webrtc.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a="), SDPMid: mid}
+				if err := session.pc.AddICECandidate(candidate); err != nil {
+					http.Error(w, "invalid candidate: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleWHIPDelete — DELETE на сессию: клиент закончил публикацию или
+// просмотр
+func (s *Server) handleWHIPDelete(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := s.whipSessionFor(w, r, kind)
+		if session == nil {
+			return
+		}
+		s.closeWHIPSession(session)
+		w.WriteHeader(http.StatusOK)
+	}
+}
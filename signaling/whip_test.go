@@ -0,0 +1,52 @@
+package signaling
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestShutdownClosesWHIPSessions(t *testing.T) {
+	s, ts := newTestServer(t, nil)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly}); err != nil {
+		t.Fatal(err)
+	}
+	offer := createOffer(t, pc)
+	resp, err := http.Post(ts.URL+"/whip/live", "application/sdp", strings.NewReader(offer.SDP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /whip/live: status %d, want 201", resp.StatusCode)
+	}
+
+	s.whipMu.Lock()
+	var sessions []*whipSession
+	for _, session := range s.whipSessions {
+		sessions = append(sessions, session)
+	}
+	s.whipMu.Unlock()
+	if len(sessions) != 1 {
+		t.Fatalf("%d WHIP sessions, want 1", len(sessions))
+	}
+
+	s.Shutdown()
+	s.whipMu.Lock()
+	left, streams := len(s.whipSessions), len(s.whipStreams)
+	s.whipMu.Unlock()
+	if left != 0 || streams != 0 {
+		t.Fatalf("%d sessions and %d streams left after shutdown", left, streams)
+	}
+	if state := sessions[0].pc.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Fatalf("WHIP PeerConnection %s after shutdown, want closed", state)
+	}
+}
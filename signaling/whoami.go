@@ -0,0 +1,97 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Заголовки, которые полезно видеть клиенту при отладке NAT/прокси
+var whoamiHeaders = []string{
+	"User-Agent",
+	"Origin",
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+	"X-Real-Ip",
+	"Via",
+}
+
+func (s *Server) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	host, port := splitHostPort(r.RemoteAddr)
+	ip := s.clientIP(r)
+
+	headers := make(map[string]string)
+	for _, name := range whoamiHeaders {
+		if v := r.Header.Get(name); v != "" {
+			headers[name] = v
+		}
+	}
+
+	resp := map[string]interface{}{
+		"ip":        ip,
+		"peerIp":    host,
+		"peerPort":  port,
+		"proxied":   ip != host,
+		"host":      r.Host,
+		"tls":       r.TLS != nil,
+		"headers":   headers,
+		"userAgent": r.UserAgent(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Warn("whoami encode error", "err", err)
+	}
+}
+
+// clientIP возвращает адрес клиента. X-Forwarded-For учитывается только
+// если соединение пришло от доверенного прокси: список разбирается справа
+// налево, и первый адрес не из доверенных сетей считается клиентским.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _ := splitHostPort(r.RemoteAddr)
+	if !s.isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// Мусор в заголовке — дальше цепочке доверять нельзя
+			break
+		}
+		if !s.isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func (s *Server) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range s.cfg.TrustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitHostPort(addr string) (string, int) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
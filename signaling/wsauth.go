@@ -0,0 +1,106 @@
+package signaling
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Коды закрытия WebSocket для отказа после upgrade. Браузер не видит
+// HTTP-статус неудавшегося upgrade, а код и причину закрытия — видит.
+const (
+	closeUnauthorized = 4401
+	closeForbidden    = 4403
+)
+
+// Подпротокол, в котором браузер передает токен: new WebSocket(url,
+// ["bearer", token]). Сервер отвечает подпротоколом "bearer".
+const bearerSubprotocol = "bearer"
+
+// checkOrigin пропускает запросы без Origin (не из браузера), с Origin
+// из WS_ALLOWED_ORIGINS или, если список пуст, с тем же хостом, что и
+// сам запрос
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(s.cfg.WSAllowedOrigins) > 0 {
+		return originAllowed(origin, s.cfg.WSAllowedOrigins)
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// requestToken достает токен из ?token=, Authorization: Bearer или
+// Sec-WebSocket-Protocol: bearer, <token>. viaProtocol — токен пришел
+// подпротоколом, и в ответе нужно выбрать "bearer", иначе браузер
+// оборвет соединение.
+func requestToken(r *http.Request) (token string, viaProtocol bool) {
+	if token = r.URL.Query().Get("token"); token != "" {
+		return token, false
+	}
+	if token, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		return token, false
+	}
+	protocols := websocket.Subprotocols(r)
+	for i, p := range protocols {
+		if p == bearerSubprotocol && i+1 < len(protocols) {
+			return protocols[i+1], true
+		}
+	}
+	return "", false
+}
+
+// validateAPIKey ищет ключ в AUTH_API_KEYS и возвращает claims с его
+// пользователем. У ключей нет срока действия и ограничения комнат.
+func (s *Server) validateAPIKey(key string) (Claims, error) {
+	for _, entry := range s.cfg.AuthAPIKeys {
+		user, secret, _ := strings.Cut(entry, ":")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(secret)) == 1 {
+			return Claims{"sub": user}, nil
+		}
+	}
+	return nil, errTokenInvalid
+}
+
+// rejectUnauthorized завершает upgrade и закрывает соединение с кодом
+// 4401 и причиной отказа
+func (s *Server) rejectUnauthorized(w http.ResponseWriter, r *http.Request, header http.Header, err error) {
+	conn, upErr := s.upgrader.Upgrade(w, r, header)
+	if upErr != nil {
+		return
+	}
+	reason := "unauthorized"
+	switch {
+	case errors.Is(err, errTokenMissing), errors.Is(err, errTokenExpired), errors.Is(err, errTokenInvalid):
+		reason = err.Error()
+	}
+	closeWithCode(conn, closeUnauthorized, reason)
+}
+
+// closeWithCode отправляет close-фрейм с кодом и причиной, не дожидаясь
+// ответа, и закрывает соединение
+func closeWithCode(conn signalConn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+}
+
+// roomAllowed — разрешена ли клиенту комната по claim rooms токена
+func (c *Client) roomAllowed(id string) bool {
+	if c.rooms == nil {
+		return true
+	}
+	for _, room := range c.rooms {
+		if room == id || room == "*" {
+			return true
+		}
+	}
+	return false
+}